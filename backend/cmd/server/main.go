@@ -1,12 +1,29 @@
 package main
 
 import (
+	"cmp"
+	"context"
+	"database/sql"
 	"fmt"
+	"io/fs"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
+	"ai-knowledge-base/internal/ai"
+	"ai-knowledge-base/internal/cache"
+	"ai-knowledge-base/internal/config"
 	"ai-knowledge-base/internal/database"
+	"ai-knowledge-base/internal/grounding"
 	"ai-knowledge-base/internal/handlers"
+	"ai-knowledge-base/internal/injection"
+	"ai-knowledge-base/internal/kb"
+	"ai-knowledge-base/internal/retrieval"
+	"ai-knowledge-base/internal/usage"
 
 	"github.com/joho/godotenv"
 )
@@ -16,20 +33,305 @@ func main() {
 	if err != nil {
 		log.Println("Warning: .env file not found, loading from environment")
 	}
+	cfg := config.Load()
 
 	db := database.InitDB("./search.db")
 	defer db.Close()
 
+	sqliteStore := kb.NewSQLiteStore(db)
+	if err := kb.Seed(sqliteStore, kb.GetArticles()); err != nil {
+		log.Fatalf("Failed to seed knowledge base: %v", err)
+	}
+
+	articles, err := sqliteStore.List()
+	if err != nil {
+		log.Fatalf("Failed to load articles: %v", err)
+	}
+	var chunker *kb.Chunker
+	splitter := retrieval.WholeArticle
+	if cfg.Chunking {
+		chunker = kb.NewChunker(cfg.ChunkMaxTokens, cfg.ChunkOverlapTokens)
+		splitter = retrieval.Chunked(chunker)
+	}
+	retriever, observers := buildRetriever(cfg, db, articles, splitter)
+	// One LLM client serves every request; it is closed once the server has drained.
+	// It is metered so that every request it makes, including the grounding judge's,
+	// is accounted to its search.
+	llm := ai.NewMetered(buildLLM(cfg))
+	defer ai.Close(llm)
+	prompt := loadPrompt(cfg)
+	checker := grounding.NewChecker()
+	checker.MinScore = cfg.GroundingMinScore
+	if cfg.GroundingJudge {
+		checker.Judge = llm
+	}
+	detector := injection.NewDetector()
+	detector.Threshold = cfg.InjectionThreshold
+	injectionPolicy := cfg.InjectionPolicy
+	if !injection.ValidPolicy(injectionPolicy) {
+		log.Printf("Warning: unknown INJECTION_POLICY %q, using %q", injectionPolicy, injection.PolicyWarn)
+		injectionPolicy = injection.PolicyWarn
+	}
+	prices, err := usage.ParsePrices(cfg.AIPrices)
+	if err != nil {
+		log.Fatalf("Failed to load AI_PRICES: %v", err)
+	}
+	// Cached answers are invalidated when an article they were generated from changes.
+	// The semantic cache also serves them to paraphrases of the question, which takes an
+	// embedder that captures meaning rather than words.
+	var answerCache *cache.Cache
+	if cfg.AnswerCache {
+		answerCache = cache.New(db, cfg.AnswerCacheSize, cfg.AnswerCacheTTL)
+		if cfg.SemanticCache {
+			embedder := buildEmbedder(cfg)
+			if _, lexical := embedder.(*retrieval.HashEmbedder); lexical {
+				log.Printf("Warning: SEMANTIC_CACHE needs a semantic EMBEDDER such as openai, not %s; matching cached answers exactly only", embedder.Model())
+			} else {
+				answerCache.Embedder, answerCache.Threshold = embedder, cfg.SemanticCacheThreshold
+			}
+		}
+		observers = append(observers, answerCache)
+	}
+	// Index observers follow writes made through the articles API.
+	store := kb.Observe(sqliteStore, observers...)
+
 	mux := http.NewServeMux()
 	mux.HandleFunc("/api/health", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		w.Write([]byte(`{"status": "ok"}`))
 	})
-	mux.HandleFunc("/api/search-query", handlers.SearchHandler(db))
-	corsHandler := handlers.CORSMiddleware(mux)
+	searchConfig := handlers.SearchConfig{
+		DB:                db,
+		Store:             store,
+		Retriever:         retriever,
+		TopK:              cfg.RetrievalTopK,
+		Chunker:           chunker,
+		LLM:               llm,
+		RetrievalFallback: cfg.RetrievalFallback,
+		AnswerOptions:     ai.AnswerOptions{Prompt: prompt, MaxRepairs: cfg.AIJSONRepairs, MaxPromptTokens: cfg.PromptTokenBudget},
+		Grounding:         checker,
+
+		Injection:       detector,
+		InjectionPolicy: injectionPolicy,
+		HistoryTokens:   cfg.ConversationHistoryTokens,
+		RewriteQueries:  cfg.QueryRewrite,
+
+		Timeout:          cfg.SearchTimeout,
+		RetrievalTimeout: cfg.RetrievalTimeout,
+		AITimeout:        cfg.AITimeout,
+
+		Cache:        answerCache,
+		Prices:       prices,
+		Budget:       usage.Limits{Daily: cfg.DailyBudgetUSD, PerClient: cfg.ClientDailyBudgetUSD},
+		CallerHeader: cfg.CallerHeader,
+	}
+	mux.HandleFunc("/api/search-query", handlers.SearchHandler(searchConfig))
+	mux.HandleFunc("/api/search-query/stream", handlers.SearchStreamHandler(searchConfig))
+	handlers.RegisterArticleRoutes(mux, store, cfg.AdminToken)
+	handlers.RegisterAdminRoutes(mux, cfg.AdminToken, db, answerCache)
+	corsHandler := handlers.CORSMiddleware(cfg.CallerHeader, mux)
 	port := ":8080"
+	server := &http.Server{Addr: port, Handler: corsHandler}
+
+	// Stop accepting requests on SIGINT or SIGTERM and let in-flight searches finish.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.SearchTimeout+5*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Printf("Failed to shut down gracefully: %v", err)
+		}
+	}()
+
+	go retryIndexing(ctx, observers, syncRetryInterval)
+
 	fmt.Printf("Server is starting and listening on port %s...\n", port)
-	if err := http.ListenAndServe(port, corsHandler); err != nil {
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
 		log.Fatalf("Failed to start server: %v", err)
 	}
+	<-drained
+	log.Println("Server stopped")
+}
+
+// syncRetryInterval is how often articles that failed to index are retried.
+const syncRetryInterval = time.Minute
+
+// retryIndexing retries, every interval until ctx is done, the articles that the index
+// observers failed to index when they were written.
+func retryIndexing(ctx context.Context, observers []kb.Observer, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		for _, observer := range observers {
+			if syncer, ok := observer.(*retrieval.ArticleSync); ok {
+				retryCtx, cancel := context.WithTimeout(ctx, retrieval.DefaultSyncTimeout)
+				if pending := syncer.Retry(retryCtx); pending > 0 {
+					log.Printf("Warning: %d articles are still missing from the search index", pending)
+				}
+				cancel()
+			}
+		}
+	}
+}
+
+// loadPrompt loads and validates the built-in prompt versions and those in
+// cfg.PromptsDir, and returns the one selected by cfg.PromptVersion. Invalid prompts
+// stop startup rather than failing every search.
+func loadPrompt(cfg config.Config) *ai.Prompt {
+	sources := []fs.FS{ai.DefaultPrompts()}
+	if cfg.PromptsDir != "" {
+		sources = append(sources, os.DirFS(cfg.PromptsDir))
+	}
+	prompts, err := ai.LoadPrompts(sources...)
+	if err != nil {
+		log.Fatalf("Failed to load prompts: %v", err)
+	}
+	prompt, err := ai.SelectPrompt(prompts, cfg.PromptVersion)
+	if err != nil {
+		log.Fatalf("Failed to select prompt: %v", err)
+	}
+	log.Printf("Using prompt version %s", prompt.Version)
+	return prompt
+}
+
+// buildRetriever creates the retriever selected by cfg.Retriever, indexes the documents
+// that splitter produces from the given articles and returns the observers that keep
+// its index in sync with the store.
+// Misconfiguration falls back to the in-memory BM25 index rather than failing startup.
+func buildRetriever(cfg config.Config, db *sql.DB, articles []kb.Article, splitter retrieval.Splitter) (retrieval.Retriever, []kb.Observer) {
+	switch cfg.Retriever {
+	case "bm25", "fts":
+		return buildLexicalRetriever(cfg.Retriever, cfg.Chunking, db, articles, splitter)
+	case "vector":
+		return buildVectorRetriever(cfg, db, articles, splitter)
+	case "hybrid":
+		lexical, lexicalObservers := buildLexicalRetriever(cfg.HybridLexical, cfg.Chunking, db, articles, splitter)
+		vector, vectorObservers := buildVectorRetriever(cfg, db, articles, splitter)
+		hybrid := retrieval.NewHybridRetriever(
+			retrieval.Stage{Name: "lexical", Retriever: lexical, Weight: cfg.HybridLexicalWeight},
+			retrieval.Stage{Name: "vector", Retriever: vector, Weight: cfg.HybridVectorWeight},
+		)
+		hybrid.K = cfg.RRFK
+		return hybrid, append(lexicalObservers, vectorObservers...)
+	default:
+		log.Printf("Warning: unknown RETRIEVER %q, using bm25", cfg.Retriever)
+		return buildLexicalRetriever("bm25", cfg.Chunking, db, articles, splitter)
+	}
+}
+
+// buildLexicalRetriever creates a keyword retriever: "fts" if requested and available, otherwise BM25.
+// With chunking, every retriever indexes the passages splitter produces, so that
+// their hits share chunk IDs and hybrid retrieval can fuse them.
+func buildLexicalRetriever(kind string, chunked bool, db *sql.DB, articles []kb.Article, splitter retrieval.Splitter) (retrieval.Retriever, []kb.Observer) {
+	if kind == "fts" {
+		switch {
+		case !database.HasFullTextSearch(db):
+			log.Println("Warning: fts retrieval requested but FTS5 is unavailable (build with -tags sqlite_fts5); using bm25")
+		case chunked:
+			// Passages are indexed in passages_fts, rebuilt from the articles on startup.
+			index := retrieval.NewFTSPassageIndex(db)
+			if err := index.Clear(); err != nil {
+				log.Fatalf("Failed to clear full-text passage index: %v", err)
+			}
+			syncer := retrieval.NewArticleSync(index, splitter)
+			if err := syncer.Load(context.Background(), articles); err != nil {
+				log.Fatalf("Failed to build full-text passage index: %v", err)
+			}
+			return index, []kb.Observer{syncer}
+		default:
+			// The articles_fts index is maintained by triggers inside SQLite, so it needs no observer.
+			return retrieval.NewFTSRetriever(db), nil
+		}
+	}
+
+	index := retrieval.NewBM25Index()
+	syncer := retrieval.NewArticleSync(index, splitter)
+	if err := syncer.Load(context.Background(), articles); err != nil {
+		log.Fatalf("Failed to build keyword index: %v", err)
+	}
+	return index, []kb.Observer{syncer}
+}
+
+// buildVectorRetriever creates an embedding retriever and embeds any articles whose
+// persisted embedding is missing or stale.
+func buildVectorRetriever(cfg config.Config, db *sql.DB, articles []kb.Article, splitter retrieval.Splitter) (retrieval.Retriever, []kb.Observer) {
+	vectors := retrieval.NewVectorRetriever(buildEmbedder(cfg), buildVectorIndex(cfg), retrieval.NewEmbeddingStore(db))
+	syncer := retrieval.NewArticleSync(vectors, splitter)
+	if err := syncer.Load(context.Background(), articles); err != nil {
+		log.Fatalf("Failed to build vector index: %v", err)
+	}
+	return vectors, []kb.Observer{syncer}
+}
+
+// buildLLM creates the fallback chain of model clients: the primary provider selected
+// by cfg.LLMProvider followed by cfg.LLMFallbacks. Each provider retries transient
+// errors and has its own circuit breaker.
+func buildLLM(cfg config.Config) ai.LLM {
+	retry := ai.RetryPolicy{MaxAttempts: cfg.AIMaxAttempts, BaseDelay: cfg.AIRetryBaseDelay, MaxDelay: cfg.AIRetryMaxDelay}
+	breaker := ai.BreakerPolicy{FailureThreshold: cfg.BreakerFailureThreshold, Cooldown: cfg.BreakerCooldown}
+	wrap := func(llm ai.LLM) ai.LLM {
+		return ai.NewCircuitBreaker(ai.NewRetry(llm, retry), breaker)
+	}
+
+	chain := []ai.LLM{wrap(buildProvider(cfg.LLMProvider, cfg.LLMModel, cfg.LLMBaseURL, cfg.LLMAPIKey))}
+	for _, fallback := range cfg.LLMFallbacks {
+		provider, model, _ := strings.Cut(fallback, ":")
+		switch provider {
+		case "gemini", "openai", "ollama", "fake":
+			chain = append(chain, wrap(buildProvider(provider, model, "", "")))
+		default:
+			log.Printf("Warning: unknown provider %q in LLM_FALLBACKS, skipping it", provider)
+		}
+	}
+	return ai.NewFallback(chain...)
+}
+
+// buildProvider creates the model client for provider, filling in the provider's
+// default model, endpoint and API key where none is given.
+func buildProvider(provider, model, baseURL, apiKey string) ai.LLM {
+	switch provider {
+	case "gemini":
+	case "openai":
+		return ai.NewOpenAI(cmp.Or(baseURL, ai.DefaultOpenAIBaseURL), cmp.Or(apiKey, os.Getenv("OPENAI_API_KEY")), cmp.Or(model, ai.DefaultOpenAIModel))
+	case "ollama":
+		return ai.NewOllama(cmp.Or(baseURL, ai.DefaultOllamaBaseURL), cmp.Or(model, ai.DefaultOllamaModel))
+	case "fake":
+		return ai.NewFake()
+	default:
+		log.Printf("Warning: unknown LLM_PROVIDER %q, using gemini", provider)
+	}
+	gemini := ai.NewGemini(cmp.Or(apiKey, os.Getenv("GEMINI_API_KEY")), cmp.Or(model, ai.DefaultGeminiModel))
+	gemini.BaseURL = cmp.Or(baseURL, ai.DefaultGeminiBaseURL)
+	return gemini
+}
+
+func buildEmbedder(cfg config.Config) retrieval.Embedder {
+	switch cfg.Embedder {
+	case "hash":
+	case "openai":
+		return retrieval.NewOpenAIEmbedder(cfg.EmbeddingBaseURL, cfg.EmbeddingAPIKey, cfg.EmbeddingModel)
+	default:
+		log.Printf("Warning: unknown EMBEDDER %q, using hash", cfg.Embedder)
+	}
+	return retrieval.NewHashEmbedder(cfg.EmbeddingDimensions)
+}
+
+func buildVectorIndex(cfg config.Config) retrieval.VectorIndex {
+	switch cfg.VectorIndex {
+	case "brute":
+	case "hnsw":
+		return retrieval.NewHNSWIndex()
+	default:
+		log.Printf("Warning: unknown VECTOR_INDEX %q, using brute", cfg.VectorIndex)
+	}
+	return retrieval.NewBruteForceIndex()
 }
@@ -3,131 +3,258 @@ package ai
 import (
 	"ai-knowledge-base/internal/kb"
 	"context"
-	"encoding/json"
 	"fmt"
 	"log"
 	"os"
+	"regexp"
 	"strings"
-
-	"github.com/google/generative-ai-go/genai"
-	"google.golang.org/api/option"
 )
 
 type AIResponse struct {
 	SummaryAnswer    string       `json:"ai_summary_answer"`
 	RelevantArticles []kb.Article `json:"ai_relevant_articles"`
+	// Completion is the model output the answer was read from, including which
+	// provider served it. It is not part of the JSON the model is asked for.
+	Completion *Completion `json:"-"`
+	// PromptVersion is the version of the prompt that produced the answer.
+	PromptVersion string `json:"-"`
+	// Budget reports which articles were fitted into the prompt and its estimated size.
+	Budget *PromptBudget `json:"-"`
 }
 
-// GenerativeAIModel interface for dependency injection.
-type GenerativeAIModel interface {
-	GenerateContent(ctx context.Context, parts ...genai.Part) (*genai.GenerateContentResponse, error)
-}
-
-// ModelFactory function type for creating AI models.
-type ModelFactory func(ctx context.Context, apiKey string) (GenerativeAIModel, error)
-
-// GetAIAnswer is the REAL function that calls the Google Gemini API.
+// GetAIAnswer answers with the Gemini model configured by the GEMINI_API_KEY
+// environment variable.
+//
+// Deprecated: GetAIAnswer opens new connections to the provider on every call. Create
+// one LLM and call Answer with it instead.
 func GetAIAnswer(userQuery string, articles []kb.Article) (*AIResponse, error) {
-	return getAIAnswerWithFactory(realModelFactory, userQuery, articles)
-}
-
-// getAIAnswerWithFactory is the internal testable function
-func getAIAnswerWithFactory(factory ModelFactory, userQuery string, articles []kb.Article) (*AIResponse, error) {
-	ctx := context.Background()
-
-	// Get the API Key from the environment variable.
 	apiKey := os.Getenv("GEMINI_API_KEY")
 	if apiKey == "" {
 		return nil, fmt.Errorf("GEMINI_API_KEY environment variable not set")
 	}
+	gemini := NewGemini(apiKey, DefaultGeminiModel)
+	defer gemini.Close()
+	return Answer(context.Background(), gemini, userQuery, articles, AnswerOptions{MaxRepairs: DefaultJSONRepairs})
+}
 
-	// Create a new client with your API key.
-	model, err := factory(ctx, apiKey)
-	if err != nil {
-		log.Printf("Failed to create genai client: %v", err)
-		return nil, err
+// DefaultJSONRepairs is how many times a malformed answer is sent back to the model
+// for repair by default.
+const DefaultJSONRepairs = 1
+
+// AnswerOptions tunes how Answer and AnswerStream talk to the model.
+type AnswerOptions struct {
+	// Prompt is the prompt version to use. Nil means DefaultPrompt.
+	Prompt *Prompt
+	// MaxRepairs is how many times the model is asked to fix an answer that is not
+	// valid JSON or does not match AIResponseSchema.
+	MaxRepairs int
+	// History is the conversation before the question, oldest first, for follow-up
+	// questions. It is only sent with prompt versions that include it.
+	History []Message
+	// MaxPromptTokens caps the estimated size of the prompt. Articles are sent in rank
+	// order until it is reached, the last one cut to fit. Zero sends every article.
+	MaxPromptTokens int
+}
+
+// prompt returns the configured prompt or the default one.
+func (opts AnswerOptions) prompt() *Prompt {
+	if opts.Prompt != nil {
+		return opts.Prompt
 	}
+	return DefaultPrompt()
+}
 
-	prompt := buildPrompt(userQuery, articles)
+// PromptVersion returns the version of the prompt the options answer with.
+func (opts AnswerOptions) PromptVersion() string {
+	return opts.prompt().Version
+}
 
-	resp, err := model.GenerateContent(ctx, genai.Text(prompt))
+// Answer asks the model to answer the user's question from the given articles, which
+// must be in rank order, and to list the articles it used. The reply is validated
+// against AIResponseSchema.
+func Answer(ctx context.Context, llm LLM, userQuery string, articles []kb.Article, opts AnswerOptions) (*AIResponse, error) {
+	data := PromptData{Query: userQuery, Articles: articles, History: opts.History}
+	prompt, _, budget, err := fitPrompt(llm, opts.prompt().Answer, data, opts.MaxPromptTokens)
 	if err != nil {
-		log.Printf("Failed to generate content: %v", err)
 		return nil, err
 	}
 
-	// The response from Gemini is inside resp.Candidates.
-	// We need to parse this response to extract our JSON.
-	if len(resp.Candidates) == 0 || len(resp.Candidates[0].Content.Parts) == 0 {
-		return nil, fmt.Errorf("received an empty response from AI")
-	}
-
-	aiContent := fmt.Sprintf("%v", resp.Candidates[0].Content.Parts[0])
-
-	// The AI's response might include markdown formatting for the JSON block (```json ... ```).
-	// We need to clean this up before parsing.
-	cleanedJSON := cleanAIResponse(aiContent)
-
-	// Unmarshal the cleaned JSON string into our AIResponse struct.
 	var aiResponse AIResponse
-	err = json.Unmarshal([]byte(cleanedJSON), &aiResponse)
+	request := Request{Messages: []Message{{Role: RoleUser, Content: prompt}}}
+	completion, err := GenerateJSON(ctx, llm, request, JSONOptions{Schema: AIResponseSchema, MaxRepairs: opts.MaxRepairs}, &aiResponse)
 	if err != nil {
-		log.Printf("Failed to unmarshal AI response. Raw response: %s", cleanedJSON)
-		return nil, fmt.Errorf("failed to parse AI response: %w", err)
+		log.Printf("Failed to generate AI answer with %s: %v", llm.Name(), err)
+		return nil, err
 	}
-
+	aiResponse.Completion = completion
+	aiResponse.PromptVersion = opts.prompt().Version
+	aiResponse.Budget = budget
 	return &aiResponse, nil
 }
 
-// realModelFactory creates the real Gemini model.
-func realModelFactory(ctx context.Context, apiKey string) (GenerativeAIModel, error) {
-	client, err := genai.NewClient(ctx, option.WithAPIKey(apiKey))
+// AnswerStream is like Answer but streams the answer text to onText as it is
+// generated. The model is asked for plain text citing articles as [id], and the
+// relevant articles are the ones it cited.
+func AnswerStream(ctx context.Context, llm LLM, userQuery string, articles []kb.Article, opts AnswerOptions, onText func(string) error) (*AIResponse, error) {
+	data := PromptData{Query: userQuery, Articles: articles, History: opts.History}
+	prompt, data, budget, err := fitPrompt(llm, opts.prompt().Stream, data, opts.MaxPromptTokens)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create genai client: %w", err)
+		return nil, err
 	}
 
-	model := client.GenerativeModel("gemini-1.5-flash")
-	return model, nil
+	completion, err := GenerateStream(ctx, llm, Request{Messages: []Message{{Role: RoleUser, Content: prompt}}}, onText)
+	if err != nil {
+		log.Printf("Failed to stream AI answer with %s: %v", llm.Name(), err)
+		return nil, err
+	}
+	return &AIResponse{
+		SummaryAnswer:    strings.TrimSpace(completion.Text),
+		RelevantArticles: citedArticles(completion.Text, data.Articles),
+		Completion:       completion,
+		PromptVersion:    opts.prompt().Version,
+		Budget:           budget,
+	}, nil
+}
+
+var citationPattern = regexp.MustCompile(`\[([^\[\]\s]+)\]`)
+
+// CitedIDs returns the IDs cited in square brackets in text, such as "kb-001" in
+// "... [kb-001]", in order of first citation.
+func CitedIDs(text string) []string {
+	var ids []string
+	seen := make(map[string]bool)
+	for _, m := range citationPattern.FindAllStringSubmatch(text, -1) {
+		if !seen[m[1]] {
+			seen[m[1]] = true
+			ids = append(ids, m[1])
+		}
+	}
+	return ids
 }
 
-func buildPrompt(userQuery string, articles []kb.Article) string {
-	var articlesContext string
+// citedArticles returns the articles whose IDs appear in square brackets in text, in
+// order of first citation. Brackets that do not hold a known ID are ignored.
+func citedArticles(text string, articles []kb.Article) []kb.Article {
+	byID := make(map[string]kb.Article, len(articles))
 	for _, article := range articles {
-		articlesContext += fmt.Sprintf("Article ID: %s\nTitle: %s\nContent: %s\n\n", article.ID, article.Title, article.Content)
+		byID[article.ID] = article
 	}
 
-	return fmt.Sprintf(`
-You are an expert IT support assistant for a corporate knowledge base.
-Your task is to answer a user's question based ONLY on the provided knowledge base articles.
+	cited := []kb.Article{}
+	for _, id := range CitedIDs(text) {
+		if article, ok := byID[id]; ok {
+			cited = append(cited, kb.Article{ID: article.ID, Title: article.Title})
+		}
+	}
+	return cited
+}
 
-Here are the available articles:
---- START OF ARTICLES ---
-%s
---- END OF ARTICLES ---
+// cleanAIResponse extracts the first JSON object from rawResponse and repairs the
+// mistakes models commonly make: text or markdown code fences around the object,
+// trailing commas, and output truncated mid-object (open strings, arrays and objects
+// are closed, a dangling key is dropped and a missing value becomes null). Text
+// without an opening brace is returned unchanged.
+func cleanAIResponse(rawResponse string) string {
+	start := strings.Index(rawResponse, "{")
+	if start == -1 {
+		return rawResponse
+	}
 
-Here is the user's question: "%s"
+	var out strings.Builder
+	var stack []byte
+	inString, escaped, isKey := false, false, false
+	// last is the last character outside a string, ignoring whitespace.
+	var last byte
+	// keyStart is where the pending key of the innermost object begins in out, or -1.
+	keyStart, stringStart := -1, 0
+	for i := start; i < len(rawResponse); i++ {
+		c := rawResponse[i]
+		if inString {
+			out.WriteByte(c)
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString, last = false, c
+				if isKey {
+					keyStart = stringStart
+				}
+			}
+			continue
+		}
 
-Based on the articles, please perform the following two tasks:
-1.  Provide a concise, one or two-sentence summary answer to the user's question. If the articles do not contain an answer, state that you could not find an answer.
-2.  Identify the articles that are most relevant to the user's question.
+		switch c {
+		case ' ', '\t', '\r', '\n':
+			out.WriteByte(c)
+			continue
+		case '"':
+			isKey = top(stack) == '{' && (last == '{' || last == ',')
+			inString, stringStart = true, out.Len()
+		case '{', '[':
+			stack = append(stack, c)
+		case '}', ']':
+			if (c == '}') != (top(stack) == '{') {
+				continue // a stray closer
+			}
+			trimTrailingComma(&out)
+			stack = stack[:len(stack)-1]
+			if len(stack) == 0 {
+				out.WriteByte(c)
+				return out.String()
+			}
+		case ':', ',':
+			keyStart = -1
+		}
+		out.WriteByte(c)
+		last = c
+	}
 
-Your entire response MUST be a single, valid JSON object with NO other text or explanation before or after it.
-The JSON object must have the following structure:
-{
-  "ai_summary_answer": "Your concise summary answer here.",
-  "ai_relevant_articles": [
-    { "id": "The ID of the most relevant article", "title": "The title of the most relevant article" }
-  ]
+	// The output was truncated: close whatever is still open.
+	result := out.String()
+	if inString {
+		if escaped {
+			result = result[:len(result)-1]
+		}
+		result += `"`
+		if isKey {
+			keyStart = stringStart
+		}
+	}
+	if keyStart >= 0 {
+		result = result[:keyStart]
+	}
+	result = strings.TrimRight(result, " \t\r\n")
+	if strings.HasSuffix(result, ":") {
+		result += "null"
+	}
+	for len(stack) > 0 {
+		result = strings.TrimSuffix(strings.TrimRight(result, " \t\r\n"), ",")
+		if top(stack) == '{' {
+			result += "}"
+		} else {
+			result += "]"
+		}
+		stack = stack[:len(stack)-1]
+	}
+	return result
 }
-`, articlesContext, userQuery)
+
+// top returns the innermost open bracket, or 0.
+func top(stack []byte) byte {
+	if len(stack) == 0 {
+		return 0
+	}
+	return stack[len(stack)-1]
 }
 
-// cleanAIResponse removes everything before and after the JSON block.
-func cleanAIResponse(rawResponse string) string {
-	start := strings.Index(rawResponse, "{")
-	end := strings.LastIndex(rawResponse, "}")
-	if start == -1 || end == -1 {
-		return rawResponse
+// trimTrailingComma removes a comma (and any whitespace after it) at the end of out.
+func trimTrailingComma(out *strings.Builder) {
+	s := strings.TrimRight(out.String(), " \t\r\n")
+	if strings.HasSuffix(s, ",") {
+		s = s[:len(s)-1]
+		out.Reset()
+		out.WriteString(s)
 	}
-	return rawResponse[start : end+1]
 }
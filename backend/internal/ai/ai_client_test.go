@@ -4,37 +4,33 @@ import (
 	"ai-knowledge-base/internal/kb"
 	"context"
 	"encoding/json"
-	"fmt"
+	"errors"
 	"os"
 	"strings"
 	"testing"
-
-	"github.com/google/generative-ai-go/genai"
 )
 
-// MockGenerativeAIModel implements GenerativeAIModel for testing.
-type MockGenerativeAIModel struct {
-	shouldError bool
-	response    *genai.GenerateContentResponse
-	errorMsg    string
+// mockLLM implements LLM for testing. It replies with replies in order, then with text.
+type mockLLM struct {
+	text     string
+	replies  []string
+	err      error
+	requests []Request
 }
 
-func (m *MockGenerativeAIModel) GenerateContent(ctx context.Context, parts ...genai.Part) (*genai.GenerateContentResponse, error) {
-	if m.shouldError {
-		return nil, fmt.Errorf(m.errorMsg)
-	}
-	return m.response, nil
-}
+func (m *mockLLM) Name() string { return "mock" }
 
-// mockModelFactory creates a mock model for testing.
-func mockModelFactory(shouldError bool, response *genai.GenerateContentResponse, errorMsg string) ModelFactory {
-	return func(ctx context.Context, apiKey string) (GenerativeAIModel, error) {
-		return &MockGenerativeAIModel{
-			shouldError: shouldError,
-			response:    response,
-			errorMsg:    errorMsg,
-		}, nil
+func (m *mockLLM) Generate(ctx context.Context, req Request) (*Completion, error) {
+	m.requests = append(m.requests, req)
+	if m.err != nil {
+		return nil, m.err
 	}
+	if len(m.replies) > 0 {
+		reply := m.replies[0]
+		m.replies = m.replies[1:]
+		return &Completion{Text: reply, Usage: Usage{TotalTokens: 10}}, nil
+	}
+	return &Completion{Text: m.text, Usage: Usage{TotalTokens: 10}}, nil
 }
 
 // TestAIResponseStruct tests the AIResponse struct definition and JSON marshaling.
@@ -112,7 +108,10 @@ func TestBuildPrompt(t *testing.T) {
 	}
 
 	userQuery := "How do I reset my password?"
-	prompt := buildPrompt(userQuery, articles)
+	prompt, err := DefaultPrompt().Answer(PromptData{Query: userQuery, Articles: articles})
+	if err != nil {
+		t.Fatalf("Failed to render prompt: %v", err)
+	}
 
 	if !strings.Contains(prompt, userQuery) {
 		t.Error("Prompt does not contain user query")
@@ -151,20 +150,23 @@ func TestBuildPrompt(t *testing.T) {
 	}
 
 	// Test that prompt has proper structure
-	if !strings.Contains(prompt, "START OF ARTICLES") {
+	if !strings.Contains(prompt, "<articles>") || !strings.Contains(prompt, `<article id="kb-001">`) {
 		t.Error("Prompt does not contain article section markers")
 	}
 
-	if !strings.Contains(prompt, "END OF ARTICLES") {
+	if !strings.Contains(prompt, "</articles>") || !strings.Contains(prompt, "<question>\n"+userQuery+"\n</question>") {
 		t.Error("Prompt does not contain article section markers")
 	}
 }
 
-// TestBuildPromptWithEmptyArticles tests buildPrompt with empty articles slice.
+// TestBuildPromptWithEmptyArticles tests the answer prompt with empty articles slice.
 func TestBuildPromptWithEmptyArticles(t *testing.T) {
 	articles := []kb.Article{}
 	userQuery := "Test query"
-	prompt := buildPrompt(userQuery, articles)
+	prompt, err := DefaultPrompt().Answer(PromptData{Query: userQuery, Articles: articles})
+	if err != nil {
+		t.Fatalf("Failed to render prompt: %v", err)
+	}
 
 	if !strings.Contains(prompt, userQuery) {
 		t.Error("Prompt does not contain user query")
@@ -204,7 +206,7 @@ func TestCleanAIResponse(t *testing.T) {
 		{
 			name:     "Multiple JSON blocks - takes first",
 			input:    `{"first": "block"} {"second": "block"}`,
-			expected: `{"first": "block"} {"second": "block"}`,
+			expected: `{"first": "block"}`,
 		},
 		{
 			name:     "No JSON braces",
@@ -219,13 +221,43 @@ func TestCleanAIResponse(t *testing.T) {
 		{
 			name:     "Only opening brace",
 			input:    "{",
-			expected: "{",
+			expected: "{}",
 		},
 		{
 			name:     "Only closing brace",
 			input:    "}",
 			expected: "}",
 		},
+		{
+			name:     "Trailing commas",
+			input:    `{"a": [1, 2,], "b": {"c": 3,},}`,
+			expected: `{"a": [1, 2], "b": {"c": 3}}`,
+		},
+		{
+			name:     "Braces and commas inside strings",
+			input:    "```\n{\"a\": \"x}, \\\"y,]\\\"\"}\n```",
+			expected: `{"a": "x}, \"y,]\""}`,
+		},
+		{
+			name:     "Truncated inside a string",
+			input:    `{"ai_summary_answer": "To reset your pass`,
+			expected: `{"ai_summary_answer": "To reset your pass"}`,
+		},
+		{
+			name:     "Truncated after a key",
+			input:    `{"a": 1, "b"`,
+			expected: `{"a": 1}`,
+		},
+		{
+			name:     "Truncated after a colon",
+			input:    `{"a": [{"b":`,
+			expected: `{"a": [{"b":null}]}`,
+		},
+		{
+			name:     "Truncated after a comma",
+			input:    `{"a": [1, 2,`,
+			expected: `{"a": [1, 2]}`,
+		},
 	}
 
 	for _, tt := range tests {
@@ -238,21 +270,9 @@ func TestCleanAIResponse(t *testing.T) {
 	}
 }
 
-// TestGetAIAnswerWithFactorySuccess tests successful AI response.
-func TestGetAIAnswerWithFactorySuccess(t *testing.T) {
-	mockResponse := &genai.GenerateContentResponse{
-		Candidates: []*genai.Candidate{
-			{
-				Content: &genai.Content{
-					Parts: []genai.Part{
-						genai.Text(`{"ai_summary_answer": "To reset your password, go to the login page and click the forgot password link.", "ai_relevant_articles": [{"id": "kb-001", "title": "How to reset your password"}]}`),
-					},
-				},
-			},
-		},
-	}
-
-	factory := mockModelFactory(false, mockResponse, "")
+// TestAnswerSuccess tests successful AI response.
+func TestAnswerSuccess(t *testing.T) {
+	model := &mockLLM{text: `{"ai_summary_answer": "To reset your password, go to the login page and click the forgot password link.", "ai_relevant_articles": [{"id": "kb-001", "title": "How to reset your password"}]}`}
 	articles := []kb.Article{
 		{
 			ID:      "kb-001",
@@ -261,11 +281,7 @@ func TestGetAIAnswerWithFactorySuccess(t *testing.T) {
 		},
 	}
 
-	originalKey := os.Getenv("GEMINI_API_KEY")
-	os.Setenv("GEMINI_API_KEY", "test-key")
-	defer os.Setenv("GEMINI_API_KEY", originalKey)
-
-	response, err := getAIAnswerWithFactory(factory, "How do I reset my password?", articles)
+	response, err := Answer(context.Background(), model, "How do I reset my password?", articles, AnswerOptions{})
 
 	if err != nil {
 		t.Errorf("Expected no error, got: %v", err)
@@ -275,6 +291,10 @@ func TestGetAIAnswerWithFactorySuccess(t *testing.T) {
 		t.Error("Expected response, got nil")
 	}
 
+	if len(model.requests) != 1 || !model.requests[0].JSON {
+		t.Errorf("Expected a single JSON-mode request, got %+v", model.requests)
+	}
+
 	if response.SummaryAnswer != "To reset your password, go to the login page and click the forgot password link." {
 		t.Errorf("Expected specific summary answer, got: %s", response.SummaryAnswer)
 	}
@@ -288,9 +308,9 @@ func TestGetAIAnswerWithFactorySuccess(t *testing.T) {
 	}
 }
 
-// TestGetAIAnswerWithFactoryAPIError tests AI API error handling.
-func TestGetAIAnswerWithFactoryAPIError(t *testing.T) {
-	factory := mockModelFactory(true, nil, "API error occurred")
+// TestAnswerAPIError tests AI API error handling.
+func TestAnswerAPIError(t *testing.T) {
+	model := &mockLLM{err: errors.New("API error occurred")}
 	articles := []kb.Article{
 		{
 			ID:      "kb-001",
@@ -299,11 +319,7 @@ func TestGetAIAnswerWithFactoryAPIError(t *testing.T) {
 		},
 	}
 
-	originalKey := os.Getenv("GEMINI_API_KEY")
-	os.Setenv("GEMINI_API_KEY", "test-key")
-	defer os.Setenv("GEMINI_API_KEY", originalKey)
-
-	response, err := getAIAnswerWithFactory(factory, "test query", articles)
+	response, err := Answer(context.Background(), model, "test query", articles, AnswerOptions{})
 
 	if err == nil {
 		t.Error("Expected error, got nil")
@@ -318,13 +334,9 @@ func TestGetAIAnswerWithFactoryAPIError(t *testing.T) {
 	}
 }
 
-// TestGetAIAnswerWithFactoryEmptyResponse tests empty AI response handling.
-func TestGetAIAnswerWithFactoryEmptyResponse(t *testing.T) {
-	mockResponse := &genai.GenerateContentResponse{
-		Candidates: []*genai.Candidate{},
-	}
-
-	factory := mockModelFactory(false, mockResponse, "")
+// TestAnswerEmptyResponse tests empty AI response handling.
+func TestAnswerEmptyResponse(t *testing.T) {
+	model := &mockLLM{}
 	articles := []kb.Article{
 		{
 			ID:      "kb-001",
@@ -333,11 +345,7 @@ func TestGetAIAnswerWithFactoryEmptyResponse(t *testing.T) {
 		},
 	}
 
-	originalKey := os.Getenv("GEMINI_API_KEY")
-	os.Setenv("GEMINI_API_KEY", "test-key")
-	defer os.Setenv("GEMINI_API_KEY", originalKey)
-
-	response, err := getAIAnswerWithFactory(factory, "test query", articles)
+	response, err := Answer(context.Background(), model, "test query", articles, AnswerOptions{})
 
 	if err == nil {
 		t.Error("Expected error for empty response, got nil")
@@ -352,21 +360,9 @@ func TestGetAIAnswerWithFactoryEmptyResponse(t *testing.T) {
 	}
 }
 
-// TestGetAIAnswerWithFactoryInvalidJSON tests invalid JSON response handling.
-func TestGetAIAnswerWithFactoryInvalidJSON(t *testing.T) {
-	mockResponse := &genai.GenerateContentResponse{
-		Candidates: []*genai.Candidate{
-			{
-				Content: &genai.Content{
-					Parts: []genai.Part{
-						genai.Text(`This is not valid JSON`),
-					},
-				},
-			},
-		},
-	}
-
-	factory := mockModelFactory(false, mockResponse, "")
+// TestAnswerInvalidJSON tests invalid JSON response handling.
+func TestAnswerInvalidJSON(t *testing.T) {
+	model := &mockLLM{text: `This is not valid JSON`}
 	articles := []kb.Article{
 		{
 			ID:      "kb-001",
@@ -375,11 +371,7 @@ func TestGetAIAnswerWithFactoryInvalidJSON(t *testing.T) {
 		},
 	}
 
-	originalKey := os.Getenv("GEMINI_API_KEY")
-	os.Setenv("GEMINI_API_KEY", "test-key")
-	defer os.Setenv("GEMINI_API_KEY", originalKey)
-
-	response, err := getAIAnswerWithFactory(factory, "test query", articles)
+	response, err := Answer(context.Background(), model, "test query", articles, AnswerOptions{})
 
 	if err == nil {
 		t.Error("Expected error for invalid JSON, got nil")
@@ -394,6 +386,50 @@ func TestGetAIAnswerWithFactoryInvalidJSON(t *testing.T) {
 	}
 }
 
+// TestAnswerRepair tests that output failing the schema is sent back to the model,
+// and that the corrected reply is used.
+func TestAnswerRepair(t *testing.T) {
+	model := &mockLLM{
+		replies: []string{`{"ai_summary_answer": "", "ai_relevant_articles": [{"title": "No ID"}]}`},
+		text:    `{"ai_summary_answer": "Use the reset link.", "ai_relevant_articles": [{"id": "kb-001"}]}`,
+	}
+	response, err := Answer(context.Background(), model, "test query", nil, AnswerOptions{MaxRepairs: 1})
+	if err != nil {
+		t.Fatalf("Expected the repaired answer, got: %v", err)
+	}
+	if response.SummaryAnswer != "Use the reset link." || response.Completion.Usage.TotalTokens != 20 {
+		t.Errorf("Unexpected response %+v with usage %+v", response, response.Completion.Usage)
+	}
+
+	if len(model.requests) != 2 {
+		t.Fatalf("Expected one repair request, got %d requests", len(model.requests))
+	}
+	messages := model.requests[1].Messages
+	if len(messages) != 3 || messages[1].Role != RoleAssistant || messages[2].Role != RoleUser || !model.requests[1].JSON {
+		t.Fatalf("Unexpected repair request %+v", model.requests[1])
+	}
+	for _, want := range []string{"$.ai_summary_answer: must be at least 1 characters long", `$.ai_relevant_articles[0]: missing required property "id"`, AIResponseSchema.String()} {
+		if !strings.Contains(messages[2].Content, want) {
+			t.Errorf("Expected the repair prompt to contain %q, got %q", want, messages[2].Content)
+		}
+	}
+	if len(model.requests[0].Messages) != 1 {
+		t.Errorf("The repair must not modify the original request, got %+v", model.requests[0].Messages)
+	}
+}
+
+// TestAnswerRepairGivesUp tests that repairs are bounded.
+func TestAnswerRepairGivesUp(t *testing.T) {
+	model := &mockLLM{text: `{"ai_summary_answer": 42}`}
+	_, err := Answer(context.Background(), model, "test query", nil, AnswerOptions{MaxRepairs: 2})
+	if err == nil || !strings.Contains(err.Error(), "does not match the schema") {
+		t.Errorf("Expected a schema error, got: %v", err)
+	}
+	if len(model.requests) != 3 {
+		t.Errorf("Expected the original request and 2 repairs, got %d requests", len(model.requests))
+	}
+}
+
 // TestGetAIAnswerWithoutAPIKey tests GetAIAnswer when API key is not set.
 func TestGetAIAnswerWithoutAPIKey(t *testing.T) {
 	originalKey := os.Getenv("GEMINI_API_KEY")
@@ -424,28 +460,12 @@ func TestGetAIAnswerWithoutAPIKey(t *testing.T) {
 	}
 }
 
-// TestGetAIAnswerWithEmptyArticles tests GetAIAnswer with empty articles slice.
-func TestGetAIAnswerWithEmptyArticles(t *testing.T) {
-	mockResponse := &genai.GenerateContentResponse{
-		Candidates: []*genai.Candidate{
-			{
-				Content: &genai.Content{
-					Parts: []genai.Part{
-						genai.Text(`{"ai_summary_answer": "No relevant articles found.", "ai_relevant_articles": []}`),
-					},
-				},
-			},
-		},
-	}
-
-	factory := mockModelFactory(false, mockResponse, "")
+// TestAnswerWithEmptyArticles tests Answer with empty articles slice.
+func TestAnswerWithEmptyArticles(t *testing.T) {
+	model := &mockLLM{text: `{"ai_summary_answer": "No relevant articles found.", "ai_relevant_articles": []}`}
 	articles := []kb.Article{}
 
-	originalKey := os.Getenv("GEMINI_API_KEY")
-	os.Setenv("GEMINI_API_KEY", "test-key")
-	defer os.Setenv("GEMINI_API_KEY", originalKey)
-
-	response, err := getAIAnswerWithFactory(factory, "test query", articles)
+	response, err := Answer(context.Background(), model, "test query", articles, AnswerOptions{})
 
 	if err != nil {
 		t.Errorf("Expected no error, got: %v", err)
@@ -464,21 +484,9 @@ func TestGetAIAnswerWithEmptyArticles(t *testing.T) {
 	}
 }
 
-// TestGetAIAnswerWithEmptyQuery tests GetAIAnswer with empty query.
-func TestGetAIAnswerWithEmptyQuery(t *testing.T) {
-	mockResponse := &genai.GenerateContentResponse{
-		Candidates: []*genai.Candidate{
-			{
-				Content: &genai.Content{
-					Parts: []genai.Part{
-						genai.Text(`{"ai_summary_answer": "Please provide a query.", "ai_relevant_articles": []}`),
-					},
-				},
-			},
-		},
-	}
-
-	factory := mockModelFactory(false, mockResponse, "")
+// TestAnswerWithEmptyQuery tests Answer with empty query.
+func TestAnswerWithEmptyQuery(t *testing.T) {
+	model := &mockLLM{text: `{"ai_summary_answer": "Please provide a query.", "ai_relevant_articles": []}`}
 	articles := []kb.Article{
 		{
 			ID:      "kb-001",
@@ -487,11 +495,7 @@ func TestGetAIAnswerWithEmptyQuery(t *testing.T) {
 		},
 	}
 
-	originalKey := os.Getenv("GEMINI_API_KEY")
-	os.Setenv("GEMINI_API_KEY", "test-key")
-	defer os.Setenv("GEMINI_API_KEY", originalKey)
-
-	response, err := getAIAnswerWithFactory(factory, "", articles)
+	response, err := Answer(context.Background(), model, "", articles, AnswerOptions{})
 
 	if err != nil {
 		t.Errorf("Expected no error, got: %v", err)
@@ -506,7 +510,7 @@ func TestGetAIAnswerWithEmptyQuery(t *testing.T) {
 	}
 }
 
-// BenchmarkBuildPrompt benchmarks the buildPrompt function.
+// BenchmarkBuildPrompt benchmarks rendering the answer prompt.
 func BenchmarkBuildPrompt(b *testing.B) {
 	articles := []kb.Article{
 		{
@@ -523,7 +527,7 @@ func BenchmarkBuildPrompt(b *testing.B) {
 	userQuery := "How do I reset my password?"
 
 	for i := 0; i < b.N; i++ {
-		buildPrompt(userQuery, articles)
+		DefaultPrompt().Answer(PromptData{Query: userQuery, Articles: articles})
 	}
 }
 
@@ -0,0 +1,164 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// BreakerState is the state of a CircuitBreaker.
+type BreakerState string
+
+// Circuit breaker states.
+const (
+	// BreakerClosed lets requests through and counts consecutive failures.
+	BreakerClosed BreakerState = "closed"
+	// BreakerOpen rejects requests without calling the provider until the cooldown ends.
+	BreakerOpen BreakerState = "open"
+	// BreakerHalfOpen lets a single probe request through to test whether the
+	// provider has recovered.
+	BreakerHalfOpen BreakerState = "half-open"
+)
+
+// ErrCircuitOpen is returned, wrapped with the provider name, for requests rejected
+// by an open CircuitBreaker.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// BreakerPolicy configures CircuitBreaker.
+type BreakerPolicy struct {
+	// FailureThreshold is how many consecutive failed requests open the circuit.
+	FailureThreshold int
+	// Cooldown is how long the circuit stays open before a probe request is allowed.
+	Cooldown time.Duration
+}
+
+// DefaultBreakerPolicy opens after 5 consecutive failures and probes again after 30s.
+var DefaultBreakerPolicy = BreakerPolicy{FailureThreshold: 5, Cooldown: 30 * time.Second}
+
+// CircuitBreaker wraps an LLM and stops calling it while it is failing, so that an
+// outage costs one fast error per request instead of a timeout. Only transient errors
+// (see ErrorKind.Transient) count as failures; an invalid request shows the provider
+// is up, and a cancelled one says nothing about it.
+type CircuitBreaker struct {
+	LLM    LLM
+	Policy BreakerPolicy
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+
+	// now is replaced in tests.
+	now func() time.Time
+}
+
+// NewCircuitBreaker wraps llm with a closed circuit breaker.
+func NewCircuitBreaker(llm LLM, policy BreakerPolicy) *CircuitBreaker {
+	return &CircuitBreaker{LLM: llm, Policy: policy, state: BreakerClosed, now: time.Now}
+}
+
+// Name implements LLM by returning the name of the wrapped LLM.
+func (b *CircuitBreaker) Name() string {
+	return b.LLM.Name()
+}
+
+// Close implements io.Closer by closing the wrapped LLM.
+func (b *CircuitBreaker) Close() error {
+	return Close(b.LLM)
+}
+
+// ModelName implements ModelNamer with the wrapped LLM's model.
+func (b *CircuitBreaker) ModelName() string {
+	return ModelName(b.LLM)
+}
+
+// EstimateTokens implements TokenEstimator with the wrapped LLM's estimate.
+func (b *CircuitBreaker) EstimateTokens(text string) int {
+	return EstimateTokens(b.LLM, text)
+}
+
+// State returns the current state of the circuit.
+func (b *CircuitBreaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == BreakerOpen && b.now().Sub(b.openedAt) >= b.Policy.Cooldown {
+		return BreakerHalfOpen
+	}
+	return b.state
+}
+
+// Generate implements LLM.
+func (b *CircuitBreaker) Generate(ctx context.Context, req Request) (*Completion, error) {
+	probe, err := b.allow()
+	if err != nil {
+		return nil, err
+	}
+	completion, err := b.LLM.Generate(ctx, req)
+	b.record(probe, err)
+	return completion, err
+}
+
+// Stream implements Streamer.
+func (b *CircuitBreaker) Stream(ctx context.Context, req Request, onText func(string) error) (*Completion, error) {
+	probe, err := b.allow()
+	if err != nil {
+		return nil, err
+	}
+	completion, err := GenerateStream(ctx, b.LLM, req, onText)
+	b.record(probe, err)
+	return completion, err
+}
+
+// allow decides whether a request may go through, moving an open circuit whose
+// cooldown has passed to half-open. It reports whether the request is the probe.
+func (b *CircuitBreaker) allow() (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == BreakerOpen && b.now().Sub(b.openedAt) >= b.Policy.Cooldown {
+		b.state = BreakerHalfOpen
+	}
+	switch {
+	case b.state == BreakerOpen, b.state == BreakerHalfOpen && b.probing:
+		return false, fmt.Errorf("%s: %w", b.LLM.Name(), ErrCircuitOpen)
+	case b.state == BreakerHalfOpen:
+		b.probing = true
+		return true, nil
+	}
+	return false, nil
+}
+
+// record updates the circuit with the outcome of a request.
+func (b *CircuitBreaker) record(probe bool, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if probe {
+		b.probing = false
+	}
+
+	kind := ErrorKind("")
+	if err != nil {
+		kind = Classify(err)
+	}
+	switch {
+	case kind == ErrorCanceled:
+		// The probe slot is freed above; the outcome says nothing about the provider.
+	case !kind.Transient():
+		if probe {
+			log.Printf("Circuit for %s closed: the provider has recovered", b.LLM.Name())
+		}
+		b.state, b.failures = BreakerClosed, 0
+	case probe:
+		log.Printf("Circuit for %s reopened: probe request failed: %v", b.LLM.Name(), err)
+		b.state, b.openedAt = BreakerOpen, b.now()
+	default:
+		b.failures++
+		if b.failures >= max(b.Policy.FailureThreshold, 1) && b.state == BreakerClosed {
+			log.Printf("Circuit for %s opened after %d consecutive failures: %v", b.LLM.Name(), b.failures, err)
+			b.state, b.openedAt = BreakerOpen, b.now()
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// newTestBreaker wraps llm with a breaker whose clock is controlled by the test.
+func newTestBreaker(llm LLM, now *time.Time) *CircuitBreaker {
+	b := NewCircuitBreaker(llm, BreakerPolicy{FailureThreshold: 2, Cooldown: time.Minute})
+	b.now = func() time.Time { return *now }
+	return b
+}
+
+// TestCircuitBreaker walks a breaker through closed, open, half-open and back.
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Now()
+	down := &StatusError{StatusCode: 503}
+	llm := &scriptedLLM{errs: []error{down, down, down}}
+	b := newTestBreaker(llm, &now)
+
+	for i := 0; i < 2; i++ {
+		if _, err := b.Generate(context.Background(), Request{}); !errors.Is(err, down) {
+			t.Fatalf("Expected the provider error, got %v", err)
+		}
+	}
+	if b.State() != BreakerOpen {
+		t.Fatalf("Expected the circuit to open after 2 failures, got %s", b.State())
+	}
+	if _, err := b.Generate(context.Background(), Request{}); !errors.Is(err, ErrCircuitOpen) || llm.calls != 2 {
+		t.Errorf("Expected an open circuit to reject without calling the provider, got %v after %d calls", err, llm.calls)
+	}
+
+	// After the cooldown one probe is let through; it fails and reopens the circuit.
+	now = now.Add(time.Minute)
+	if b.State() != BreakerHalfOpen {
+		t.Errorf("Expected half-open after the cooldown, got %s", b.State())
+	}
+	if _, err := b.Generate(context.Background(), Request{}); !errors.Is(err, down) || b.State() != BreakerOpen {
+		t.Errorf("Expected the failed probe to reopen the circuit, got %v and %s", err, b.State())
+	}
+
+	// The next probe succeeds and closes it.
+	now = now.Add(time.Minute)
+	if completion, err := b.Generate(context.Background(), Request{}); err != nil || completion.Text != "ok" {
+		t.Fatalf("Expected the probe to succeed, got %v", err)
+	}
+	if b.State() != BreakerClosed {
+		t.Errorf("Expected the circuit to close after a successful probe, got %s", b.State())
+	}
+}
+
+// TestCircuitBreakerSingleProbe tests that only one request probes a half-open circuit.
+func TestCircuitBreakerSingleProbe(t *testing.T) {
+	now := time.Now()
+	b := newTestBreaker(&scriptedLLM{}, &now)
+	b.state, b.openedAt = BreakerOpen, now.Add(-time.Hour)
+
+	probe, err := b.allow()
+	if !probe || err != nil {
+		t.Fatalf("Expected the first request to probe, got %t and %v", probe, err)
+	}
+	if _, err := b.allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Expected a concurrent request to be rejected during the probe, got %v", err)
+	}
+	b.record(true, context.Canceled)
+	if probe, _ := b.allow(); !probe {
+		t.Errorf("Expected a cancelled probe to free the probe slot")
+	}
+}
+
+// TestCircuitBreakerIgnoresInvalidRequests tests that errors which are not the
+// provider's fault do not open the circuit.
+func TestCircuitBreakerIgnoresInvalidRequests(t *testing.T) {
+	now := time.Now()
+	invalid := &StatusError{StatusCode: 400}
+	b := newTestBreaker(&scriptedLLM{errs: []error{invalid, invalid, invalid}}, &now)
+	for i := 0; i < 3; i++ {
+		b.Generate(context.Background(), Request{})
+	}
+	if b.State() != BreakerClosed {
+		t.Errorf("Expected invalid requests to leave the circuit closed, got %s", b.State())
+	}
+}
@@ -0,0 +1,134 @@
+package ai
+
+import (
+	"ai-knowledge-base/internal/kb"
+	"log"
+	"regexp"
+)
+
+// PromptBudget reports how the articles of a prompt were fitted into its token budget.
+type PromptBudget struct {
+	// MaxTokens is the budget. Zero means the prompt was not limited.
+	MaxTokens int `json:"max_tokens"`
+	// EstimatedTokens is the estimated size of the prompt that was sent.
+	EstimatedTokens int `json:"estimated_tokens"`
+	// Articles are the IDs of the articles that were sent, in rank order.
+	Articles []string `json:"articles"`
+	// Truncated is the ID of the last article sent if its content was cut to fit.
+	Truncated string `json:"truncated,omitempty"`
+	// Dropped are the IDs of the articles left out of the prompt.
+	Dropped []string `json:"dropped,omitempty"`
+}
+
+// minTruncatedWords is the least of an article's content worth sending when it has to
+// be cut; an article that would keep fewer words is left out instead.
+const minTruncatedWords = 20
+
+// truncationMarker ends the content of an article that was cut to fit the budget.
+const truncationMarker = " …"
+
+var wordPattern = regexp.MustCompile(`\S+`)
+
+// fitPrompt renders data, keeping as many of its articles, in rank order, as fit in
+// maxTokens as estimated for llm. The first article that does not fit whole is cut at
+// a word boundary to the space left, and the ones after it are left out. Zero
+// maxTokens keeps every article. It returns the prompt and the data it was rendered with.
+func fitPrompt(llm LLM, render func(PromptData) (string, error), data PromptData, maxTokens int) (string, PromptData, *PromptBudget, error) {
+	try := func(articles []kb.Article) (string, int, error) {
+		data.Articles = articles
+		prompt, err := render(data)
+		if err != nil {
+			return "", 0, err
+		}
+		return prompt, EstimateTokens(llm, prompt), nil
+	}
+
+	all := data.Articles
+	budget := &PromptBudget{MaxTokens: maxTokens, Articles: []string{}}
+	prompt, tokens, err := try(all)
+	if err != nil {
+		return "", data, nil, err
+	}
+	if maxTokens <= 0 || tokens <= maxTokens {
+		budget.EstimatedTokens = tokens
+		for _, article := range all {
+			budget.Articles = append(budget.Articles, article.ID)
+		}
+		return prompt, data, budget, nil
+	}
+
+	kept := make([]kb.Article, 0, len(all))
+	if prompt, tokens, err = try(kept); err != nil {
+		return "", data, nil, err
+	}
+	dropped := all
+	for i, article := range all {
+		if tokens > maxTokens {
+			break
+		}
+		p, t, err := try(append(kept, article))
+		if err != nil {
+			return "", data, nil, err
+		}
+		if t <= maxTokens {
+			kept, prompt, tokens, dropped = append(kept, article), p, t, all[i+1:]
+			continue
+		}
+		cut, p, t, err := truncateArticle(article, maxTokens, func(a kb.Article) (string, int, error) {
+			return try(append(kept, a))
+		})
+		if err != nil {
+			return "", data, nil, err
+		}
+		if p != "" {
+			kept, prompt, tokens, dropped = append(kept, cut), p, t, all[i+1:]
+			budget.Truncated = article.ID
+		}
+		break
+	}
+	if len(kept) == 0 {
+		log.Printf("Warning: the prompt exceeds its budget of %d tokens without any articles", maxTokens)
+	}
+
+	data.Articles = kept
+	budget.EstimatedTokens = tokens
+	for _, article := range kept {
+		budget.Articles = append(budget.Articles, article.ID)
+	}
+	for _, article := range dropped {
+		budget.Dropped = append(budget.Dropped, article.ID)
+	}
+	return prompt, data, budget, nil
+}
+
+// truncateArticle finds the longest cut of article's content, at a word boundary, with
+// which try estimates the prompt within maxTokens. It returns an empty prompt if even
+// minTruncatedWords do not fit.
+func truncateArticle(article kb.Article, maxTokens int, try func(kb.Article) (string, int, error)) (kb.Article, string, int, error) {
+	words := wordPattern.FindAllStringIndex(article.Content, -1)
+	cut := func(n int) kb.Article {
+		a := article
+		a.Content = article.Content[:words[n-1][1]] + truncationMarker
+		return a
+	}
+
+	// Binary search for the most words that fit. lo is minTruncatedWords-1 until a cut fits.
+	var best kb.Article
+	var prompt string
+	var tokens int
+	lo, hi := minTruncatedWords-1, len(words)-1
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+		candidate := cut(mid)
+		p, t, err := try(candidate)
+		if err != nil {
+			return kb.Article{}, "", 0, err
+		}
+		if t <= maxTokens {
+			lo, best, prompt, tokens = mid, candidate, p, t
+		} else {
+			hi = mid - 1
+		}
+	}
+	return best, prompt, tokens, nil
+}
@@ -0,0 +1,81 @@
+package ai
+
+import (
+	"ai-knowledge-base/internal/kb"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// words returns n numbered words.
+func words(n int) string {
+	w := make([]string, n)
+	for i := range w {
+		w[i] = fmt.Sprintf("w%d", i)
+	}
+	return strings.Join(w, " ")
+}
+
+// TestFitPrompt tests filling a prompt with articles in rank order. The fake counts a
+// token per word, and the test template costs 3 words plus 1 per article besides its
+// content.
+func TestFitPrompt(t *testing.T) {
+	prompts, _ := LoadPrompts(fstest.MapFS{
+		"test/answer.tmpl": {Data: []byte(testStreamTemplate)},
+		"test/stream.tmpl": {Data: []byte(testStreamTemplate)},
+	})
+	articles := []kb.Article{
+		{ID: "a1", Content: words(10)},
+		{ID: "a2", Content: words(50)},
+		{ID: "a3", Content: words(10)},
+	}
+	tests := []struct {
+		maxTokens int
+		tokens    int
+		sent      string
+		truncated string
+		dropped   string
+	}{
+		{0, 76, "a1 a2 a3", "", ""},
+		{1000, 76, "a1 a2 a3", "", ""},
+		{45, 45, "a1 a2", "a2", "a3"},
+		{30, 14, "a1", "", "a2 a3"},
+		{2, 3, "", "", "a1 a2 a3"},
+	}
+	for _, tt := range tests {
+		data := PromptData{Query: "why?", Articles: articles}
+		prompt, fitted, budget, err := fitPrompt(NewFake(), prompts["test"].Answer, data, tt.maxTokens)
+		if err != nil {
+			t.Fatalf("fitPrompt(%d) failed: %v", tt.maxTokens, err)
+		}
+		if budget.MaxTokens != tt.maxTokens || budget.EstimatedTokens != tt.tokens || len(strings.Fields(prompt)) != tt.tokens ||
+			strings.Join(budget.Articles, " ") != tt.sent || budget.Truncated != tt.truncated || strings.Join(budget.Dropped, " ") != tt.dropped {
+			t.Errorf("fitPrompt(%d) = %+v for prompt %q", tt.maxTokens, budget, prompt)
+		}
+		if len(fitted.Articles) != len(budget.Articles) {
+			t.Errorf("fitPrompt(%d) returned %d articles, want %d", tt.maxTokens, len(fitted.Articles), len(budget.Articles))
+		}
+		if tt.truncated != "" && fitted.Articles[len(fitted.Articles)-1].Content != words(29)+truncationMarker {
+			t.Errorf("fitPrompt(%d) cut %q", tt.maxTokens, fitted.Articles[len(fitted.Articles)-1].Content)
+		}
+	}
+}
+
+// TestAnswerBudget tests that Answer sends only what fits and reports it.
+func TestAnswerBudget(t *testing.T) {
+	articles := []kb.Article{{ID: "kb-001", Content: words(400)}, {ID: "kb-002", Content: words(400)}}
+	model := &mockLLM{text: `{"ai_summary_answer": "Yes.", "ai_relevant_articles": []}`}
+	response, err := Answer(context.Background(), model, "question", articles, AnswerOptions{MaxPromptTokens: 1000})
+	if err != nil {
+		t.Fatalf("Answer failed: %v", err)
+	}
+	prompt := model.requests[0].Messages[0].Content
+	if budget := response.Budget; budget == nil || budget.Truncated != "kb-002" || budget.EstimatedTokens > 1000 || EstimateTokens(model, prompt) != budget.EstimatedTokens {
+		t.Errorf("Unexpected budget %+v", response.Budget)
+	}
+	if !strings.Contains(prompt, truncationMarker+"\n</article>") {
+		t.Errorf("Expected the second article to be cut in the prompt:\n%s", prompt)
+	}
+}
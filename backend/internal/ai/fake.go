@@ -0,0 +1,177 @@
+package ai
+
+import (
+	"ai-knowledge-base/internal/kb"
+	"context"
+	"encoding/json"
+	"regexp"
+	"strings"
+)
+
+// Fake is an offline LLM for development and end-to-end tests. It reads the articles
+// and question back out of the answer prompt and replies with an extractive answer:
+// the sentence of the top-ranked article that shares the most words with the
+// question, followed by the article ID in brackets. Asked to rewrite a follow-up
+// question, it prefixes it with the previous question of the conversation. The same
+// prompt always yields the same answer.
+type Fake struct{}
+
+// NewFake creates a Fake.
+func NewFake() *Fake {
+	return &Fake{}
+}
+
+// Name implements LLM.
+func (f *Fake) Name() string {
+	return "fake"
+}
+
+// EstimateTokens implements TokenEstimator by counting words, as the Fake's usage does.
+func (f *Fake) EstimateTokens(text string) int {
+	return len(strings.Fields(text))
+}
+
+// FakeNoAnswer is the Fake's answer when the prompt contains no articles.
+const FakeNoAnswer = "I could not find an answer in the knowledge base."
+
+var (
+	fakeQuestionPattern = regexp.MustCompile(`user's question: "(.*)"|(?s)<question>\n(.*?)\n</question>`)
+	fakeArticlePattern  = regexp.MustCompile(`(?s)<article id="([^"]*)">\nTitle: ([^\n]*)\n(.*?)\n</article>`)
+	fakeSentencePattern = regexp.MustCompile(`[^.!?]+[.!?]*`)
+	fakeWordPattern     = regexp.MustCompile(`[\p{L}\p{N}]+`)
+	fakePiecePattern    = regexp.MustCompile(`\s*\S+`)
+	fakeFollowUpPattern = regexp.MustCompile(`(?s)<follow_up>\n(.*?)\n</follow_up>`)
+	fakeUserTurnPattern = regexp.MustCompile(`(?s)<turn role="user">\n(.*?)\n</turn>`)
+)
+
+// Generate implements LLM.
+func (f *Fake) Generate(ctx context.Context, req Request) (*Completion, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var prompt strings.Builder
+	for _, m := range req.Messages {
+		prompt.WriteString(m.Content)
+		prompt.WriteString("\n")
+	}
+	text := prompt.String()
+
+	if m := fakeFollowUpPattern.FindStringSubmatch(text); m != nil {
+		return fakeCompletion(text, fakeRewrite(text, m[1])), nil
+	}
+
+	question := ""
+	if m := fakeQuestionPattern.FindStringSubmatch(text); m != nil {
+		question = m[1] + m[2]
+	}
+
+	response := AIResponse{SummaryAnswer: FakeNoAnswer, RelevantArticles: []kb.Article{}}
+	if article, ok := firstPromptArticle(text); ok {
+		response.SummaryAnswer = bestSentence(article.Content, question) + " [" + article.ID + "]"
+		response.RelevantArticles = []kb.Article{{ID: article.ID, Title: article.Title}}
+	}
+
+	output := response.SummaryAnswer
+	if req.JSON {
+		raw, err := json.Marshal(response)
+		if err != nil {
+			return nil, err
+		}
+		output = string(raw)
+	}
+	return fakeCompletion(text, output), nil
+}
+
+// fakeCompletion returns output as the completion of prompt, counting words as tokens.
+func fakeCompletion(prompt, output string) *Completion {
+	promptTokens := len(strings.Fields(prompt))
+	completionTokens := len(strings.Fields(output))
+	return &Completion{
+		Text:  output,
+		Model: "fake",
+		Usage: Usage{PromptTokens: promptTokens, CompletionTokens: completionTokens, TotalTokens: promptTokens + completionTokens},
+	}
+}
+
+// fakeRewrite answers a RewriteQuery prompt by prefixing the follow-up question with
+// the last question of the conversation.
+func fakeRewrite(prompt, followUp string) string {
+	turns := fakeUserTurnPattern.FindAllStringSubmatch(prompt, -1)
+	if len(turns) == 0 {
+		return followUp
+	}
+	return turns[len(turns)-1][1] + " " + followUp
+}
+
+// Stream implements Streamer by delivering the output of Generate a word at a time.
+func (f *Fake) Stream(ctx context.Context, req Request, onText func(string) error) (*Completion, error) {
+	completion, err := f.Generate(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	for _, piece := range fakePiecePattern.FindAllString(completion.Text, -1) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if err := onText(piece); err != nil {
+			return nil, err
+		}
+	}
+	return completion, nil
+}
+
+// firstPromptArticle parses the first article out of a prompt rendered from the
+// built-in prompt templates: enclosed in <article> tags, or in the "Article ID:"
+// layout of v1.
+func firstPromptArticle(prompt string) (kb.Article, bool) {
+	if m := fakeArticlePattern.FindStringSubmatch(prompt); m != nil {
+		return kb.Article{ID: m[1], Title: m[2], Content: strings.TrimSpace(m[3])}, true
+	}
+	start := strings.Index(prompt, "Article ID: ")
+	if start < 0 {
+		return kb.Article{}, false
+	}
+	block := prompt[start+len("Article ID: "):]
+	if end := strings.Index(block, "\n\nArticle ID: "); end >= 0 {
+		block = block[:end]
+	} else if end := strings.Index(block, "--- END OF ARTICLES ---"); end >= 0 {
+		block = block[:end]
+	}
+
+	id, rest, _ := strings.Cut(block, "\nTitle: ")
+	title, content, _ := strings.Cut(rest, "\nContent: ")
+	return kb.Article{ID: id, Title: title, Content: strings.TrimSpace(content)}, id != ""
+}
+
+// bestSentence returns the sentence of content sharing the most distinct words with
+// the question, preferring earlier sentences on ties.
+func bestSentence(content, question string) string {
+	words := make(map[string]bool)
+	for _, w := range fakeWordPattern.FindAllString(strings.ToLower(question), -1) {
+		words[w] = true
+	}
+
+	best, bestScore := "", -1
+	for _, sentence := range fakeSentencePattern.FindAllString(content, -1) {
+		sentence = strings.TrimSpace(sentence)
+		if sentence == "" {
+			continue
+		}
+		score := 0
+		seen := make(map[string]bool)
+		for _, w := range fakeWordPattern.FindAllString(strings.ToLower(sentence), -1) {
+			if words[w] && !seen[w] {
+				seen[w] = true
+				score++
+			}
+		}
+		if score > bestScore {
+			best, bestScore = sentence, score
+		}
+	}
+	if best == "" {
+		return strings.TrimSpace(content)
+	}
+	return best
+}
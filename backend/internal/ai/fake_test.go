@@ -0,0 +1,55 @@
+package ai
+
+import (
+	"ai-knowledge-base/internal/kb"
+	"context"
+	"testing"
+)
+
+// TestFakeAnswersFromTopArticle tests that the fake picks the best matching sentence of
+// the first article and cites it.
+func TestFakeAnswersFromTopArticle(t *testing.T) {
+	articles := []kb.Article{
+		{ID: "kb-002", Title: "VPN Connection Issues", Content: "Check your internet connection first.\n\nIf the VPN client shows an authentication error, your password may have expired."},
+		{ID: "kb-001", Title: "How to reset your password", Content: "Go to the login page."},
+	}
+
+	response, err := Answer(context.Background(), NewFake(), "why does the vpn say authentication error?", articles, AnswerOptions{})
+	if err != nil {
+		t.Fatalf("Answer failed: %v", err)
+	}
+	want := "If the VPN client shows an authentication error, your password may have expired. [kb-002]"
+	if response.SummaryAnswer != want {
+		t.Errorf("Expected %q, got %q", want, response.SummaryAnswer)
+	}
+	if len(response.RelevantArticles) != 1 || response.RelevantArticles[0].ID != "kb-002" {
+		t.Errorf("Expected kb-002 to be cited, got %+v", response.RelevantArticles)
+	}
+
+	again, _ := Answer(context.Background(), NewFake(), "why does the vpn say authentication error?", articles, AnswerOptions{})
+	if again.SummaryAnswer != response.SummaryAnswer {
+		t.Error("Expected the fake to be deterministic")
+	}
+}
+
+// TestFakeWithoutArticles tests the fake's answer when nothing was retrieved.
+func TestFakeWithoutArticles(t *testing.T) {
+	response, err := Answer(context.Background(), NewFake(), "anything", nil, AnswerOptions{})
+	if err != nil {
+		t.Fatalf("Answer failed: %v", err)
+	}
+	if response.SummaryAnswer != FakeNoAnswer || len(response.RelevantArticles) != 0 {
+		t.Errorf("Unexpected response %+v", response)
+	}
+}
+
+// TestFakeReportsUsage tests that the fake fills in token usage for plain-text requests.
+func TestFakeReportsUsage(t *testing.T) {
+	completion, err := NewFake().Generate(context.Background(), Request{Messages: []Message{{Role: RoleUser, Content: "two words"}}})
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if completion.Text != FakeNoAnswer || completion.Usage.PromptTokens != 2 || completion.Usage.TotalTokens <= 2 {
+		t.Errorf("Unexpected completion %+v", completion)
+	}
+}
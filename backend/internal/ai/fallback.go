@@ -0,0 +1,107 @@
+package ai
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Fallback is an ordered chain of LLMs: each request goes to the first one, and on
+// failure to the next, until one succeeds. Wrapping each LLM in a CircuitBreaker
+// makes a provider that is down fail fast, so the chain moves on without waiting for
+// it. The provider that served a request is reported in Completion.Provider.
+type Fallback struct {
+	LLMs []LLM
+}
+
+// NewFallback creates a chain trying llms in order.
+func NewFallback(llms ...LLM) *Fallback {
+	return &Fallback{LLMs: llms}
+}
+
+// Name implements LLM. It lists the providers of the chain, e.g. "gemini>openai".
+func (f *Fallback) Name() string {
+	names := make([]string, len(f.LLMs))
+	for i, llm := range f.LLMs {
+		names[i] = llm.Name()
+	}
+	return strings.Join(names, ">")
+}
+
+// Close implements io.Closer by closing every LLM of the chain.
+func (f *Fallback) Close() error {
+	var errs []error
+	for _, llm := range f.LLMs {
+		errs = append(errs, Close(llm))
+	}
+	return errors.Join(errs...)
+}
+
+// ModelName implements ModelNamer. It lists the models of the chain in the order of
+// Name, e.g. "gemini-1.5-flash>gpt-4o-mini".
+func (f *Fallback) ModelName() string {
+	models := make([]string, len(f.LLMs))
+	for i, llm := range f.LLMs {
+		models[i] = ModelName(llm)
+	}
+	return strings.Join(models, ">")
+}
+
+// EstimateTokens implements TokenEstimator with the highest estimate of the chain, so
+// that a prompt budgeted with it fits whichever provider serves the request.
+func (f *Fallback) EstimateTokens(text string) int {
+	tokens := 0
+	for _, llm := range f.LLMs {
+		tokens = max(tokens, EstimateTokens(llm, text))
+	}
+	return tokens
+}
+
+// Generate implements LLM.
+func (f *Fallback) Generate(ctx context.Context, req Request) (*Completion, error) {
+	return f.do(ctx, func(llm LLM) (*Completion, bool, error) {
+		completion, err := llm.Generate(ctx, req)
+		return completion, true, err
+	})
+}
+
+// Stream implements Streamer. Text already delivered to onText cannot be taken back,
+// so a provider failing mid-stream ends the request instead of falling back.
+func (f *Fallback) Stream(ctx context.Context, req Request, onText func(string) error) (*Completion, error) {
+	return f.do(ctx, func(llm LLM) (*Completion, bool, error) {
+		delivered := false
+		completion, err := GenerateStream(ctx, llm, req, func(text string) error {
+			delivered = true
+			return onText(text)
+		})
+		return completion, !delivered, err
+	})
+}
+
+// do runs attempt against each LLM in turn. attempt reports whether a failure may
+// fall back to the next LLM.
+func (f *Fallback) do(ctx context.Context, attempt func(llm LLM) (*Completion, bool, error)) (*Completion, error) {
+	if len(f.LLMs) == 0 {
+		return nil, errors.New("no AI providers configured")
+	}
+	var errs []error
+	for i, llm := range f.LLMs {
+		completion, canFallBack, err := attempt(llm)
+		if err == nil {
+			completion.Provider = cmp.Or(completion.Provider, llm.Name())
+			return completion, nil
+		}
+		errs = append(errs, err)
+		if !canFallBack || ctx.Err() != nil || i == len(f.LLMs)-1 {
+			break
+		}
+		log.Printf("AI provider %s failed, falling back to %s: %v", llm.Name(), f.LLMs[i+1].Name(), err)
+	}
+	if len(errs) == 1 {
+		return nil, errs[0]
+	}
+	return nil, fmt.Errorf("all AI providers failed: %w", errors.Join(errs...))
+}
@@ -0,0 +1,92 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// namedLLM gives a scriptedLLM a distinct provider name.
+type namedLLM struct {
+	*scriptedLLM
+	name string
+}
+
+func (n namedLLM) Name() string {
+	return n.name
+}
+
+// TestFallback tests that the chain moves on to the next provider and reports which
+// one served the request.
+func TestFallback(t *testing.T) {
+	primary := namedLLM{&scriptedLLM{errs: []error{&StatusError{StatusCode: 503}}}, "primary"}
+	secondary := namedLLM{&scriptedLLM{}, "secondary"}
+	chain := NewFallback(primary, secondary)
+
+	completion, err := chain.Generate(context.Background(), Request{})
+	if err != nil || completion.Provider != "secondary" {
+		t.Fatalf("Expected the secondary provider to serve the request, got %+v and %v", completion, err)
+	}
+	completion, err = chain.Generate(context.Background(), Request{})
+	if err != nil || completion.Provider != "primary" || secondary.calls != 1 {
+		t.Errorf("Expected the recovered primary to serve the next request, got %+v and %v", completion, err)
+	}
+	if chain.Name() != "primary>secondary" {
+		t.Errorf("Unexpected name %q", chain.Name())
+	}
+}
+
+// TestFallbackAllFail tests the error when every provider fails.
+func TestFallbackAllFail(t *testing.T) {
+	chain := NewFallback(
+		namedLLM{&scriptedLLM{errs: []error{errors.New("first down")}}, "a"},
+		namedLLM{&scriptedLLM{errs: []error{&StatusError{StatusCode: 429}}}, "b"},
+	)
+	_, err := chain.Generate(context.Background(), Request{})
+	if err == nil || !strings.Contains(err.Error(), "first down") || Classify(err) != ErrorRateLimit {
+		t.Errorf("Expected both provider errors, got %v", err)
+	}
+}
+
+// TestFallbackSkipsOpenCircuit tests that a provider whose circuit is open is skipped
+// without being called.
+func TestFallbackSkipsOpenCircuit(t *testing.T) {
+	now := time.Now()
+	down := &scriptedLLM{errs: []error{&StatusError{StatusCode: 500}, &StatusError{StatusCode: 500}, &StatusError{StatusCode: 500}}}
+	primary := newTestBreaker(namedLLM{down, "primary"}, &now)
+	chain := NewFallback(primary, namedLLM{&scriptedLLM{}, "secondary"})
+
+	for i := 0; i < 3; i++ {
+		completion, err := chain.Generate(context.Background(), Request{})
+		if err != nil || completion.Provider != "secondary" {
+			t.Fatalf("Expected the secondary provider to serve request %d, got %v", i, err)
+		}
+	}
+	if down.calls != 2 {
+		t.Errorf("Expected the open circuit to stop calls to the primary after 2 failures, got %d", down.calls)
+	}
+}
+
+// TestFallbackStream tests that streams fall back before their first piece but not after.
+func TestFallbackStream(t *testing.T) {
+	var text string
+	onText := func(piece string) error {
+		text += piece
+		return nil
+	}
+
+	chain := NewFallback(namedLLM{&scriptedLLM{errs: []error{errors.New("down")}}, "a"}, NewFake())
+	completion, err := chain.Stream(context.Background(), Request{}, onText)
+	if err != nil || completion.Provider != "fake" {
+		t.Errorf("Expected the fake to serve the stream, got %+v and %v", completion, err)
+	}
+
+	text = ""
+	secondary := &scriptedLLM{}
+	chain = NewFallback(namedLLM{&scriptedLLM{errs: []error{errors.New("cut off")}, pieces: []string{"partial"}}, "a"}, namedLLM{secondary, "b"})
+	if _, err := chain.Stream(context.Background(), Request{}, onText); err == nil || secondary.calls != 0 || text != "partial" {
+		t.Errorf("Expected no fallback after text was delivered, got %v, %q and %d calls", err, text, secondary.calls)
+	}
+}
@@ -0,0 +1,196 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Defaults for the Gemini provider.
+const (
+	DefaultGeminiBaseURL = "https://generativelanguage.googleapis.com/v1beta"
+	DefaultGeminiModel   = "gemini-1.5-flash"
+)
+
+// Gemini calls the generateContent method of the Google Gemini REST API.
+type Gemini struct {
+	// BaseURL is the API root, e.g. "https://generativelanguage.googleapis.com/v1beta".
+	BaseURL string
+	APIKey  string
+	Model   string
+	client  *http.Client
+}
+
+// NewGemini creates a Gemini client for the given model on the public API.
+func NewGemini(apiKey, model string) *Gemini {
+	return &Gemini{
+		BaseURL: DefaultGeminiBaseURL,
+		APIKey:  apiKey,
+		Model:   model,
+		client:  newHTTPClient(60 * time.Second),
+	}
+}
+
+// Name implements LLM.
+func (g *Gemini) Name() string {
+	return "gemini"
+}
+
+// Close implements io.Closer by closing the idle connections to the provider.
+func (g *Gemini) Close() error {
+	g.client.CloseIdleConnections()
+	return nil
+}
+
+// ModelName implements ModelNamer.
+func (g *Gemini) ModelName() string {
+	return g.Model
+}
+
+// EstimateTokens implements TokenEstimator.
+func (g *Gemini) EstimateTokens(text string) int {
+	return estimateByChars(text, defaultCharsPerToken)
+}
+
+type geminiPart struct {
+	Text string `json:"text"`
+}
+
+type geminiContent struct {
+	Role  string       `json:"role,omitempty"`
+	Parts []geminiPart `json:"parts"`
+}
+
+type geminiGenerationConfig struct {
+	ResponseMIMEType string `json:"responseMimeType,omitempty"`
+	MaxOutputTokens  int    `json:"maxOutputTokens,omitempty"`
+}
+
+type geminiRequest struct {
+	Contents          []geminiContent        `json:"contents"`
+	SystemInstruction *geminiContent         `json:"systemInstruction,omitempty"`
+	GenerationConfig  geminiGenerationConfig `json:"generationConfig"`
+}
+
+type geminiResponse struct {
+	Candidates []struct {
+		Content geminiContent `json:"content"`
+	} `json:"candidates"`
+	UsageMetadata struct {
+		PromptTokenCount     int `json:"promptTokenCount"`
+		CandidatesTokenCount int `json:"candidatesTokenCount"`
+		TotalTokenCount      int `json:"totalTokenCount"`
+	} `json:"usageMetadata"`
+	ModelVersion string `json:"modelVersion"`
+}
+
+// Generate implements LLM.
+func (g *Gemini) Generate(ctx context.Context, req Request) (*Completion, error) {
+	if g.APIKey == "" {
+		return nil, fmt.Errorf("Gemini API key not set")
+	}
+
+	var parsed geminiResponse
+	if err := postJSON(ctx, g.client, g.url("generateContent"), g.headers(), g.request(req), &parsed); err != nil {
+		return nil, err
+	}
+	if len(parsed.Candidates) == 0 || len(parsed.Candidates[0].Content.Parts) == 0 {
+		return nil, fmt.Errorf("received an empty response from AI")
+	}
+
+	completion := &Completion{Model: g.Model}
+	g.accumulate(completion, &parsed)
+	return completion, nil
+}
+
+// Stream implements Streamer using the server-sent events variant of streamGenerateContent.
+func (g *Gemini) Stream(ctx context.Context, req Request, onText func(string) error) (*Completion, error) {
+	if g.APIKey == "" {
+		return nil, fmt.Errorf("Gemini API key not set")
+	}
+
+	body, err := post(ctx, g.client, g.url("streamGenerateContent")+"?alt=sse", g.headers(), g.request(req))
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	completion := &Completion{Model: g.Model}
+	err = readSSE(body, func(data string) error {
+		var chunk geminiResponse
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return fmt.Errorf("failed to parse AI response: %w", err)
+		}
+		if text := g.accumulate(completion, &chunk); text != "" {
+			return onText(text)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if completion.Text == "" {
+		return nil, fmt.Errorf("received an empty response from AI")
+	}
+	return completion, nil
+}
+
+// request converts a Request to the Gemini format. System messages become the system
+// instruction and assistant messages become "model" turns.
+func (g *Gemini) request(req Request) geminiRequest {
+	body := geminiRequest{GenerationConfig: geminiGenerationConfig{MaxOutputTokens: req.MaxTokens}}
+	if req.JSON {
+		body.GenerationConfig.ResponseMIMEType = "application/json"
+	}
+	var system []geminiPart
+	for _, m := range req.Messages {
+		switch m.Role {
+		case RoleSystem:
+			system = append(system, geminiPart{Text: m.Content})
+		case RoleAssistant:
+			body.Contents = append(body.Contents, geminiContent{Role: "model", Parts: []geminiPart{{Text: m.Content}}})
+		default:
+			body.Contents = append(body.Contents, geminiContent{Role: "user", Parts: []geminiPart{{Text: m.Content}}})
+		}
+	}
+	if len(system) > 0 {
+		body.SystemInstruction = &geminiContent{Parts: system}
+	}
+	return body
+}
+
+func (g *Gemini) url(method string) string {
+	return fmt.Sprintf("%s/models/%s:%s", strings.TrimSuffix(g.BaseURL, "/"), g.Model, method)
+}
+
+// headers carries the API key. It goes in a header rather than the URL so that it
+// never appears in errors.
+func (g *Gemini) headers() map[string]string {
+	return map[string]string{"x-goog-api-key": g.APIKey}
+}
+
+// accumulate adds a (possibly partial) response to completion and returns its text.
+// Usage metadata is cumulative, so the latest value wins.
+func (g *Gemini) accumulate(completion *Completion, resp *geminiResponse) string {
+	var text strings.Builder
+	if len(resp.Candidates) > 0 {
+		for _, part := range resp.Candidates[0].Content.Parts {
+			text.WriteString(part.Text)
+		}
+	}
+	completion.Text += text.String()
+	if resp.ModelVersion != "" {
+		completion.Model = resp.ModelVersion
+	}
+	if u := resp.UsageMetadata; u.TotalTokenCount > 0 {
+		completion.Usage = Usage{
+			PromptTokens:     u.PromptTokenCount,
+			CompletionTokens: u.CandidatesTokenCount,
+			TotalTokens:      u.TotalTokenCount,
+		}
+	}
+	return text.String()
+}
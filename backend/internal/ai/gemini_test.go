@@ -0,0 +1,131 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestGemini tests the request format and response parsing against a stand-in for the Gemini REST API.
+func TestGemini(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1beta/models/test-model:generateContent" {
+			t.Errorf("Unexpected path %s", r.URL.Path)
+		}
+		if key := r.Header.Get("x-goog-api-key"); key != "test-key" {
+			t.Errorf("Unexpected API key %q", key)
+		}
+
+		var req struct {
+			Contents []struct {
+				Role  string `json:"role"`
+				Parts []struct {
+					Text string `json:"text"`
+				} `json:"parts"`
+			} `json:"contents"`
+			SystemInstruction *struct {
+				Parts []struct {
+					Text string `json:"text"`
+				} `json:"parts"`
+			} `json:"systemInstruction"`
+			GenerationConfig struct {
+				ResponseMimeType string `json:"responseMimeType"`
+			} `json:"generationConfig"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		if len(req.Contents) != 3 || req.Contents[1].Role != "model" || req.Contents[2].Parts[0].Text != "second question" {
+			t.Errorf("Unexpected contents %+v", req.Contents)
+		}
+		if req.SystemInstruction == nil || req.SystemInstruction.Parts[0].Text != "be brief" {
+			t.Errorf("Unexpected system instruction %+v", req.SystemInstruction)
+		}
+		if req.GenerationConfig.ResponseMimeType != "application/json" {
+			t.Errorf("Expected JSON mode, got %+v", req.GenerationConfig)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{
+			"candidates": [{"content": {"role": "model", "parts": [{"text": "{\"ok\": "}, {"text": "true}"}]}}],
+			"usageMetadata": {"promptTokenCount": 12, "candidatesTokenCount": 4, "totalTokenCount": 16}
+		}`))
+	}))
+	defer server.Close()
+
+	gemini := NewGemini("test-key", "test-model")
+	gemini.BaseURL = server.URL + "/v1beta"
+	completion, err := gemini.Generate(context.Background(), Request{
+		Messages: []Message{
+			{Role: RoleSystem, Content: "be brief"},
+			{Role: RoleUser, Content: "first question"},
+			{Role: RoleAssistant, Content: "first answer"},
+			{Role: RoleUser, Content: "second question"},
+		},
+		JSON: true,
+	})
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if completion.Text != `{"ok": true}` {
+		t.Errorf("Unexpected text %q", completion.Text)
+	}
+	if completion.Model != "test-model" {
+		t.Errorf("Expected the configured model, got %q", completion.Model)
+	}
+	if completion.Usage != (Usage{PromptTokens: 12, CompletionTokens: 4, TotalTokens: 16}) {
+		t.Errorf("Unexpected usage %+v", completion.Usage)
+	}
+}
+
+// TestGeminiWithoutAPIKey tests that a missing key fails before any request is made.
+func TestGeminiWithoutAPIKey(t *testing.T) {
+	_, err := NewGemini("", DefaultGeminiModel).Generate(context.Background(), Request{Messages: []Message{{Role: RoleUser, Content: "hi"}}})
+	if err == nil || !strings.Contains(err.Error(), "API key") {
+		t.Errorf("Expected a missing API key error, got %v", err)
+	}
+}
+
+// TestGeminiError tests that API errors surface with their status and message.
+func TestGeminiError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error": {"message": "quota exceeded"}}`, http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	gemini := NewGemini("test-key", "test-model")
+	gemini.BaseURL = server.URL
+	_, err := gemini.Generate(context.Background(), Request{Messages: []Message{{Role: RoleUser, Content: "hi"}}})
+	if err == nil || !strings.Contains(err.Error(), "429") || !strings.Contains(err.Error(), "quota exceeded") {
+		t.Errorf("Expected status error with body, got %v", err)
+	}
+}
+
+// TestGeminiStream tests parsing the server-sent events of streamGenerateContent.
+func TestGeminiStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/models/test-model:streamGenerateContent" || r.URL.Query().Get("alt") != "sse" {
+			t.Errorf("Unexpected URL %s", r.URL)
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: {\"candidates\": [{\"content\": {\"parts\": [{\"text\": \"Hello\"}]}}]}\r\n\r\n"))
+		w.Write([]byte("data: {\"candidates\": [{\"content\": {\"parts\": [{\"text\": \" world\"}]}}]," +
+			"\"usageMetadata\": {\"promptTokenCount\": 3, \"candidatesTokenCount\": 2, \"totalTokenCount\": 5}}\r\n\r\n"))
+	}))
+	defer server.Close()
+
+	gemini := NewGemini("test-key", "test-model")
+	gemini.BaseURL = server.URL
+	var pieces []string
+	completion, err := gemini.Stream(context.Background(), Request{Messages: []Message{{Role: RoleUser, Content: "hi"}}}, func(text string) error {
+		pieces = append(pieces, text)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+	if strings.Join(pieces, "|") != "Hello| world" || completion.Text != "Hello world" || completion.Usage.TotalTokens != 5 {
+		t.Errorf("Unexpected pieces %q and completion %+v", pieces, completion)
+	}
+}
@@ -0,0 +1,265 @@
+package ai
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Message roles.
+const (
+	RoleSystem    = "system"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
+
+// Message is one turn of a conversation with an LLM.
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// Request is a provider-neutral generation request.
+type Request struct {
+	Messages []Message
+	// JSON asks the provider to constrain its output to a JSON object.
+	JSON bool
+	// MaxTokens caps the length of the output. Zero leaves it to the provider.
+	MaxTokens int
+}
+
+// Usage reports the tokens consumed by a request, as counted by the provider.
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// Completion is the output of an LLM.
+type Completion struct {
+	Text string
+	// Provider is the name of the LLM that produced the text. When a Fallback chain
+	// is used, it names the provider that actually served the request.
+	Provider string
+	// Model is the model that produced the text, as reported by the provider when available.
+	Model string
+	Usage Usage
+}
+
+// LLM is a chat model. Implementations exist for Gemini, OpenAI-compatible
+// chat-completions APIs and Ollama, selected by the LLM_PROVIDER setting.
+//
+// Implementations are safe for concurrent use and keep their connections to the
+// provider alive between requests, so the server creates one at startup, shares it
+// across requests and releases it with Close on shutdown. Their exported fields must
+// not be changed once the LLM is in use.
+type LLM interface {
+	// Name identifies the provider, e.g. "gemini" or "ollama".
+	Name() string
+	Generate(ctx context.Context, req Request) (*Completion, error)
+}
+
+// ModelNamer is implemented by LLMs that know which model they request.
+type ModelNamer interface {
+	ModelName() string
+}
+
+// ModelName returns the model llm requests, or "" if it does not implement ModelNamer.
+func ModelName(llm LLM) string {
+	if namer, ok := llm.(ModelNamer); ok {
+		return namer.ModelName()
+	}
+	return ""
+}
+
+// JSONOptions controls how GenerateJSON checks and repairs model output.
+type JSONOptions struct {
+	// Schema, when set, is what the decoded output must match.
+	Schema *Schema
+	// MaxRepairs is how many times the model is asked to correct output that cannot be
+	// parsed or does not match the schema before giving up.
+	MaxRepairs int
+}
+
+// GenerateJSON runs a JSON-mode request and decodes the output into v. The output is
+// read tolerantly: text around the JSON object such as a markdown code fence, trailing
+// commas and output truncated mid-object are all accepted. If it still cannot be
+// parsed or does not match opts.Schema, the model is shown its reply and the problem
+// and asked for a corrected one, up to opts.MaxRepairs times. The returned usage
+// covers every attempt.
+func GenerateJSON(ctx context.Context, llm LLM, req Request, opts JSONOptions, v interface{}) (*Completion, error) {
+	req.JSON = true
+	var usage Usage
+	for repairs := 0; ; repairs++ {
+		completion, err := llm.Generate(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		completion.Provider = cmp.Or(completion.Provider, llm.Name())
+		usage = usage.Add(completion.Usage)
+		completion.Usage = usage
+		if completion.Text == "" {
+			return completion, fmt.Errorf("received an empty response from AI")
+		}
+
+		err = decodeJSON(completion.Text, opts.Schema, v)
+		if err == nil {
+			return completion, nil
+		}
+		if repairs >= opts.MaxRepairs || ctx.Err() != nil {
+			return completion, err
+		}
+		log.Printf("Asking %s to repair its JSON output: %v", completion.Provider, err)
+		req.Messages = append(req.Messages[:len(req.Messages):len(req.Messages)],
+			Message{Role: RoleAssistant, Content: completion.Text},
+			Message{Role: RoleUser, Content: repairPrompt(err, opts.Schema)},
+		)
+	}
+}
+
+// decodeJSON parses model output into v after checking it against schema, if set.
+func decodeJSON(text string, schema *Schema, v interface{}) error {
+	cleaned := []byte(cleanAIResponse(text))
+	if schema != nil {
+		var decoded interface{}
+		if err := json.Unmarshal(cleaned, &decoded); err != nil {
+			return fmt.Errorf("failed to parse AI response: %w", err)
+		}
+		if err := schema.Validate(decoded); err != nil {
+			return fmt.Errorf("AI response does not match the schema: %w", err)
+		}
+	}
+	if err := json.Unmarshal(cleaned, v); err != nil {
+		return fmt.Errorf("failed to parse AI response: %w", err)
+	}
+	return nil
+}
+
+// repairPrompt asks the model to correct a reply that failed with err.
+func repairPrompt(err error, schema *Schema) string {
+	prompt := fmt.Sprintf("Your previous reply could not be used: %v. Reply again with only a single, complete JSON object", err)
+	if schema != nil {
+		return prompt + " that matches this JSON Schema, with no other text:\n" + schema.String()
+	}
+	return prompt + ", with no other text."
+}
+
+// Add returns the sum of two usages.
+func (u Usage) Add(other Usage) Usage {
+	return Usage{
+		PromptTokens:     u.PromptTokens + other.PromptTokens,
+		CompletionTokens: u.CompletionTokens + other.CompletionTokens,
+		TotalTokens:      u.TotalTokens + other.TotalTokens,
+	}
+}
+
+// Close releases the resources held by llm, such as idle connections to the provider,
+// if it holds any. The LLM must not be used afterwards.
+func Close(llm LLM) error {
+	if closer, ok := llm.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// maxIdleConnsPerHost is how many idle connections an LLM keeps to its provider. All of
+// an LLM's requests go to one host, so the net/http default of 2 would make concurrent
+// searches open and close connections constantly.
+const maxIdleConnsPerHost = 32
+
+// newHTTPClient creates an HTTP client with its own connection pool, so that an LLM
+// can release its connections on Close without affecting other clients. The client
+// has no overall timeout, which would cut off long streamed answers: requests are
+// bounded by their context, and a provider that accepts the connection but does not
+// start responding within headerTimeout fails fast.
+func newHTTPClient(headerTimeout time.Duration) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConnsPerHost = maxIdleConnsPerHost
+	transport.ResponseHeaderTimeout = headerTimeout
+	return &http.Client{Transport: transport}
+}
+
+// postJSON sends body as JSON with the given extra headers and decodes a JSON response
+// into v. Non-200 responses become errors that include the start of the response body.
+func postJSON(ctx context.Context, client *http.Client, url string, headers map[string]string, body, v interface{}) error {
+	respBody, err := post(ctx, client, url, headers, body)
+	if err != nil {
+		return err
+	}
+	defer respBody.Close()
+
+	if err := json.NewDecoder(respBody).Decode(v); err != nil {
+		return fmt.Errorf("failed to parse AI response: %w", err)
+	}
+	return nil
+}
+
+// post sends body as JSON with the given extra headers and returns the body of a 200
+// response, which the caller must close. Other statuses become errors that include
+// the start of the response body.
+func post(ctx context.Context, client *http.Client, url string, headers map[string]string, body interface{}) (io.ReadCloser, error) {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("AI request failed: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, &StatusError{
+			StatusCode: resp.StatusCode,
+			Message:    strings.TrimSpace(string(msg)),
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+		}
+	}
+	return resp.Body, nil
+}
+
+// StatusError is returned when a provider answers with a non-200 status.
+type StatusError struct {
+	StatusCode int
+	// Message is the start of the response body.
+	Message string
+	// RetryAfter is how long the provider asked us to wait before retrying, from the
+	// Retry-After header. Zero means no hint.
+	RetryAfter time.Duration
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("AI request failed with status %d: %s", e.StatusCode, e.Message)
+}
+
+// parseRetryAfter parses a Retry-After header, which is either a number of seconds or
+// an HTTP date. Missing, invalid and past values yield zero.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return max(time.Duration(seconds)*time.Second, 0)
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(date.Sub(now), 0)
+	}
+	return 0
+}
@@ -0,0 +1,139 @@
+package ai
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// newCountingGeminiServer starts a stand-in Gemini API that counts the TCP connections
+// opened to it.
+func newCountingGeminiServer(tb testing.TB) (*httptest.Server, *atomic.Int64) {
+	var conns atomic.Int64
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"candidates": [{"content": {"parts": [{"text": "ok"}]}}]}`))
+	}))
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	server.Start()
+	tb.Cleanup(server.Close)
+	return server, &conns
+}
+
+// newTestGemini creates a Gemini client for a stand-in server.
+func newTestGemini(baseURL string) *Gemini {
+	gemini := NewGemini("test-key", "test-model")
+	gemini.BaseURL = baseURL
+	return gemini
+}
+
+var benchmarkRequest = Request{Messages: []Message{{Role: RoleUser, Content: "hi"}}}
+
+// TestLLMConcurrentUse tests that one provider can serve concurrent requests over a
+// pool of reused connections.
+func TestLLMConcurrentUse(t *testing.T) {
+	server, conns := newCountingGeminiServer(t)
+	gemini := newTestGemini(server.URL)
+	defer Close(gemini)
+
+	const workers, requests = 8, 10
+	var wg sync.WaitGroup
+	var failures atomic.Int64
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < requests; j++ {
+				completion, err := gemini.Generate(context.Background(), benchmarkRequest)
+				if err != nil || completion.Text != "ok" {
+					failures.Add(1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if failures.Load() != 0 {
+		t.Errorf("%d of %d requests failed", failures.Load(), workers*requests)
+	}
+	// The transport may dial a spare connection while another is being returned to
+	// the pool, so only check that connections are reused rather than one per request.
+	if n := conns.Load(); n > workers*requests/4 {
+		t.Errorf("Expected connections to be reused, got %d for %d requests", n, workers*requests)
+	}
+}
+
+// TestClose tests that Close releases providers' connections and ignores LLMs that
+// hold none.
+func TestClose(t *testing.T) {
+	server, conns := newCountingGeminiServer(t)
+	gemini := newTestGemini(server.URL)
+	if _, err := gemini.Generate(context.Background(), benchmarkRequest); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if err := Close(gemini); err != nil {
+		t.Errorf("Close failed: %v", err)
+	}
+	if _, err := gemini.Generate(context.Background(), benchmarkRequest); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if n := conns.Load(); n != 2 {
+		t.Errorf("Expected Close to drop the idle connection, got %d connections", n)
+	}
+
+	if err := Close(NewFake()); err != nil {
+		t.Errorf("Close of an LLM without resources failed: %v", err)
+	}
+}
+
+// BenchmarkGenerateSharedClient measures requests through one long-lived provider, as
+// the server makes them. Connections are reused, so conns/op approaches zero.
+func BenchmarkGenerateSharedClient(b *testing.B) {
+	server, conns := newCountingGeminiServer(b)
+	gemini := newTestGemini(server.URL)
+	defer Close(gemini)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := gemini.Generate(context.Background(), benchmarkRequest); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(conns.Load())/float64(b.N), "conns/op")
+}
+
+// BenchmarkGenerateClientPerRequest measures the old approach of constructing a
+// client for every search, which opens a new connection each time.
+func BenchmarkGenerateClientPerRequest(b *testing.B) {
+	server, conns := newCountingGeminiServer(b)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		gemini := newTestGemini(server.URL)
+		if _, err := gemini.Generate(context.Background(), benchmarkRequest); err != nil {
+			b.Fatal(err)
+		}
+		Close(gemini)
+	}
+	b.ReportMetric(float64(conns.Load())/float64(b.N), "conns/op")
+}
+
+// TestModelName tests that wrappers report the model of the LLM they wrap and that a
+// fallback chain lists the models of its providers.
+func TestModelName(t *testing.T) {
+	gemini := NewGemini("key", "gemini-1.5-pro")
+	wrapped := NewMetered(NewCircuitBreaker(NewRetry(gemini, RetryPolicy{}), BreakerPolicy{}))
+	if got := ModelName(wrapped); got != "gemini-1.5-pro" {
+		t.Errorf("ModelName(wrapped) = %q, want gemini-1.5-pro", got)
+	}
+	if got := ModelName(NewFallback(wrapped, NewOpenAI("", "", "gpt-4o-mini"), NewFake())); got != "gemini-1.5-pro>gpt-4o-mini>" {
+		t.Errorf("ModelName(fallback) = %q", got)
+	}
+}
@@ -0,0 +1,118 @@
+package ai
+
+import (
+	"cmp"
+	"context"
+	"strings"
+	"sync"
+)
+
+// UsageRecord is the usage of one request to a model.
+type UsageRecord struct {
+	Provider string
+	Model    string
+	Usage    Usage
+	// Estimated reports that the provider did not count the tokens, so they were
+	// estimated from the request and the output.
+	Estimated bool
+}
+
+// UsageRecorder collects the usage of the requests made by a Metered LLM with a
+// context carrying it. It is safe for concurrent use.
+type UsageRecorder struct {
+	mu      sync.Mutex
+	records []UsageRecord
+}
+
+// Records returns the usage recorded so far, in request order.
+func (r *UsageRecorder) Records() []UsageRecord {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]UsageRecord(nil), r.records...)
+}
+
+func (r *UsageRecorder) add(record UsageRecord) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.records = append(r.records, record)
+}
+
+type usageRecorderKey struct{}
+
+// WithUsageRecorder returns a context whose requests through a Metered LLM are
+// recorded in r.
+func WithUsageRecorder(ctx context.Context, r *UsageRecorder) context.Context {
+	return context.WithValue(ctx, usageRecorderKey{}, r)
+}
+
+// Metered wraps an LLM to record the usage of each successful request in the
+// UsageRecorder of the request's context, if it has one. Wrapping the whole fallback
+// chain records the provider and model that actually served each request.
+type Metered struct {
+	LLM LLM
+}
+
+// NewMetered wraps llm with usage recording.
+func NewMetered(llm LLM) *Metered {
+	return &Metered{LLM: llm}
+}
+
+// Name implements LLM by returning the name of the wrapped LLM.
+func (m *Metered) Name() string {
+	return m.LLM.Name()
+}
+
+// Close implements io.Closer by closing the wrapped LLM.
+func (m *Metered) Close() error {
+	return Close(m.LLM)
+}
+
+// ModelName implements ModelNamer with the wrapped LLM's model.
+func (m *Metered) ModelName() string {
+	return ModelName(m.LLM)
+}
+
+// EstimateTokens implements TokenEstimator with the wrapped LLM's estimate.
+func (m *Metered) EstimateTokens(text string) int {
+	return EstimateTokens(m.LLM, text)
+}
+
+// Generate implements LLM.
+func (m *Metered) Generate(ctx context.Context, req Request) (*Completion, error) {
+	completion, err := m.LLM.Generate(ctx, req)
+	if err == nil {
+		m.record(ctx, req, completion)
+	}
+	return completion, err
+}
+
+// Stream implements Streamer.
+func (m *Metered) Stream(ctx context.Context, req Request, onText func(string) error) (*Completion, error) {
+	completion, err := GenerateStream(ctx, m.LLM, req, onText)
+	if err == nil {
+		m.record(ctx, req, completion)
+	}
+	return completion, err
+}
+
+// record adds the usage of a completed request to the context's recorder, estimating
+// it if the provider did not report it.
+func (m *Metered) record(ctx context.Context, req Request, completion *Completion) {
+	recorder, ok := ctx.Value(usageRecorderKey{}).(*UsageRecorder)
+	if !ok {
+		return
+	}
+	record := UsageRecord{Provider: cmp.Or(completion.Provider, m.LLM.Name()), Model: completion.Model, Usage: completion.Usage}
+	if record.Usage.TotalTokens == 0 {
+		var prompt strings.Builder
+		for _, message := range req.Messages {
+			prompt.WriteString(message.Content)
+			prompt.WriteString("\n")
+		}
+		record.Usage.PromptTokens = m.EstimateTokens(prompt.String())
+		record.Usage.CompletionTokens = m.EstimateTokens(completion.Text)
+		record.Usage.TotalTokens = record.Usage.PromptTokens + record.Usage.CompletionTokens
+		record.Estimated = true
+	}
+	recorder.add(record)
+}
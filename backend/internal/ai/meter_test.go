@@ -0,0 +1,64 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// silentLLM replies without reporting usage, as some OpenAI-compatible servers do.
+type silentLLM struct{}
+
+func (silentLLM) Name() string { return "silent" }
+
+func (silentLLM) Generate(ctx context.Context, req Request) (*Completion, error) {
+	return &Completion{Text: "three word reply", Model: "silent-1"}, nil
+}
+
+// TestMetered tests that requests made with a recorder in the context are recorded,
+// with the provider's counts or an estimate, and that failures and requests without a
+// recorder are not.
+func TestMetered(t *testing.T) {
+	recorder := &UsageRecorder{}
+	ctx := WithUsageRecorder(context.Background(), recorder)
+	request := Request{Messages: []Message{{Role: RoleUser, Content: "how do I reset my password"}}}
+
+	fake := NewMetered(NewFake())
+	if _, err := fake.Generate(ctx, request); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if _, err := fake.Stream(ctx, request, func(string) error { return nil }); err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+	if _, err := NewMetered(silentLLM{}).Generate(ctx, request); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	NewMetered(&mockLLM{err: errors.New("down")}).Generate(ctx, request)
+	fake.Generate(context.Background(), request)
+
+	records := recorder.Records()
+	if len(records) != 3 {
+		t.Fatalf("Expected 3 records, got %+v", records)
+	}
+	for _, r := range records[:2] {
+		if r.Provider != "fake" || r.Model != "fake" || r.Usage.PromptTokens == 0 || r.Estimated {
+			t.Errorf("Expected the fake's own counts, got %+v", r)
+		}
+	}
+	silent := records[2]
+	want := Usage{PromptTokens: 7, CompletionTokens: 4, TotalTokens: 11} // 27 and 16 characters
+	if silent.Provider != "silent" || silent.Model != "silent-1" || silent.Usage != want || !silent.Estimated {
+		t.Errorf("Expected estimated usage %+v, got %+v", want, silent)
+	}
+}
+
+// TestMeteredFallback tests that the provider that served a request is recorded.
+func TestMeteredFallback(t *testing.T) {
+	recorder := &UsageRecorder{}
+	llm := NewMetered(NewFallback(&mockLLM{err: errors.New("down")}, NewFake()))
+	llm.Generate(WithUsageRecorder(context.Background(), recorder), Request{Messages: []Message{{Role: RoleUser, Content: "hi"}}})
+
+	if records := recorder.Records(); len(records) != 1 || records[0].Provider != "fake" {
+		t.Errorf("Expected one record for the fallback provider, got %+v", records)
+	}
+}
@@ -0,0 +1,140 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Defaults for the Ollama provider.
+const (
+	DefaultOllamaBaseURL = "http://localhost:11434"
+	DefaultOllamaModel   = "llama3.1"
+)
+
+// Ollama calls the native /api/chat endpoint of an Ollama server.
+type Ollama struct {
+	// BaseURL is the server root, e.g. "http://localhost:11434".
+	BaseURL string
+	Model   string
+	client  *http.Client
+}
+
+// NewOllama creates a client for the given Ollama server and model. Local models can
+// be slow to load, so the timeout is generous.
+func NewOllama(baseURL, model string) *Ollama {
+	return &Ollama{
+		BaseURL: strings.TrimSuffix(baseURL, "/"),
+		Model:   model,
+		client:  newHTTPClient(5 * time.Minute),
+	}
+}
+
+// Name implements LLM.
+func (o *Ollama) Name() string {
+	return "ollama"
+}
+
+// Close implements io.Closer by closing the idle connections to the provider.
+func (o *Ollama) Close() error {
+	o.client.CloseIdleConnections()
+	return nil
+}
+
+// ModelName implements ModelNamer.
+func (o *Ollama) ModelName() string {
+	return o.Model
+}
+
+// EstimateTokens implements TokenEstimator.
+func (o *Ollama) EstimateTokens(text string) int {
+	return estimateByChars(text, llamaCharsPerToken)
+}
+
+type ollamaChatRequest struct {
+	Model    string         `json:"model"`
+	Messages []Message      `json:"messages"`
+	Stream   bool           `json:"stream"`
+	Format   string         `json:"format,omitempty"`
+	Options  map[string]int `json:"options,omitempty"`
+}
+
+type ollamaChatResponse struct {
+	Model           string  `json:"model"`
+	Message         Message `json:"message"`
+	Done            bool    `json:"done"`
+	PromptEvalCount int     `json:"prompt_eval_count"`
+	EvalCount       int     `json:"eval_count"`
+}
+
+// Generate implements LLM.
+func (o *Ollama) Generate(ctx context.Context, req Request) (*Completion, error) {
+	var parsed ollamaChatResponse
+	if err := postJSON(ctx, o.client, o.BaseURL+"/api/chat", nil, o.request(req), &parsed); err != nil {
+		return nil, err
+	}
+	completion := &Completion{}
+	accumulateOllama(completion, &parsed)
+	return completion, nil
+}
+
+// Stream implements Streamer. Ollama streams newline-delimited JSON objects, the last
+// of which has done set and carries the token counts.
+func (o *Ollama) Stream(ctx context.Context, req Request, onText func(string) error) (*Completion, error) {
+	body := o.request(req)
+	body.Stream = true
+
+	respBody, err := post(ctx, o.client, o.BaseURL+"/api/chat", nil, body)
+	if err != nil {
+		return nil, err
+	}
+	defer respBody.Close()
+
+	completion := &Completion{}
+	err = readLines(respBody, func(line string) (bool, error) {
+		var chunk ollamaChatResponse
+		if err := json.Unmarshal([]byte(line), &chunk); err != nil {
+			return false, fmt.Errorf("failed to parse AI response: %w", err)
+		}
+		accumulateOllama(completion, &chunk)
+		if chunk.Message.Content != "" {
+			if err := onText(chunk.Message.Content); err != nil {
+				return false, err
+			}
+		}
+		return !chunk.Done, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return completion, nil
+}
+
+func (o *Ollama) request(req Request) ollamaChatRequest {
+	body := ollamaChatRequest{Model: o.Model, Messages: req.Messages}
+	if req.JSON {
+		body.Format = "json"
+	}
+	if req.MaxTokens > 0 {
+		body.Options = map[string]int{"num_predict": req.MaxTokens}
+	}
+	return body
+}
+
+// accumulateOllama adds a (possibly partial) response to completion.
+func accumulateOllama(completion *Completion, resp *ollamaChatResponse) {
+	completion.Text += resp.Message.Content
+	if resp.Model != "" {
+		completion.Model = resp.Model
+	}
+	if resp.Done {
+		completion.Usage = Usage{
+			PromptTokens:     resp.PromptEvalCount,
+			CompletionTokens: resp.EvalCount,
+			TotalTokens:      resp.PromptEvalCount + resp.EvalCount,
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestOllama tests the request format and response parsing against a stand-in Ollama server.
+func TestOllama(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/chat" {
+			t.Errorf("Unexpected path %s", r.URL.Path)
+		}
+
+		var req ollamaChatRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.Model != "llama-test" || req.Stream || req.Format != "json" || len(req.Messages) != 1 {
+			t.Errorf("Unexpected request %+v", req)
+		}
+
+		w.Write([]byte(`{
+			"model": "llama-test",
+			"message": {"role": "assistant", "content": "{\"ok\": true}"},
+			"done": true,
+			"prompt_eval_count": 30,
+			"eval_count": 7
+		}`))
+	}))
+	defer server.Close()
+
+	completion, err := NewOllama(server.URL, "llama-test").Generate(context.Background(), Request{
+		Messages: []Message{{Role: RoleUser, Content: "question"}},
+		JSON:     true,
+	})
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if completion.Text != `{"ok": true}` {
+		t.Errorf("Unexpected text %q", completion.Text)
+	}
+	if completion.Usage != (Usage{PromptTokens: 30, CompletionTokens: 7, TotalTokens: 37}) {
+		t.Errorf("Unexpected usage %+v", completion.Usage)
+	}
+}
+
+// TestOllamaStream tests parsing Ollama's newline-delimited JSON stream.
+func TestOllamaStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ollamaChatRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if !req.Stream {
+			t.Errorf("Expected a streaming request, got %+v", req)
+		}
+		w.Write([]byte(`{"model":"llama-test","message":{"role":"assistant","content":"Hi"},"done":false}` + "\n"))
+		w.Write([]byte(`{"model":"llama-test","message":{"role":"assistant","content":" there"},"done":false}` + "\n"))
+		w.Write([]byte(`{"model":"llama-test","message":{"role":"assistant","content":""},"done":true,"prompt_eval_count":9,"eval_count":2}` + "\n"))
+	}))
+	defer server.Close()
+
+	var pieces []string
+	completion, err := NewOllama(server.URL, "llama-test").Stream(context.Background(), Request{Messages: []Message{{Role: RoleUser, Content: "hi"}}}, func(text string) error {
+		pieces = append(pieces, text)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+	if len(pieces) != 2 || completion.Text != "Hi there" || completion.Usage.TotalTokens != 11 {
+		t.Errorf("Unexpected pieces %q and completion %+v", pieces, completion)
+	}
+}
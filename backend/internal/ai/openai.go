@@ -0,0 +1,157 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Defaults for the OpenAI provider.
+const (
+	DefaultOpenAIBaseURL = "https://api.openai.com/v1"
+	DefaultOpenAIModel   = "gpt-4o-mini"
+)
+
+// OpenAI calls an OpenAI-compatible /chat/completions endpoint. Besides OpenAI itself
+// this covers vLLM, LocalAI, LM Studio and most hosted gateways.
+type OpenAI struct {
+	// BaseURL is the API root, e.g. "https://api.openai.com/v1".
+	BaseURL string
+	APIKey  string
+	Model   string
+	client  *http.Client
+}
+
+// NewOpenAI creates a chat-completions client for the given endpoint and model.
+func NewOpenAI(baseURL, apiKey, model string) *OpenAI {
+	return &OpenAI{
+		BaseURL: strings.TrimSuffix(baseURL, "/"),
+		APIKey:  apiKey,
+		Model:   model,
+		client:  newHTTPClient(60 * time.Second),
+	}
+}
+
+// Name implements LLM.
+func (o *OpenAI) Name() string {
+	return "openai"
+}
+
+// Close implements io.Closer by closing the idle connections to the provider.
+func (o *OpenAI) Close() error {
+	o.client.CloseIdleConnections()
+	return nil
+}
+
+// ModelName implements ModelNamer.
+func (o *OpenAI) ModelName() string {
+	return o.Model
+}
+
+// EstimateTokens implements TokenEstimator.
+func (o *OpenAI) EstimateTokens(text string) int {
+	return estimateByChars(text, defaultCharsPerToken)
+}
+
+type chatCompletionRequest struct {
+	Model          string          `json:"model"`
+	Messages       []Message       `json:"messages"`
+	MaxTokens      int             `json:"max_tokens,omitempty"`
+	ResponseFormat *responseFormat `json:"response_format,omitempty"`
+	Stream         bool            `json:"stream,omitempty"`
+	StreamOptions  *streamOptions  `json:"stream_options,omitempty"`
+}
+
+type streamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+type responseFormat struct {
+	Type string `json:"type"`
+}
+
+type chatCompletionResponse struct {
+	Model   string `json:"model"`
+	Choices []struct {
+		Message Message `json:"message"`
+	} `json:"choices"`
+	Usage Usage `json:"usage"`
+}
+
+type chatCompletionChunk struct {
+	Model   string `json:"model"`
+	Choices []struct {
+		Delta Message `json:"delta"`
+	} `json:"choices"`
+	Usage *Usage `json:"usage"`
+}
+
+// Generate implements LLM.
+func (o *OpenAI) Generate(ctx context.Context, req Request) (*Completion, error) {
+	var parsed chatCompletionResponse
+	if err := postJSON(ctx, o.client, o.BaseURL+"/chat/completions", o.headers(), o.request(req), &parsed); err != nil {
+		return nil, err
+	}
+	if len(parsed.Choices) == 0 {
+		return nil, fmt.Errorf("received an empty response from AI")
+	}
+	return &Completion{Text: parsed.Choices[0].Message.Content, Model: parsed.Model, Usage: parsed.Usage}, nil
+}
+
+// Stream implements Streamer. Usage is requested in the final chunk; servers that
+// ignore stream_options leave it zero.
+func (o *OpenAI) Stream(ctx context.Context, req Request, onText func(string) error) (*Completion, error) {
+	body := o.request(req)
+	body.Stream = true
+	body.StreamOptions = &streamOptions{IncludeUsage: true}
+
+	respBody, err := post(ctx, o.client, o.BaseURL+"/chat/completions", o.headers(), body)
+	if err != nil {
+		return nil, err
+	}
+	defer respBody.Close()
+
+	completion := &Completion{Model: o.Model}
+	err = readSSE(respBody, func(data string) error {
+		var chunk chatCompletionChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return fmt.Errorf("failed to parse AI response: %w", err)
+		}
+		if chunk.Model != "" {
+			completion.Model = chunk.Model
+		}
+		if chunk.Usage != nil {
+			completion.Usage = *chunk.Usage
+		}
+		if len(chunk.Choices) == 0 || chunk.Choices[0].Delta.Content == "" {
+			return nil
+		}
+		completion.Text += chunk.Choices[0].Delta.Content
+		return onText(chunk.Choices[0].Delta.Content)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if completion.Text == "" {
+		return nil, fmt.Errorf("received an empty response from AI")
+	}
+	return completion, nil
+}
+
+func (o *OpenAI) request(req Request) chatCompletionRequest {
+	body := chatCompletionRequest{Model: o.Model, Messages: req.Messages, MaxTokens: req.MaxTokens}
+	if req.JSON {
+		body.ResponseFormat = &responseFormat{Type: "json_object"}
+	}
+	return body
+}
+
+func (o *OpenAI) headers() map[string]string {
+	if o.APIKey == "" {
+		return nil
+	}
+	return map[string]string{"Authorization": "Bearer " + o.APIKey}
+}
@@ -0,0 +1,123 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestOpenAI tests the request format and response parsing against a stand-in
+// chat-completions server.
+func TestOpenAI(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" {
+			t.Errorf("Unexpected path %s", r.URL.Path)
+		}
+		if auth := r.Header.Get("Authorization"); auth != "Bearer test-key" {
+			t.Errorf("Unexpected Authorization header %q", auth)
+		}
+
+		var req chatCompletionRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.Model != "test-model" || len(req.Messages) != 2 || req.Messages[0].Role != RoleSystem {
+			t.Errorf("Unexpected request %+v", req)
+		}
+		if req.ResponseFormat == nil || req.ResponseFormat.Type != "json_object" || req.MaxTokens != 100 {
+			t.Errorf("Expected JSON mode and max tokens, got %+v", req)
+		}
+
+		w.Write([]byte(`{
+			"model": "test-model-0613",
+			"choices": [{"message": {"role": "assistant", "content": "{\"answer\": 42}"}}],
+			"usage": {"prompt_tokens": 20, "completion_tokens": 5, "total_tokens": 25}
+		}`))
+	}))
+	defer server.Close()
+
+	var out struct{ Answer int }
+	completion, err := GenerateJSON(context.Background(), NewOpenAI(server.URL+"/v1/", "test-key", "test-model"), Request{
+		Messages:  []Message{{Role: RoleSystem, Content: "be brief"}, {Role: RoleUser, Content: "question"}},
+		MaxTokens: 100,
+	}, JSONOptions{}, &out)
+	if err != nil {
+		t.Fatalf("GenerateJSON failed: %v", err)
+	}
+	if out.Answer != 42 || completion.Model != "test-model-0613" {
+		t.Errorf("Unexpected output %+v from %+v", out, completion)
+	}
+	if completion.Usage != (Usage{PromptTokens: 20, CompletionTokens: 5, TotalTokens: 25}) {
+		t.Errorf("Unexpected usage %+v", completion.Usage)
+	}
+}
+
+// TestOpenAIError tests that non-200 responses surface as errors.
+func TestOpenAIError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "model not found", http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	_, err := NewOpenAI(server.URL, "", "missing").Generate(context.Background(), Request{Messages: []Message{{Role: RoleUser, Content: "hi"}}})
+	if err == nil || !strings.Contains(err.Error(), "404") || !strings.Contains(err.Error(), "model not found") {
+		t.Errorf("Expected status error with body, got %v", err)
+	}
+}
+
+// TestOpenAIStream tests parsing streamed chat-completion chunks, including the final usage chunk.
+func TestOpenAIStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req chatCompletionRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if !req.Stream || req.StreamOptions == nil || !req.StreamOptions.IncludeUsage {
+			t.Errorf("Expected a streaming request with usage, got %+v", req)
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte(`data: {"model":"m","choices":[{"delta":{"role":"assistant","content":""}}]}` + "\n\n"))
+		w.Write([]byte(`data: {"model":"m","choices":[{"delta":{"content":"Hi"}}]}` + "\n\n"))
+		w.Write([]byte(`data: {"model":"m","choices":[{"delta":{"content":" there"}}]}` + "\n\n"))
+		w.Write([]byte(`data: {"model":"m","choices":[],"usage":{"prompt_tokens":4,"completion_tokens":2,"total_tokens":6}}` + "\n\n"))
+		w.Write([]byte("data: [DONE]\n\n"))
+	}))
+	defer server.Close()
+
+	var pieces []string
+	completion, err := NewOpenAI(server.URL, "", "m").Stream(context.Background(), Request{Messages: []Message{{Role: RoleUser, Content: "hi"}}}, func(text string) error {
+		pieces = append(pieces, text)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+	if strings.Join(pieces, "|") != "Hi| there" || completion.Text != "Hi there" || completion.Usage.TotalTokens != 6 {
+		t.Errorf("Unexpected pieces %q and completion %+v", pieces, completion)
+	}
+}
+
+// TestOpenAIStreamOutlivesHeaderTimeout tests that a stream keeps going for longer
+// than the time allowed for the response headers, as long as its context allows.
+func TestOpenAIStreamOutlivesHeaderTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, piece := range []string{"slow", " and", " steady"} {
+			w.Write([]byte(`data: {"model":"m","choices":[{"delta":{"content":"` + piece + `"}}]}` + "\n\n"))
+			w.(http.Flusher).Flush()
+			time.Sleep(100 * time.Millisecond)
+		}
+		w.Write([]byte("data: [DONE]\n\n"))
+	}))
+	defer server.Close()
+
+	llm := NewOpenAI(server.URL, "", "m")
+	llm.client = newHTTPClient(200 * time.Millisecond)
+	completion, err := llm.Stream(context.Background(), Request{Messages: []Message{{Role: RoleUser, Content: "hi"}}}, func(string) error { return nil })
+	if err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+	if completion.Text != "slow and steady" {
+		t.Errorf("Unexpected completion %+v", completion)
+	}
+}
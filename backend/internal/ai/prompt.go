@@ -0,0 +1,171 @@
+package ai
+
+import (
+	"ai-knowledge-base/internal/injection"
+	"ai-knowledge-base/internal/kb"
+	"embed"
+	"errors"
+	"fmt"
+	"html"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// DefaultPromptVersion is the prompt version used when none is configured.
+const DefaultPromptVersion = "v3"
+
+// The templates every prompt version consists of.
+const (
+	// answerTemplate asks for the JSON answer of Answer.
+	answerTemplate = "answer.tmpl"
+	// streamTemplate asks for the plain-text answer of AnswerStream.
+	streamTemplate = "stream.tmpl"
+)
+
+//go:embed prompts
+var embeddedPrompts embed.FS
+
+// DefaultPrompts returns the prompt versions built into the server.
+func DefaultPrompts() fs.FS {
+	prompts, _ := fs.Sub(embeddedPrompts, "prompts")
+	return prompts
+}
+
+// PromptData is what prompt templates are executed with.
+type PromptData struct {
+	// Query is the user's question.
+	Query string
+	// Articles are the articles or passages the model may answer from.
+	Articles []kb.Article
+	// History is the conversation before Query, oldest first, with the user's
+	// questions and the answers given. It is empty for the first question.
+	History []Message
+}
+
+// Prompt is a named version of the prompts sent to the model. Each version is a
+// directory holding an answer.tmpl and a stream.tmpl text/template, executed with
+// PromptData. Templates should pass the query, articles and history through the
+// untrusted function and enclose them in delimiters, as v2 and v3 do, so that they
+// cannot pose as instructions. Versions before v3 leave out the history.
+type Prompt struct {
+	// Version identifies the prompt, e.g. "v1". It is recorded with each search.
+	Version string
+	answer  *template.Template
+	stream  *template.Template
+}
+
+// LoadPrompts loads and validates every prompt version found in the given file
+// systems, each version being a top-level directory. A version in a later file
+// system replaces one of the same name in an earlier one.
+func LoadPrompts(fsyss ...fs.FS) (map[string]*Prompt, error) {
+	prompts := make(map[string]*Prompt)
+	for _, fsys := range fsyss {
+		entries, err := fs.ReadDir(fsys, ".")
+		if err != nil {
+			return nil, fmt.Errorf("failed to list prompt versions: %w", err)
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				continue
+			}
+			prompt, err := loadPrompt(fsys, entry.Name())
+			if err != nil {
+				return nil, err
+			}
+			prompts[prompt.Version] = prompt
+		}
+	}
+	return prompts, nil
+}
+
+// SelectPrompt returns the prompt with the given version.
+func SelectPrompt(prompts map[string]*Prompt, version string) (*Prompt, error) {
+	if prompt, ok := prompts[version]; ok {
+		return prompt, nil
+	}
+	versions := make([]string, 0, len(prompts))
+	for v := range prompts {
+		versions = append(versions, v)
+	}
+	sort.Strings(versions)
+	return nil, fmt.Errorf("unknown prompt version %q (available: %s)", version, strings.Join(versions, ", "))
+}
+
+// DefaultPrompt returns the built-in DefaultPromptVersion.
+var DefaultPrompt = sync.OnceValue(func() *Prompt {
+	prompt, err := loadPrompt(DefaultPrompts(), DefaultPromptVersion)
+	if err != nil {
+		panic(err)
+	}
+	return prompt
+})
+
+// promptFuncs are the functions available to prompt templates. untrusted defuses
+// anything in a query or article that looks like the tags the prompt encloses them in,
+// and attribute also escapes an untrusted value, such as an article ID, for use inside
+// a quoted tag attribute.
+var promptFuncs = template.FuncMap{
+	"untrusted": injection.Neutralize,
+	"attribute": func(value string) string { return html.EscapeString(injection.Neutralize(value)) },
+}
+
+// loadPrompt parses the templates of one version and checks that they render the
+// question and the articles.
+func loadPrompt(fsys fs.FS, version string) (*Prompt, error) {
+	prompt := &Prompt{Version: version}
+	for name, t := range map[string]**template.Template{answerTemplate: &prompt.answer, streamTemplate: &prompt.stream} {
+		file := path.Join(version, name)
+		text, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read prompt %s: %w", file, err)
+		}
+		*t, err = template.New(file).Option("missingkey=error").Funcs(promptFuncs).Parse(string(text))
+		if err != nil {
+			return nil, fmt.Errorf("invalid prompt %s: %w", file, err)
+		}
+		if err := validatePrompt(*t); err != nil {
+			return nil, fmt.Errorf("invalid prompt %s: %w", file, err)
+		}
+	}
+	return prompt, nil
+}
+
+// validatePrompt executes t with sample data and checks that the output includes it.
+func validatePrompt(t *template.Template) error {
+	sample := PromptData{
+		Query:    "sample question",
+		Articles: []kb.Article{{ID: "sample-id", Title: "Sample title", Content: "Sample content"}},
+	}
+	out, err := render(t, sample)
+	if err != nil {
+		return err
+	}
+	for _, want := range []string{sample.Query, sample.Articles[0].ID, sample.Articles[0].Content} {
+		if !strings.Contains(out, want) {
+			return errors.New("the prompt must include the question and each article's ID and content")
+		}
+	}
+	return nil
+}
+
+// Answer renders the prompt asking for the JSON answer of Answer.
+func (p *Prompt) Answer(data PromptData) (string, error) {
+	return render(p.answer, data)
+}
+
+// Stream renders the prompt asking for the plain-text answer of AnswerStream.
+func (p *Prompt) Stream(data PromptData) (string, error) {
+	return render(p.stream, data)
+}
+
+func render(t *template.Template, data PromptData) (string, error) {
+	var out strings.Builder
+	if err := t.Execute(&out, data); err != nil {
+		return "", fmt.Errorf("failed to render prompt: %w", err)
+	}
+	return out.String(), nil
+}
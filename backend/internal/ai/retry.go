@@ -0,0 +1,215 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math/rand"
+	"net"
+	"net/http"
+	"time"
+)
+
+// ErrorKind classifies provider errors by whether trying again could help.
+type ErrorKind string
+
+// Error kinds.
+const (
+	// ErrorRateLimit is a 429: the provider asked us to slow down.
+	ErrorRateLimit ErrorKind = "rate_limit"
+	// ErrorServer is a 5xx (or 408) from the provider.
+	ErrorServer ErrorKind = "server"
+	// ErrorTimeout is a request that ran out of time.
+	ErrorTimeout ErrorKind = "timeout"
+	// ErrorNetwork is a connection failure, such as a refused or reset connection.
+	ErrorNetwork ErrorKind = "network"
+	// ErrorCanceled is a request whose context was cancelled.
+	ErrorCanceled ErrorKind = "canceled"
+	// ErrorInvalid is everything else: bad requests, authentication failures, missing
+	// models and unparseable responses. Sending the same request again would fail again.
+	ErrorInvalid ErrorKind = "invalid"
+)
+
+// Transient reports whether an error of this kind may go away if the request is retried.
+func (k ErrorKind) Transient() bool {
+	switch k {
+	case ErrorRateLimit, ErrorServer, ErrorTimeout, ErrorNetwork:
+		return true
+	}
+	return false
+}
+
+// Classify returns the kind of an error returned by an LLM.
+func Classify(err error) ErrorKind {
+	var statusErr *StatusError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &statusErr):
+		switch {
+		case statusErr.StatusCode == http.StatusTooManyRequests:
+			return ErrorRateLimit
+		case statusErr.StatusCode == http.StatusRequestTimeout || statusErr.StatusCode >= 500:
+			return ErrorServer
+		}
+		return ErrorInvalid
+	case errors.Is(err, context.Canceled):
+		return ErrorCanceled
+	case errors.Is(err, context.DeadlineExceeded):
+		return ErrorTimeout
+	case errors.As(err, &netErr):
+		if netErr.Timeout() {
+			return ErrorTimeout
+		}
+		return ErrorNetwork
+	}
+	return ErrorInvalid
+}
+
+// RetryPolicy configures Retry.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first. One disables retries.
+	MaxAttempts int
+	// BaseDelay is the backoff before the first retry; it doubles with every retry up
+	// to MaxDelay. The actual wait is drawn between half and all of the backoff.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+// DefaultRetryPolicy makes up to three attempts, waiting about 200ms and 400ms between them.
+var DefaultRetryPolicy = RetryPolicy{MaxAttempts: 3, BaseDelay: 200 * time.Millisecond, MaxDelay: 5 * time.Second}
+
+// backoff returns the wait before retry number n (starting at 1), given a random
+// number in [0, 1) for the jitter.
+func (p RetryPolicy) backoff(n int, random float64) time.Duration {
+	delay := p.MaxDelay
+	if n-1 < 32 {
+		delay = min(p.BaseDelay<<(n-1), p.MaxDelay)
+	}
+	return delay/2 + time.Duration(random*float64(delay/2))
+}
+
+// Retry wraps an LLM and retries transient failures (see ErrorKind.Transient) with
+// capped exponential backoff and jitter. A provider's Retry-After hint replaces the
+// backoff but is capped at MaxDelay too. Retry never waits past the request context's
+// deadline: if the next attempt could not start in time, it returns the last error
+// straight away.
+type Retry struct {
+	LLM    LLM
+	Policy RetryPolicy
+
+	// sleep and random are replaced in tests.
+	sleep  func(ctx context.Context, d time.Duration) error
+	random func() float64
+}
+
+// NewRetry wraps llm with the given retry policy.
+func NewRetry(llm LLM, policy RetryPolicy) *Retry {
+	return &Retry{LLM: llm, Policy: policy, sleep: sleep, random: rand.Float64}
+}
+
+// Name implements LLM by returning the name of the wrapped LLM.
+func (r *Retry) Name() string {
+	return r.LLM.Name()
+}
+
+// Close implements io.Closer by closing the wrapped LLM.
+func (r *Retry) Close() error {
+	return Close(r.LLM)
+}
+
+// ModelName implements ModelNamer with the wrapped LLM's model.
+func (r *Retry) ModelName() string {
+	return ModelName(r.LLM)
+}
+
+// EstimateTokens implements TokenEstimator with the wrapped LLM's estimate.
+func (r *Retry) EstimateTokens(text string) int {
+	return EstimateTokens(r.LLM, text)
+}
+
+// Generate implements LLM.
+func (r *Retry) Generate(ctx context.Context, req Request) (*Completion, error) {
+	var completion *Completion
+	err := r.do(ctx, func() error {
+		var err error
+		completion, err = r.LLM.Generate(ctx, req)
+		return err
+	})
+	return completion, err
+}
+
+// Stream implements Streamer. Once any text has been delivered to onText the stream
+// cannot be restarted, so only failures before the first piece are retried.
+func (r *Retry) Stream(ctx context.Context, req Request, onText func(string) error) (*Completion, error) {
+	var completion *Completion
+	delivered := false
+	err := r.do(ctx, func() error {
+		var err error
+		completion, err = GenerateStream(ctx, r.LLM, req, func(text string) error {
+			delivered = true
+			return onText(text)
+		})
+		if err != nil && delivered {
+			return permanent{err}
+		}
+		return err
+	})
+	return completion, err
+}
+
+// permanent marks an error that must not be retried whatever its kind.
+type permanent struct {
+	error
+}
+
+func (p permanent) Unwrap() error {
+	return p.error
+}
+
+// do calls attempt until it succeeds, fails permanently or runs out of attempts or time.
+func (r *Retry) do(ctx context.Context, attempt func() error) error {
+	maxAttempts := max(r.Policy.MaxAttempts, 1)
+	for n := 1; ; n++ {
+		err := attempt()
+		if err == nil {
+			return nil
+		}
+		var p permanent
+		if errors.As(err, &p) {
+			return p.error
+		}
+		kind := Classify(err)
+		if !kind.Transient() || n == maxAttempts || ctx.Err() != nil {
+			return err
+		}
+
+		delay := r.Policy.backoff(n, r.random())
+		var statusErr *StatusError
+		if errors.As(err, &statusErr) && statusErr.RetryAfter > 0 {
+			delay = statusErr.RetryAfter
+			if r.Policy.MaxDelay > 0 {
+				delay = min(delay, r.Policy.MaxDelay)
+			}
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			log.Printf("Not retrying %s: waiting %s would pass the deadline: %v", r.LLM.Name(), delay, err)
+			return err
+		}
+		log.Printf("AI request to %s failed (%s), retrying in %s (attempt %d of %d): %v", r.LLM.Name(), kind, delay, n+1, maxAttempts, err)
+		if err := r.sleep(ctx, delay); err != nil {
+			return err
+		}
+	}
+}
+
+// sleep waits for d or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
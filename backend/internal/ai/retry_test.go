@@ -0,0 +1,218 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// scriptedLLM returns the scripted errors in turn, then succeeds.
+type scriptedLLM struct {
+	errs  []error
+	calls int
+	// pieces are streamed before each failure when set.
+	pieces []string
+}
+
+func (s *scriptedLLM) Name() string {
+	return "scripted"
+}
+
+func (s *scriptedLLM) Generate(ctx context.Context, req Request) (*Completion, error) {
+	s.calls++
+	if s.calls <= len(s.errs) {
+		return nil, s.errs[s.calls-1]
+	}
+	return &Completion{Text: "ok"}, nil
+}
+
+func (s *scriptedLLM) Stream(ctx context.Context, req Request, onText func(string) error) (*Completion, error) {
+	for _, piece := range s.pieces {
+		if err := onText(piece); err != nil {
+			return nil, err
+		}
+	}
+	return s.Generate(ctx, req)
+}
+
+// newTestRetry wraps llm with a policy whose sleeps are recorded instead of waited out.
+func newTestRetry(llm LLM, sleeps *[]time.Duration) *Retry {
+	r := NewRetry(llm, RetryPolicy{MaxAttempts: 3, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second})
+	r.random = func() float64 { return 0.5 }
+	r.sleep = func(ctx context.Context, d time.Duration) error {
+		*sleeps = append(*sleeps, d)
+		return nil
+	}
+	return r
+}
+
+// TestClassify tests the classification of provider errors.
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		err  error
+		want ErrorKind
+	}{
+		{&StatusError{StatusCode: 429}, ErrorRateLimit},
+		{fmt.Errorf("wrapped: %w", &StatusError{StatusCode: 503}), ErrorServer},
+		{&StatusError{StatusCode: 408}, ErrorServer},
+		{&StatusError{StatusCode: 400}, ErrorInvalid},
+		{&StatusError{StatusCode: 401}, ErrorInvalid},
+		{fmt.Errorf("AI request failed: %w", context.DeadlineExceeded), ErrorTimeout},
+		{context.Canceled, ErrorCanceled},
+		{errors.New("failed to parse AI response"), ErrorInvalid},
+	}
+	for _, tt := range tests {
+		if got := Classify(tt.err); got != tt.want {
+			t.Errorf("Classify(%v) = %s, want %s", tt.err, got, tt.want)
+		}
+	}
+
+	// A refused connection is a network error.
+	_, err := NewOllama("http://127.0.0.1:1", "m").Generate(context.Background(), Request{})
+	if got := Classify(err); got != ErrorNetwork {
+		t.Errorf("Classify(%v) = %s, want %s", err, got, ErrorNetwork)
+	}
+}
+
+// TestParseRetryAfter tests both forms of the Retry-After header.
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := map[string]time.Duration{
+		"":                              0,
+		"3":                             3 * time.Second,
+		"-1":                            0,
+		"soon":                          0,
+		"Wed, 01 May 2024 12:00:10 GMT": 10 * time.Second,
+		"Wed, 01 May 2024 11:00:00 GMT": 0,
+	}
+	for value, want := range tests {
+		if got := parseRetryAfter(value, now); got != want {
+			t.Errorf("parseRetryAfter(%q) = %s, want %s", value, got, want)
+		}
+	}
+}
+
+// TestBackoff tests that the backoff doubles, is capped and is jittered within range.
+func TestBackoff(t *testing.T) {
+	policy := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	if got := policy.backoff(1, 0); got != 50*time.Millisecond {
+		t.Errorf("backoff(1, 0) = %s", got)
+	}
+	if got := policy.backoff(3, 0.999); got <= 300*time.Millisecond || got > 400*time.Millisecond {
+		t.Errorf("backoff(3, 0.999) = %s", got)
+	}
+	if got := policy.backoff(100, 0.5); got != 750*time.Millisecond {
+		t.Errorf("backoff(100, 0.5) = %s, expected the cap", got)
+	}
+}
+
+// TestRetryTransientErrors tests that rate limits and server errors are retried with
+// growing backoff.
+func TestRetryTransientErrors(t *testing.T) {
+	var sleeps []time.Duration
+	llm := &scriptedLLM{errs: []error{&StatusError{StatusCode: 429}, &StatusError{StatusCode: 503}}}
+	completion, err := newTestRetry(llm, &sleeps).Generate(context.Background(), Request{})
+	if err != nil || completion.Text != "ok" {
+		t.Fatalf("Expected success after retries, got %v", err)
+	}
+	if llm.calls != 3 || len(sleeps) != 2 || sleeps[0] != 75*time.Millisecond || sleeps[1] != 150*time.Millisecond {
+		t.Errorf("Unexpected calls %d and sleeps %v", llm.calls, sleeps)
+	}
+}
+
+// TestRetryGivesUp tests that invalid requests are not retried and that transient
+// errors are retried only up to MaxAttempts.
+func TestRetryGivesUp(t *testing.T) {
+	var sleeps []time.Duration
+	invalid := &scriptedLLM{errs: []error{&StatusError{StatusCode: 400}}}
+	if _, err := newTestRetry(invalid, &sleeps).Generate(context.Background(), Request{}); err == nil || invalid.calls != 1 {
+		t.Errorf("Expected one attempt for an invalid request, got %d and %v", invalid.calls, err)
+	}
+
+	down := &scriptedLLM{errs: []error{&StatusError{StatusCode: 500}, &StatusError{StatusCode: 502}, &StatusError{StatusCode: 503}, nil}}
+	_, err := newTestRetry(down, &sleeps).Generate(context.Background(), Request{})
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != 503 || down.calls != 3 {
+		t.Errorf("Expected the last error after 3 attempts, got %d and %v", down.calls, err)
+	}
+}
+
+// TestRetryAfter tests that a Retry-After hint replaces the backoff up to MaxDelay,
+// unless waiting would pass the request deadline.
+func TestRetryAfter(t *testing.T) {
+	var sleeps []time.Duration
+	llm := &scriptedLLM{errs: []error{&StatusError{StatusCode: 429, RetryAfter: 700 * time.Millisecond}}}
+	if _, err := newTestRetry(llm, &sleeps).Generate(context.Background(), Request{}); err != nil {
+		t.Fatalf("Expected success after the hinted wait, got %v", err)
+	}
+	if len(sleeps) != 1 || sleeps[0] != 700*time.Millisecond {
+		t.Errorf("Expected to wait the hinted 700ms, got %v", sleeps)
+	}
+
+	sleeps = nil
+	llm = &scriptedLLM{errs: []error{&StatusError{StatusCode: 429, RetryAfter: time.Hour}}}
+	if _, err := newTestRetry(llm, &sleeps).Generate(context.Background(), Request{}); err != nil {
+		t.Fatalf("Expected success after the capped wait, got %v", err)
+	}
+	if len(sleeps) != 1 || sleeps[0] != time.Second {
+		t.Errorf("Expected the hinted hour capped at MaxDelay, got %v", sleeps)
+	}
+
+	sleeps = nil
+	llm = &scriptedLLM{errs: []error{&StatusError{StatusCode: 429, RetryAfter: time.Minute}}}
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	if _, err := newTestRetry(llm, &sleeps).Generate(ctx, Request{}); Classify(err) != ErrorRateLimit {
+		t.Errorf("Expected the rate limit error, got %v", err)
+	}
+	if llm.calls != 1 || len(sleeps) != 0 {
+		t.Errorf("Expected no retry past the deadline, got %d calls and sleeps %v", llm.calls, sleeps)
+	}
+}
+
+// TestRetryStream tests that a stream is retried before its first piece but not after.
+func TestRetryStream(t *testing.T) {
+	var sleeps []time.Duration
+	var text string
+	onText := func(piece string) error {
+		text += piece
+		return nil
+	}
+
+	llm := &scriptedLLM{errs: []error{&StatusError{StatusCode: 503}}}
+	if _, err := newTestRetry(llm, &sleeps).Stream(context.Background(), Request{}, onText); err != nil || llm.calls != 2 {
+		t.Errorf("Expected a retry before any text, got %d calls and %v", llm.calls, err)
+	}
+
+	text = ""
+	llm = &scriptedLLM{errs: []error{&StatusError{StatusCode: 503}}, pieces: []string{"partial"}}
+	_, err := newTestRetry(llm, &sleeps).Stream(context.Background(), Request{}, onText)
+	if Classify(err) != ErrorServer || llm.calls != 1 || text != "partial" {
+		t.Errorf("Expected no retry after text was delivered, got %d calls, %q and %v", llm.calls, text, err)
+	}
+}
+
+// TestRetryGemini tests recovering from a 503 against a stand-in Gemini API.
+func TestRetryGemini(t *testing.T) {
+	var calls atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.Header().Set("Retry-After", "0")
+			http.Error(w, "overloaded", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"candidates": [{"content": {"parts": [{"text": "ok"}]}}]}`))
+	}))
+	defer server.Close()
+
+	retry := NewRetry(newTestGemini(server.URL), RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond})
+	completion, err := retry.Generate(context.Background(), benchmarkRequest)
+	if err != nil || completion.Text != "ok" || calls.Load() != 2 || retry.Name() != "gemini" {
+		t.Errorf("Expected success on the second attempt, got %v after %d calls", err, calls.Load())
+	}
+}
@@ -0,0 +1,50 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+var vpnHistory = []Message{
+	{Role: RoleUser, Content: "How do I connect to the VPN?"},
+	{Role: RoleAssistant, Content: "Install the latest VPN client and sign in [kb-002]."},
+}
+
+// TestRewriteQuery tests that the conversation is sent with the follow-up and that
+// the reply is cleaned up.
+func TestRewriteQuery(t *testing.T) {
+	model := &mockLLM{text: "\n\"VPN connection still fails after installing the client\"\nBecause the user refers to the VPN."}
+	rewritten, completion, err := RewriteQuery(context.Background(), model, vpnHistory, "what if that still fails?")
+	if err != nil || completion == nil {
+		t.Fatalf("RewriteQuery failed: %v", err)
+	}
+	if rewritten != "VPN connection still fails after installing the client" {
+		t.Errorf("Unexpected rewritten query %q", rewritten)
+	}
+	prompt := model.requests[0].Messages[0].Content
+	for _, want := range []string{"How do I connect to the VPN?", "[kb-002]", "<follow_up>\nwhat if that still fails?\n</follow_up>"} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("Expected the prompt to contain %q:\n%s", want, prompt)
+		}
+	}
+}
+
+// TestRewriteQueryErrors tests that failed and empty rewrites are errors.
+func TestRewriteQueryErrors(t *testing.T) {
+	if _, _, err := RewriteQuery(context.Background(), &mockLLM{err: errors.New("down")}, vpnHistory, "and then?"); err == nil {
+		t.Error("Expected the model's error")
+	}
+	if _, _, err := RewriteQuery(context.Background(), &mockLLM{text: " \n\"\""}, vpnHistory, "and then?"); err == nil {
+		t.Error("Expected an error for an empty rewrite")
+	}
+}
+
+// TestFakeRewrite tests that the fake provider resolves follow-ups offline.
+func TestFakeRewrite(t *testing.T) {
+	rewritten, _, err := RewriteQuery(context.Background(), NewFake(), vpnHistory, "what if that still fails?")
+	if err != nil || rewritten != "How do I connect to the VPN? what if that still fails?" {
+		t.Errorf("Unexpected fake rewrite %q, %v", rewritten, err)
+	}
+}
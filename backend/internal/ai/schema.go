@@ -0,0 +1,136 @@
+package ai
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Schema is the subset of JSON Schema used to validate model output: type,
+// properties, required, additionalProperties (false only), items and minLength.
+type Schema struct {
+	Type                 string             `json:"type"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *bool              `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	MinLength            int                `json:"minLength,omitempty"`
+}
+
+// AIResponseSchema describes the JSON object the model is asked for by Answer.
+var AIResponseSchema = &Schema{
+	Type: "object",
+	Properties: map[string]*Schema{
+		"ai_summary_answer": {Type: "string", MinLength: 1},
+		"ai_relevant_articles": {
+			Type: "array",
+			Items: &Schema{
+				Type: "object",
+				Properties: map[string]*Schema{
+					"id":    {Type: "string", MinLength: 1},
+					"title": {Type: "string"},
+				},
+				Required: []string{"id"},
+			},
+		},
+	},
+	Required: []string{"ai_summary_answer", "ai_relevant_articles"},
+}
+
+// String returns the schema as JSON, for inclusion in prompts.
+func (s *Schema) String() string {
+	raw, _ := json.Marshal(s)
+	return string(raw)
+}
+
+// Validate checks a value decoded by encoding/json into an interface{} against the
+// schema. The error lists every violation with its JSON path.
+func (s *Schema) Validate(v interface{}) error {
+	var problems []string
+	s.validate("$", v, &problems)
+	if len(problems) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(problems, "; "))
+}
+
+func (s *Schema) validate(path string, v interface{}, problems *[]string) {
+	fail := func(format string, args ...interface{}) {
+		*problems = append(*problems, path+": "+fmt.Sprintf(format, args...))
+	}
+
+	switch s.Type {
+	case "object":
+		object, ok := v.(map[string]interface{})
+		if !ok {
+			fail("expected an object, got %s", jsonType(v))
+			return
+		}
+		for _, name := range s.Required {
+			if _, ok := object[name]; !ok {
+				fail("missing required property %q", name)
+			}
+		}
+		names := make([]string, 0, len(object))
+		for name := range object {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if property, ok := s.Properties[name]; ok {
+				property.validate(path+"."+name, object[name], problems)
+			} else if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+				fail("unexpected property %q", name)
+			}
+		}
+	case "array":
+		array, ok := v.([]interface{})
+		if !ok {
+			fail("expected an array, got %s", jsonType(v))
+			return
+		}
+		if s.Items != nil {
+			for i, item := range array {
+				s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item, problems)
+			}
+		}
+	case "string":
+		str, ok := v.(string)
+		if !ok {
+			fail("expected a string, got %s", jsonType(v))
+			return
+		}
+		if len([]rune(str)) < s.MinLength {
+			fail("must be at least %d characters long", s.MinLength)
+		}
+	case "number":
+		if _, ok := v.(float64); !ok {
+			fail("expected a number, got %s", jsonType(v))
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			fail("expected a boolean, got %s", jsonType(v))
+		}
+	}
+}
+
+// jsonType names the JSON type of a decoded value.
+func jsonType(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case map[string]interface{}:
+		return "an object"
+	case []interface{}:
+		return "an array"
+	case string:
+		return "a string"
+	case float64:
+		return "a number"
+	case bool:
+		return "a boolean"
+	}
+	return fmt.Sprintf("%T", v)
+}
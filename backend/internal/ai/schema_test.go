@@ -0,0 +1,62 @@
+package ai
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// TestSchemaValidate tests the validation of decoded JSON against AIResponseSchema.
+func TestSchemaValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			name:  "Valid",
+			input: `{"ai_summary_answer": "Answer", "ai_relevant_articles": [{"id": "kb-001", "title": "Title"}], "extra": true}`,
+		},
+		{
+			name:  "Not an object",
+			input: `["answer"]`,
+			want:  "$: expected an object, got an array",
+		},
+		{
+			name:  "Missing properties",
+			input: `{}`,
+			want:  `$: missing required property "ai_summary_answer"; $: missing required property "ai_relevant_articles"`,
+		},
+		{
+			name:  "Wrong types",
+			input: `{"ai_summary_answer": null, "ai_relevant_articles": [{"id": 1}, "kb-002"]}`,
+			want:  "$.ai_relevant_articles[0].id: expected a string, got a number; $.ai_relevant_articles[1]: expected an object, got a string; $.ai_summary_answer: expected a string, got null",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var decoded interface{}
+			if err := json.Unmarshal([]byte(tt.input), &decoded); err != nil {
+				t.Fatal(err)
+			}
+			got := ""
+			if err := AIResponseSchema.Validate(decoded); err != nil {
+				got = err.Error()
+			}
+			if got != tt.want {
+				t.Errorf("Validate(%s) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestSchemaAdditionalProperties tests that additionalProperties: false rejects
+// unknown properties.
+func TestSchemaAdditionalProperties(t *testing.T) {
+	closed := false
+	schema := &Schema{Type: "object", Properties: map[string]*Schema{"a": {Type: "number"}}, AdditionalProperties: &closed}
+	err := schema.Validate(map[string]interface{}{"a": 1.0, "b": true})
+	if err == nil || err.Error() != `$: unexpected property "b"` {
+		t.Errorf("Expected the unknown property to be rejected, got %v", err)
+	}
+}
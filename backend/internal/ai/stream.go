@@ -0,0 +1,77 @@
+package ai
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"io"
+	"strings"
+)
+
+// Streamer is implemented by LLMs that can deliver their output incrementally.
+type Streamer interface {
+	// Stream is like Generate but calls onText with each piece of output as it
+	// arrives. If onText returns an error, streaming stops and Stream returns it.
+	// The returned Completion holds the full text.
+	Stream(ctx context.Context, req Request, onText func(string) error) (*Completion, error)
+}
+
+// GenerateStream streams the output of llm if it implements Streamer. Otherwise it
+// waits for Generate and delivers the whole text as a single piece.
+func GenerateStream(ctx context.Context, llm LLM, req Request, onText func(string) error) (*Completion, error) {
+	completion, err := generateStream(ctx, llm, req, onText)
+	if err != nil {
+		return nil, err
+	}
+	completion.Provider = cmp.Or(completion.Provider, llm.Name())
+	return completion, nil
+}
+
+func generateStream(ctx context.Context, llm LLM, req Request, onText func(string) error) (*Completion, error) {
+	if streamer, ok := llm.(Streamer); ok {
+		return streamer.Stream(ctx, req, onText)
+	}
+	completion, err := llm.Generate(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if err := onText(completion.Text); err != nil {
+		return nil, err
+	}
+	return completion, nil
+}
+
+// readLines calls fn with each non-empty line of r until r is exhausted or fn
+// returns false or an error.
+func readLines(r io.Reader, fn func(line string) (bool, error)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		more, err := fn(line)
+		if err != nil || !more {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// readSSE calls fn with the data of each server-sent event in r, stopping at the
+// OpenAI-style "[DONE]" sentinel. Multi-line data fields are not used by any of the
+// supported providers and are not reassembled.
+func readSSE(r io.Reader, fn func(data string) error) error {
+	return readLines(r, func(line string) (bool, error) {
+		data, ok := strings.CutPrefix(line, "data:")
+		if !ok {
+			return true, nil
+		}
+		data = strings.TrimSpace(data)
+		if data == "[DONE]" {
+			return false, nil
+		}
+		return true, fn(data)
+	})
+}
@@ -0,0 +1,69 @@
+package ai
+
+import (
+	"ai-knowledge-base/internal/kb"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// TestGenerateStreamWithoutStreamer tests that non-streaming LLMs deliver their whole output at once.
+func TestGenerateStreamWithoutStreamer(t *testing.T) {
+	var pieces []string
+	completion, err := GenerateStream(context.Background(), &mockLLM{text: "whole answer"}, Request{}, func(text string) error {
+		pieces = append(pieces, text)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("GenerateStream failed: %v", err)
+	}
+	if len(pieces) != 1 || pieces[0] != "whole answer" || completion.Text != "whole answer" {
+		t.Errorf("Unexpected pieces %q and completion %+v", pieces, completion)
+	}
+}
+
+// TestAnswerStream tests streaming a cited answer from the fake provider.
+func TestAnswerStream(t *testing.T) {
+	articles := []kb.Article{{ID: "kb-003", Title: "Printers", Content: "Open Settings and choose Add Printer."}}
+
+	var streamed strings.Builder
+	response, err := AnswerStream(context.Background(), NewFake(), "add printer", articles, AnswerOptions{}, func(text string) error {
+		streamed.WriteString(text)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("AnswerStream failed: %v", err)
+	}
+	if response.SummaryAnswer != "Open Settings and choose Add Printer. [kb-003]" || streamed.String() != response.SummaryAnswer {
+		t.Errorf("Streamed %q, answer %q", streamed.String(), response.SummaryAnswer)
+	}
+	if len(response.RelevantArticles) != 1 || response.RelevantArticles[0].Title != "Printers" {
+		t.Errorf("Expected the cited article, got %+v", response.RelevantArticles)
+	}
+}
+
+// TestAnswerStreamStopsWhenCallbackFails tests that a failing consumer, such as a
+// disconnected client, stops the stream.
+func TestAnswerStreamStopsWhenCallbackFails(t *testing.T) {
+	articles := []kb.Article{{ID: "kb-003", Title: "Printers", Content: "Open Settings and choose Add Printer."}}
+	gone := errors.New("client gone")
+
+	calls := 0
+	_, err := AnswerStream(context.Background(), NewFake(), "printer", articles, AnswerOptions{}, func(string) error {
+		calls++
+		return gone
+	})
+	if !errors.Is(err, gone) || calls != 1 {
+		t.Errorf("Expected the stream to stop after the first piece, got %v after %d calls", err, calls)
+	}
+}
+
+// TestCitedArticles tests extracting bracketed citations.
+func TestCitedArticles(t *testing.T) {
+	articles := []kb.Article{{ID: "kb-001", Title: "One"}, {ID: "kb-002#1", Title: "Two"}}
+	cited := citedArticles("See [kb-002#1] and [kb-001], again [kb-002#1], not [kb-999] or [see here].", articles)
+	if len(cited) != 2 || cited[0].ID != "kb-002#1" || cited[1].ID != "kb-001" {
+		t.Errorf("Unexpected citations %+v", cited)
+	}
+}
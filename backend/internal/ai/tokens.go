@@ -0,0 +1,39 @@
+package ai
+
+import (
+	"math"
+	"strings"
+	"unicode/utf8"
+)
+
+// TokenEstimator is implemented by LLMs that can estimate how many tokens their model
+// counts in a text. Estimates are meant for budgeting prompts, not billing: they
+// approximate the provider's tokenizer without calling it.
+type TokenEstimator interface {
+	EstimateTokens(text string) int
+}
+
+// Characters per token for English text, by tokenizer family.
+const (
+	// defaultCharsPerToken suits the byte-pair and SentencePiece tokenizers of hosted
+	// models such as GPT and Gemini.
+	defaultCharsPerToken = 4.0
+	// llamaCharsPerToken suits the smaller vocabularies of open models served by Ollama.
+	llamaCharsPerToken = 3.5
+)
+
+// EstimateTokens estimates the tokens llm counts in text, with its own estimator if it
+// implements TokenEstimator and defaultCharsPerToken otherwise.
+func EstimateTokens(llm LLM, text string) int {
+	if estimator, ok := llm.(TokenEstimator); ok {
+		return estimator.EstimateTokens(text)
+	}
+	return estimateByChars(text, defaultCharsPerToken)
+}
+
+// estimateByChars estimates tokens from the length of text, counting every word as
+// at least one token.
+func estimateByChars(text string, charsPerToken float64) int {
+	byChars := int(math.Ceil(float64(utf8.RuneCountInString(text)) / charsPerToken))
+	return max(byChars, len(strings.Fields(text)))
+}
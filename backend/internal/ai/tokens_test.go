@@ -0,0 +1,43 @@
+package ai
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestEstimateTokens tests the per-provider estimates and their wrappers.
+func TestEstimateTokens(t *testing.T) {
+	text := strings.Repeat("password ", 40) // 40 words, 360 characters
+
+	gemini := NewGemini("key", DefaultGeminiModel)
+	ollama := NewOllama("http://localhost:11434", "llama3")
+	tests := []struct {
+		name string
+		llm  LLM
+		want int
+	}{
+		{"gemini", gemini, 90},
+		{"openai", NewOpenAI("", "key", "gpt-4o-mini"), 90},
+		{"ollama", ollama, 103},
+		{"fake", NewFake(), 40},
+		{"no estimator", &mockLLM{}, 90},
+		{"retry", NewRetry(ollama, RetryPolicy{}), 103},
+		{"breaker", NewCircuitBreaker(ollama, BreakerPolicy{}), 103},
+		{"fallback", NewFallback(gemini, ollama, NewFake()), 103},
+	}
+	for _, tt := range tests {
+		if got := EstimateTokens(tt.llm, text); got != tt.want {
+			t.Errorf("%s: EstimateTokens = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+// TestEstimateTokensCountsWords tests that short words count as a token each.
+func TestEstimateTokensCountsWords(t *testing.T) {
+	if got := estimateByChars("a b c d e f", defaultCharsPerToken); got != 6 {
+		t.Errorf("Expected 6 tokens, got %d", got)
+	}
+	if got := estimateByChars("", defaultCharsPerToken); got != 0 {
+		t.Errorf("Expected 0 tokens, got %d", got)
+	}
+}
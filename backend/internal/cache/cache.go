@@ -0,0 +1,599 @@
+// Package cache stores AI answers so that repeated questions about unchanged articles
+// are answered without calling the model again.
+package cache
+
+import (
+	"ai-knowledge-base/internal/kb"
+	"ai-knowledge-base/internal/retrieval"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode"
+)
+
+// DefaultThreshold is the cosine similarity from which a question counts as a
+// paraphrase of a cached one.
+const DefaultThreshold = 0.9
+
+// Match kinds of a Lookup.
+const (
+	// MatchExact is a hit on the same normalized question about the same articles.
+	MatchExact = "exact"
+	// MatchSemantic is a hit on a question similar in meaning about the same articles.
+	MatchSemantic = "semantic"
+)
+
+// Entry is a cached answer.
+type Entry struct {
+	Key string `json:"key"`
+	// Query is the normalized query the answer was generated for.
+	Query string `json:"query"`
+	// Context identifies the prompt version and article versions the answer was
+	// generated from; only entries with the same context are matched by meaning.
+	Context string `json:"context,omitempty"`
+	// ArticleIDs are the articles the answer was generated from. Changing any of them
+	// invalidates the entry.
+	ArticleIDs []string `json:"article_ids"`
+	// Value is the answer, encoded by the caller.
+	Value     json.RawMessage `json:"value"`
+	CreatedAt time.Time       `json:"created_at"`
+	// ExpiresAt is when the entry stops being served. Zero never expires.
+	ExpiresAt time.Time `json:"expires_at"`
+	// Hits counts the searches the entry has answered.
+	Hits int `json:"hits"`
+	// Embedding is the embedding of Query, for matches by meaning.
+	Embedding []float32 `json:"-"`
+}
+
+// expired reports whether e has expired at now.
+func (e *Entry) expired(now time.Time) bool {
+	return !e.ExpiresAt.IsZero() && !now.Before(e.ExpiresAt)
+}
+
+// Normalize lowercases query and reduces punctuation and runs of spaces to single
+// spaces, so that trivially different spellings of a question share an entry.
+func Normalize(query string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	}), " ")
+}
+
+// negations are the words, after Normalize, that turn a question into its opposite.
+// "t" is what is left of "n't".
+var negations = map[string]bool{"not": true, "no": true, "never": true, "cannot": true, "t": true}
+
+// negated reports whether a normalized query is negated, that is whether it has an odd
+// number of negations. Embeddings barely move with a negation, so a negated question
+// is never matched by meaning to one that is not.
+func negated(query string) bool {
+	n := 0
+	for _, word := range strings.Fields(query) {
+		if negations[word] {
+			n++
+		}
+	}
+	return n%2 == 1
+}
+
+// Key identifies the answer to query generated by the given prompt version and model
+// from articles, in the order they were sent to the model. model names the provider
+// and the model it requests, so that answers cached before either was changed are not
+// served. Each article is included with a hash of its content, so an edited article
+// never matches an old answer.
+func Key(query, promptVersion, model string, articles []kb.Article) string {
+	h := sha256.New()
+	h.Write([]byte(Normalize(query) + "\x00" + promptVersion + "\x00" + model))
+	for _, article := range articles {
+		writeArticle(h, article)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// ContextKey identifies the prompt version, the model and the set of article versions
+// an answer is generated from, whatever the question and the order the articles were
+// retrieved in, which can differ between paraphrases.
+func ContextKey(promptVersion, model string, articles []kb.Article) string {
+	sorted := append([]kb.Article(nil), articles...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].ID < sorted[j].ID })
+	h := sha256.New()
+	h.Write([]byte(promptVersion + "\x00" + model))
+	for _, article := range sorted {
+		writeArticle(h, article)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// writeArticle adds an article's ID and a hash of its content to h.
+func writeArticle(h hash.Hash, article kb.Article) {
+	content := sha256.Sum256([]byte(article.Title + "\x00" + article.Content))
+	h.Write([]byte("\x00" + article.ID + "\x00"))
+	h.Write(content[:])
+}
+
+// Lookup is the outcome of Find.
+type Lookup struct {
+	// Entry is the cached answer, or nil on a miss.
+	Entry *Entry
+	// Match is MatchExact or MatchSemantic on a hit.
+	Match string
+	// Similarity is the cosine similarity of the question to the cached one, 1 for an
+	// exact match.
+	Similarity float64
+	// Embedding is the question's embedding, if it was computed. Setting it on the
+	// entry given to Put saves computing it again.
+	Embedding []float32
+}
+
+// Stats counts the lookups made with Find.
+type Stats struct {
+	ExactHits    int64 `json:"exact_hits"`
+	SemanticHits int64 `json:"semantic_hits"`
+	Misses       int64 `json:"misses"`
+	// HitRate is the share of lookups that were hits, from 0 to 1.
+	HitRate float64 `json:"hit_rate"`
+	// MemoryEntries is the number of entries in the memory tier.
+	MemoryEntries int `json:"memory_entries"`
+}
+
+// Cache holds answers in a bounded in-memory LRU tier backed by a SQLite tier, which
+// keeps them across restarts. Entries expire after a TTL and are invalidated when an
+// article they were generated from is saved or deleted; Cache implements kb.Observer
+// for that. Failures of the SQLite tier are logged and treated as misses. It is safe
+// for concurrent use.
+type Cache struct {
+	// Embedder, when set, also matches questions by meaning: a question about the same
+	// article versions whose embedding is at least Threshold cosine-similar to that of
+	// a cached question is served its answer. When embedding fails, only exact matches
+	// are served.
+	Embedder  retrieval.Embedder
+	Threshold float64
+
+	db   *sql.DB
+	size int
+	ttl  time.Duration
+	now  func() time.Time
+
+	mu      sync.Mutex
+	lru     *list.List // of *Entry, most recently used first
+	entries map[string]*list.Element
+
+	exactHits, semanticHits, misses atomic.Int64
+}
+
+// New creates a cache holding up to size entries in memory, persisted in the
+// answer_cache tables created by database.InitDB when db is not nil. Entries expire
+// after ttl; zero means they never do.
+func New(db *sql.DB, size int, ttl time.Duration) *Cache {
+	return &Cache{Threshold: DefaultThreshold, db: db, size: size, ttl: ttl, now: time.Now, lru: list.New(), entries: make(map[string]*list.Element)}
+}
+
+// Find returns the answer with the given key or, failing that and with an Embedder, the
+// answer to the question in contextKey most similar to query, and counts the hit or
+// miss.
+func (c *Cache) Find(ctx context.Context, key, contextKey, query string) Lookup {
+	if entry, ok := c.Get(key); ok {
+		c.exactHits.Add(1)
+		c.hit(entry)
+		return Lookup{Entry: entry, Match: MatchExact, Similarity: 1}
+	}
+	var lookup Lookup
+	if c.Embedder != nil {
+		lookup.Embedding = c.embed(ctx, query)
+	}
+	if lookup.Embedding != nil {
+		entry, similarity, err := c.similar(contextKey, Normalize(query), lookup.Embedding)
+		if err != nil {
+			log.Printf("Failed to search answer cache: %v", err)
+		}
+		if entry != nil {
+			c.semanticHits.Add(1)
+			c.hit(entry)
+			lookup.Entry, lookup.Match, lookup.Similarity = entry, MatchSemantic, similarity
+			return lookup
+		}
+	}
+	c.misses.Add(1)
+	return lookup
+}
+
+// Stats returns the counts of the lookups made since the cache was created.
+func (c *Cache) Stats() Stats {
+	stats := Stats{ExactHits: c.exactHits.Load(), SemanticHits: c.semanticHits.Load(), Misses: c.misses.Load(), MemoryEntries: c.Len()}
+	if lookups := stats.ExactHits + stats.SemanticHits + stats.Misses; lookups > 0 {
+		stats.HitRate = float64(stats.ExactHits+stats.SemanticHits) / float64(lookups)
+	}
+	return stats
+}
+
+// Get returns the unexpired entry for key, from memory or else from SQLite.
+func (c *Cache) Get(key string) (*Entry, bool) {
+	now := c.now()
+	c.mu.Lock()
+	if element, ok := c.entries[key]; ok {
+		entry := element.Value.(*Entry)
+		if !entry.expired(now) {
+			c.lru.MoveToFront(element)
+			c.mu.Unlock()
+			return entry, true
+		}
+		c.remove(element)
+	}
+	c.mu.Unlock()
+
+	if c.db == nil {
+		return nil, false
+	}
+	entry, err := c.load(key, now)
+	if err != nil {
+		log.Printf("Failed to read answer cache: %v", err)
+		return nil, false
+	}
+	if entry == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	c.add(entry)
+	c.mu.Unlock()
+	return entry, true
+}
+
+// Put stores an entry, setting its creation and expiry times. With an Embedder, its
+// query is embedded unless the entry carries the embedding already.
+func (c *Cache) Put(ctx context.Context, entry Entry) {
+	if c.Embedder != nil && entry.Embedding == nil {
+		entry.Embedding = c.embed(ctx, entry.Query)
+	}
+	entry.CreatedAt = c.now()
+	entry.ExpiresAt = time.Time{}
+	if c.ttl > 0 {
+		entry.ExpiresAt = entry.CreatedAt.Add(c.ttl)
+	}
+	entry.Hits = 0
+	c.mu.Lock()
+	if element, ok := c.entries[entry.Key]; ok {
+		c.remove(element)
+	}
+	c.add(&entry)
+	c.mu.Unlock()
+
+	if c.db != nil {
+		if err := c.save(&entry); err != nil {
+			log.Printf("Failed to write answer cache: %v", err)
+		}
+	}
+}
+
+// Invalidate removes every entry generated from the article with the given ID.
+func (c *Cache) Invalidate(articleID string) {
+	c.removeWhere(func(e *Entry) bool {
+		for _, id := range e.ArticleIDs {
+			if id == articleID {
+				return true
+			}
+		}
+		return false
+	})
+	if c.db == nil {
+		return
+	}
+	if _, err := c.deleteWhere("key IN (SELECT cache_key FROM answer_cache_articles WHERE article_id = ?)", articleID); err != nil {
+		log.Printf("Failed to invalidate cached answers for article %s: %v", articleID, err)
+	}
+}
+
+// ArticleSaved implements kb.Observer.
+func (c *Cache) ArticleSaved(article kb.Article) {
+	c.Invalidate(article.ID)
+}
+
+// ArticleDeleted implements kb.Observer.
+func (c *Cache) ArticleDeleted(id string) {
+	c.Invalidate(id)
+}
+
+// List returns up to limit unexpired entries, newest first.
+func (c *Cache) List(limit int) ([]Entry, error) {
+	now := c.now()
+	entries := []Entry{}
+	if c.db == nil {
+		c.mu.Lock()
+		for element := c.lru.Front(); element != nil; element = element.Next() {
+			if entry := element.Value.(*Entry); !entry.expired(now) {
+				entries = append(entries, *entry)
+			}
+		}
+		c.mu.Unlock()
+		sort.SliceStable(entries, func(i, j int) bool { return entries[i].CreatedAt.After(entries[j].CreatedAt) })
+		return entries[:min(limit, len(entries))], nil
+	}
+
+	rows, err := c.db.Query("SELECT key FROM answer_cache WHERE expires_at = 0 OR expires_at > ? ORDER BY created_at DESC, rowid DESC LIMIT ?", now.Unix(), limit)
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		entry, err := c.load(key, now)
+		if err != nil {
+			return nil, err
+		}
+		if entry != nil {
+			entries = append(entries, *entry)
+		}
+	}
+	return entries, nil
+}
+
+// Purge removes the entry with the given key and reports whether there was one.
+func (c *Cache) Purge(key string) (bool, error) {
+	found := c.removeWhere(func(e *Entry) bool { return e.Key == key }) > 0
+	if c.db == nil {
+		return found, nil
+	}
+	deleted, err := c.deleteWhere("key = ?", key)
+	return found || deleted > 0, err
+}
+
+// PurgeAll removes every entry and returns how many there were.
+func (c *Cache) PurgeAll() (int, error) {
+	removed := c.removeWhere(func(*Entry) bool { return true })
+	if c.db == nil {
+		return removed, nil
+	}
+	// The memory tier only holds entries that are also in SQLite.
+	deleted, err := c.deleteWhere("1 = 1")
+	return max(removed, int(deleted)), err
+}
+
+// Len returns the number of entries in the memory tier.
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+// embed returns the embedding of the normalized query, or nil if it fails.
+func (c *Cache) embed(ctx context.Context, query string) []float32 {
+	embeddings, err := c.Embedder.Embed(ctx, []string{Normalize(query)})
+	if err != nil {
+		log.Printf("Failed to embed query for the answer cache: %v", err)
+		return nil
+	}
+	if len(embeddings) != 1 {
+		log.Printf("Failed to embed query for the answer cache: got %d embeddings", len(embeddings))
+		return nil
+	}
+	return embeddings[0]
+}
+
+// hit counts a search answered by entry.
+func (c *Cache) hit(entry *Entry) {
+	c.mu.Lock()
+	entry.Hits++
+	c.mu.Unlock()
+	if c.db == nil {
+		return
+	}
+	if _, err := c.db.Exec("UPDATE answer_cache SET hits = hits + 1 WHERE key = ?", entry.Key); err != nil {
+		log.Printf("Failed to count answer cache hit: %v", err)
+	}
+}
+
+// similar returns the unexpired entry in contextKey whose query embedding is the most
+// similar to embedding, the embedding of query, if that reaches the threshold.
+// Embeddings of another model, and queries negated unlike query, are not compared.
+func (c *Cache) similar(contextKey, query string, embedding []float32) (*Entry, float64, error) {
+	now := c.now()
+	negative := negated(query)
+	bestKey, best := "", 0.0
+	if c.db == nil {
+		c.mu.Lock()
+		for element := c.lru.Front(); element != nil; element = element.Next() {
+			entry := element.Value.(*Entry)
+			if entry.Context != contextKey || entry.expired(now) || negated(entry.Query) != negative {
+				continue
+			}
+			if similarity := retrieval.Cosine(embedding, entry.Embedding); similarity > best {
+				bestKey, best = entry.Key, similarity
+			}
+		}
+		c.mu.Unlock()
+	} else {
+		rows, err := c.db.Query(`SELECT key, query, embedding FROM answer_cache
+            WHERE context = ? AND embedding_model = ? AND embedding IS NOT NULL AND (expires_at = 0 OR expires_at > ?)`,
+			contextKey, c.Embedder.Model(), now.Unix())
+		if err != nil {
+			return nil, 0, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var key, cached string
+			var blob []byte
+			if err := rows.Scan(&key, &cached, &blob); err != nil {
+				return nil, 0, err
+			}
+			if negated(cached) != negative {
+				continue
+			}
+			vector, err := retrieval.DecodeVector(blob)
+			if err != nil {
+				return nil, 0, fmt.Errorf("embedding of cached answer %s: %w", key, err)
+			}
+			if similarity := retrieval.Cosine(embedding, vector); similarity > best {
+				bestKey, best = key, similarity
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return nil, 0, err
+		}
+	}
+	if bestKey == "" || best < c.Threshold {
+		return nil, 0, nil
+	}
+	entry, ok := c.Get(bestKey)
+	if !ok {
+		return nil, 0, nil
+	}
+	return entry, best, nil
+}
+
+// add puts entry at the front of the LRU list, evicting the least recently used entry
+// when the memory tier is full. The caller holds c.mu.
+func (c *Cache) add(entry *Entry) {
+	c.entries[entry.Key] = c.lru.PushFront(entry)
+	for c.lru.Len() > c.size {
+		c.remove(c.lru.Back())
+	}
+}
+
+// remove drops element from the memory tier. The caller holds c.mu.
+func (c *Cache) remove(element *list.Element) {
+	c.lru.Remove(element)
+	delete(c.entries, element.Value.(*Entry).Key)
+}
+
+// removeWhere drops the entries of the memory tier that match and returns how many
+// it dropped.
+func (c *Cache) removeWhere(match func(*Entry) bool) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	removed := 0
+	for element := c.lru.Front(); element != nil; {
+		next := element.Next()
+		if match(element.Value.(*Entry)) {
+			c.remove(element)
+			removed++
+		}
+		element = next
+	}
+	return removed
+}
+
+// load reads the entry for key from SQLite, or nil if there is no unexpired one.
+func (c *Cache) load(key string, now time.Time) (*Entry, error) {
+	entry := &Entry{Key: key}
+	var value string
+	var expiresAt int64
+	var embedding []byte
+	err := c.db.QueryRow("SELECT query, context, value, created_at, expires_at, hits, embedding FROM answer_cache WHERE key = ?", key).
+		Scan(&entry.Query, &entry.Context, &value, &entry.CreatedAt, &expiresAt, &entry.Hits, &embedding)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	entry.Value = json.RawMessage(value)
+	if expiresAt > 0 {
+		entry.ExpiresAt = time.Unix(expiresAt, 0)
+	}
+	if entry.expired(now) {
+		_, err := c.deleteWhere("key = ?", key)
+		return nil, err
+	}
+	if embedding != nil {
+		if entry.Embedding, err = retrieval.DecodeVector(embedding); err != nil {
+			return nil, fmt.Errorf("embedding of cached answer %s: %w", key, err)
+		}
+	}
+
+	rows, err := c.db.Query("SELECT article_id FROM answer_cache_articles WHERE cache_key = ? ORDER BY rowid", key)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		entry.ArticleIDs = append(entry.ArticleIDs, id)
+	}
+	return entry, rows.Err()
+}
+
+// save writes entry to SQLite, replacing any entry with the same key, and drops the
+// entries that have expired.
+func (c *Cache) save(entry *Entry) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var expiresAt int64
+	if !entry.ExpiresAt.IsZero() {
+		expiresAt = entry.ExpiresAt.Unix()
+	}
+	var embeddingModel string
+	var embedding []byte
+	if entry.Embedding != nil && c.Embedder != nil {
+		embeddingModel, embedding = c.Embedder.Model(), retrieval.EncodeVector(entry.Embedding)
+	}
+	if _, err := tx.Exec("DELETE FROM answer_cache_articles WHERE cache_key = ?", entry.Key); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`INSERT OR REPLACE INTO answer_cache(key, query, context, value, created_at, expires_at, embedding_model, embedding)
+        VALUES(?, ?, ?, ?, ?, ?, ?, ?)`,
+		entry.Key, entry.Query, entry.Context, string(entry.Value), entry.CreatedAt.UTC(), expiresAt, embeddingModel, embedding); err != nil {
+		return err
+	}
+	for _, id := range entry.ArticleIDs {
+		if _, err := tx.Exec("INSERT OR IGNORE INTO answer_cache_articles(cache_key, article_id) VALUES(?, ?)", entry.Key, id); err != nil {
+			return err
+		}
+	}
+	if _, err := deleteWhere(tx, "expires_at > 0 AND expires_at <= ?", c.now().Unix()); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// deleteWhere deletes the SQLite entries matching the condition, and their articles,
+// and returns how many entries it deleted.
+func (c *Cache) deleteWhere(condition string, args ...interface{}) (int64, error) {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	deleted, err := deleteWhere(tx, condition, args...)
+	if err != nil {
+		return 0, err
+	}
+	return deleted, tx.Commit()
+}
+
+func deleteWhere(tx *sql.Tx, condition string, args ...interface{}) (int64, error) {
+	res, err := tx.Exec("DELETE FROM answer_cache WHERE "+condition, args...)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec("DELETE FROM answer_cache_articles WHERE cache_key NOT IN (SELECT key FROM answer_cache)"); err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
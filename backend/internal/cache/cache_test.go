@@ -0,0 +1,223 @@
+package cache
+
+import (
+	"ai-knowledge-base/internal/database"
+	"ai-knowledge-base/internal/kb"
+	"ai-knowledge-base/internal/retrieval"
+	"context"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+)
+
+var ctx = context.Background()
+
+var articles = []kb.Article{
+	{ID: "kb-001#0", Title: "How to reset your password", Content: "Click Forgot Password."},
+	{ID: "kb-002#0", Title: "VPN", Content: "Install the VPN client."},
+}
+
+// TestNormalize tests that case, punctuation and spacing do not matter.
+func TestNormalize(t *testing.T) {
+	for _, query := range []string{"How to reset password?", "  how TO reset   password", "how-to reset password!!"} {
+		if got := Normalize(query); got != "how to reset password" {
+			t.Errorf("Normalize(%q) = %q", query, got)
+		}
+	}
+}
+
+// TestKey tests that keys change with the prompt version, the model and the articles'
+// IDs, order and content, but not with the spelling of the query.
+func TestKey(t *testing.T) {
+	key := Key("How to reset password?", "v3", "gemini/gemini-1.5-flash", articles)
+	if Key("how to reset password", "v3", "gemini/gemini-1.5-flash", articles) != key {
+		t.Error("Expected normalized queries to share a key")
+	}
+	edited := append([]kb.Article(nil), articles...)
+	edited[1].Content = "Install the new VPN client."
+	for name, other := range map[string]string{
+		"query":   Key("how to change password", "v3", "gemini/gemini-1.5-flash", articles),
+		"version": Key("how to reset password", "v2", "gemini/gemini-1.5-flash", articles),
+		"model":   Key("how to reset password", "v3", "openai/gpt-4o-mini", articles),
+		"order":   Key("how to reset password", "v3", "gemini/gemini-1.5-flash", []kb.Article{articles[1], articles[0]}),
+		"subset":  Key("how to reset password", "v3", "gemini/gemini-1.5-flash", articles[:1]),
+		"content": Key("how to reset password", "v3", "gemini/gemini-1.5-flash", edited),
+	} {
+		if other == key {
+			t.Errorf("Expected a different key when the %s changes", name)
+		}
+	}
+}
+
+// TestContextKey tests that context keys change with the prompt version, the model and
+// the articles' versions, but not with their order.
+func TestContextKey(t *testing.T) {
+	key := ContextKey("v3", "gemini/gemini-1.5-flash", articles)
+	if ContextKey("v3", "gemini/gemini-1.5-flash", []kb.Article{articles[1], articles[0]}) != key {
+		t.Error("Expected the order of the articles not to matter")
+	}
+	edited := append([]kb.Article(nil), articles...)
+	edited[0].Content = "Click Reset Password."
+	if ContextKey("v2", "gemini/gemini-1.5-flash", articles) == key || ContextKey("v3", "gemini/gemini-1.5-pro", articles) == key || ContextKey("v3", "gemini/gemini-1.5-flash", articles[:1]) == key || ContextKey("v3", "gemini/gemini-1.5-flash", edited) == key {
+		t.Error("Expected a different context key for other prompts or articles")
+	}
+}
+
+// entry returns an entry for key generated from the given articles.
+func entry(key string, articleIDs ...string) Entry {
+	return Entry{Key: key, Query: key, ArticleIDs: articleIDs, Value: json.RawMessage(`{"answer":"` + key + `"}`)}
+}
+
+// TestMemoryTier tests LRU eviction, expiry and invalidation without SQLite.
+func TestMemoryTier(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	c := New(nil, 2, time.Hour)
+	c.now = func() time.Time { return now }
+
+	c.Put(ctx, entry("a", "kb-001"))
+	c.Put(ctx, entry("b", "kb-002"))
+	c.Get("a")
+	c.Put(ctx, entry("c", "kb-001", "kb-003"))
+	if _, ok := c.Get("b"); ok || c.Len() != 2 {
+		t.Errorf("Expected the least recently used entry to be evicted, %d entries left", c.Len())
+	}
+	if e, ok := c.Get("a"); !ok || string(e.Value) != `{"answer":"a"}` || !e.ExpiresAt.Equal(now.Add(time.Hour)) {
+		t.Errorf("Expected entry a, got %+v", e)
+	}
+
+	c.Invalidate("kb-001")
+	if c.Len() != 0 {
+		t.Errorf("Expected the entries of kb-001 invalidated, %d left", c.Len())
+	}
+
+	c.Put(ctx, entry("d"))
+	now = now.Add(time.Hour)
+	if _, ok := c.Get("d"); ok {
+		t.Error("Expected the entry to expire after the TTL")
+	}
+}
+
+// TestSQLiteTier tests that entries survive a restart, expire and are invalidated when
+// an article changes.
+func TestSQLiteTier(t *testing.T) {
+	tempFile := "test_answer_cache.sqlite"
+	defer os.Remove(tempFile)
+	db := database.InitDB(tempFile)
+	defer db.Close()
+
+	now := time.Now()
+	c := New(db, 10, time.Hour)
+	c.Put(ctx, entry("a", "kb-001", "kb-002"))
+	c.Put(ctx, entry("b", "kb-002"))
+	c.Put(ctx, entry("c", "kb-003"))
+
+	restarted := New(db, 10, time.Hour)
+	e, ok := restarted.Get("a")
+	if !ok || string(e.Value) != `{"answer":"a"}` || len(e.ArticleIDs) != 2 || e.ArticleIDs[1] != "kb-002" || e.ExpiresAt.Unix() != now.Add(time.Hour).Unix() {
+		t.Fatalf("Expected entry a from SQLite, got %+v", e)
+	}
+
+	restarted.ArticleSaved(kb.Article{ID: "kb-002"})
+	for _, key := range []string{"a", "b"} {
+		if _, ok := New(db, 10, time.Hour).Get(key); ok {
+			t.Errorf("Expected entry %s invalidated with kb-002", key)
+		}
+	}
+	var links int
+	db.QueryRow("SELECT COUNT(*) FROM answer_cache_articles").Scan(&links)
+	if links != 1 {
+		t.Errorf("Expected only the articles of entry c left, got %d", links)
+	}
+
+	later := New(db, 10, time.Hour)
+	later.now = func() time.Time { return now.Add(2 * time.Hour) }
+	if _, ok := later.Get("c"); ok {
+		t.Error("Expected entry c to have expired")
+	}
+	var rows int
+	db.QueryRow("SELECT COUNT(*) FROM answer_cache").Scan(&rows)
+	if rows != 0 {
+		t.Errorf("Expected the expired entry deleted, %d rows left", rows)
+	}
+}
+
+// TestSemantic tests that paraphrases are matched within the same context and above
+// the threshold only, that negated questions are not, in memory and from SQLite, and
+// that lookups are counted.
+func TestSemantic(t *testing.T) {
+	tempFile := "test_semantic_cache.sqlite"
+	defer os.Remove(tempFile)
+	db := database.InitDB(tempFile)
+	defer db.Close()
+
+	for name, c := range map[string]*Cache{"memory": New(nil, 10, time.Hour), "sqlite": New(db, 10, time.Hour)} {
+		c.Embedder, c.Threshold = retrieval.NewHashEmbedder(256), 0.7
+		stored := entry("a", "kb-001")
+		stored.Query, stored.Context = "how do i reset my password", "ctx-1"
+		c.Put(ctx, stored)
+		if name == "sqlite" {
+			// Match from SQLite rather than the memory tier.
+			c = New(db, 10, time.Hour)
+			c.Embedder, c.Threshold = retrieval.NewHashEmbedder(256), 0.7
+		}
+
+		lookup := c.Find(ctx, "b", "ctx-1", "How can I reset my password?")
+		if lookup.Entry == nil || lookup.Entry.Key != "a" || lookup.Match != MatchSemantic || lookup.Similarity < 0.7 || lookup.Embedding == nil {
+			t.Fatalf("%s: expected a semantic match, got %+v", name, lookup)
+		}
+		if lookup := c.Find(ctx, "b", "ctx-2", "How can I reset my password?"); lookup.Entry != nil {
+			t.Errorf("%s: expected no match in another context, got %+v", name, lookup.Entry)
+		}
+		if lookup := c.Find(ctx, "b", "ctx-1", "install the vpn client"); lookup.Entry != nil {
+			t.Errorf("%s: expected no match below the threshold, got %+v", name, lookup.Entry)
+		}
+		for _, negated := range []string{"How can I not reset my password?", "Why can't I reset my password"} {
+			if lookup := c.Find(ctx, "b", "ctx-1", negated); lookup.Entry != nil {
+				t.Errorf("%s: expected no match for the negated %q, got %+v", name, negated, lookup.Entry)
+			}
+		}
+		if lookup := c.Find(ctx, "a", "ctx-2", "anything"); lookup.Match != MatchExact || lookup.Similarity != 1 {
+			t.Errorf("%s: expected an exact match, got %+v", name, lookup)
+		}
+
+		stats := c.Stats()
+		if stats.ExactHits != 1 || stats.SemanticHits != 1 || stats.Misses != 4 || stats.HitRate != 1.0/3 || stats.MemoryEntries != 1 {
+			t.Errorf("%s: unexpected stats %+v", name, stats)
+		}
+		if entries, err := c.List(10); err != nil || len(entries) != 1 || entries[0].Hits != 2 {
+			t.Errorf("%s: expected the entry with 2 hits, got %+v, %v", name, entries, err)
+		}
+	}
+}
+
+// TestListAndPurge tests listing entries newest first and purging one or all of them.
+func TestListAndPurge(t *testing.T) {
+	tempFile := "test_purge_cache.sqlite"
+	defer os.Remove(tempFile)
+	db := database.InitDB(tempFile)
+	defer db.Close()
+
+	for name, c := range map[string]*Cache{"memory": New(nil, 10, time.Hour), "sqlite": New(db, 10, time.Hour)} {
+		now := time.Now()
+		for i, key := range []string{"a", "b", "c"} {
+			c.now = func() time.Time { return now.Add(time.Duration(i) * time.Second) }
+			c.Put(ctx, entry(key, "kb-001"))
+		}
+		if entries, err := c.List(2); err != nil || len(entries) != 2 || entries[0].Key != "c" || entries[1].Key != "b" {
+			t.Errorf("%s: expected the 2 newest entries, got %+v, %v", name, entries, err)
+		}
+		if found, err := c.Purge("b"); !found || err != nil {
+			t.Errorf("%s: Purge(b) = %t, %v", name, found, err)
+		}
+		if found, _ := c.Purge("b"); found {
+			t.Errorf("%s: expected b to be purged already", name)
+		}
+		if purged, err := c.PurgeAll(); purged != 2 || err != nil {
+			t.Errorf("%s: PurgeAll() = %d, %v, want 2", name, purged, err)
+		}
+		if entries, _ := c.List(10); len(entries) != 0 {
+			t.Errorf("%s: expected no entries left, got %+v", name, entries)
+		}
+	}
+}
@@ -0,0 +1,297 @@
+package config
+
+import (
+	"ai-knowledge-base/internal/ai"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds the server settings that can be tuned through environment variables.
+type Config struct {
+	// Retriever selects the retrieval backend: "bm25" (in-memory index), "fts" (SQLite FTS5),
+	// "vector" (embedding similarity) or "hybrid" (lexical and vector fused with RRF).
+	Retriever string
+	// RetrievalTopK is how many articles are retrieved and sent to the model per search.
+	RetrievalTopK int
+
+	// Embedder selects the embedding backend for vector retrieval: "hash" (deterministic,
+	// offline) or "openai" (any OpenAI-compatible /embeddings endpoint).
+	Embedder string
+	// EmbeddingDimensions is the vector size produced by the hash embedder.
+	EmbeddingDimensions int
+	// EmbeddingBaseURL, EmbeddingAPIKey and EmbeddingModel configure the "openai" embedder.
+	EmbeddingBaseURL string
+	EmbeddingAPIKey  string
+	EmbeddingModel   string
+	// VectorIndex selects the nearest-neighbour index: "brute" (exact) or "hnsw" (approximate).
+	VectorIndex string
+
+	// HybridLexical selects the lexical stage of hybrid retrieval: "bm25" or "fts".
+	HybridLexical string
+	// HybridLexicalWeight and HybridVectorWeight scale each stage's reciprocal rank fusion score.
+	HybridLexicalWeight float64
+	HybridVectorWeight  float64
+	// RRFK is the reciprocal rank fusion rank offset.
+	RRFK float64
+
+	// LLMProvider selects the model backend: "gemini", "openai" (any OpenAI-compatible
+	// chat-completions API), "ollama" or "fake" (deterministic and offline).
+	LLMProvider string
+	// LLMModel and LLMBaseURL override the provider's default model and endpoint.
+	LLMModel   string
+	LLMBaseURL string
+	// LLMAPIKey authenticates with the provider. For Gemini it defaults to GEMINI_API_KEY.
+	LLMAPIKey string
+	// LLMFallbacks lists providers to try in order when the primary fails, each as
+	// "provider" or "provider:model". Their API keys come from GEMINI_API_KEY and
+	// OPENAI_API_KEY.
+	LLMFallbacks []string
+	// RetrievalFallback ends the fallback chain with the retrieval-only answer in the
+	// default answer mode too, not only in auto mode. It is off so that answer mode
+	// fails rather than degrading to auto.
+	RetrievalFallback bool
+	// BreakerFailureThreshold consecutive failures open a provider's circuit breaker,
+	// which then rejects requests for BreakerCooldown before probing the provider again.
+	BreakerFailureThreshold int
+	BreakerCooldown         time.Duration
+	// AIMaxAttempts is how many times a request that fails with a transient error (rate
+	// limit, server error, timeout) is tried. AIRetryBaseDelay and AIRetryMaxDelay bound
+	// the exponential backoff between attempts.
+	AIMaxAttempts    int
+	AIRetryBaseDelay time.Duration
+	AIRetryMaxDelay  time.Duration
+	// AIJSONRepairs is how many times an answer that is not valid JSON, or does not
+	// match the expected schema, is sent back to the model to be fixed.
+	AIJSONRepairs int
+	// PromptVersion selects the prompt templates sent to the model. PromptsDir is a
+	// directory of additional versions, each a subdirectory holding answer.tmpl and
+	// stream.tmpl; empty means only the built-in versions.
+	PromptVersion string
+	PromptsDir    string
+	// PromptTokenBudget caps the estimated tokens of an answer prompt. Articles are
+	// added in rank order until it is reached. Zero means no limit.
+	PromptTokenBudget int
+
+	// GroundingMinScore is the grounding score below which an AI answer is withheld,
+	// from 0 to 1. Zero never withholds answers but still reports their grounding.
+	GroundingMinScore float64
+	// GroundingJudge also asks the LLM whether each sentence of an answer is supported
+	// by the cited passages, in addition to the lexical check.
+	GroundingJudge bool
+
+	// InjectionPolicy is what happens to queries and articles flagged as prompt-injection
+	// attempts: "block", "warn" or "strip".
+	InjectionPolicy string
+	// InjectionThreshold is the detector score, from 0 to 1, from which text is flagged.
+	InjectionThreshold float64
+
+	// ConversationHistoryTokens is how much of a conversation, in estimated tokens, is
+	// sent to the model with a follow-up question. Zero sends none.
+	ConversationHistoryTokens int
+	// QueryRewrite has the model rewrite follow-up questions into standalone search
+	// queries. Otherwise they are prefixed with the previous question.
+	QueryRewrite bool
+
+	// AIPrices overrides or adds to the built-in price table, each entry as
+	// "model=input/output" in US dollars per million tokens.
+	AIPrices []string
+	// DailyBudgetUSD caps the estimated daily cost of AI requests of all clients, and
+	// ClientDailyBudgetUSD of each client address. Searches past a cap are answered
+	// with retrieval only. Zero means no cap.
+	DailyBudgetUSD       float64
+	ClientDailyBudgetUSD float64
+	// CallerHeader is the request header labelling callers in usage reports. It is not
+	// authenticated, so budgets do not use it.
+	CallerHeader string
+	// AdminToken is the bearer token the admin endpoints require. Empty disables them.
+	AdminToken string
+
+	// AnswerCache reuses the AI answer to a question asked again about the same
+	// articles. AnswerCacheSize is how many answers are kept in memory, in front of the
+	// SQLite copy, and AnswerCacheTTL how long answers are served. Zero never expires them.
+	AnswerCache     bool
+	AnswerCacheSize int
+	AnswerCacheTTL  time.Duration
+	// SemanticCache also serves a cached answer to a question about the same articles
+	// whose embedding is at least SemanticCacheThreshold cosine-similar to the cached
+	// question's, using the EMBEDDER. It needs a semantic embedder: the hash embedder
+	// only compares words, so the server disables it with that one.
+	SemanticCache          bool
+	SemanticCacheThreshold float64
+
+	// Chunking indexes articles as passages instead of whole documents, so that long
+	// articles are retrieved and cited at passage level.
+	Chunking bool
+	// ChunkMaxTokens and ChunkOverlapTokens size the passages (in words) and the overlap
+	// between consecutive windows of a long paragraph.
+	ChunkMaxTokens     int
+	ChunkOverlapTokens int
+
+	// SearchTimeout bounds a whole search request, and RetrievalTimeout and AITimeout
+	// bound its retrieval and answer-generation stages. Zero means no limit.
+	SearchTimeout    time.Duration
+	RetrievalTimeout time.Duration
+	AITimeout        time.Duration
+}
+
+// Load reads the configuration from the environment, falling back to defaults for unset values.
+func Load() Config {
+	return Config{
+		Retriever:     getString("RETRIEVER", "bm25"),
+		RetrievalTopK: getInt("RETRIEVAL_TOP_K", 5),
+
+		Embedder:            getString("EMBEDDER", "hash"),
+		EmbeddingDimensions: getInt("EMBEDDING_DIMENSIONS", 256),
+		EmbeddingBaseURL:    getString("EMBEDDING_BASE_URL", "https://api.openai.com/v1"),
+		EmbeddingAPIKey:     os.Getenv("EMBEDDING_API_KEY"),
+		EmbeddingModel:      getString("EMBEDDING_MODEL", "text-embedding-3-small"),
+		VectorIndex:         getString("VECTOR_INDEX", "brute"),
+
+		HybridLexical:       getString("HYBRID_LEXICAL", "bm25"),
+		HybridLexicalWeight: getFloat("HYBRID_LEXICAL_WEIGHT", 1.0),
+		HybridVectorWeight:  getFloat("HYBRID_VECTOR_WEIGHT", 1.0),
+		RRFK:                getFloat("RRF_K", 60),
+
+		LLMProvider: getString("LLM_PROVIDER", "gemini"),
+		LLMModel:    os.Getenv("LLM_MODEL"),
+		LLMBaseURL:  os.Getenv("LLM_BASE_URL"),
+		LLMAPIKey:   os.Getenv("LLM_API_KEY"),
+
+		LLMFallbacks:            getList("LLM_FALLBACKS"),
+		RetrievalFallback:       getBool("RETRIEVAL_FALLBACK", false),
+		BreakerFailureThreshold: getInt("BREAKER_FAILURE_THRESHOLD", 5),
+		BreakerCooldown:         getDuration("BREAKER_COOLDOWN", 30*time.Second),
+
+		AIMaxAttempts:    getInt("AI_MAX_ATTEMPTS", 3),
+		AIRetryBaseDelay: getDuration("AI_RETRY_BASE_DELAY", 200*time.Millisecond),
+		AIRetryMaxDelay:  getDuration("AI_RETRY_MAX_DELAY", 5*time.Second),
+		AIJSONRepairs:    getCount("AI_JSON_REPAIRS", 1),
+		PromptVersion:    getString("PROMPT_VERSION", ai.DefaultPromptVersion),
+		PromptsDir:       os.Getenv("PROMPTS_DIR"),
+
+		PromptTokenBudget: getCount("PROMPT_TOKEN_BUDGET", 6000),
+
+		GroundingMinScore: getFloat("GROUNDING_MIN_SCORE", 0.5),
+		GroundingJudge:    getBool("GROUNDING_JUDGE", false),
+
+		InjectionPolicy:    getString("INJECTION_POLICY", "warn"),
+		InjectionThreshold: getFloat("INJECTION_THRESHOLD", 0.5),
+
+		ConversationHistoryTokens: getCount("CONVERSATION_HISTORY_TOKENS", 500),
+		QueryRewrite:              getBool("QUERY_REWRITE", true),
+
+		AIPrices:             getList("AI_PRICES"),
+		DailyBudgetUSD:       getFloat("DAILY_BUDGET_USD", 0),
+		ClientDailyBudgetUSD: getFloat("CLIENT_DAILY_BUDGET_USD", 0),
+		CallerHeader:         getString("CALLER_HEADER", "X-User-ID"),
+		AdminToken:           os.Getenv("ADMIN_TOKEN"),
+
+		AnswerCache:     getBool("ANSWER_CACHE", true),
+		AnswerCacheSize: getInt("ANSWER_CACHE_SIZE", 1000),
+		AnswerCacheTTL:  getDuration("ANSWER_CACHE_TTL", 24*time.Hour),
+
+		SemanticCache:          getBool("SEMANTIC_CACHE", false),
+		SemanticCacheThreshold: getFloat("SEMANTIC_CACHE_THRESHOLD", 0.9),
+
+		Chunking:           getBool("CHUNKING", true),
+		ChunkMaxTokens:     getInt("CHUNK_MAX_TOKENS", 200),
+		ChunkOverlapTokens: getCount("CHUNK_OVERLAP_TOKENS", 40),
+
+		SearchTimeout:    getDuration("SEARCH_TIMEOUT", 30*time.Second),
+		RetrievalTimeout: getDuration("RETRIEVAL_TIMEOUT", 5*time.Second),
+		AITimeout:        getDuration("AI_TIMEOUT", 25*time.Second),
+	}
+}
+
+// getString reads a string environment variable, falling back when it is unset.
+func getString(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// getList reads a comma-separated environment variable, dropping empty items.
+func getList(key string) []string {
+	var items []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// getInt reads a positive integer environment variable, logging and ignoring invalid values.
+func getInt(key string, fallback int) int {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return fallback
+	}
+	value, err := strconv.Atoi(raw)
+	if err != nil || value <= 0 {
+		log.Printf("Warning: invalid %s=%q, using default %d", key, raw, fallback)
+		return fallback
+	}
+	return value
+}
+
+// getCount reads a non-negative integer environment variable, logging and ignoring invalid values.
+func getCount(key string, fallback int) int {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return fallback
+	}
+	value, err := strconv.Atoi(raw)
+	if err != nil || value < 0 {
+		log.Printf("Warning: invalid %s=%q, using default %d", key, raw, fallback)
+		return fallback
+	}
+	return value
+}
+
+// getBool reads a boolean environment variable, logging and ignoring invalid values.
+func getBool(key string, fallback bool) bool {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return fallback
+	}
+	value, err := strconv.ParseBool(raw)
+	if err != nil {
+		log.Printf("Warning: invalid %s=%q, using default %t", key, raw, fallback)
+		return fallback
+	}
+	return value
+}
+
+// getFloat reads a non-negative float environment variable, logging and ignoring invalid values.
+func getFloat(key string, fallback float64) float64 {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return fallback
+	}
+	value, err := strconv.ParseFloat(raw, 64)
+	if err != nil || value < 0 {
+		log.Printf("Warning: invalid %s=%q, using default %g", key, raw, fallback)
+		return fallback
+	}
+	return value
+}
+
+// getDuration reads a non-negative duration environment variable such as "30s",
+// logging and ignoring invalid values.
+func getDuration(key string, fallback time.Duration) time.Duration {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return fallback
+	}
+	value, err := time.ParseDuration(raw)
+	if err != nil || value < 0 {
+		log.Printf("Warning: invalid %s=%q, using default %s", key, raw, fallback)
+		return fallback
+	}
+	return value
+}
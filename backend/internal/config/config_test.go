@@ -0,0 +1,291 @@
+package config
+
+import (
+	"ai-knowledge-base/internal/ai"
+	"testing"
+	"time"
+)
+
+// TestLoadDefaults tests that Load falls back to defaults when nothing is set.
+func TestLoadDefaults(t *testing.T) {
+	t.Setenv("RETRIEVAL_TOP_K", "")
+	t.Setenv("RETRIEVER", "")
+	t.Setenv("EMBEDDER", "")
+	t.Setenv("EMBEDDING_DIMENSIONS", "")
+	t.Setenv("VECTOR_INDEX", "")
+
+	cfg := Load()
+	if cfg.Retriever != "bm25" {
+		t.Errorf("Expected default Retriever 'bm25', got '%s'", cfg.Retriever)
+	}
+	if cfg.RetrievalTopK != 5 {
+		t.Errorf("Expected default RetrievalTopK 5, got %d", cfg.RetrievalTopK)
+	}
+	if cfg.Embedder != "hash" || cfg.EmbeddingDimensions != 256 || cfg.VectorIndex != "brute" {
+		t.Errorf("Unexpected embedding defaults: %+v", cfg)
+	}
+}
+
+// TestLoadFromEnv tests that Load reads values from the environment.
+func TestLoadFromEnv(t *testing.T) {
+	t.Setenv("RETRIEVAL_TOP_K", "12")
+	t.Setenv("RETRIEVER", "fts")
+	t.Setenv("VECTOR_INDEX", "hnsw")
+	t.Setenv("EMBEDDING_MODEL", "nomic-embed-text")
+
+	cfg := Load()
+	if cfg.VectorIndex != "hnsw" || cfg.EmbeddingModel != "nomic-embed-text" {
+		t.Errorf("Unexpected embedding settings: %+v", cfg)
+	}
+	if cfg.Retriever != "fts" {
+		t.Errorf("Expected Retriever 'fts', got '%s'", cfg.Retriever)
+	}
+	if cfg.RetrievalTopK != 12 {
+		t.Errorf("Expected RetrievalTopK 12, got %d", cfg.RetrievalTopK)
+	}
+}
+
+// TestLoadHybridWeights tests reading and validating the float-valued hybrid settings.
+func TestLoadHybridWeights(t *testing.T) {
+	t.Setenv("HYBRID_LEXICAL_WEIGHT", "0.5")
+	t.Setenv("HYBRID_VECTOR_WEIGHT", "-1")
+	t.Setenv("RRF_K", "")
+
+	cfg := Load()
+	if cfg.HybridLexicalWeight != 0.5 {
+		t.Errorf("Expected HybridLexicalWeight 0.5, got %g", cfg.HybridLexicalWeight)
+	}
+	if cfg.HybridVectorWeight != 1.0 {
+		t.Errorf("Expected negative weight to fall back to 1.0, got %g", cfg.HybridVectorWeight)
+	}
+	if cfg.RRFK != 60 {
+		t.Errorf("Expected default RRFK 60, got %g", cfg.RRFK)
+	}
+}
+
+// TestLoadInvalidValues tests that invalid values are ignored in favour of the defaults.
+func TestLoadInvalidValues(t *testing.T) {
+	for _, raw := range []string{"abc", "0", "-3"} {
+		t.Setenv("RETRIEVAL_TOP_K", raw)
+		if cfg := Load(); cfg.RetrievalTopK != 5 {
+			t.Errorf("RETRIEVAL_TOP_K=%q: expected default 5, got %d", raw, cfg.RetrievalTopK)
+		}
+	}
+}
+
+// TestLoadChunking tests the chunking settings, including a zero overlap.
+func TestLoadChunking(t *testing.T) {
+	t.Setenv("CHUNKING", "")
+	t.Setenv("CHUNK_MAX_TOKENS", "")
+	t.Setenv("CHUNK_OVERLAP_TOKENS", "")
+	if cfg := Load(); !cfg.Chunking || cfg.ChunkMaxTokens != 200 || cfg.ChunkOverlapTokens != 40 {
+		t.Errorf("Unexpected chunking defaults: %+v", cfg)
+	}
+
+	t.Setenv("CHUNKING", "false")
+	t.Setenv("CHUNK_MAX_TOKENS", "80")
+	t.Setenv("CHUNK_OVERLAP_TOKENS", "0")
+	if cfg := Load(); cfg.Chunking || cfg.ChunkMaxTokens != 80 || cfg.ChunkOverlapTokens != 0 {
+		t.Errorf("Unexpected chunking settings: %+v", cfg)
+	}
+
+	t.Setenv("CHUNKING", "maybe")
+	t.Setenv("CHUNK_OVERLAP_TOKENS", "-1")
+	if cfg := Load(); !cfg.Chunking || cfg.ChunkOverlapTokens != 40 {
+		t.Errorf("Expected invalid values to fall back to defaults, got %+v", cfg)
+	}
+}
+
+// TestLoadLLM tests the model provider settings.
+func TestLoadLLM(t *testing.T) {
+	t.Setenv("LLM_PROVIDER", "")
+	t.Setenv("LLM_MODEL", "")
+	if cfg := Load(); cfg.LLMProvider != "gemini" || cfg.LLMModel != "" {
+		t.Errorf("Unexpected LLM defaults: %+v", cfg)
+	}
+
+	t.Setenv("LLM_PROVIDER", "ollama")
+	t.Setenv("LLM_MODEL", "mistral")
+	t.Setenv("LLM_BASE_URL", "http://gpu-box:11434")
+	if cfg := Load(); cfg.LLMProvider != "ollama" || cfg.LLMModel != "mistral" || cfg.LLMBaseURL != "http://gpu-box:11434" {
+		t.Errorf("Unexpected LLM settings: %+v", cfg)
+	}
+}
+
+// TestLoadTimeouts tests the search deadlines, including a disabled stage budget.
+func TestLoadTimeouts(t *testing.T) {
+	t.Setenv("SEARCH_TIMEOUT", "")
+	t.Setenv("RETRIEVAL_TIMEOUT", "")
+	t.Setenv("AI_TIMEOUT", "")
+	if cfg := Load(); cfg.SearchTimeout != 30*time.Second || cfg.RetrievalTimeout != 5*time.Second || cfg.AITimeout != 25*time.Second {
+		t.Errorf("Unexpected timeout defaults: %+v", cfg)
+	}
+
+	t.Setenv("SEARCH_TIMEOUT", "2m")
+	t.Setenv("RETRIEVAL_TIMEOUT", "0")
+	t.Setenv("AI_TIMEOUT", "soon")
+	if cfg := Load(); cfg.SearchTimeout != 2*time.Minute || cfg.RetrievalTimeout != 0 || cfg.AITimeout != 25*time.Second {
+		t.Errorf("Unexpected timeout settings: %+v", cfg)
+	}
+}
+
+// TestLoadRetry tests the AI retry settings.
+func TestLoadRetry(t *testing.T) {
+	t.Setenv("AI_MAX_ATTEMPTS", "")
+	t.Setenv("AI_RETRY_BASE_DELAY", "")
+	t.Setenv("AI_RETRY_MAX_DELAY", "")
+	if cfg := Load(); cfg.AIMaxAttempts != 3 || cfg.AIRetryBaseDelay != 200*time.Millisecond || cfg.AIRetryMaxDelay != 5*time.Second {
+		t.Errorf("Unexpected retry defaults: %+v", cfg)
+	}
+
+	t.Setenv("AI_MAX_ATTEMPTS", "1")
+	t.Setenv("AI_RETRY_BASE_DELAY", "1s")
+	t.Setenv("AI_RETRY_MAX_DELAY", "1m")
+	if cfg := Load(); cfg.AIMaxAttempts != 1 || cfg.AIRetryBaseDelay != time.Second || cfg.AIRetryMaxDelay != time.Minute {
+		t.Errorf("Unexpected retry settings: %+v", cfg)
+	}
+}
+
+// TestLoadFallbacks tests the fallback chain and circuit breaker settings.
+func TestLoadFallbacks(t *testing.T) {
+	t.Setenv("LLM_FALLBACKS", "")
+	t.Setenv("BREAKER_FAILURE_THRESHOLD", "")
+	t.Setenv("BREAKER_COOLDOWN", "")
+	if cfg := Load(); cfg.LLMFallbacks != nil || cfg.BreakerFailureThreshold != 5 || cfg.BreakerCooldown != 30*time.Second {
+		t.Errorf("Unexpected fallback defaults: %+v", cfg)
+	}
+
+	t.Setenv("LLM_FALLBACKS", " openai:gpt-4o, ,ollama ")
+	t.Setenv("BREAKER_FAILURE_THRESHOLD", "2")
+	t.Setenv("BREAKER_COOLDOWN", "1m")
+	cfg := Load()
+	if len(cfg.LLMFallbacks) != 2 || cfg.LLMFallbacks[0] != "openai:gpt-4o" || cfg.LLMFallbacks[1] != "ollama" {
+		t.Errorf("Unexpected fallbacks %q", cfg.LLMFallbacks)
+	}
+	if cfg.BreakerFailureThreshold != 2 || cfg.BreakerCooldown != time.Minute {
+		t.Errorf("Unexpected breaker settings: %+v", cfg)
+	}
+}
+
+// TestLoadRetrievalFallback tests that answer mode does not fall back to retrieval-only
+// unless RETRIEVAL_FALLBACK is set.
+func TestLoadRetrievalFallback(t *testing.T) {
+	t.Setenv("RETRIEVAL_FALLBACK", "")
+	if cfg := Load(); cfg.RetrievalFallback {
+		t.Error("Expected no retrieval-only fallback in answer mode by default")
+	}
+	t.Setenv("RETRIEVAL_FALLBACK", "true")
+	if cfg := Load(); !cfg.RetrievalFallback {
+		t.Error("Expected RETRIEVAL_FALLBACK=true to enable the fallback")
+	}
+}
+
+// TestLoadJSONRepairs tests that AI_JSON_REPAIRS defaults to one repair and accepts zero.
+func TestLoadJSONRepairs(t *testing.T) {
+	t.Setenv("AI_JSON_REPAIRS", "")
+	if cfg := Load(); cfg.AIJSONRepairs != 1 {
+		t.Errorf("Expected 1 repair by default, got %d", cfg.AIJSONRepairs)
+	}
+	t.Setenv("AI_JSON_REPAIRS", "0")
+	if cfg := Load(); cfg.AIJSONRepairs != 0 {
+		t.Errorf("Expected repairs to be disabled, got %d", cfg.AIJSONRepairs)
+	}
+}
+
+// TestLoadGrounding tests the grounding check settings.
+func TestLoadGrounding(t *testing.T) {
+	t.Setenv("GROUNDING_MIN_SCORE", "")
+	t.Setenv("GROUNDING_JUDGE", "")
+	if cfg := Load(); cfg.GroundingMinScore != 0.5 || cfg.GroundingJudge {
+		t.Errorf("Unexpected grounding defaults: %+v", cfg)
+	}
+	t.Setenv("GROUNDING_MIN_SCORE", "0.8")
+	t.Setenv("GROUNDING_JUDGE", "true")
+	if cfg := Load(); cfg.GroundingMinScore != 0.8 || !cfg.GroundingJudge {
+		t.Errorf("Unexpected grounding settings: %+v", cfg)
+	}
+}
+
+// TestLoadInjection tests the prompt-injection settings.
+func TestLoadInjection(t *testing.T) {
+	t.Setenv("INJECTION_POLICY", "")
+	t.Setenv("INJECTION_THRESHOLD", "")
+	if cfg := Load(); cfg.InjectionPolicy != "warn" || cfg.InjectionThreshold != 0.5 {
+		t.Errorf("Unexpected injection defaults: %+v", cfg)
+	}
+	t.Setenv("INJECTION_POLICY", "block")
+	t.Setenv("INJECTION_THRESHOLD", "0.7")
+	if cfg := Load(); cfg.InjectionPolicy != "block" || cfg.InjectionThreshold != 0.7 {
+		t.Errorf("Unexpected injection settings: %+v", cfg)
+	}
+}
+
+// TestLoadConversation tests the follow-up question settings.
+func TestLoadConversation(t *testing.T) {
+	t.Setenv("CONVERSATION_HISTORY_TOKENS", "")
+	t.Setenv("QUERY_REWRITE", "")
+	if cfg := Load(); cfg.ConversationHistoryTokens != 500 || !cfg.QueryRewrite {
+		t.Errorf("Unexpected conversation defaults: %+v", cfg)
+	}
+	t.Setenv("CONVERSATION_HISTORY_TOKENS", "0")
+	t.Setenv("QUERY_REWRITE", "false")
+	if cfg := Load(); cfg.ConversationHistoryTokens != 0 || cfg.QueryRewrite {
+		t.Errorf("Unexpected conversation settings: %+v", cfg)
+	}
+}
+
+// TestLoadUsage tests the usage accounting and budget settings.
+func TestLoadUsage(t *testing.T) {
+	for _, key := range []string{"AI_PRICES", "DAILY_BUDGET_USD", "CLIENT_DAILY_BUDGET_USD", "CALLER_HEADER", "ADMIN_TOKEN"} {
+		t.Setenv(key, "")
+	}
+	if cfg := Load(); cfg.AIPrices != nil || cfg.DailyBudgetUSD != 0 || cfg.ClientDailyBudgetUSD != 0 || cfg.CallerHeader != "X-User-ID" || cfg.AdminToken != "" {
+		t.Errorf("Unexpected usage defaults: %+v", cfg)
+	}
+	t.Setenv("AI_PRICES", "gpt-4o=2.5/10, my-model=1/2")
+	t.Setenv("DAILY_BUDGET_USD", "20")
+	t.Setenv("CLIENT_DAILY_BUDGET_USD", "0.5")
+	t.Setenv("CALLER_HEADER", "X-Team")
+	t.Setenv("ADMIN_TOKEN", "secret")
+	cfg := Load()
+	if len(cfg.AIPrices) != 2 || cfg.AIPrices[1] != "my-model=1/2" || cfg.DailyBudgetUSD != 20 || cfg.ClientDailyBudgetUSD != 0.5 ||
+		cfg.CallerHeader != "X-Team" || cfg.AdminToken != "secret" {
+		t.Errorf("Unexpected usage settings: %+v", cfg)
+	}
+}
+
+// TestLoadAnswerCache tests the answer cache settings.
+func TestLoadAnswerCache(t *testing.T) {
+	t.Setenv("ANSWER_CACHE", "")
+	t.Setenv("ANSWER_CACHE_SIZE", "")
+	t.Setenv("ANSWER_CACHE_TTL", "")
+	t.Setenv("SEMANTIC_CACHE", "")
+	t.Setenv("SEMANTIC_CACHE_THRESHOLD", "")
+	if cfg := Load(); !cfg.AnswerCache || cfg.AnswerCacheSize != 1000 || cfg.AnswerCacheTTL != 24*time.Hour || cfg.SemanticCache || cfg.SemanticCacheThreshold != 0.9 {
+		t.Errorf("Unexpected answer cache defaults: %+v", cfg)
+	}
+	t.Setenv("ANSWER_CACHE", "false")
+	t.Setenv("ANSWER_CACHE_SIZE", "50")
+	t.Setenv("ANSWER_CACHE_TTL", "0")
+	t.Setenv("SEMANTIC_CACHE", "true")
+	t.Setenv("SEMANTIC_CACHE_THRESHOLD", "0.85")
+	if cfg := Load(); cfg.AnswerCache || cfg.AnswerCacheSize != 50 || cfg.AnswerCacheTTL != 0 || !cfg.SemanticCache || cfg.SemanticCacheThreshold != 0.85 {
+		t.Errorf("Unexpected answer cache settings: %+v", cfg)
+	}
+}
+
+// TestLoadPrompts tests the prompt selection settings.
+func TestLoadPrompts(t *testing.T) {
+	t.Setenv("PROMPT_VERSION", "")
+	t.Setenv("PROMPTS_DIR", "")
+	t.Setenv("PROMPT_TOKEN_BUDGET", "")
+	if cfg := Load(); cfg.PromptVersion != ai.DefaultPromptVersion || cfg.PromptsDir != "" || cfg.PromptTokenBudget != 6000 {
+		t.Errorf("Unexpected prompt defaults: %+v", cfg)
+	}
+	t.Setenv("PROMPT_VERSION", "v1")
+	t.Setenv("PROMPTS_DIR", "./prompts")
+	t.Setenv("PROMPT_TOKEN_BUDGET", "0")
+	if cfg := Load(); cfg.PromptVersion != "v1" || cfg.PromptsDir != "./prompts" || cfg.PromptTokenBudget != 0 {
+		t.Errorf("Unexpected prompt settings: %+v", cfg)
+	}
+}
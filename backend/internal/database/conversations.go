@@ -0,0 +1,99 @@
+package database
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+// ErrConversationNotFound is returned for a conversation ID that does not exist.
+var ErrConversationNotFound = errors.New("conversation not found")
+
+// Message is one turn of a conversation: a user's question or the answer to it.
+type Message struct {
+	ID             int64
+	ConversationID string
+	// Role is "user" or "assistant".
+	Role    string
+	Content string
+	// RewrittenQuery is the standalone query a follow-up question was rewritten to for
+	// retrieval. It is empty for answers and for questions that were not rewritten.
+	RewrittenQuery string
+	// SearchID is the search_history record of the search the message belongs to, or 0.
+	SearchID  int64
+	CreatedAt time.Time
+}
+
+// CreateConversation starts a new conversation and returns its randomly generated ID.
+func CreateConversation(db *sql.DB) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	id := hex.EncodeToString(b)
+	if _, err := db.Exec("INSERT INTO conversations(id) VALUES(?)", id); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// RecentMessages returns up to limit of the latest messages of a conversation, oldest
+// first, or ErrConversationNotFound if there is no such conversation.
+func RecentMessages(db *sql.DB, conversationID string, limit int) ([]Message, error) {
+	var exists bool
+	if err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM conversations WHERE id = ?)", conversationID).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrConversationNotFound
+	}
+
+	rows, err := db.Query(`SELECT id, conversation_id, role, content, COALESCE(rewritten_query, ''), COALESCE(search_id, 0), created_at
+        FROM messages WHERE conversation_id = ? ORDER BY id DESC LIMIT ?`, conversationID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var messages []Message
+	for rows.Next() {
+		var m Message
+		if err := rows.Scan(&m.ID, &m.ConversationID, &m.Role, &m.Content, &m.RewrittenQuery, &m.SearchID, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		messages = append(messages, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	// The newest messages were selected; return them in conversation order.
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+	return messages, nil
+}
+
+// SaveMessages appends messages to a conversation in one transaction.
+func SaveMessages(db *sql.DB, conversationID string, messages ...Message) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare("INSERT INTO messages(conversation_id, role, content, rewritten_query, search_id) VALUES(?, ?, ?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, m := range messages {
+		if _, err := stmt.Exec(conversationID, m.Role, m.Content, m.RewrittenQuery, m.SearchID); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec("UPDATE conversations SET updated_at = CURRENT_TIMESTAMP WHERE id = ?", conversationID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,52 @@
+package database
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+// TestConversations tests saving turns and loading the latest messages in order.
+func TestConversations(t *testing.T) {
+	tempFile := "test_conversations.sqlite"
+	defer os.Remove(tempFile)
+
+	db := InitDB(tempFile)
+	defer db.Close()
+
+	id, err := CreateConversation(db)
+	if err != nil || len(id) != 32 {
+		t.Fatalf("CreateConversation returned %q, %v", id, err)
+	}
+	if err := SaveMessages(db, id,
+		Message{Role: "user", Content: "How do I connect to the VPN?", SearchID: 1},
+		Message{Role: "assistant", Content: "Install the client.", SearchID: 1},
+	); err != nil {
+		t.Fatalf("SaveMessages failed: %v", err)
+	}
+	if err := SaveMessages(db, id,
+		Message{Role: "user", Content: "What if that fails?", RewrittenQuery: "VPN connection fails", SearchID: 2},
+		Message{Role: "assistant", Content: "Restart your computer.", SearchID: 2},
+	); err != nil {
+		t.Fatalf("SaveMessages failed: %v", err)
+	}
+
+	messages, err := RecentMessages(db, id, 3)
+	if err != nil {
+		t.Fatalf("RecentMessages failed: %v", err)
+	}
+	if len(messages) != 3 || messages[0].Content != "Install the client." || messages[2].Content != "Restart your computer." {
+		t.Fatalf("Expected the latest 3 messages oldest first, got %+v", messages)
+	}
+	if m := messages[1]; m.RewrittenQuery != "VPN connection fails" || m.SearchID != 2 || m.ConversationID != id || m.CreatedAt.IsZero() {
+		t.Errorf("Unexpected message %+v", m)
+	}
+
+	other, _ := CreateConversation(db)
+	if messages, err := RecentMessages(db, other, 10); err != nil || len(messages) != 0 {
+		t.Errorf("Expected a new conversation to be empty, got %+v, %v", messages, err)
+	}
+	if _, err := RecentMessages(db, "missing", 10); !errors.Is(err, ErrConversationNotFound) {
+		t.Errorf("Expected ErrConversationNotFound, got %v", err)
+	}
+}
@@ -16,7 +16,23 @@ type SearchHistory struct {
 	UserQuery          string
 	AISummaryAnswer    string
 	AIRelevantArticles string
-	CreatedAt          time.Time
+	// Provider is the AI provider that served the answer, or "retrieval" when no
+	// provider did and the ranked articles were returned instead.
+	Provider string
+	// CitationWarnings is a JSON array of the model's citations that were dropped or
+	// corrected because they did not match the articles it was given.
+	CitationWarnings string
+	// PromptVersion is the version of the prompt that produced the answer, empty for
+	// retrieval-only answers.
+	PromptVersion string
+	// Caller identifies who made the search, from the caller header or the client address.
+	Caller string
+	// PromptTokens, CompletionTokens and CostUSD total the AI requests of the search:
+	// query rewriting, the answer and its repairs, and the grounding judge.
+	PromptTokens     int
+	CompletionTokens int
+	CostUSD          float64
+	CreatedAt        time.Time
 }
 
 // InitDB initializes the SQLite database connection and creates the necessary tables.
@@ -41,30 +57,280 @@ func InitDB(filepath string) *sql.DB {
         "user_query" TEXT,
         "ai_summary_answer" TEXT,
         "ai_relevant_articles" TEXT,
-        "created_at" TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+        "created_at" TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        "provider" TEXT,
+        "citation_warnings" TEXT,
+        "prompt_version" TEXT,
+        "caller" TEXT,
+        "prompt_tokens" INTEGER NOT NULL DEFAULT 0,
+        "completion_tokens" INTEGER NOT NULL DEFAULT 0,
+        "cost_usd" REAL NOT NULL DEFAULT 0
     );`
 
 	_, err = db.Exec(createTableSQL)
 	if err != nil {
 		log.Fatalf("Failed to create table: %v", err)
 	}
+	// Databases created before a column was added get it on startup.
+	for _, column := range []struct{ name, definition string }{
+		{"provider", "TEXT"},
+		{"citation_warnings", "TEXT"},
+		{"prompt_version", "TEXT"},
+		{"caller", "TEXT"},
+		{"prompt_tokens", "INTEGER NOT NULL DEFAULT 0"},
+		{"completion_tokens", "INTEGER NOT NULL DEFAULT 0"},
+		{"cost_usd", "REAL NOT NULL DEFAULT 0"},
+	} {
+		if err := ensureColumn(db, "search_history", column.name, column.definition); err != nil {
+			log.Fatalf("Failed to migrate search_history table: %v", err)
+		}
+	}
+
+	// ai_usage holds the tokens and estimated cost of each model used by a search, one
+	// row per model, for usage reports and daily budgets. caller is the label the client
+	// claims for reports, and client the address the server saw, which budgets use.
+	createUsageSQL := `
+    CREATE TABLE IF NOT EXISTS ai_usage (
+        "id" INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+        "search_id" INTEGER,
+        "caller" TEXT NOT NULL,
+        "client" TEXT NOT NULL DEFAULT '',
+        "provider" TEXT NOT NULL,
+        "model" TEXT NOT NULL,
+        "requests" INTEGER NOT NULL,
+        "prompt_tokens" INTEGER NOT NULL,
+        "completion_tokens" INTEGER NOT NULL,
+        "cost_usd" REAL NOT NULL,
+        "estimated" BOOLEAN NOT NULL DEFAULT 0,
+        "created_at" TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+    );
+    CREATE INDEX IF NOT EXISTS ai_usage_created_at ON ai_usage ("created_at");`
+
+	_, err = db.Exec(createUsageSQL)
+	if err != nil {
+		log.Fatalf("Failed to create ai_usage table: %v", err)
+	}
+	if err := ensureColumn(db, "ai_usage", "client", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		log.Fatalf("Failed to migrate ai_usage table: %v", err)
+	}
+
+	// The articles table backs kb.SQLiteStore. IDs are supplied by the caller
+	// (e.g. "kb-001"), so the primary key is a TEXT column rather than an autoincrement.
+	createArticlesSQL := `
+    CREATE TABLE IF NOT EXISTS articles (
+        "id" TEXT NOT NULL PRIMARY KEY,
+        "title" TEXT NOT NULL,
+        "content" TEXT NOT NULL,
+        "created_at" TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        "updated_at" TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+    );`
+
+	_, err = db.Exec(createArticlesSQL)
+	if err != nil {
+		log.Fatalf("Failed to create articles table: %v", err)
+	}
+
+	// Embeddings are cached per document and model so the server does not have to
+	// re-embed the whole knowledge base on every start. content_hash detects stale rows.
+	createEmbeddingsSQL := `
+    CREATE TABLE IF NOT EXISTS embeddings (
+        "document_id" TEXT NOT NULL,
+        "model" TEXT NOT NULL,
+        "content_hash" TEXT NOT NULL,
+        "vector" BLOB NOT NULL,
+        "updated_at" TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        PRIMARY KEY ("document_id", "model")
+    );`
+
+	_, err = db.Exec(createEmbeddingsSQL)
+	if err != nil {
+		log.Fatalf("Failed to create embeddings table: %v", err)
+	}
+
+	// answer_cache persists the answer cache, and answer_cache_articles lists the articles
+	// each cached answer was generated from so that editing one invalidates its answers.
+	// expires_at is in Unix seconds; 0 never expires. context and the query's embedding
+	// find paraphrases of a cached question asked about the same articles.
+	createAnswerCacheSQL := `
+    CREATE TABLE IF NOT EXISTS answer_cache (
+        "key" TEXT NOT NULL PRIMARY KEY,
+        "query" TEXT NOT NULL,
+        "value" TEXT NOT NULL,
+        "created_at" TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        "expires_at" INTEGER NOT NULL DEFAULT 0,
+        "context" TEXT NOT NULL DEFAULT '',
+        "embedding_model" TEXT NOT NULL DEFAULT '',
+        "embedding" BLOB,
+        "hits" INTEGER NOT NULL DEFAULT 0
+    );
+    CREATE TABLE IF NOT EXISTS answer_cache_articles (
+        "cache_key" TEXT NOT NULL,
+        "article_id" TEXT NOT NULL,
+        PRIMARY KEY ("cache_key", "article_id")
+    );
+    CREATE INDEX IF NOT EXISTS answer_cache_articles_article_id ON answer_cache_articles ("article_id");`
+
+	_, err = db.Exec(createAnswerCacheSQL)
+	if err != nil {
+		log.Fatalf("Failed to create answer_cache table: %v", err)
+	}
+	for _, column := range []struct{ name, definition string }{
+		{"context", "TEXT NOT NULL DEFAULT ''"},
+		{"embedding_model", "TEXT NOT NULL DEFAULT ''"},
+		{"embedding", "BLOB"},
+		{"hits", "INTEGER NOT NULL DEFAULT 0"},
+	} {
+		if err := ensureColumn(db, "answer_cache", column.name, column.definition); err != nil {
+			log.Fatalf("Failed to migrate answer_cache table: %v", err)
+		}
+	}
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS answer_cache_context ON answer_cache ("context")`)
+	if err != nil {
+		log.Fatalf("Failed to create answer_cache index: %v", err)
+	}
+
+	// A conversation groups the searches of a multi-turn session. Each search adds the
+	// user's question and the answer to its messages.
+	createConversationsSQL := `
+    CREATE TABLE IF NOT EXISTS conversations (
+        "id" TEXT NOT NULL PRIMARY KEY,
+        "created_at" TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        "updated_at" TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+    );
+    CREATE TABLE IF NOT EXISTS messages (
+        "id" INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+        "conversation_id" TEXT NOT NULL REFERENCES conversations("id") ON DELETE CASCADE,
+        "role" TEXT NOT NULL,
+        "content" TEXT NOT NULL,
+        "rewritten_query" TEXT,
+        "search_id" INTEGER,
+        "created_at" TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+    );
+    CREATE INDEX IF NOT EXISTS messages_conversation ON messages ("conversation_id", "id");`
+
+	_, err = db.Exec(createConversationsSQL)
+	if err != nil {
+		log.Fatalf("Failed to create conversation tables: %v", err)
+	}
 
-	log.Println("Database initialized successfully and table created.")
+	if err := initArticlesFTS(db); err != nil {
+		// FTS5 is only compiled into go-sqlite3 with the sqlite_fts5 build tag.
+		// Without it the server still works, it just falls back to in-memory retrieval.
+		// Triggers left over from an FTS5-enabled build would make every article write
+		// fail, so drop them; the index is rebuilt once FTS5 is available again.
+		log.Printf("Warning: full-text search disabled: %v", err)
+		for _, trigger := range ftsTriggers {
+			db.Exec("DROP TRIGGER IF EXISTS " + trigger)
+		}
+	}
+
+	log.Println("Database initialized successfully and tables created.")
 	return db
 }
 
+// ensureColumn adds a column to an existing table unless it is already there.
+func ensureColumn(db *sql.DB, table, column, definition string) error {
+	rows, err := db.Query("SELECT name FROM pragma_table_info(?)", table)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	_, err = db.Exec(`ALTER TABLE "` + table + `" ADD COLUMN "` + column + `" ` + definition)
+	return err
+}
+
+// ftsTriggers are the triggers that keep articles_fts in sync with the articles table.
+var ftsTriggers = []string{"articles_fts_insert", "articles_fts_delete", "articles_fts_update"}
+
+// initArticlesFTS creates the articles_fts FTS5 index over the articles table, plus the
+// triggers that keep it in sync with inserts, updates and deletes, and the
+// passages_fts index of article passages.
+func initArticlesFTS(db *sql.DB) error {
+	var triggerCount int
+	err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type='trigger' AND name LIKE 'articles_fts_%'").Scan(&triggerCount)
+	if err != nil {
+		return err
+	}
+
+	// articles_fts is an external-content table: it stores only the index and reads the
+	// text back from the articles table (joined on rowid) for snippet().
+	statements := []string{
+		`CREATE VIRTUAL TABLE IF NOT EXISTS articles_fts USING fts5(
+        title, content,
+        content='articles', content_rowid='rowid',
+        tokenize='porter unicode61'
+    );`,
+		`CREATE TRIGGER IF NOT EXISTS articles_fts_insert AFTER INSERT ON articles BEGIN
+        INSERT INTO articles_fts(rowid, title, content) VALUES (new.rowid, new.title, new.content);
+    END;`,
+		`CREATE TRIGGER IF NOT EXISTS articles_fts_delete AFTER DELETE ON articles BEGIN
+        INSERT INTO articles_fts(articles_fts, rowid, title, content) VALUES ('delete', old.rowid, old.title, old.content);
+    END;`,
+		`CREATE TRIGGER IF NOT EXISTS articles_fts_update AFTER UPDATE ON articles BEGIN
+        INSERT INTO articles_fts(articles_fts, rowid, title, content) VALUES ('delete', old.rowid, old.title, old.content);
+        INSERT INTO articles_fts(rowid, title, content) VALUES (new.rowid, new.title, new.content);
+    END;`,
+	}
+	for _, stmt := range statements {
+		if _, err := db.Exec(stmt); err != nil {
+			return err
+		}
+	}
+
+	// passages_fts indexes article passages for chunked full-text retrieval. Passages
+	// are computed in Go, so it is kept in sync by retrieval.ArticleSync, not triggers.
+	if _, err := db.Exec(`CREATE VIRTUAL TABLE IF NOT EXISTS passages_fts USING fts5(
+        id UNINDEXED, title, content,
+        tokenize='porter unicode61'
+    );`); err != nil {
+		return err
+	}
+
+	// Articles written while the triggers were missing are not in the index yet.
+	if triggerCount < len(ftsTriggers) {
+		if _, err := db.Exec("INSERT INTO articles_fts(articles_fts) VALUES ('rebuild')"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// HasFullTextSearch reports whether the articles_fts index exists and is usable,
+// i.e. the binary was built with FTS5 support.
+func HasFullTextSearch(db *sql.DB) bool {
+	rows, err := db.Query("SELECT rowid FROM articles_fts LIMIT 0")
+	if err != nil {
+		return false
+	}
+	rows.Close()
+	return true
+}
+
 // SaveSearch saves a given search history record to the database.
 // It uses prepared statements to prevent SQL injection vulnerabilities.
 func SaveSearch(db *sql.DB, search SearchHistory) (int64, error) {
 	// The '?' are placeholders for the actual values.
-	stmt, err := db.Prepare("INSERT INTO search_history(user_query, ai_summary_answer, ai_relevant_articles) VALUES(?, ?, ?)")
+	stmt, err := db.Prepare("INSERT INTO search_history(user_query, ai_summary_answer, ai_relevant_articles, provider, citation_warnings, prompt_version, caller, prompt_tokens, completion_tokens, cost_usd) VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
 	if err != nil {
 		return 0, err
 	}
 	defer stmt.Close()
 
 	// Execute the prepared statement, passing in the values to use for the placeholders.
-	res, err := stmt.Exec(search.UserQuery, search.AISummaryAnswer, search.AIRelevantArticles)
+	res, err := stmt.Exec(search.UserQuery, search.AISummaryAnswer, search.AIRelevantArticles, search.Provider, search.CitationWarnings, search.PromptVersion,
+		search.Caller, search.PromptTokens, search.CompletionTokens, search.CostUSD)
 	if err != nil {
 		return 0, err
 	}
@@ -44,6 +44,13 @@ func TestInitDB(t *testing.T) {
 		"ai_summary_answer":    "TEXT",
 		"ai_relevant_articles": "TEXT",
 		"created_at":           "TIMESTAMP",
+		"provider":             "TEXT",
+		"citation_warnings":    "TEXT",
+		"prompt_version":       "TEXT",
+		"caller":               "TEXT",
+		"prompt_tokens":        "INTEGER",
+		"completion_tokens":    "INTEGER",
+		"cost_usd":             "REAL",
 	}
 
 	columnCount := 0
@@ -70,6 +77,93 @@ func TestInitDB(t *testing.T) {
 	}
 }
 
+// TestInitDBAddsMissingColumns tests that a search_history table from an older version
+// is migrated in place.
+func TestInitDBAddsMissingColumns(t *testing.T) {
+	tempFile := "test_migrate.sqlite"
+	defer os.Remove(tempFile)
+
+	old, err := sql.Open("sqlite3", tempFile)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	_, err = old.Exec(`CREATE TABLE search_history (
+        "id" INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+        "user_query" TEXT,
+        "ai_summary_answer" TEXT,
+        "ai_relevant_articles" TEXT,
+        "created_at" TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+    );
+    INSERT INTO search_history(user_query) VALUES ('old query');`)
+	old.Close()
+	if err != nil {
+		t.Fatalf("Failed to create old schema: %v", err)
+	}
+
+	db := InitDB(tempFile)
+	defer db.Close()
+
+	if _, err := SaveSearch(db, SearchHistory{UserQuery: "new query", Provider: "ollama", CitationWarnings: "[]"}); err != nil {
+		t.Fatalf("SaveSearch failed after migration: %v", err)
+	}
+	var count int
+	db.QueryRow("SELECT COUNT(*) FROM search_history WHERE (provider = 'ollama' AND citation_warnings = '[]') OR (user_query = 'old query' AND provider IS NULL)").Scan(&count)
+	if count != 2 {
+		t.Errorf("Expected the old row kept and the new row saved with its provider, got %d rows", count)
+	}
+}
+
+// TestInitDBCreatesArticlesTable tests that the articles table is created alongside search_history.
+func TestInitDBCreatesArticlesTable(t *testing.T) {
+	tempFile := "test_articles_table.sqlite"
+	defer os.Remove(tempFile)
+
+	db := InitDB(tempFile)
+	defer db.Close()
+
+	var tableName string
+	err := db.QueryRow("SELECT name FROM sqlite_master WHERE type='table' AND name='articles'").Scan(&tableName)
+	if err != nil {
+		t.Fatalf("articles table was not created: %v", err)
+	}
+
+	// Running InitDB against an existing file must not fail on the existing tables.
+	db2 := InitDB(tempFile)
+	db2.Close()
+}
+
+// TestInitDBRebuildsFullTextIndex tests that articles written while the FTS triggers
+// were missing are indexed on the next start.
+func TestInitDBRebuildsFullTextIndex(t *testing.T) {
+	tempFile := "test_fts_rebuild.sqlite"
+	defer os.Remove(tempFile)
+
+	db := InitDB(tempFile)
+	if !HasFullTextSearch(db) {
+		db.Close()
+		t.Skip("FTS5 not available; run with -tags sqlite_fts5")
+	}
+	for _, trigger := range ftsTriggers {
+		db.Exec("DROP TRIGGER " + trigger)
+	}
+	if _, err := db.Exec("INSERT INTO articles(id, title, content) VALUES('kb-001', 'VPN', 'Reconnect the client')"); err != nil {
+		t.Fatalf("Failed to insert article: %v", err)
+	}
+	db.Close()
+
+	db = InitDB(tempFile)
+	defer db.Close()
+
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM articles_fts WHERE articles_fts MATCH 'reconnect'").Scan(&count)
+	if err != nil {
+		t.Fatalf("Failed to query full-text index: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("Expected rebuilt index to contain the article, got %d matches", count)
+	}
+}
+
 // TestInitDBWithInvalidPath tests database initialization with invalid path
 func TestInitDBWithInvalidPath(t *testing.T) {
 	t.Skip("Skipping test that requires log.Fatalf to panic")
@@ -87,6 +181,9 @@ func TestSaveSearch(t *testing.T) {
 		UserQuery:          "test query",
 		AISummaryAnswer:    "test answer",
 		AIRelevantArticles: `[{"id":"1","title":"Test Article"}]`,
+		Provider:           "gemini",
+		CitationWarnings:   `[{"id":"kb-999","problem":"unknown_id"}]`,
+		PromptVersion:      "v1",
 		CreatedAt:          time.Now(),
 	}
 
@@ -99,8 +196,8 @@ func TestSaveSearch(t *testing.T) {
 	}
 
 	var savedSearch SearchHistory
-	err = db.QueryRow("SELECT id, user_query, ai_summary_answer, ai_relevant_articles, created_at FROM search_history WHERE id = ?", id).
-		Scan(&savedSearch.ID, &savedSearch.UserQuery, &savedSearch.AISummaryAnswer, &savedSearch.AIRelevantArticles, &savedSearch.CreatedAt)
+	err = db.QueryRow("SELECT id, user_query, ai_summary_answer, ai_relevant_articles, provider, citation_warnings, prompt_version, created_at FROM search_history WHERE id = ?", id).
+		Scan(&savedSearch.ID, &savedSearch.UserQuery, &savedSearch.AISummaryAnswer, &savedSearch.AIRelevantArticles, &savedSearch.Provider, &savedSearch.CitationWarnings, &savedSearch.PromptVersion, &savedSearch.CreatedAt)
 	if err != nil {
 		t.Fatalf("Failed to query saved search: %v", err)
 	}
@@ -114,6 +211,15 @@ func TestSaveSearch(t *testing.T) {
 	if savedSearch.AIRelevantArticles != testSearch.AIRelevantArticles {
 		t.Errorf("AIRelevantArticles mismatch: expected '%s', got '%s'", testSearch.AIRelevantArticles, savedSearch.AIRelevantArticles)
 	}
+	if savedSearch.Provider != testSearch.Provider {
+		t.Errorf("Provider mismatch: expected '%s', got '%s'", testSearch.Provider, savedSearch.Provider)
+	}
+	if savedSearch.CitationWarnings != testSearch.CitationWarnings {
+		t.Errorf("CitationWarnings mismatch: expected '%s', got '%s'", testSearch.CitationWarnings, savedSearch.CitationWarnings)
+	}
+	if savedSearch.PromptVersion != testSearch.PromptVersion {
+		t.Errorf("PromptVersion mismatch: expected '%s', got '%s'", testSearch.PromptVersion, savedSearch.PromptVersion)
+	}
 	if savedSearch.ID != id {
 		t.Errorf("ID mismatch: expected %d, got %d", id, savedSearch.ID)
 	}
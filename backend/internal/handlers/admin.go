@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"ai-knowledge-base/internal/cache"
+	"ai-knowledge-base/internal/usage"
+	"crypto/subtle"
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultUsageDays is how many days a usage report covers when no range is given.
+	defaultUsageDays = 30
+	// defaultCacheEntries and maxCacheEntries bound how many entries the cache
+	// endpoint lists.
+	defaultCacheEntries = 50
+	maxCacheEntries     = 500
+)
+
+// UsageReport is the response of the usage endpoint.
+type UsageReport struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	// Rows aggregate the usage by day, model and caller.
+	Rows []usage.ReportRow `json:"rows"`
+	// Total sums the rows.
+	Total UsageTotal `json:"total"`
+}
+
+// UsageTotal sums the rows of a UsageReport.
+type UsageTotal struct {
+	Requests         int     `json:"requests"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	TotalTokens      int     `json:"total_tokens"`
+	CostUSD          float64 `json:"cost_usd"`
+}
+
+// CacheReport is the response of the cache endpoint.
+type CacheReport struct {
+	Stats cache.Stats `json:"stats"`
+	// Entries are the newest cached answers.
+	Entries []cache.Entry `json:"entries"`
+}
+
+// RegisterAdminRoutes wires the admin endpoints onto the given mux. They require the
+// bearer token given, and are disabled when it is empty. answerCache may be nil when
+// the answer cache is disabled.
+func RegisterAdminRoutes(mux *http.ServeMux, token string, db *sql.DB, answerCache *cache.Cache) {
+	mux.Handle("GET /api/admin/usage", RequireAdmin(token, UsageHandler(db)))
+	mux.Handle("GET /api/admin/cache", RequireAdmin(token, CacheHandler(answerCache)))
+	mux.Handle("DELETE /api/admin/cache", RequireAdmin(token, PurgeCacheHandler(answerCache)))
+	mux.Handle("DELETE /api/admin/cache/{key}", RequireAdmin(token, PurgeCacheHandler(answerCache)))
+}
+
+// RequireAdmin only lets requests through that carry token as a bearer token. With an
+// empty token, every request is refused.
+func RequireAdmin(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token == "" {
+			http.Error(w, "Admin endpoints are disabled; set ADMIN_TOKEN", http.StatusForbidden)
+			return
+		}
+		given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// UsageHandler handles GET /api/admin/usage. The from and to parameters select an
+// inclusive range of UTC days as YYYY-MM-DD, by default the last 30 days, and caller
+// restricts the report to one caller.
+func UsageHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := r.URL.Query()
+		to, err := parseDay(params.Get("to"), time.Now().UTC())
+		if err != nil {
+			http.Error(w, "Invalid to date, expected YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+		from, err := parseDay(params.Get("from"), to.AddDate(0, 0, 1-defaultUsageDays))
+		if err != nil {
+			http.Error(w, "Invalid from date, expected YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+		if from.After(to) {
+			http.Error(w, "from must not be after to", http.StatusBadRequest)
+			return
+		}
+
+		rows, err := usage.Report(db, usage.Filter{From: from, To: to, Caller: params.Get("caller")})
+		if err != nil {
+			log.Printf("Failed to report AI usage: %v", err)
+			http.Error(w, "Failed to report usage", http.StatusInternalServerError)
+			return
+		}
+		report := UsageReport{From: from.Format(time.DateOnly), To: to.Format(time.DateOnly), Rows: rows}
+		for _, row := range rows {
+			report.Total.Requests += row.Requests
+			report.Total.PromptTokens += row.PromptTokens
+			report.Total.CompletionTokens += row.CompletionTokens
+			report.Total.TotalTokens += row.TotalTokens
+			report.Total.CostUSD += row.CostUSD
+		}
+		writeJSON(w, http.StatusOK, report)
+	}
+}
+
+// parseDay parses a YYYY-MM-DD day, returning fallback for an empty one.
+func parseDay(raw string, fallback time.Time) (time.Time, error) {
+	if raw == "" {
+		return fallback, nil
+	}
+	return time.Parse(time.DateOnly, raw)
+}
+
+// CacheHandler handles GET /api/admin/cache, returning the answer cache's hit and miss
+// counts and its newest entries. The limit parameter sets how many, by default 50.
+func CacheHandler(answerCache *cache.Cache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if answerCache == nil {
+			http.Error(w, "Answer cache is disabled", http.StatusNotFound)
+			return
+		}
+		limit := defaultCacheEntries
+		if raw := r.URL.Query().Get("limit"); raw != "" {
+			n, err := strconv.Atoi(raw)
+			if err != nil || n < 1 || n > maxCacheEntries {
+				http.Error(w, "Invalid limit, expected 1 to "+strconv.Itoa(maxCacheEntries), http.StatusBadRequest)
+				return
+			}
+			limit = n
+		}
+		entries, err := answerCache.List(limit)
+		if err != nil {
+			log.Printf("Failed to list answer cache: %v", err)
+			http.Error(w, "Failed to list answer cache", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, CacheReport{Stats: answerCache.Stats(), Entries: entries})
+	}
+}
+
+// PurgeCacheHandler handles DELETE /api/admin/cache/{key}, which removes one entry of
+// the answer cache, and DELETE /api/admin/cache, which removes them all and returns
+// how many there were.
+func PurgeCacheHandler(answerCache *cache.Cache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if answerCache == nil {
+			http.Error(w, "Answer cache is disabled", http.StatusNotFound)
+			return
+		}
+		if key := r.PathValue("key"); key != "" {
+			found, err := answerCache.Purge(key)
+			if err != nil {
+				log.Printf("Failed to purge cached answer %s: %v", key, err)
+				http.Error(w, "Failed to purge cached answer", http.StatusInternalServerError)
+				return
+			}
+			if !found {
+				http.Error(w, "Cached answer not found", http.StatusNotFound)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		purged, err := answerCache.PurgeAll()
+		if err != nil {
+			log.Printf("Failed to purge answer cache: %v", err)
+			http.Error(w, "Failed to purge answer cache", http.StatusInternalServerError)
+			return
+		}
+		log.Printf("Purged %d cached answers", purged)
+		writeJSON(w, http.StatusOK, map[string]int{"purged": purged})
+	}
+}
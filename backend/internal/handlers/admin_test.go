@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"ai-knowledge-base/internal/ai"
+	"ai-knowledge-base/internal/cache"
+	"ai-knowledge-base/internal/database"
+	"ai-knowledge-base/internal/usage"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// adminRequest sends a request to the admin routes with the given bearer token.
+func adminRequest(mux *http.ServeMux, method, path, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	return rr
+}
+
+// TestRequireAdmin tests that admin routes are disabled without a token and refuse
+// requests without the right one.
+func TestRequireAdmin(t *testing.T) {
+	db := database.InitDB(testDBFile)
+	defer db.Close()
+
+	disabled := http.NewServeMux()
+	RegisterAdminRoutes(disabled, "", db, nil)
+	if rr := adminRequest(disabled, "GET", "/api/admin/usage", "anything"); rr.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 with admin routes disabled, got %d", rr.Code)
+	}
+
+	mux := http.NewServeMux()
+	RegisterAdminRoutes(mux, "secret", db, nil)
+	for _, token := range []string{"", "wrong"} {
+		if rr := adminRequest(mux, "GET", "/api/admin/usage", token); rr.Code != http.StatusUnauthorized {
+			t.Errorf("Expected 401 for token %q, got %d", token, rr.Code)
+		}
+	}
+	if rr := adminRequest(mux, "GET", "/api/admin/usage", "secret"); rr.Code != http.StatusOK {
+		t.Errorf("Expected 200 with the admin token, got %d", rr.Code)
+	}
+}
+
+// TestUsageHandler tests reporting usage for a caller and validating the date range.
+func TestUsageHandler(t *testing.T) {
+	db := database.InitDB(testDBFile)
+	defer db.Close()
+
+	summary := &usage.Summary{Models: []usage.ModelUsage{
+		{Provider: "openai", Model: "gpt-4o-mini", Requests: 2, Usage: ai.Usage{PromptTokens: 300, CompletionTokens: 40}, CostUSD: 0.25},
+		{Provider: "ollama", Model: "llama3", Requests: 1, Usage: ai.Usage{PromptTokens: 100, CompletionTokens: 10}},
+	}}
+	if err := usage.Save(db, 0, "report-tester", "192.0.2.1", summary); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	mux := http.NewServeMux()
+	RegisterAdminRoutes(mux, "secret", db, nil)
+
+	rr := adminRequest(mux, "GET", "/api/admin/usage?caller=report-tester", "secret")
+	var report UsageReport
+	if err := json.NewDecoder(rr.Body).Decode(&report); err != nil {
+		t.Fatalf("could not decode report: %v", err)
+	}
+	today := time.Now().UTC().Format(time.DateOnly)
+	if report.To != today || report.From != time.Now().UTC().AddDate(0, 0, -29).Format(time.DateOnly) {
+		t.Errorf("Expected the last 30 days, got %s to %s", report.From, report.To)
+	}
+	if len(report.Rows) != 2 || report.Rows[0].Model != "gpt-4o-mini" || report.Rows[0].Day != today || report.Rows[0].Caller != "report-tester" {
+		t.Errorf("Unexpected rows %+v", report.Rows)
+	}
+	if report.Total.Requests != 3 || report.Total.TotalTokens != 450 || report.Total.CostUSD != 0.25 {
+		t.Errorf("Unexpected total %+v", report.Total)
+	}
+
+	for _, query := range []string{"from=yesterday", "to=2026-13-01", "from=2026-02-02&to=2026-02-01"} {
+		if rr := adminRequest(mux, "GET", "/api/admin/usage?"+query, "secret"); rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %s, got %d", query, rr.Code)
+		}
+	}
+}
+
+// TestCacheHandlers tests inspecting the answer cache and purging one or all entries.
+func TestCacheHandlers(t *testing.T) {
+	db := database.InitDB(testDBFile)
+	defer db.Close()
+
+	disabled := http.NewServeMux()
+	RegisterAdminRoutes(disabled, "secret", db, nil)
+	if rr := adminRequest(disabled, "GET", "/api/admin/cache", "secret"); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 with the answer cache disabled, got %d", rr.Code)
+	}
+
+	answerCache := cache.New(nil, 10, time.Hour)
+	for _, key := range []string{"a", "b", "c"} {
+		answerCache.Put(context.Background(), cache.Entry{Key: key, Query: "question " + key, ArticleIDs: []string{"kb-001"}, Value: json.RawMessage(`{}`)})
+	}
+	answerCache.Find(context.Background(), "a", "", "question a")
+	answerCache.Find(context.Background(), "d", "", "question d")
+	mux := http.NewServeMux()
+	RegisterAdminRoutes(mux, "secret", db, answerCache)
+
+	if rr := adminRequest(mux, "DELETE", "/api/admin/cache", ""); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without the admin token, got %d", rr.Code)
+	}
+	rr := adminRequest(mux, "GET", "/api/admin/cache?limit=2", "secret")
+	var report CacheReport
+	if err := json.NewDecoder(rr.Body).Decode(&report); err != nil {
+		t.Fatalf("could not decode cache report: %v", err)
+	}
+	if len(report.Entries) != 2 || report.Stats.ExactHits != 1 || report.Stats.Misses != 1 || report.Stats.HitRate != 0.5 || report.Stats.MemoryEntries != 3 {
+		t.Errorf("Unexpected cache report %+v", report)
+	}
+	if rr := adminRequest(mux, "GET", "/api/admin/cache?limit=0", "secret"); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid limit, got %d", rr.Code)
+	}
+
+	if rr := adminRequest(mux, "DELETE", "/api/admin/cache/b", "secret"); rr.Code != http.StatusNoContent {
+		t.Errorf("Expected 204 purging an entry, got %d", rr.Code)
+	}
+	if rr := adminRequest(mux, "DELETE", "/api/admin/cache/b", "secret"); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 purging a missing entry, got %d", rr.Code)
+	}
+	rr = adminRequest(mux, "DELETE", "/api/admin/cache", "secret")
+	var purged map[string]int
+	json.NewDecoder(rr.Body).Decode(&purged)
+	if rr.Code != http.StatusOK || purged["purged"] != 2 || answerCache.Len() != 0 {
+		t.Errorf("Expected 2 entries purged, got %d %v", rr.Code, purged)
+	}
+}
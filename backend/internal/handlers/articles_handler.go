@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"ai-knowledge-base/internal/kb"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// articleIDPattern is what an article ID may consist of.
+var articleIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// ArticlePatch is the body of a PATCH request. Omitted fields are left unchanged.
+type ArticlePatch struct {
+	Title   *string `json:"title"`
+	Content *string `json:"content"`
+}
+
+// RegisterArticleRoutes wires the article CRUD endpoints onto the given mux. Article
+// content is sent to the model, so creating, updating and deleting articles requires
+// the admin token, as the admin routes do; reading them does not.
+func RegisterArticleRoutes(mux *http.ServeMux, store kb.Store, adminToken string) {
+	mux.HandleFunc("GET /api/articles", ListArticlesHandler(store))
+	mux.Handle("POST /api/articles", RequireAdmin(adminToken, CreateArticleHandler(store)))
+	mux.HandleFunc("GET /api/articles/{id}", GetArticleHandler(store))
+	mux.Handle("PUT /api/articles/{id}", RequireAdmin(adminToken, UpdateArticleHandler(store)))
+	mux.Handle("PATCH /api/articles/{id}", RequireAdmin(adminToken, PatchArticleHandler(store)))
+	mux.Handle("DELETE /api/articles/{id}", RequireAdmin(adminToken, DeleteArticleHandler(store)))
+}
+
+// ListArticlesHandler handles GET /api/articles.
+func ListArticlesHandler(store kb.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		articles, err := store.List()
+		if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, articles)
+	}
+}
+
+// CreateArticleHandler handles POST /api/articles.
+func CreateArticleHandler(store kb.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var article kb.Article
+		if err := json.NewDecoder(r.Body).Decode(&article); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if strings.TrimSpace(article.ID) == "" {
+			http.Error(w, "Article ID cannot be empty", http.StatusBadRequest)
+			return
+		}
+		// IDs are placed in URLs and prompts, and '#' separates an article ID from a chunk index.
+		if !articleIDPattern.MatchString(article.ID) {
+			http.Error(w, "Article ID can only contain letters, digits, '.', '_' and '-'", http.StatusBadRequest)
+			return
+		}
+		if msg := validateArticle(article); msg != "" {
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+
+		if err := store.Create(article); err != nil {
+			writeStoreError(w, err)
+			return
+		}
+
+		w.Header().Set("Location", "/api/articles/"+article.ID)
+		writeJSON(w, http.StatusCreated, article)
+	}
+}
+
+// GetArticleHandler handles GET /api/articles/{id}.
+func GetArticleHandler(store kb.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		article, err := store.Get(r.PathValue("id"))
+		if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, article)
+	}
+}
+
+// UpdateArticleHandler handles PUT /api/articles/{id}, replacing the whole article.
+func UpdateArticleHandler(store kb.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+
+		var article kb.Article
+		if err := json.NewDecoder(r.Body).Decode(&article); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		// The ID in the body is optional, but if present it must agree with the URL.
+		if article.ID != "" && article.ID != id {
+			http.Error(w, "Article ID in body does not match URL", http.StatusBadRequest)
+			return
+		}
+		article.ID = id
+		if msg := validateArticle(article); msg != "" {
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+
+		if err := store.Update(article); err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, article)
+	}
+}
+
+// PatchArticleHandler handles PATCH /api/articles/{id}, updating only the supplied fields.
+func PatchArticleHandler(store kb.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var patch ArticlePatch
+		if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		article, err := store.Get(r.PathValue("id"))
+		if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		if patch.Title != nil {
+			article.Title = *patch.Title
+		}
+		if patch.Content != nil {
+			article.Content = *patch.Content
+		}
+		if msg := validateArticle(article); msg != "" {
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+
+		if err := store.Update(article); err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, article)
+	}
+}
+
+// DeleteArticleHandler handles DELETE /api/articles/{id}.
+func DeleteArticleHandler(store kb.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := store.Delete(r.PathValue("id")); err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// validateArticle returns a user-facing message describing why the article is invalid,
+// or an empty string if it is valid.
+func validateArticle(article kb.Article) string {
+	if strings.TrimSpace(article.Title) == "" {
+		return "Article title cannot be empty"
+	}
+	if strings.TrimSpace(article.Content) == "" {
+		return "Article content cannot be empty"
+	}
+	return ""
+}
+
+// writeStoreError maps kb.Store errors onto HTTP status codes.
+func writeStoreError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, kb.ErrNotFound):
+		http.Error(w, "Article not found", http.StatusNotFound)
+	case errors.Is(err, kb.ErrAlreadyExists):
+		http.Error(w, "An article with this ID already exists", http.StatusConflict)
+	default:
+		log.Printf("Article store error: %v", err)
+		http.Error(w, "Failed to access knowledge base", http.StatusInternalServerError)
+	}
+}
+
+// writeJSON encodes v as the JSON response body with the given status code.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"ai-knowledge-base/internal/ai"
+	"ai-knowledge-base/internal/cache"
+	"ai-knowledge-base/internal/grounding"
+	"ai-knowledge-base/internal/kb"
+	"context"
+	"encoding/json"
+	"log"
+)
+
+// cachedAnswer is what the answer cache holds for an AI answer: the answer after its
+// citations were verified, the passages it cites, who produced it and its grounding.
+type cachedAnswer struct {
+	SummaryAnswer    string       `json:"ai_summary_answer"`
+	RelevantArticles []kb.Article `json:"ai_relevant_articles"`
+	// Citations are the cited passages, kept so that a hit cites the same chunks
+	// rather than whichever passage of each article ranks first for the new question.
+	Citations     []Citation        `json:"citations"`
+	Provider      string            `json:"provider"`
+	Model         string            `json:"model,omitempty"`
+	PromptVersion string            `json:"prompt_version"`
+	Grounding     *grounding.Result `json:"grounding,omitempty"`
+}
+
+// CacheHit describes how an answer was found in the answer cache.
+type CacheHit struct {
+	// Match is "exact" for the same question or "semantic" for a question similar in
+	// meaning, about the same articles.
+	Match string `json:"match"`
+	// Similarity is the cosine similarity of the question to the cached one.
+	Similarity float64 `json:"similarity"`
+	// Query is the normalized question the answer was generated for.
+	Query string `json:"query"`
+}
+
+// answerQuery identifies the answer to a question in the answer cache.
+type answerQuery struct {
+	key, context, query string
+	articles            []kb.Article
+	// embedding is the question's embedding, if the lookup computed it.
+	embedding []float32
+}
+
+// answerCacheQuery returns what identifies the answer to query from articles by llm in
+// the answer cache, or nil if the answer is not cached: when there is no cache, and for
+// follow-up questions, whose answers depend on the conversation.
+func answerCacheQuery(cfg SearchConfig, llm ai.LLM, query string, articles []kb.Article, opts ai.AnswerOptions) *answerQuery {
+	if cfg.Cache == nil || len(opts.History) > 0 {
+		return nil
+	}
+	model := llm.Name() + "/" + ai.ModelName(llm)
+	return &answerQuery{
+		key:      cache.Key(query, opts.PromptVersion(), model, articles),
+		context:  cache.ContextKey(opts.PromptVersion(), model, articles),
+		query:    query,
+		articles: articles,
+	}
+}
+
+// lookupAnswer returns the cached answer to q and how it matched, if there is one.
+// Embedding the question for a match by meaning is bounded by the retrieval budget.
+func lookupAnswer(ctx context.Context, cfg SearchConfig, q *answerQuery) (*cachedAnswer, *CacheHit) {
+	if q == nil {
+		return nil, nil
+	}
+	ctx, cancel := withBudget(ctx, cfg.RetrievalTimeout)
+	defer cancel()
+	lookup := cfg.Cache.Find(ctx, q.key, q.context, q.query)
+	q.embedding = lookup.Embedding
+	if lookup.Entry == nil {
+		return nil, nil
+	}
+	var answer cachedAnswer
+	if err := json.Unmarshal(lookup.Entry.Value, &answer); err != nil {
+		log.Printf("Ignoring unreadable cached answer %s: %v", lookup.Entry.Key, err)
+		return nil, nil
+	}
+	return &answer, &CacheHit{Match: lookup.Match, Similarity: lookup.Similarity, Query: lookup.Entry.Query}
+}
+
+// response returns the cached answer as an AI response that consumed no tokens.
+func (a *cachedAnswer) response() *ai.AIResponse {
+	return &ai.AIResponse{
+		SummaryAnswer:    a.SummaryAnswer,
+		RelevantArticles: a.RelevantArticles,
+		Completion:       &ai.Completion{Text: a.SummaryAnswer, Provider: a.Provider, Model: a.Model},
+		PromptVersion:    a.PromptVersion,
+	}
+}
+
+// settleCached returns the cached answer with the citations it was stored with.
+// Entries cached before citations were kept are cited again from passages.
+func settleCached(passages []passage, articles []kb.Article, answer *cachedAnswer) (string, *ai.AIResponse, []Citation, []CitationWarning) {
+	if answer.Citations == nil {
+		return settleAnswer(passages, articles, answer.response())
+	}
+	return ModeAnswer, answer.response(), answer.Citations, []CitationWarning{}
+}
+
+// storeAnswer caches an AI answer to q with its citations. Retrieval-only answers and
+// answers withheld by the grounding check are not cached.
+func storeAnswer(ctx context.Context, cfg SearchConfig, q *answerQuery, aiResponse *ai.AIResponse, citations []Citation, result *grounding.Result) {
+	if q == nil || aiResponse.Completion == nil || (result != nil && !result.Confident) {
+		return
+	}
+	value, err := json.Marshal(cachedAnswer{
+		SummaryAnswer:    aiResponse.SummaryAnswer,
+		RelevantArticles: aiResponse.RelevantArticles,
+		Citations:        citations,
+		Provider:         aiResponse.Completion.Provider,
+		Model:            aiResponse.Completion.Model,
+		PromptVersion:    aiResponse.PromptVersion,
+		Grounding:        result,
+	})
+	if err != nil {
+		log.Printf("Failed to encode answer for the cache: %v", err)
+		return
+	}
+	ids := make([]string, 0, len(q.articles))
+	seen := make(map[string]bool, len(q.articles))
+	for _, article := range q.articles {
+		if id, _, _ := kb.ParseChunkID(article.ID); !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	ctx, cancel := withBudget(ctx, cfg.RetrievalTimeout)
+	defer cancel()
+	cfg.Cache.Put(ctx, cache.Entry{
+		Key:        q.key,
+		Query:      cache.Normalize(q.query),
+		Context:    q.context,
+		ArticleIDs: ids,
+		Value:      value,
+		Embedding:  q.embedding,
+	})
+}
@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"ai-knowledge-base/internal/ai"
+	"ai-knowledge-base/internal/cache"
+	"ai-knowledge-base/internal/grounding"
+	"ai-knowledge-base/internal/injection"
+	"ai-knowledge-base/internal/kb"
+	"ai-knowledge-base/internal/retrieval"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newCacheConfig configures a search with a memory-only answer cache whose articles can
+// be edited through the returned store.
+func newCacheConfig(t *testing.T) (SearchConfig, *promptRecorder, kb.Store) {
+	cfg, recorder := newInjectionConfig(t, injection.PolicyWarn)
+	cfg.Cache = cache.New(nil, 10, time.Hour)
+	store := kb.Observe(cfg.Store, cfg.Cache)
+	cfg.Store = store
+	return cfg, recorder, store
+}
+
+// TestSearchHandler_Cache tests that a repeated question is answered from the cache
+// until an article it was answered from changes.
+func TestSearchHandler_Cache(t *testing.T) {
+	cfg, recorder, store := newCacheConfig(t)
+	handler := SearchHandler(cfg)
+
+	var first SearchResponse
+	json.NewDecoder(postSearch(handler, `{"query":"How to reset password?"}`).Body).Decode(&first)
+	if first.Cached || len(recorder.prompts) != 1 || cfg.Cache.Len() != 1 {
+		t.Fatalf("Expected an answer from the model, cached for later, got %+v", first)
+	}
+
+	var second SearchResponse
+	json.NewDecoder(postSearch(handler, `{"query":"how to reset  password"}`).Body).Decode(&second)
+	if !second.Cached || len(recorder.prompts) != 1 {
+		t.Fatalf("Expected the answer from the cache, got %+v after %d prompts", second, len(recorder.prompts))
+	}
+	if second.SummaryAnswer != first.SummaryAnswer || second.Provider != first.Provider || len(second.Citations) != len(first.Citations) ||
+		second.GroundingScore == nil || *second.GroundingScore != *first.GroundingScore || second.Tokens != nil || second.Usage != nil {
+		t.Errorf("Expected the first answer without token usage, got %+v", second)
+	}
+
+	article, _ := store.Get("kb-001")
+	article.Content += " Passwords expire every 90 days."
+	if err := store.Update(article); err != nil {
+		t.Fatal(err)
+	}
+	var third SearchResponse
+	json.NewDecoder(postSearch(handler, `{"query":"How to reset password?"}`).Body).Decode(&third)
+	if third.Cached || len(recorder.prompts) != 2 {
+		t.Errorf("Expected the edited article to invalidate the answer, got %+v", third)
+	}
+}
+
+// TestSearchHandler_CacheSkipsWithheldAnswers tests that answers withheld by the
+// grounding check are not cached.
+func TestSearchHandler_CacheSkipsWithheldAnswers(t *testing.T) {
+	cfg, _, _ := newCacheConfig(t)
+	cfg.Grounding = &grounding.Checker{SentenceThreshold: grounding.DefaultSentenceThreshold, MinScore: 2}
+
+	var resp SearchResponse
+	json.NewDecoder(postSearch(SearchHandler(cfg), `{"query":"How to reset password?"}`).Body).Decode(&resp)
+	if resp.Warning != groundingWarning || cfg.Cache.Len() != 0 {
+		t.Errorf("Expected the withheld answer left out of the cache, got %+v and %d entries", resp, cfg.Cache.Len())
+	}
+}
+
+// TestSearchHandler_SemanticCache tests that a paraphrase of a cached question about
+// the same articles is answered from the cache, and that the match is reported.
+func TestSearchHandler_SemanticCache(t *testing.T) {
+	cfg, recorder, _ := newCacheConfig(t)
+	cfg.Cache.Embedder, cfg.Cache.Threshold = retrieval.NewHashEmbedder(256), 0.6
+	handler := SearchHandler(cfg)
+
+	var first SearchResponse
+	json.NewDecoder(postSearch(handler, `{"query":"How to reset password?"}`).Body).Decode(&first)
+	var second SearchResponse
+	json.NewDecoder(postSearch(handler, `{"query":"How do I reset the password"}`).Body).Decode(&second)
+	if !second.Cached || second.Cache == nil || second.Cache.Match != cache.MatchSemantic || second.Cache.Query != "how to reset password" || len(recorder.prompts) != 1 {
+		t.Fatalf("Expected a semantic cache hit, got %+v after %d prompts", second.Cache, len(recorder.prompts))
+	}
+	if second.SummaryAnswer != first.SummaryAnswer || second.Cache.Similarity < 0.6 {
+		t.Errorf("Expected the first answer, got %+v", second)
+	}
+	if stats := cfg.Cache.Stats(); stats.SemanticHits != 1 || stats.Misses != 1 {
+		t.Errorf("Unexpected cache stats %+v", stats)
+	}
+}
+
+// TestSearchHandler_CacheKeepsCitations tests that a cached answer cites the same
+// passages as the original answer, not the article's top-ranked passage.
+func TestSearchHandler_CacheKeepsCitations(t *testing.T) {
+	cfg, _, _ := newCacheConfig(t)
+	chunker := kb.NewChunker(50, 0)
+	index := retrieval.NewBM25Index()
+	retrieval.NewArticleSync(index, retrieval.Chunked(chunker)).Load(context.Background(), []kb.Article{runbook})
+	cfg.Store, cfg.Retriever, cfg.Chunker = kb.NewMemoryStore(runbook), index, chunker
+	cfg.LLM = replyLLM{`{"ai_summary_answer": "Redeploy the previous release [kb-010#2].",
+		"ai_relevant_articles": [{"id": "kb-010", "title": "Server runbook"}, {"id": "kb-010#2", "title": "Server runbook - Rollback"}]}`}
+	handler := SearchHandler(cfg)
+
+	var first SearchResponse
+	json.NewDecoder(postSearch(handler, `{"query":"restart script or rollback release"}`).Body).Decode(&first)
+	var second SearchResponse
+	json.NewDecoder(postSearch(handler, `{"query":"restart script or rollback release"}`).Body).Decode(&second)
+	if !second.Cached {
+		t.Fatalf("Expected the answer from the cache, got %+v", second)
+	}
+	if len(first.Citations) == 0 || first.Citations[0].ChunkID == "kb-010#2" {
+		t.Fatalf("Expected the article's top-ranked passage cited first, got %+v", first.Citations)
+	}
+	if !reflect.DeepEqual(second.Citations, first.Citations) || !reflect.DeepEqual(second.RelevantArticles, first.RelevantArticles) {
+		t.Errorf("Expected the cached citations %+v, got %+v", first.Citations, second.Citations)
+	}
+}
+
+// modelRecorder is a promptRecorder that names the model it stands for.
+type modelRecorder struct {
+	*promptRecorder
+	model string
+}
+
+func (m modelRecorder) ModelName() string {
+	return m.model
+}
+
+// TestSearchHandler_CacheModelChange tests that answers cached by one model are not
+// served once another model is configured.
+func TestSearchHandler_CacheModelChange(t *testing.T) {
+	cfg, recorder, _ := newCacheConfig(t)
+	cfg.LLM = modelRecorder{recorder, "model-a"}
+	postSearch(SearchHandler(cfg), `{"query":"How to reset password?"}`)
+
+	cfg.LLM = modelRecorder{recorder, "model-b"}
+	var resp SearchResponse
+	json.NewDecoder(postSearch(SearchHandler(cfg), `{"query":"How to reset password?"}`).Body).Decode(&resp)
+	if resp.Cached || len(recorder.prompts) != 2 {
+		t.Errorf("Expected a cache miss after the model changed, got %+v after %d prompts", resp.Cache, len(recorder.prompts))
+	}
+	if stats := cfg.Cache.Stats(); stats.Misses != 2 {
+		t.Errorf("Unexpected cache stats %+v", stats)
+	}
+}
+
+// TestAnswerCacheQuery tests that follow-up questions and searches without a cache are
+// not cached, and that the context does not depend on the question.
+func TestAnswerCacheQuery(t *testing.T) {
+	cfg, _, _ := newCacheConfig(t)
+	articles := kb.GetArticles()[:1]
+	q := answerCacheQuery(cfg, cfg.LLM, "reset password", articles, ai.AnswerOptions{})
+	if q == nil || q.key == "" || q.context == "" {
+		t.Fatalf("Expected a key and context for a first question, got %+v", q)
+	}
+	if other := answerCacheQuery(cfg, cfg.LLM, "change password", articles, ai.AnswerOptions{}); other.key == q.key || other.context != q.context {
+		t.Errorf("Expected another key in the same context, got %+v", other)
+	}
+	if q := answerCacheQuery(cfg, cfg.LLM, "and then?", articles, ai.AnswerOptions{History: []ai.Message{{Role: ai.RoleUser, Content: "reset password"}}}); q != nil {
+		t.Errorf("Expected no cache query for a follow-up, got %+v", q)
+	}
+	cfg.Cache = nil
+	if q := answerCacheQuery(cfg, cfg.LLM, "reset password", articles, ai.AnswerOptions{}); q != nil {
+		t.Errorf("Expected no cache query without a cache, got %+v", q)
+	}
+}
+
+// TestSearchStreamHandler_Cache tests that a cached answer is streamed as one token.
+func TestSearchStreamHandler_Cache(t *testing.T) {
+	cfg, recorder, _ := newCacheConfig(t)
+	postSearch(SearchHandler(cfg), `{"query":"How to reset password?"}`)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/search-query/stream?query=how+to+reset+password", nil)
+	rr := httptest.NewRecorder()
+	SearchStreamHandler(cfg).ServeHTTP(rr, req)
+
+	events := parseEvents(t, rr.Body.String())
+	if names := eventNames(events); names != "retrieval,token,done" {
+		t.Fatalf("unexpected event order %q", names)
+	}
+	var token StreamToken
+	json.Unmarshal([]byte(events[1].data), &token)
+	var done StreamDone
+	decodeEvent(t, events, EventDone, &done)
+	if !done.Cached || done.Cache == nil || done.Cache.Match != cache.MatchExact || token.Text != done.SummaryAnswer || !strings.Contains(done.SummaryAnswer, "[kb-001]") || done.Tokens != nil || len(recorder.prompts) != 1 {
+		t.Errorf("Expected the cached answer, got %+v after %d prompts", done, len(recorder.prompts))
+	}
+}
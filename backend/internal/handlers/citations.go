@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"ai-knowledge-base/internal/ai"
+	"ai-knowledge-base/internal/kb"
+	"ai-knowledge-base/internal/retrieval"
+	"errors"
+	"strings"
+)
+
+// Citation points to the passage of an article that supports the answer.
+type Citation struct {
+	ArticleID string `json:"article_id"`
+	ChunkID   string `json:"chunk_id"`
+	Title     string `json:"title"`
+	Heading   string `json:"heading,omitempty"`
+	Passage   string `json:"passage"`
+	// Start and End are byte offsets of the passage within the article content.
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// Citation warning problems.
+const (
+	// CitationUnknown flags an ID that was not among the passages shown to the model.
+	// The citation is dropped.
+	CitationUnknown = "unknown_id"
+	// CitationMislabeled flags a citation whose title does not match the cited
+	// article. The article's own title is used instead.
+	CitationMislabeled = "mislabeled_title"
+)
+
+// CitationWarning reports a citation made by the model that could not be used as given.
+type CitationWarning struct {
+	// ID is the ID the model cited.
+	ID string `json:"id"`
+	// Problem is CitationUnknown or CitationMislabeled.
+	Problem string `json:"problem"`
+	// Title is the title the model gave the citation, if any.
+	Title string `json:"title,omitempty"`
+}
+
+// passage is a retrieved hit resolved to the article and chunk it refers to.
+type passage struct {
+	hit     retrieval.Hit
+	article kb.Article
+	chunk   kb.Chunk
+}
+
+// resolvePassages loads the article behind each hit and, for chunk-level hits,
+// re-splits it to find the passage. When chunker is nil every hit is a whole
+// article. Hits whose article or chunk no longer exists are dropped, so the
+// returned passages are in retrieval order and always resolvable.
+func resolvePassages(store kb.Store, chunker *kb.Chunker, hits []retrieval.Hit) ([]passage, error) {
+	articles := make(map[string]kb.Article)
+	chunks := make(map[string][]kb.Chunk)
+
+	passages := make([]passage, 0, len(hits))
+	for _, hit := range hits {
+		articleID, index, isChunk := kb.ParseChunkID(hit.ID)
+		if chunker == nil || !isChunk {
+			articleID, isChunk = hit.ID, false
+		}
+
+		article, ok := articles[articleID]
+		if !ok {
+			var err error
+			article, err = store.Get(articleID)
+			if errors.Is(err, kb.ErrNotFound) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			articles[articleID] = article
+		}
+
+		chunk := kb.Chunk{ID: article.ID, ArticleID: article.ID, Text: article.Content, End: len(article.Content)}
+		if isChunk {
+			if _, ok := chunks[articleID]; !ok {
+				chunks[articleID] = chunker.Split(article)
+			}
+			if index >= len(chunks[articleID]) {
+				continue
+			}
+			chunk = chunks[articleID][index]
+		}
+		passages = append(passages, passage{hit: hit, article: article, chunk: chunk})
+	}
+	return passages, nil
+}
+
+// promptArticles presents each passage to the model as an article of its own, so
+// that the IDs the model cites are chunk IDs.
+func promptArticles(passages []passage) []kb.Article {
+	articles := make([]kb.Article, len(passages))
+	for i, p := range passages {
+		articles[i] = kb.Article{ID: p.chunk.ID, Title: p.title(), Content: p.chunk.Text}
+	}
+	return articles
+}
+
+// promptedPassages returns the passages the model was shown: those among articles, the
+// prompt articles left after screening, and among the ones the prompt budget kept.
+func promptedPassages(passages []passage, articles []kb.Article, budget *ai.PromptBudget) []passage {
+	shown := make(map[string]bool, len(articles))
+	for _, article := range articles {
+		shown[article.ID] = true
+	}
+	if budget != nil {
+		kept := make(map[string]bool, len(budget.Articles))
+		for _, id := range budget.Articles {
+			kept[id] = shown[id]
+		}
+		shown = kept
+	}
+	prompted := make([]passage, 0, len(passages))
+	for _, p := range passages {
+		if shown[p.chunk.ID] {
+			prompted = append(prompted, p)
+		}
+	}
+	return prompted
+}
+
+// title is the title the passage is shown to the model with.
+func (p passage) title() string {
+	if p.chunk.Heading != "" {
+		return p.article.Title + " - " + p.chunk.Heading
+	}
+	return p.article.Title
+}
+
+// cite maps the IDs the model returned back to passages. A chunk ID cites that
+// passage; a bare article ID cites the article's highest-ranked passage. passages must
+// be the ones in the prompt: other IDs are dropped, since the model may not cite what
+// it was not shown. It returns the cited articles, deduplicated and with their canonical
+// titles, and one citation per distinct passage.
+//
+// Every citation that could not be used as given is reported in the warnings: IDs
+// that were not shown, whether listed in cited or written as [id] in the answer
+// text, and titles that match neither the article nor the passage cited.
+func cite(passages []passage, cited []kb.Article, answer string) ([]kb.Article, []Citation, []CitationWarning) {
+	byChunk := make(map[string]passage, len(passages))
+	byArticle := make(map[string]passage, len(passages))
+	for _, p := range passages {
+		byChunk[p.chunk.ID] = p
+		if _, ok := byArticle[p.article.ID]; !ok {
+			byArticle[p.article.ID] = p
+		}
+	}
+	lookup := func(id string) (passage, bool) {
+		if p, ok := byChunk[id]; ok {
+			return p, true
+		}
+		p, ok := byArticle[id]
+		return p, ok
+	}
+
+	articles := []kb.Article{}
+	citations := []Citation{}
+	warnings := []CitationWarning{}
+	seenArticles := make(map[string]bool)
+	seenChunks := make(map[string]bool)
+	seenWarnings := make(map[[2]string]bool)
+	warn := func(warning CitationWarning) {
+		if key := [2]string{warning.Problem, warning.ID}; !seenWarnings[key] {
+			seenWarnings[key] = true
+			warnings = append(warnings, warning)
+		}
+	}
+	for _, c := range cited {
+		p, ok := lookup(c.ID)
+		if !ok {
+			warn(CitationWarning{ID: c.ID, Problem: CitationUnknown, Title: c.Title})
+			continue
+		}
+		if c.Title != "" && !matchesTitle(c.Title, p) {
+			warn(CitationWarning{ID: c.ID, Problem: CitationMislabeled, Title: c.Title})
+		}
+		if !seenArticles[p.article.ID] {
+			seenArticles[p.article.ID] = true
+			articles = append(articles, kb.Article{ID: p.article.ID, Title: p.article.Title})
+		}
+		if !seenChunks[p.chunk.ID] {
+			seenChunks[p.chunk.ID] = true
+			citations = append(citations, Citation{
+				ArticleID: p.article.ID,
+				ChunkID:   p.chunk.ID,
+				Title:     p.article.Title,
+				Heading:   p.chunk.Heading,
+				Passage:   p.chunk.Text,
+				Start:     p.chunk.Start,
+				End:       p.chunk.End,
+			})
+		}
+	}
+	for _, id := range ai.CitedIDs(answer) {
+		if _, ok := lookup(id); !ok {
+			warn(CitationWarning{ID: id, Problem: CitationUnknown})
+		}
+	}
+	return articles, citations, warnings
+}
+
+// matchesTitle reports whether title, as given by the model, names the article or
+// passage p. Case and surrounding whitespace are ignored.
+func matchesTitle(title string, p passage) bool {
+	title = strings.TrimSpace(title)
+	return strings.EqualFold(title, p.article.Title) || strings.EqualFold(title, p.title())
+}
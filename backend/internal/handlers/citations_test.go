@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"ai-knowledge-base/internal/kb"
+	"ai-knowledge-base/internal/retrieval"
+	"reflect"
+	"testing"
+)
+
+var runbook = kb.Article{
+	ID:      "kb-010",
+	Title:   "Server runbook",
+	Content: "Overview of the service.\n\n## Restart\n\nRun the restart script.\n\n## Rollback\n\nRedeploy the previous release.",
+}
+
+// TestResolvePassagesSkipsDeletedArticles tests that hits for articles missing from the store are dropped.
+func TestResolvePassagesSkipsDeletedArticles(t *testing.T) {
+	store := kb.NewMemoryStore(kb.GetArticles()...)
+	hits := []retrieval.Hit{{ID: "kb-002", Score: 2}, {ID: "kb-404", Score: 1.5}, {ID: "kb-001", Score: 1}}
+
+	passages, err := resolvePassages(store, nil, hits)
+	if err != nil {
+		t.Fatalf("resolvePassages failed: %v", err)
+	}
+	if len(passages) != 2 {
+		t.Fatalf("expected 2 passages, got %d", len(passages))
+	}
+	if passages[0].hit.ID != "kb-002" || passages[0].article.ID != "kb-002" || passages[1].article.ID != "kb-001" {
+		t.Errorf("passages out of order: %+v", passages)
+	}
+	if passages[1].chunk.Text != passages[1].article.Content {
+		t.Errorf("expected a whole-article passage without a chunker, got %+v", passages[1].chunk)
+	}
+}
+
+// TestResolvePassagesChunks tests that chunk hits resolve to their passage and that
+// chunk indexes past the end of the article are dropped.
+func TestResolvePassagesChunks(t *testing.T) {
+	store := kb.NewMemoryStore(runbook)
+	hits := []retrieval.Hit{{ID: "kb-010#2"}, {ID: "kb-010#9"}, {ID: "kb-010#1"}}
+
+	passages, err := resolvePassages(store, kb.NewChunker(50, 0), hits)
+	if err != nil {
+		t.Fatalf("resolvePassages failed: %v", err)
+	}
+	if len(passages) != 2 {
+		t.Fatalf("expected 2 passages, got %+v", passages)
+	}
+	if p := passages[0].chunk; p.Heading != "Rollback" || p.Text != "Redeploy the previous release." {
+		t.Errorf("unexpected first passage %+v", p)
+	}
+	if p := passages[1].chunk; runbook.Content[p.Start:p.End] != "Run the restart script." {
+		t.Errorf("unexpected second passage %+v", p)
+	}
+}
+
+// TestCite tests mapping cited IDs back to articles and passages.
+func TestCite(t *testing.T) {
+	passages, _ := resolvePassages(kb.NewMemoryStore(runbook), kb.NewChunker(50, 0),
+		[]retrieval.Hit{{ID: "kb-010#1"}, {ID: "kb-010#2"}})
+
+	articles, citations, warnings := cite(passages, []kb.Article{
+		{ID: "kb-010#2", Title: "Server runbook - Rollback"},
+		{ID: "kb-010"},   // bare article ID: the top-ranked passage
+		{ID: "kb-010#2"}, // duplicate
+	}, "Redeploy the previous release [kb-010#2].")
+
+	if len(articles) != 1 || articles[0].ID != "kb-010" || articles[0].Title != "Server runbook" {
+		t.Errorf("expected the canonical article once, got %+v", articles)
+	}
+	if len(citations) != 2 || citations[0].ChunkID != "kb-010#2" || citations[1].ChunkID != "kb-010#1" {
+		t.Fatalf("unexpected citations %+v", citations)
+	}
+	if citations[1].Heading != "Restart" || citations[1].Passage != "Run the restart script." {
+		t.Errorf("unexpected citation %+v", citations[1])
+	}
+	if len(warnings) != 0 {
+		t.Errorf("expected no warnings, got %+v", warnings)
+	}
+}
+
+// TestCiteWarnings tests that unknown IDs are dropped and reported, and that wrong
+// titles are replaced and reported.
+func TestCiteWarnings(t *testing.T) {
+	passages, _ := resolvePassages(kb.NewMemoryStore(runbook), kb.NewChunker(50, 0),
+		[]retrieval.Hit{{ID: "kb-010#1"}})
+
+	articles, citations, warnings := cite(passages, []kb.Article{
+		{ID: "kb-999", Title: "Invented article"},
+		{ID: "kb-010#1", Title: "Database backups"},
+		{ID: "kb-010#2", Title: "Server runbook - Rollback"}, // exists, but was not retrieved
+	}, "Restart it [kb-010#1], or see [kb-999] and [kb-404].")
+
+	if len(articles) != 1 || articles[0].Title != "Server runbook" || len(citations) != 1 {
+		t.Errorf("expected only the retrieved passage, with its own title, got %+v and %+v", articles, citations)
+	}
+	want := []CitationWarning{
+		{ID: "kb-999", Problem: CitationUnknown, Title: "Invented article"},
+		{ID: "kb-010#1", Problem: CitationMislabeled, Title: "Database backups"},
+		{ID: "kb-010#2", Problem: CitationUnknown, Title: "Server runbook - Rollback"},
+		{ID: "kb-404", Problem: CitationUnknown},
+	}
+	if !reflect.DeepEqual(warnings, want) {
+		t.Errorf("got warnings %+v, want %+v", warnings, want)
+	}
+}
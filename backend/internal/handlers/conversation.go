@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"ai-knowledge-base/internal/ai"
+	"ai-knowledge-base/internal/database"
+	"cmp"
+	"context"
+	"database/sql"
+	"log"
+	"strings"
+)
+
+// maxHistoryMessages is how many of a conversation's latest messages are loaded for a
+// follow-up question, before the token budget is applied.
+const maxHistoryMessages = 20
+
+// loadConversation returns the earlier messages of the conversation a search continues,
+// oldest first, or none when it starts a new one. An unknown conversation is
+// database.ErrConversationNotFound.
+func loadConversation(db *sql.DB, conversationID string) ([]database.Message, error) {
+	if conversationID == "" {
+		return nil, nil
+	}
+	messages, err := database.RecentMessages(db, conversationID, maxHistoryMessages)
+	if err != nil {
+		log.Printf("Failed to load conversation %s: %v", conversationID, err)
+	}
+	return messages, err
+}
+
+// historyTurns returns the latest messages that fit within maxTokens as estimated for
+// llm, oldest first, as turns for the prompt. A leading answer whose question did not
+// fit is left out too.
+func historyTurns(llm ai.LLM, messages []database.Message, maxTokens int) []ai.Message {
+	start, tokens := len(messages), 0
+	for start > 0 {
+		tokens += ai.EstimateTokens(llm, messages[start-1].Content)
+		if tokens > maxTokens {
+			break
+		}
+		start--
+	}
+	for start < len(messages) && messages[start].Role != ai.RoleUser {
+		start++
+	}
+	turns := make([]ai.Message, 0, len(messages)-start)
+	for _, m := range messages[start:] {
+		turns = append(turns, ai.Message{Role: m.Role, Content: m.Content})
+	}
+	return turns
+}
+
+// retrievalQuery returns the query to retrieve passages for. A follow-up question is
+// rewritten into a standalone query by the model, within the AI budget, when
+// cfg.RewriteQueries is set and the search may call the AI. The model is given
+// promptQuery, the question as screened for prompt injection, and the screened history.
+// Otherwise, or if the model fails, the question is prefixed with the previous one.
+func retrievalQuery(ctx context.Context, cfg SearchConfig, llm ai.LLM, req SearchRequest, promptQuery string, messages []database.Message, history []ai.Message) string {
+	if len(messages) == 0 {
+		return req.Query
+	}
+	if cfg.RewriteQueries && req.Mode != ModeRetrieve && len(history) > 0 {
+		aiCtx, cancel := withBudget(ctx, cfg.AITimeout)
+		rewritten, _, err := ai.RewriteQuery(aiCtx, llm, history, promptQuery)
+		cancel()
+		if err == nil {
+			return rewritten
+		}
+		log.Printf("Failed to rewrite follow-up question, prefixing the previous one: %v", err)
+	}
+	return expandQuery(messages, req.Query)
+}
+
+// expandQuery prefixes query with the last question of the conversation, as rewritten
+// for retrieval if it was.
+func expandQuery(messages []database.Message, query string) string {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if m := messages[i]; m.Role == ai.RoleUser {
+			return cmp.Or(m.RewrittenQuery, m.Content) + " " + query
+		}
+	}
+	return query
+}
+
+// saveTurn adds a search's question and answer to its conversation, starting a new
+// conversation if it has none, and returns the conversation ID. Failures are only
+// logged, and an empty ID is returned if no conversation could be started.
+func saveTurn(db *sql.DB, req SearchRequest, query string, aiResponse *ai.AIResponse, searchID int64) string {
+	conversationID := req.ConversationID
+	if conversationID == "" {
+		id, err := database.CreateConversation(db)
+		if err != nil {
+			log.Printf("Failed to start conversation: %v", err)
+			return ""
+		}
+		conversationID = id
+	}
+	question := database.Message{Role: ai.RoleUser, Content: req.Query, SearchID: searchID}
+	if query != req.Query {
+		question.RewrittenQuery = query
+	}
+	answer := database.Message{Role: ai.RoleAssistant, Content: turnAnswer(aiResponse), SearchID: searchID}
+	if err := database.SaveMessages(db, conversationID, question, answer); err != nil {
+		log.Printf("Failed to save conversation %s: %v", conversationID, err)
+	}
+	return conversationID
+}
+
+// turnAnswer is the answer recorded in the conversation: the summary answer, or the
+// titles of the relevant articles for retrieval-only searches.
+func turnAnswer(aiResponse *ai.AIResponse) string {
+	if aiResponse.SummaryAnswer != "" {
+		return aiResponse.SummaryAnswer
+	}
+	titles := make([]string, len(aiResponse.RelevantArticles))
+	for i, article := range aiResponse.RelevantArticles {
+		titles[i] = article.Title
+	}
+	return "Relevant articles: " + strings.Join(titles, "; ")
+}
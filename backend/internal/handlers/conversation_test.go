@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"ai-knowledge-base/internal/ai"
+	"ai-knowledge-base/internal/database"
+	"ai-knowledge-base/internal/injection"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+var vpnConversation = []database.Message{
+	{Role: ai.RoleUser, Content: "How do I connect to the VPN?"},
+	{Role: ai.RoleAssistant, Content: "Install the latest VPN client [kb-002]."},
+	{Role: ai.RoleUser, Content: "What if that still fails?", RewrittenQuery: "VPN connection still fails"},
+	{Role: ai.RoleAssistant, Content: "Restart your computer [kb-002]."},
+}
+
+// TestHistoryTurns tests that the latest turns within the budget are kept, starting
+// with a question.
+func TestHistoryTurns(t *testing.T) {
+	tests := []struct {
+		budget int
+		want   int
+	}{
+		{100, 4},
+		{12, 2}, // the last answer and question fit
+		{8, 0},  // only the last answer would fit, without its question
+		{0, 0},
+	}
+	for _, tt := range tests {
+		turns := historyTurns(ai.NewFake(), vpnConversation, tt.budget)
+		if len(turns) != tt.want || (len(turns) > 0 && (turns[0].Role != ai.RoleUser || turns[len(turns)-1].Content != "Restart your computer [kb-002].")) {
+			t.Errorf("historyTurns(%d) = %+v, want the last %d messages", tt.budget, turns, tt.want)
+		}
+	}
+}
+
+// TestExpandQuery tests the fallback for follow-up questions that are not rewritten.
+func TestExpandQuery(t *testing.T) {
+	if got := expandQuery(vpnConversation, "and on a Mac?"); got != "VPN connection still fails and on a Mac?" {
+		t.Errorf("Unexpected expanded query %q", got)
+	}
+	if got := expandQuery(vpnConversation[:2], "and on a Mac?"); got != "How do I connect to the VPN? and on a Mac?" {
+		t.Errorf("Unexpected expanded query %q", got)
+	}
+}
+
+// TestSearchHandler_FollowUp tests that a follow-up question is retrieved with its
+// rewritten query and answered with the conversation so far.
+func TestSearchHandler_FollowUp(t *testing.T) {
+	cfg, recorder := newInjectionConfig(t, injection.PolicyWarn)
+	handler := SearchHandler(cfg)
+
+	var first SearchResponse
+	json.NewDecoder(postSearch(handler, `{"query":"How do I connect to the VPN?"}`).Body).Decode(&first)
+	if first.ConversationID == "" || first.RewrittenQuery != "" || strings.Contains(recorder.prompts[0], "<conversation>") {
+		t.Fatalf("expected a new conversation without history, got %+v", first)
+	}
+
+	var second SearchResponse
+	json.NewDecoder(postSearch(handler, `{"query":"what if that still fails?","conversation_id":"`+first.ConversationID+`"}`).Body).Decode(&second)
+	if second.ConversationID != first.ConversationID || second.RewrittenQuery != "How do I connect to the VPN? what if that still fails?" {
+		t.Errorf("expected the follow-up rewritten within the conversation, got %+v", second)
+	}
+	if len(recorder.prompts) != 3 || !strings.Contains(recorder.prompts[1], "<follow_up>") {
+		t.Fatalf("expected a rewrite and an answer prompt, got %q", recorder.prompts)
+	}
+	answerPrompt := recorder.prompts[2]
+	if !strings.Contains(answerPrompt, "<turn role=\"user\">\nHow do I connect to the VPN?\n</turn>") ||
+		!strings.Contains(answerPrompt, "<turn role=\"assistant\">\n"+first.SummaryAnswer+"\n</turn>") ||
+		!strings.Contains(answerPrompt, "<question>\nwhat if that still fails?\n</question>") {
+		t.Errorf("expected the first turn in the answer prompt, got:\n%s", answerPrompt)
+	}
+
+	messages, _ := database.RecentMessages(cfg.DB, first.ConversationID, 10)
+	if len(messages) != 4 || messages[2].RewrittenQuery != second.RewrittenQuery || messages[3].Content != second.SummaryAnswer {
+		t.Errorf("expected both turns saved, got %+v", messages)
+	}
+}
+
+// TestSearchHandler_FollowUpWithoutRewriting tests that follow-ups fall back to the
+// previous question when rewriting is off or the search is retrieval-only.
+func TestSearchHandler_FollowUpWithoutRewriting(t *testing.T) {
+	cfg, recorder := newInjectionConfig(t, injection.PolicyWarn)
+	cfg.RewriteQueries = false
+	handler := SearchHandler(cfg)
+
+	var first, second SearchResponse
+	json.NewDecoder(postSearch(handler, `{"query":"printer offline","mode":"retrieve"}`).Body).Decode(&first)
+	json.NewDecoder(postSearch(handler, `{"query":"on Windows?","conversation_id":"`+first.ConversationID+`"}`).Body).Decode(&second)
+	if second.RewrittenQuery != "printer offline on Windows?" || len(recorder.prompts) != 1 {
+		t.Errorf("expected the previous question prefixed without a rewrite prompt, got %+v after %q", second, recorder.prompts)
+	}
+	if !strings.Contains(recorder.prompts[0], "Relevant articles: ") {
+		t.Errorf("expected the retrieval-only turn in the history, got:\n%s", recorder.prompts[0])
+	}
+}
+
+// TestSearchHandler_UnknownConversation tests that an unknown conversation is a 404.
+func TestSearchHandler_UnknownConversation(t *testing.T) {
+	cfg, _ := newInjectionConfig(t, injection.PolicyWarn)
+	if rr := postSearch(SearchHandler(cfg), `{"query":"vpn","conversation_id":"missing"}`); rr.Code != http.StatusNotFound {
+		t.Errorf("got %v want %v", rr.Code, http.StatusNotFound)
+	}
+
+	req, _ := http.NewRequest("GET", "/api/search-query/stream?query=vpn&conversation_id=missing", nil)
+	rr := httptest.NewRecorder()
+	SearchStreamHandler(cfg).ServeHTTP(rr, req)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("stream: got %v want %v", rr.Code, http.StatusNotFound)
+	}
+}
+
+// TestSearchStreamHandler_FollowUp tests follow-up questions on the streaming endpoint.
+func TestSearchStreamHandler_FollowUp(t *testing.T) {
+	cfg, _ := newInjectionConfig(t, injection.PolicyWarn)
+	handler := SearchStreamHandler(cfg)
+	stream := func(params url.Values) StreamDone {
+		req, _ := http.NewRequest("GET", "/api/search-query/stream?"+params.Encode(), nil)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		var done StreamDone
+		decodeEvent(t, parseEvents(t, rr.Body.String()), EventDone, &done)
+		return done
+	}
+
+	first := stream(url.Values{"query": {"How do I connect to the VPN?"}})
+	second := stream(url.Values{"query": {"what if that still fails?"}, "conversation_id": {first.ConversationID}})
+	if first.ConversationID == "" || second.ConversationID != first.ConversationID || second.RewrittenQuery == "" {
+		t.Errorf("expected the follow-up to continue the conversation, got %+v and %+v", first, second)
+	}
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Search stages, as reported in ErrorResponse.
+const (
+	StageRetrieval = "retrieval"
+	StageAI        = "ai"
+)
+
+// ErrorResponse is the JSON body of structured error responses, such as the 504
+// returned when a search runs out of time.
+type ErrorResponse struct {
+	Error string `json:"error"`
+	// Stage is the search stage that failed: StageRetrieval or StageAI.
+	Stage string `json:"stage,omitempty"`
+	// Timeout is the budget that was exceeded, e.g. "30s".
+	Timeout string `json:"timeout,omitempty"`
+}
+
+// withBudget returns a context that expires after budget, or ctx itself if budget is
+// zero. The parent's deadline still applies.
+func withBudget(ctx context.Context, budget time.Duration) (context.Context, context.CancelFunc) {
+	if budget <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, budget)
+}
+
+// stageError describes why stage failed with err. It reports whether the failure was a
+// timeout, in which case the response says whether the whole search (ctx) or only the
+// stage ran out of time. Other failures get the generic msg.
+func stageError(ctx context.Context, cfg SearchConfig, stage string, err error, msg string) (ErrorResponse, bool) {
+	if !errors.Is(err, context.DeadlineExceeded) {
+		return ErrorResponse{Error: msg, Stage: stage}, false
+	}
+	if ctx.Err() != nil {
+		return ErrorResponse{Error: "Search timed out", Stage: stage, Timeout: cfg.Timeout.String()}, true
+	}
+	budget := cfg.RetrievalTimeout
+	if stage == StageAI {
+		budget = cfg.AITimeout
+	}
+	resp := ErrorResponse{Error: "Search stage timed out", Stage: stage}
+	if budget > 0 {
+		resp.Timeout = budget.String()
+	}
+	return resp, true
+}
+
+// writeStageError responds to a failed stage: a structured 504 for timeouts, nothing
+// if the client has already gone away, and a plain 500 with msg otherwise.
+func writeStageError(ctx context.Context, w http.ResponseWriter, r *http.Request, cfg SearchConfig, stage string, err error, msg string) {
+	if r.Context().Err() != nil {
+		log.Printf("Client went away during %s stage: %v", stage, err)
+		return
+	}
+	resp, timedOut := stageError(ctx, cfg, stage, err, msg)
+	if !timedOut {
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Search %s stage timed out: %v", stage, err)
+	writeJSONError(w, http.StatusGatewayTimeout, resp)
+}
+
+// writeJSONError sends resp as a JSON error response.
+func writeJSONError(w http.ResponseWriter, status int, resp ErrorResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"ai-knowledge-base/internal/ai"
+	"ai-knowledge-base/internal/database"
+	"ai-knowledge-base/internal/retrieval"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// hangingLLM stands in for a provider that never answers: it blocks until the request
+// context ends.
+type hangingLLM struct{}
+
+func (hangingLLM) Name() string {
+	return "hanging"
+}
+
+func (hangingLLM) Generate(ctx context.Context, req ai.Request) (*ai.Completion, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+// hangingRetriever is a retriever that blocks until the request context ends.
+type hangingRetriever struct{}
+
+func (hangingRetriever) Retrieve(ctx context.Context, query string, k int) ([]retrieval.Hit, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+// decodeError checks for a 504 and returns its structured body.
+func decodeError(t *testing.T, rr *httptest.ResponseRecorder) ErrorResponse {
+	t.Helper()
+	if rr.Code != http.StatusGatewayTimeout {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusGatewayTimeout)
+	}
+	var resp ErrorResponse
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("could not decode error body: %v", err)
+	}
+	return resp
+}
+
+// TestSearchHandler_AITimeout tests that an AI call running over its budget gets a
+// 504 in answer mode and falls back to retrieval-only in auto mode.
+func TestSearchHandler_AITimeout(t *testing.T) {
+	db := database.InitDB(testDBFile)
+	defer db.Close()
+
+	cfg := newSearchConfig(db)
+	cfg.LLM = hangingLLM{}
+	cfg.AITimeout = 20 * time.Millisecond
+	handler := SearchHandler(cfg)
+
+	resp := decodeError(t, postSearch(handler, `{"query":"vpn"}`))
+	if resp != (ErrorResponse{Error: "Search stage timed out", Stage: StageAI, Timeout: "20ms"}) {
+		t.Errorf("unexpected error body %+v", resp)
+	}
+
+	rr := postSearch(handler, `{"query":"vpn","mode":"auto"}`)
+	var fallback SearchResponse
+	json.NewDecoder(rr.Body).Decode(&fallback)
+	if rr.Code != http.StatusOK || fallback.Mode != ModeRetrieve || fallback.Warning == "" {
+		t.Errorf("expected auto mode to fall back, got %d %+v", rr.Code, fallback)
+	}
+}
+
+// TestSearchHandler_SearchTimeout tests that running out of the overall budget is a
+// 504 even in auto mode.
+func TestSearchHandler_SearchTimeout(t *testing.T) {
+	db := database.InitDB(testDBFile)
+	defer db.Close()
+
+	cfg := newSearchConfig(db)
+	cfg.LLM = hangingLLM{}
+	cfg.Timeout = 20 * time.Millisecond
+	cfg.AITimeout = time.Minute
+
+	resp := decodeError(t, postSearch(SearchHandler(cfg), `{"query":"vpn","mode":"auto"}`))
+	if resp != (ErrorResponse{Error: "Search timed out", Stage: StageAI, Timeout: "20ms"}) {
+		t.Errorf("unexpected error body %+v", resp)
+	}
+}
+
+// TestSearchHandler_RetrievalTimeout tests the retrieval budget.
+func TestSearchHandler_RetrievalTimeout(t *testing.T) {
+	db := database.InitDB(testDBFile)
+	defer db.Close()
+
+	cfg := newSearchConfig(db)
+	cfg.Retriever = hangingRetriever{}
+	cfg.RetrievalTimeout = 20 * time.Millisecond
+
+	resp := decodeError(t, postSearch(SearchHandler(cfg), `{"query":"vpn","mode":"retrieve"}`))
+	if resp.Stage != StageRetrieval || resp.Timeout != "20ms" {
+		t.Errorf("unexpected error body %+v", resp)
+	}
+}
+
+// TestSearchHandler_ClientGone tests that the AI call is cancelled with the request
+// and that nothing is written to a client that has gone away.
+func TestSearchHandler_ClientGone(t *testing.T) {
+	db := database.InitDB(testDBFile)
+	defer db.Close()
+
+	cfg := newSearchConfig(db)
+	cfg.LLM = hangingLLM{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, "POST", "/api/search-query", strings.NewReader(`{"query":"vpn"}`))
+	rr := httptest.NewRecorder()
+	time.AfterFunc(20*time.Millisecond, cancel)
+	SearchHandler(cfg).ServeHTTP(rr, req)
+
+	if rr.Body.Len() != 0 {
+		t.Errorf("expected no response for a cancelled request, got %q", rr.Body.String())
+	}
+}
+
+// TestSearchStreamHandler_AITimeout tests that a timeout after the stream has started
+// is reported in the error event.
+func TestSearchStreamHandler_AITimeout(t *testing.T) {
+	db := database.InitDB(testDBFile)
+	defer db.Close()
+
+	cfg := newSearchConfig(db)
+	cfg.LLM = hangingLLM{}
+	cfg.AITimeout = 20 * time.Millisecond
+
+	events := parseEvents(t, postSearch(SearchStreamHandler(cfg), `{"query":"vpn"}`).Body.String())
+	if names := eventNames(events); names != "retrieval,error" {
+		t.Fatalf("unexpected event order %q", names)
+	}
+	var resp ErrorResponse
+	decodeEvent(t, events, EventError, &resp)
+	if resp.Stage != StageAI || resp.Timeout != "20ms" {
+		t.Errorf("unexpected error event %+v", resp)
+	}
+}
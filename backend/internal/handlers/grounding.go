@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"ai-knowledge-base/internal/ai"
+	"ai-knowledge-base/internal/grounding"
+	"context"
+	"log"
+)
+
+// lowConfidenceAnswer replaces an AI answer that the grounding check does not trust.
+const lowConfidenceAnswer = "I could not find a confident answer to your question in the knowledge base. The articles below may still help."
+
+// groundingWarning tells the user that the AI answer was withheld.
+const groundingWarning = "The AI answer was not supported well enough by the cited articles, so it was withheld."
+
+// groundAnswer checks the AI answer against the passages it cites. An answer that is
+// not confidently grounded is replaced with lowConfidenceAnswer, keeping its relevant
+// articles, and a warning is returned. It returns nil for retrieval-only answers or
+// when no checker is configured.
+func groundAnswer(ctx context.Context, cfg SearchConfig, aiResponse *ai.AIResponse, citations []Citation) (*grounding.Result, string) {
+	if cfg.Grounding == nil || aiResponse.Completion == nil {
+		return nil, ""
+	}
+	sources := make([]grounding.Source, len(citations))
+	for i, c := range citations {
+		sources[i] = grounding.Source{ID: c.ChunkID, Text: c.Passage}
+	}
+
+	ctx, cancel := withBudget(ctx, cfg.AITimeout)
+	defer cancel()
+	result := cfg.Grounding.Check(ctx, aiResponse.SummaryAnswer, sources)
+	if result.Confident {
+		return &result, ""
+	}
+	log.Printf("Withholding AI answer from %s with grounding score %.2f: %q", answerProvider(aiResponse), result.Score, aiResponse.SummaryAnswer)
+	aiResponse.SummaryAnswer = lowConfidenceAnswer
+	return &result, groundingWarning
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"ai-knowledge-base/internal/ai"
+	"ai-knowledge-base/internal/injection"
+	"ai-knowledge-base/internal/kb"
+	"errors"
+	"log"
+)
+
+// Sources of InjectionWarnings other than articles.
+const (
+	// InjectionSourceQuery is the Source of an InjectionWarning about the user's query.
+	InjectionSourceQuery = "query"
+	// InjectionSourceHistory is the Source of an InjectionWarning about an earlier turn
+	// of the conversation.
+	InjectionSourceHistory = "history"
+)
+
+// InjectionWarning reports a query or article that looks like a prompt-injection
+// attempt, and what was done about it.
+type InjectionWarning struct {
+	// Source is InjectionSourceQuery or the ID of the article or passage.
+	Source string `json:"source"`
+	injection.Detection
+	// Action is the policy applied: injection.PolicyBlock, PolicyWarn or PolicyStrip.
+	Action string `json:"action"`
+}
+
+// errInjectionBlocked rejects a query under injection.PolicyBlock.
+var errInjectionBlocked = errors.New("Query was rejected because it looks like a prompt-injection attempt")
+
+// screenQuery scans a query that is about to be sent to the model and applies the
+// injection policy. It returns the query to put in the prompt, or errInjectionBlocked.
+// Retrieval-only searches never reach the model and are not screened.
+func screenQuery(cfg SearchConfig, req SearchRequest) (string, []InjectionWarning, error) {
+	if cfg.Injection == nil || req.Mode == ModeRetrieve {
+		return req.Query, nil, nil
+	}
+	detection := cfg.Injection.Detect(req.Query)
+	if !cfg.Injection.Flagged(detection) {
+		return req.Query, nil, nil
+	}
+	log.Printf("Possible prompt injection in query (policy %s): %+v", cfg.InjectionPolicy, detection)
+	warning := InjectionWarning{Source: InjectionSourceQuery, Detection: detection, Action: cfg.InjectionPolicy}
+	switch cfg.InjectionPolicy {
+	case injection.PolicyBlock:
+		return "", nil, errInjectionBlocked
+	case injection.PolicyStrip:
+		return injection.Strip(req.Query), []InjectionWarning{warning}, nil
+	}
+	return req.Query, []InjectionWarning{warning}, nil
+}
+
+// screenHistory scans the earlier turns of a conversation that are about to be sent to
+// the model and applies the injection policy. Turns are saved as they were written,
+// and retrieval-only turns were never screened, so they are screened each time they
+// are replayed: a flagged question is left out with its answer under
+// injection.PolicyBlock, and flagged turns have the matched instructions removed under
+// injection.PolicyStrip.
+func screenHistory(cfg SearchConfig, req SearchRequest, turns []ai.Message) ([]ai.Message, []InjectionWarning) {
+	if cfg.Injection == nil || req.Mode == ModeRetrieve {
+		return turns, nil
+	}
+	var warnings []InjectionWarning
+	screened := make([]ai.Message, 0, len(turns))
+	dropAnswer := false
+	for _, turn := range turns {
+		if dropAnswer && turn.Role != ai.RoleUser {
+			continue
+		}
+		dropAnswer = false
+		detection := cfg.Injection.Detect(turn.Content)
+		if !cfg.Injection.Flagged(detection) {
+			screened = append(screened, turn)
+			continue
+		}
+		log.Printf("Possible prompt injection in conversation history (policy %s): %+v", cfg.InjectionPolicy, detection)
+		warnings = append(warnings, InjectionWarning{Source: InjectionSourceHistory, Detection: detection, Action: cfg.InjectionPolicy})
+		switch cfg.InjectionPolicy {
+		case injection.PolicyBlock:
+			dropAnswer = turn.Role == ai.RoleUser
+			continue
+		case injection.PolicyStrip:
+			turn.Content = injection.Strip(turn.Content)
+		}
+		screened = append(screened, turn)
+	}
+	return screened, warnings
+}
+
+// screenArticles scans the articles about to be sent to the model, IDs included, and applies the
+// injection policy: flagged articles are left out under injection.PolicyBlock and
+// have the matched instructions removed under injection.PolicyStrip.
+func screenArticles(cfg SearchConfig, articles []kb.Article) ([]kb.Article, []InjectionWarning) {
+	if cfg.Injection == nil {
+		return articles, nil
+	}
+	var warnings []InjectionWarning
+	screened := make([]kb.Article, 0, len(articles))
+	for _, article := range articles {
+		detection := cfg.Injection.Detect(article.ID + "\n" + article.Title + "\n" + article.Content)
+		if !cfg.Injection.Flagged(detection) {
+			screened = append(screened, article)
+			continue
+		}
+		log.Printf("Possible prompt injection in article %s (policy %s): %+v", article.ID, cfg.InjectionPolicy, detection)
+		warnings = append(warnings, InjectionWarning{Source: article.ID, Detection: detection, Action: cfg.InjectionPolicy})
+		switch cfg.InjectionPolicy {
+		case injection.PolicyBlock:
+			continue
+		case injection.PolicyStrip:
+			article.Title, article.Content = injection.Strip(article.Title), injection.Strip(article.Content)
+		}
+		screened = append(screened, article)
+	}
+	return screened, warnings
+}
@@ -2,13 +2,20 @@ package handlers
 
 import "net/http"
 
-// CORSMiddleware enables Cross-Origin Resource Sharing for our API.
-func CORSMiddleware(next http.Handler) http.Handler {
+// CORSMiddleware enables Cross-Origin Resource Sharing for our API. callerHeader is the
+// configured header labelling callers, which browsers must be allowed to send.
+func CORSMiddleware(callerHeader string, next http.Handler) http.Handler {
+	allowedHeaders := "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization"
+	if callerHeader != "" {
+		allowedHeaders += ", " + callerHeader
+	}
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Set headers to allow requests from any origin, with any method and headers.
+		// Set headers to allow searches and reads from any origin. The write methods are
+		// not advertised, so browsers on other origins cannot edit articles or purge the
+		// cache; those routes also require the admin token.
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
-		w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
+		w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", allowedHeaders)
 
 		// If this is a pre-flight "OPTIONS" request, we just send back the headers and a 200 OK.
 		// The browser sends this automatically to check if the actual request is safe to send.
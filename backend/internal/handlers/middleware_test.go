@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestCORSMiddleware tests that preflight requests are answered without reaching the
+// handler, that write methods are not offered to other origins and that the configured
+// caller header may be sent.
+func TestCORSMiddleware(t *testing.T) {
+	called := false
+	handler := CORSMiddleware("X-Team", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { called = true }))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodOptions, "/api/articles/kb-001", nil))
+	if rr.Code != http.StatusOK || called {
+		t.Errorf("Expected the preflight answered by the middleware, got %d", rr.Code)
+	}
+	methods := rr.Header().Get("Access-Control-Allow-Methods")
+	for _, method := range []string{"PUT", "PATCH", "DELETE"} {
+		if strings.Contains(methods, method) {
+			t.Errorf("Expected %s not to be allowed cross-origin, got %q", method, methods)
+		}
+	}
+	if headers := rr.Header().Get("Access-Control-Allow-Headers"); !strings.HasSuffix(headers, ", X-Team") || strings.Contains(headers, "X-User-ID") {
+		t.Errorf("Expected the configured caller header allowed, got %q", headers)
+	}
+}
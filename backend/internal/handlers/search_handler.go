@@ -2,21 +2,197 @@ package handlers
 
 import (
 	"ai-knowledge-base/internal/ai"
+	"ai-knowledge-base/internal/cache"
 	"ai-knowledge-base/internal/database"
+	"ai-knowledge-base/internal/grounding"
+	"ai-knowledge-base/internal/injection"
 	"ai-knowledge-base/internal/kb"
+	"ai-knowledge-base/internal/retrieval"
+	"ai-knowledge-base/internal/usage"
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
+	"os"
+	"strings"
+	"time"
 )
 
+// Search modes.
+const (
+	// ModeAnswer asks the AI for a summary answer. If the AI is unavailable it falls
+	// back to ModeRetrieve when SearchConfig.RetrievalFallback is set, and fails otherwise.
+	ModeAnswer = "answer"
+	// ModeRetrieve returns ranked articles with highlighted snippets and never calls the AI.
+	ModeRetrieve = "retrieve"
+	// ModeAuto behaves like ModeAnswer but always falls back to ModeRetrieve when the AI fails.
+	ModeAuto = "auto"
+)
+
+// ProviderRetrieval is reported as the provider of retrieval-only responses: the last
+// step of the fallback chain, after every AI provider.
+const ProviderRetrieval = "retrieval"
+
+// snippetWords is the length of the highlighted snippets generated for retrieval results.
+const snippetWords = 30
+
 // SearchRequest defines the structure of the incoming JSON request from the frontend.
 type SearchRequest struct {
 	Query string `json:"query"`
+	// Mode is ModeAnswer, ModeRetrieve or ModeAuto. It defaults to ModeAnswer.
+	Mode string `json:"mode,omitempty"`
+	// ConversationID continues an earlier conversation, making Query a follow-up
+	// question. Empty starts a new conversation.
+	ConversationID string `json:"conversation_id,omitempty"`
+}
+
+// SearchResponse is the AI answer plus debugging information about how it was produced.
+type SearchResponse struct {
+	*ai.AIResponse
+	// Mode is the mode that produced the response: ModeAnswer, or ModeRetrieve when
+	// retrieval-only was requested or the search fell back to it.
+	Mode string `json:"mode"`
+	// Warning explains why the search fell back to retrieval-only, or why the AI
+	// answer was withheld.
+	Warning string `json:"warning,omitempty"`
+	// Cached reports that the AI answer was served from the answer cache instead of
+	// the model.
+	Cached bool `json:"cached,omitempty"`
+	// Cache describes how the cached answer matched the query.
+	Cache *CacheHit `json:"cache,omitempty"`
+	// ConversationID identifies the conversation the search was added to, for follow-up
+	// questions. It is empty if the conversation could not be saved.
+	ConversationID string `json:"conversation_id,omitempty"`
+	// RewrittenQuery is the standalone query a follow-up question was retrieved with.
+	RewrittenQuery string `json:"rewritten_query,omitempty"`
+	// Provider is the AI provider that served the answer, or ProviderRetrieval.
+	Provider string `json:"provider"`
+	// Citations point to the passages behind the relevant articles.
+	Citations []Citation `json:"citations"`
+	// CitationWarnings lists the model's citations that were dropped or corrected
+	// because they did not match the articles it was given.
+	CitationWarnings []CitationWarning `json:"citation_warnings"`
+	// GroundingScore is how well the answer is supported by the passages it cites,
+	// from 0 to 1, and Grounding the support found for each of its sentences. They
+	// are omitted for retrieval-only responses.
+	GroundingScore *float64             `json:"grounding_score,omitempty"`
+	Grounding      []grounding.Sentence `json:"grounding,omitempty"`
+	// InjectionWarnings lists the query or articles flagged as prompt-injection attempts.
+	InjectionWarnings []InjectionWarning `json:"injection_warnings,omitempty"`
+	// Tokens counts the tokens of the AI answer. It is omitted for retrieval-only responses.
+	Tokens *TokenCounts `json:"tokens,omitempty"`
+	// Usage totals the tokens and estimated cost of every AI request the search made,
+	// including query rewriting and the grounding judge. It is omitted when there were none.
+	Usage *usage.Summary `json:"usage,omitempty"`
+	// Results are the retrieved articles or passages in rank order.
+	Results []SearchResult `json:"results"`
+	Debug   SearchDebug    `json:"debug"`
+}
+
+// SearchResult is one ranked article or passage with a highlighted snippet.
+type SearchResult struct {
+	ArticleID string  `json:"article_id"`
+	ChunkID   string  `json:"chunk_id"`
+	Title     string  `json:"title"`
+	Heading   string  `json:"heading,omitempty"`
+	Score     float64 `json:"score"`
+	// Snippet is an excerpt with matched terms wrapped in <mark> tags.
+	Snippet string `json:"snippet"`
+}
+
+// SearchDebug exposes retrieval internals for tuning relevance.
+type SearchDebug struct {
+	// Retrieval lists the articles (or passages, when chunking is enabled) sent to the
+	// model with their retrieval scores and, for hybrid retrieval, their rank in each stage.
+	Retrieval []retrieval.Hit `json:"retrieval"`
+	// Prompt reports which of them fitted into the prompt's token budget and the
+	// prompt's estimated size. It is omitted for retrieval-only responses.
+	Prompt *ai.PromptBudget `json:"prompt,omitempty"`
+}
+
+// TokenCounts are the tokens consumed by an AI answer, including any repair requests.
+type TokenCounts struct {
+	ai.Usage
+	// Estimated reports that the provider did not count them, so they were estimated.
+	Estimated bool `json:"estimated,omitempty"`
+}
+
+// SearchConfig holds the dependencies of SearchHandler and SearchStreamHandler.
+type SearchConfig struct {
+	DB        *sql.DB
+	Store     kb.Store
+	Retriever retrieval.Retriever
+	// TopK is how many retrieved articles or passages are passed to the AI.
+	TopK int
+	// Chunker must be the one the retriever's index was built with, so that chunk IDs
+	// resolve to the same passages. Nil means the index holds whole articles.
+	Chunker *kb.Chunker
+	// LLM generates the AI answer. Nil means Gemini with the key in GEMINI_API_KEY.
+	LLM ai.LLM
+	// RetrievalFallback makes ModeAnswer fall back to retrieval-only, the last step of
+	// the fallback chain, when every AI provider fails, as ModeAuto always does.
+	RetrievalFallback bool
+	// AnswerOptions tunes answer generation, such as how often malformed JSON output
+	// is sent back to the model for repair.
+	AnswerOptions ai.AnswerOptions
+	// Grounding checks AI answers against the passages they cite and withholds those
+	// it does not trust. Nil disables the check.
+	Grounding *grounding.Checker
+	// Injection scans queries and articles for prompt-injection attempts before they
+	// are sent to the model, and InjectionPolicy (injection.PolicyBlock, PolicyWarn or
+	// PolicyStrip) decides what happens to flagged text. Nil disables the scan.
+	Injection       *injection.Detector
+	InjectionPolicy string
+	// HistoryTokens is how much of a conversation, in estimated tokens, is sent with a
+	// follow-up question. RewriteQueries has the model rewrite follow-up questions into
+	// standalone queries for retrieval; otherwise they are prefixed with the previous
+	// question.
+	HistoryTokens  int
+	RewriteQueries bool
+	// Timeout bounds each search request. RetrievalTimeout and AITimeout bound its
+	// retrieval and answer-generation stages within that. Zero means no limit.
+	Timeout          time.Duration
+	RetrievalTimeout time.Duration
+	AITimeout        time.Duration
+	// Prices prices the tokens of each search's AI requests. Models missing from it
+	// cost nothing.
+	Prices usage.Prices
+	// Budget caps the daily cost of AI requests; searches past it are answered with
+	// retrieval only.
+	Budget usage.Limits
+	// Cache serves repeated questions about the same articles from earlier answers.
+	// Nil disables it.
+	Cache *cache.Cache
+	// CallerHeader is the request header labelling the caller in usage reports, by
+	// default DefaultCallerHeader. Requests without it are labelled with the client's
+	// address. The label is not trusted: Budget applies to client addresses.
+	CallerHeader string
+}
+
+// llm returns the configured LLM or the Gemini default, metered so that the usage of
+// each search can be recorded. An LLM that is already metered is used as it is, so
+// that a grounding judge sharing it is metered too.
+func (cfg SearchConfig) llm() ai.LLM {
+	llm := cfg.LLM
+	if llm == nil {
+		llm = ai.NewGemini(os.Getenv("GEMINI_API_KEY"), ai.DefaultGeminiModel)
+	}
+	if metered, ok := llm.(*ai.Metered); ok {
+		return metered
+	}
+	return ai.NewMetered(llm)
 }
 
 // SearchHandler is the main HTTP handler for the /api/search-query endpoint.
-func SearchHandler(db *sql.DB) http.HandlerFunc {
+// Only the TopK articles or passages ranked highest by the retriever are passed to the AI.
+// The request is cancelled if the client goes away, and a search that runs out of
+// time gets a 504 with an ErrorResponse. Each search is added to a conversation, which
+// a follow-up question continues by passing its ID; an unknown ID gets a 404.
+func SearchHandler(cfg SearchConfig) http.HandlerFunc {
+	db := cfg.DB
+	llm := cfg.llm()
 	return func(w http.ResponseWriter, r *http.Request) {
 		// 1. Decode the incoming JSON request body.
 		var req SearchRequest
@@ -24,42 +200,285 @@ func SearchHandler(db *sql.DB) http.HandlerFunc {
 			http.Error(w, "Invalid request body", http.StatusBadRequest)
 			return
 		}
-		if req.Query == "" {
-			http.Error(w, "Query cannot be empty", http.StatusBadRequest)
+		if err := validateSearchRequest(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		who := requesterOf(r, cfg.CallerHeader)
+		budgetWarning := applyBudget(cfg, &req, who)
+		promptQuery, injectionWarnings, err := screenQuery(cfg, req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		messages, err := loadConversation(db, req.ConversationID)
+		if err != nil {
+			writeConversationError(w, err)
 			return
 		}
+		opts := cfg.AnswerOptions
+		var historyWarnings []InjectionWarning
+		opts.History, historyWarnings = screenHistory(cfg, req, historyTurns(llm, messages, cfg.HistoryTokens))
+		injectionWarnings = append(injectionWarnings, historyWarnings...)
 
-		// 2. Get the simulated knowledge base articles.
-		articles := kb.GetArticles()
+		ctx, cancel := withBudget(r.Context(), cfg.Timeout)
+		defer cancel()
+		recorder := &ai.UsageRecorder{}
+		ctx = ai.WithUsageRecorder(ctx, recorder)
+		saved := false
+		defer keepUsage(cfg, who, recorder, &saved)
 
-		// 3. Call our (mocked) AI client to get a response.
-		aiResponse, err := ai.GetAIAnswer(req.Query, articles)
+		// 2. Retrieve the most relevant candidate articles or passages, for the
+		// standalone form of a follow-up question.
+		query := retrievalQuery(ctx, cfg, llm, req, promptQuery, messages, opts.History)
+		passages, msg, err := retrievePassages(ctx, cfg, query)
 		if err != nil {
-			http.Error(w, "Failed to get response from AI service", http.StatusInternalServerError)
+			writeStageError(ctx, w, r, cfg, StageRetrieval, err, msg)
 			return
 		}
 
-		// 4. Prepare the data to be saved to the database.
-		// We marshal the relevant articles slice into a JSON string for storage.
-		relevantArticlesJSON, _ := json.Marshal(aiResponse.RelevantArticles)
-
-		searchRecord := database.SearchHistory{
-			UserQuery:          req.Query,
-			AISummaryAnswer:    aiResponse.SummaryAnswer,
-			AIRelevantArticles: string(relevantArticlesJSON),
+		response := SearchResponse{
+			Mode:    req.Mode,
+			Warning: budgetWarning,
+			Results: searchResults(query, passages),
+			Debug:   SearchDebug{Retrieval: passageHits(passages)},
+		}
+		if query != req.Query {
+			response.RewrittenQuery = query
 		}
 
-		// 5. Save the interaction to the database.
-		_, err = database.SaveSearch(db, searchRecord)
-		if err != nil {
-			log.Printf("Failed to save search to database: %v", err)
-			// We don't return an error to the user here, as the primary function (getting an answer) succeeded.
-			// Logging the error is sufficient for now.
+		// 3. Call our AI client to get a response, then map the passages it cited back to articles.
+		// In retrieval-only mode, the retrieved articles are the answer.
+		// An earlier answer to the same question from the same articles is reused.
+		var aiResponse *ai.AIResponse
+		var articles []kb.Article
+		var cacheQuery *answerQuery
+		var cached *cachedAnswer
+		if req.Mode != ModeRetrieve {
+			var warnings []InjectionWarning
+			articles, warnings = screenArticles(cfg, promptArticles(passages))
+			response.InjectionWarnings = append(injectionWarnings, warnings...)
+			cacheQuery = answerCacheQuery(cfg, llm, promptQuery, articles, opts)
+			cached, response.Cache = lookupAnswer(ctx, cfg, cacheQuery)
+			response.Cached = cached != nil
+		}
+		if req.Mode != ModeRetrieve && !response.Cached {
+			aiCtx, cancelAI := withBudget(ctx, cfg.AITimeout)
+			aiResponse, err = ai.Answer(aiCtx, llm, promptQuery, articles, opts)
+			cancelAI()
+			// The search can fall back when the AI fails or runs over its own budget,
+			// but not once the whole search is out of time.
+			if err != nil && (!cfg.fallsBack(req.Mode) || ctx.Err() != nil) {
+				log.Printf("Failed to get AI answer: %v", err)
+				writeStageError(ctx, w, r, cfg, StageAI, err, "Failed to get response from AI service")
+				return
+			}
+			if err != nil {
+				log.Printf("Failed to get AI answer, falling back to retrieval-only: %v", err)
+				response.Warning = fallbackWarning
+			}
+		}
+		if response.Cached {
+			response.Mode, response.AIResponse, response.Citations, response.CitationWarnings = settleCached(passages, articles, cached)
+		} else {
+			response.Mode, response.AIResponse, response.Citations, response.CitationWarnings = settleAnswer(passages, articles, aiResponse)
 		}
+		response.Provider = answerProvider(response.AIResponse)
+		response.Debug.Prompt = response.AIResponse.Budget
+		var result *grounding.Result
+		var warning string
+		if response.Cached {
+			log.Printf("Answering %q from the answer cache (%s match)", req.Query, response.Cache.Match)
+			result = cached.Grounding
+		} else {
+			response.Tokens = tokenCounts(llm, response.AIResponse)
+			result, warning = groundAnswer(ctx, cfg, response.AIResponse, response.Citations)
+			storeAnswer(ctx, cfg, cacheQuery, response.AIResponse, response.Citations, result)
+		}
+		if result != nil {
+			response.GroundingScore, response.Grounding, response.Warning = &result.Score, result.Sentences, warning
+		}
+
+		// 4. Save the interaction to the database.
+		// We don't return an error to the user if this fails, as the primary function (getting an answer) succeeded.
+		response.Usage = usage.Summarize(cfg.Prices, recorder.Records())
+		saved = true
+		historyID := saveSearch(db, req.Query, who, response.AIResponse, response.CitationWarnings, response.Usage)
+		response.ConversationID = saveTurn(db, req, query, response.AIResponse, historyID)
 
-		// 6. Encode the AI response and send it back to the frontend.
+		// 5. Encode the AI response and send it back to the frontend.
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(aiResponse)
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// writeConversationError reports a conversation that could not be loaded.
+func writeConversationError(w http.ResponseWriter, err error) {
+	if errors.Is(err, database.ErrConversationNotFound) {
+		http.Error(w, "Conversation not found", http.StatusNotFound)
+		return
+	}
+	http.Error(w, "Failed to load conversation", http.StatusInternalServerError)
+}
+
+// fallsBack reports whether a search in mode falls back to retrieval-only when every
+// AI provider fails.
+func (cfg SearchConfig) fallsBack(mode string) bool {
+	return mode == ModeAuto || cfg.RetrievalFallback
+}
+
+// fallbackWarning tells the user that the search fell back to retrieval-only.
+const fallbackWarning = "The AI service is unavailable; showing the best matching articles instead."
+
+// validateSearchRequest checks the query and mode of req and defaults the mode to
+// ModeAnswer. The error is suitable for showing to the client.
+func validateSearchRequest(req *SearchRequest) error {
+	if strings.TrimSpace(req.Query) == "" {
+		return errors.New("Query cannot be empty")
+	}
+	switch req.Mode {
+	case "":
+		req.Mode = ModeAnswer
+	case ModeAnswer, ModeRetrieve, ModeAuto:
+	default:
+		return errors.New("Mode must be one of answer, retrieve or auto")
+	}
+	return nil
+}
+
+// retrievePassages retrieves the TopK passages for query within the retrieval budget
+// and resolves them to their articles. On failure it also returns a message suitable for showing to the client.
+func retrievePassages(ctx context.Context, cfg SearchConfig, query string) ([]passage, string, error) {
+	ctx, cancel := withBudget(ctx, cfg.RetrievalTimeout)
+	defer cancel()
+	hits, err := cfg.Retriever.Retrieve(ctx, query, cfg.TopK)
+	if err != nil {
+		log.Printf("Failed to retrieve articles: %v", err)
+		return nil, "Failed to search knowledge base", err
+	}
+	passages, err := resolvePassages(cfg.Store, cfg.Chunker, hits)
+	if err != nil {
+		log.Printf("Failed to load articles: %v", err)
+		return nil, "Failed to load knowledge base articles", err
+	}
+	return passages, "", nil
+}
+
+// settleAnswer maps the passages cited by the AI back to articles, verifying the
+// citations against the passages the model was shown: those among articles, the prompt
+// articles left after screening, that fitted in the prompt. It returns the mode that
+// produced the answer. A nil aiResponse means retrieval-only: the ranked articles are
+// the answer.
+func settleAnswer(passages []passage, articles []kb.Article, aiResponse *ai.AIResponse) (string, *ai.AIResponse, []Citation, []CitationWarning) {
+	if aiResponse == nil {
+		return ModeRetrieve, &ai.AIResponse{RelevantArticles: rankedArticles(passages)}, []Citation{}, []CitationWarning{}
+	}
+	var citations []Citation
+	var warnings []CitationWarning
+	shown := promptedPassages(passages, articles, aiResponse.Budget)
+	aiResponse.RelevantArticles, citations, warnings = cite(shown, aiResponse.RelevantArticles, aiResponse.SummaryAnswer)
+	if len(warnings) > 0 {
+		log.Printf("AI answer from %s has %d citation problems: %+v", answerProvider(aiResponse), len(warnings), warnings)
+	}
+	return ModeAnswer, aiResponse, citations, warnings
+}
+
+// answerProvider returns the provider that served aiResponse, or ProviderRetrieval if
+// no AI provider did.
+func answerProvider(aiResponse *ai.AIResponse) string {
+	if aiResponse.Completion == nil {
+		return ProviderRetrieval
+	}
+	return aiResponse.Completion.Provider
+}
+
+// tokenCounts returns the tokens consumed by aiResponse as counted by the provider, or
+// estimated from the prompt and answer if it did not count them. It returns nil if no
+// AI provider served the answer.
+func tokenCounts(llm ai.LLM, aiResponse *ai.AIResponse) *TokenCounts {
+	completion := aiResponse.Completion
+	if completion == nil {
+		return nil
+	}
+	if completion.Usage.TotalTokens > 0 {
+		return &TokenCounts{Usage: completion.Usage}
+	}
+	usage := ai.Usage{CompletionTokens: ai.EstimateTokens(llm, completion.Text)}
+	if aiResponse.Budget != nil {
+		usage.PromptTokens = aiResponse.Budget.EstimatedTokens
+	}
+	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	return &TokenCounts{Usage: usage, Estimated: true}
+}
+
+// saveSearch records a search and its AI usage in the history and returns its ID, or 0
+// if it could not be saved. Failures are only logged, and the usage is kept for budgets
+// even when the search is not.
+func saveSearch(db *sql.DB, query string, who requester, aiResponse *ai.AIResponse, warnings []CitationWarning, summary *usage.Summary) int64 {
+	// We marshal the relevant articles slice into a JSON string for storage.
+	relevantArticlesJSON, _ := json.Marshal(aiResponse.RelevantArticles)
+	warningsJSON, _ := json.Marshal(warnings)
+
+	search := database.SearchHistory{
+		UserQuery:          query,
+		AISummaryAnswer:    aiResponse.SummaryAnswer,
+		AIRelevantArticles: string(relevantArticlesJSON),
+		Provider:           answerProvider(aiResponse),
+		CitationWarnings:   string(warningsJSON),
+		PromptVersion:      aiResponse.PromptVersion,
+		Caller:             who.caller,
+	}
+	if summary != nil {
+		search.PromptTokens, search.CompletionTokens, search.CostUSD = summary.PromptTokens, summary.CompletionTokens, summary.CostUSD
+	}
+	id, err := database.SaveSearch(db, search)
+	if err != nil {
+		log.Printf("Failed to save search to database: %v", err)
+	}
+	saveUsage(db, id, who, summary)
+	return id
+}
+
+// searchResults builds the ranked results of a search. Retrievers that produce their
+// own highlighted snippet (FTS) keep it; for the others the passage is highlighted here.
+func searchResults(query string, passages []passage) []SearchResult {
+	results := make([]SearchResult, len(passages))
+	for i, p := range passages {
+		snippet := p.hit.Snippet
+		if snippet == "" {
+			snippet = retrieval.Highlight(p.chunk.Text, query, snippetWords)
+		}
+		results[i] = SearchResult{
+			ArticleID: p.article.ID,
+			ChunkID:   p.chunk.ID,
+			Title:     p.article.Title,
+			Heading:   p.chunk.Heading,
+			Score:     p.hit.Score,
+			Snippet:   snippet,
+		}
+	}
+	return results
+}
+
+// rankedArticles returns the distinct articles behind the passages, in rank order.
+func rankedArticles(passages []passage) []kb.Article {
+	articles := []kb.Article{}
+	seen := make(map[string]bool)
+	for _, p := range passages {
+		if !seen[p.article.ID] {
+			seen[p.article.ID] = true
+			articles = append(articles, kb.Article{ID: p.article.ID, Title: p.article.Title})
+		}
+	}
+	return articles
+}
+
+// passageHits returns the retrieval hits behind the passages sent to the model.
+func passageHits(passages []passage) []retrieval.Hit {
+	hits := make([]retrieval.Hit, len(passages))
+	for i, p := range passages {
+		hits[i] = p.hit
 	}
+	return hits
 }
@@ -1,12 +1,21 @@
 package handlers
 
 import (
+	"ai-knowledge-base/internal/ai"
 	"ai-knowledge-base/internal/database"
+	"ai-knowledge-base/internal/grounding"
+	"ai-knowledge-base/internal/injection"
+	"ai-knowledge-base/internal/kb"
+	"ai-knowledge-base/internal/retrieval"
 	"bytes"
+	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
 )
 
@@ -33,12 +42,61 @@ func teardown() {
 	os.Remove(testDBFile)
 }
 
+// newSearchConfig configures a search over the default articles, indexed with BM25 and
+// answered by the offline fake provider.
+func newSearchConfig(db *sql.DB) SearchConfig {
+	articles := kb.GetArticles()
+	index := retrieval.NewBM25Index()
+	retrieval.NewArticleSync(index, retrieval.WholeArticle).Load(context.Background(), articles)
+	return SearchConfig{
+		DB:        db,
+		Store:     kb.NewMemoryStore(articles...),
+		Retriever: index,
+		TopK:      5,
+		LLM:       ai.NewFake(),
+		Grounding: grounding.NewChecker(),
+
+		Injection:       injection.NewDetector(),
+		InjectionPolicy: injection.PolicyWarn,
+		HistoryTokens:   500,
+		RewriteQueries:  true,
+	}
+}
+
+// newSearchHandler builds a SearchHandler over the default articles, indexed with BM25.
+func newSearchHandler(db *sql.DB) http.HandlerFunc {
+	return SearchHandler(newSearchConfig(db))
+}
+
+// postSearch sends a search request to handler and returns the recorded response.
+func postSearch(handler http.Handler, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("POST", "/api/search-query", bytes.NewReader([]byte(body)))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	return rr
+}
+
+// failingLLM stands in for an unreachable AI provider and counts the calls made to it.
+type failingLLM struct {
+	calls int
+}
+
+func (f *failingLLM) Name() string {
+	return "failing"
+}
+
+func (f *failingLLM) Generate(ctx context.Context, req ai.Request) (*ai.Completion, error) {
+	f.calls++
+	return nil, errors.New("Gemini API key not set")
+}
+
 func TestSearchHandler(t *testing.T) {
 	db := database.InitDB(testDBFile)
 	defer db.Close()
 
 	// Create our handler, passing in the test database.
-	handler := SearchHandler(db)
+	handler := newSearchHandler(db)
 
 	// Create the request body (the JSON we want to send).
 	requestBody := SearchRequest{
@@ -66,8 +124,8 @@ func TestSearchHandler(t *testing.T) {
 	}
 
 	// Check the response body.
-	// We expect the mocked response from our `ai_client`.
-	expectedSummary := "To reset your password, please navigate to the login page and click the 'Forgot Password' link. This is a mocked response."
+	// We expect the fake provider's extractive answer from the top-ranked article.
+	expectedSummary := "To reset your password, go to the login page and click on the 'Forgot Password' link. [kb-001]"
 
 	var responseBody map[string]interface{}
 	if err := json.NewDecoder(rr.Body).Decode(&responseBody); err != nil {
@@ -94,7 +152,7 @@ func TestSearchHandler_EmptyQuery(t *testing.T) {
 	db := database.InitDB(testDBFile)
 	defer db.Close()
 
-	handler := SearchHandler(db)
+	handler := newSearchHandler(db)
 
 	requestBody := SearchRequest{Query: " "}
 	bodyBytes, _ := json.Marshal(requestBody)
@@ -116,7 +174,7 @@ func TestSearchHandler_InvalidJSON(t *testing.T) {
 	db := database.InitDB(testDBFile)
 	defer db.Close()
 
-	handler := SearchHandler(db)
+	handler := newSearchHandler(db)
 
 	invalidJSON := []byte(`{"query": "test"`)
 
@@ -131,3 +189,274 @@ func TestSearchHandler_InvalidJSON(t *testing.T) {
 		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusBadRequest)
 	}
 }
+
+// TestSearchHandler_RetrieveMode tests that retrieval-only mode returns highlighted
+// results without calling the AI.
+func TestSearchHandler_RetrieveMode(t *testing.T) {
+	db := database.InitDB(testDBFile)
+	defer db.Close()
+
+	llm := &failingLLM{}
+	cfg := newSearchConfig(db)
+	cfg.LLM = llm
+
+	rr := postSearch(SearchHandler(cfg), `{"query":"how to reset password?","mode":"retrieve"}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	var resp SearchResponse
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("could not decode response body: %v", err)
+	}
+	if resp.Mode != ModeRetrieve || resp.SummaryAnswer != "" || resp.Warning != "" || resp.Provider != ProviderRetrieval {
+		t.Errorf("unexpected retrieval-only response: %+v", resp)
+	}
+	if len(resp.Results) == 0 || resp.Results[0].ArticleID != "kb-001" {
+		t.Fatalf("expected kb-001 ranked first, got %+v", resp.Results)
+	}
+	if !strings.Contains(resp.Results[0].Snippet, "<mark>password</mark>") {
+		t.Errorf("expected a highlighted snippet, got %q", resp.Results[0].Snippet)
+	}
+	if len(resp.RelevantArticles) == 0 || resp.RelevantArticles[0].ID != "kb-001" {
+		t.Errorf("expected ranked articles as relevant articles, got %+v", resp.RelevantArticles)
+	}
+	if llm.calls != 0 {
+		t.Errorf("AI must not be called in retrieve mode, got %d calls", llm.calls)
+	}
+}
+
+// TestSearchHandler_AutoModeFallsBack tests that auto mode degrades to retrieval-only
+// when the AI fails, while answer mode reports the failure.
+func TestSearchHandler_AutoModeFallsBack(t *testing.T) {
+	db := database.InitDB(testDBFile)
+	defer db.Close()
+
+	cfg := newSearchConfig(db)
+	cfg.LLM = &failingLLM{}
+	handler := SearchHandler(cfg)
+
+	rr := postSearch(handler, `{"query":"vpn","mode":"auto"}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	var resp SearchResponse
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("could not decode response body: %v", err)
+	}
+	if resp.Mode != ModeRetrieve || resp.Warning == "" || len(resp.Results) == 0 {
+		t.Errorf("expected a retrieval-only fallback with a warning, got %+v", resp)
+	}
+
+	if rr := postSearch(handler, `{"query":"vpn","mode":"answer"}`); rr.Code != http.StatusInternalServerError {
+		t.Errorf("answer mode: got %v want %v", rr.Code, http.StatusInternalServerError)
+	}
+}
+
+// TestSearchHandler_InvalidMode tests that unknown modes are rejected.
+func TestSearchHandler_InvalidMode(t *testing.T) {
+	db := database.InitDB(testDBFile)
+	defer db.Close()
+
+	if rr := postSearch(newSearchHandler(db), `{"query":"vpn","mode":"guess"}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+}
+
+// TestSearchHandler_FallbackProvider tests that the provider that actually served the
+// answer is reported and saved, with the prompt version, when the primary provider fails.
+func TestSearchHandler_FallbackProvider(t *testing.T) {
+	db := database.InitDB(testDBFile)
+	defer db.Close()
+
+	cfg := newSearchConfig(db)
+	cfg.LLM = ai.NewFallback(&failingLLM{}, ai.NewFake())
+
+	const query = "fallback provider vpn"
+	rr := postSearch(SearchHandler(cfg), `{"query":"`+query+`"}`)
+	var resp SearchResponse
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("could not decode response body: %v", err)
+	}
+	if rr.Code != http.StatusOK || resp.Mode != ModeAnswer || resp.Provider != "fake" {
+		t.Errorf("expected the fake provider to answer, got %d %+v", rr.Code, resp)
+	}
+
+	var provider, promptVersion string
+	if err := db.QueryRow("SELECT provider, prompt_version FROM search_history WHERE user_query = ?", query).Scan(&provider, &promptVersion); err != nil || provider != "fake" || promptVersion != ai.DefaultPromptVersion {
+		t.Errorf("expected the provider and prompt version saved in search_history, got %q, %q, %v", provider, promptVersion, err)
+	}
+}
+
+// replyLLM always replies with text.
+type replyLLM struct {
+	text string
+}
+
+func (l replyLLM) Name() string {
+	return "reply"
+}
+
+func (l replyLLM) Generate(ctx context.Context, req ai.Request) (*ai.Completion, error) {
+	return &ai.Completion{Text: l.text}, nil
+}
+
+// TestSearchHandler_CitationWarnings tests that citations of articles the model was
+// not given are dropped, and reported in the response and the saved search.
+func TestSearchHandler_CitationWarnings(t *testing.T) {
+	db := database.InitDB(testDBFile)
+	defer db.Close()
+
+	cfg := newSearchConfig(db)
+	cfg.LLM = replyLLM{`{"ai_summary_answer": "Use the reset link [kb-001] [kb-999].",
+		"ai_relevant_articles": [{"id": "kb-001", "title": "Password reset"}, {"id": "kb-999", "title": "Made up"}]}`}
+
+	const query = "citation warnings password reset"
+	rr := postSearch(SearchHandler(cfg), `{"query":"`+query+`"}`)
+	var resp SearchResponse
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("could not decode response body: %v", err)
+	}
+	if len(resp.RelevantArticles) != 1 || resp.RelevantArticles[0].ID != "kb-001" || resp.RelevantArticles[0].Title != "How to reset your password" {
+		t.Errorf("expected only kb-001 with its canonical title, got %+v", resp.RelevantArticles)
+	}
+	if len(resp.CitationWarnings) != 2 || resp.CitationWarnings[0].Problem != CitationMislabeled || resp.CitationWarnings[1].ID != "kb-999" {
+		t.Errorf("unexpected citation warnings %+v", resp.CitationWarnings)
+	}
+
+	var saved string
+	db.QueryRow("SELECT citation_warnings FROM search_history WHERE user_query = ?", query).Scan(&saved)
+	if !strings.Contains(saved, `"id":"kb-999","problem":"unknown_id"`) {
+		t.Errorf("expected the warnings saved in search_history, got %q", saved)
+	}
+}
+
+// TestSearchHandler_Grounding tests that an answer with steps found in none of the
+// cited articles is withheld, and that a grounded one is kept with its score.
+func TestSearchHandler_Grounding(t *testing.T) {
+	db := database.InitDB(testDBFile)
+	defer db.Close()
+
+	cfg := newSearchConfig(db)
+	cfg.LLM = replyLLM{`{"ai_summary_answer": "Reinstall the operating system and then call the vendor hotline [kb-001].",
+		"ai_relevant_articles": [{"id": "kb-001"}]}`}
+
+	const query = "grounding password reset"
+	var resp SearchResponse
+	json.NewDecoder(postSearch(SearchHandler(cfg), `{"query":"`+query+`"}`).Body).Decode(&resp)
+	if resp.SummaryAnswer != lowConfidenceAnswer || resp.Warning != groundingWarning || resp.GroundingScore == nil || *resp.GroundingScore >= 0.5 {
+		t.Errorf("expected the ungrounded answer to be withheld, got %+v", resp)
+	}
+	if len(resp.Grounding) != 1 || resp.Grounding[0].Supported || len(resp.RelevantArticles) != 1 {
+		t.Errorf("expected the unsupported sentence and the relevant article to be reported, got %+v", resp)
+	}
+	var saved string
+	db.QueryRow("SELECT ai_summary_answer FROM search_history WHERE user_query = ?", query).Scan(&saved)
+	if saved != lowConfidenceAnswer {
+		t.Errorf("expected the withheld answer not to be saved, got %q", saved)
+	}
+
+	resp = SearchResponse{}
+	json.NewDecoder(postSearch(newSearchHandler(db), `{"query":"how to reset password?"}`).Body).Decode(&resp)
+	if resp.GroundingScore == nil || *resp.GroundingScore != 1 || resp.Warning != "" || len(resp.Grounding) != 1 || !resp.Grounding[0].Supported {
+		t.Errorf("expected the extractive answer to be fully grounded, got %+v", resp)
+	}
+
+	resp = SearchResponse{}
+	json.NewDecoder(postSearch(newSearchHandler(db), `{"query":"vpn","mode":"retrieve"}`).Body).Decode(&resp)
+	if resp.GroundingScore != nil {
+		t.Errorf("expected no grounding score for retrieval-only results, got %v", *resp.GroundingScore)
+	}
+}
+
+// TestSearchHandler_Tokens tests that token counts and the prompt budget are reported,
+// and estimated when the provider does not count tokens.
+func TestSearchHandler_Tokens(t *testing.T) {
+	db := database.InitDB(testDBFile)
+	defer db.Close()
+
+	cfg := newSearchConfig(db)
+	cfg.AnswerOptions.MaxPromptTokens = 320
+	var resp SearchResponse
+	json.NewDecoder(postSearch(SearchHandler(cfg), `{"query":"reset password vpn email printer"}`).Body).Decode(&resp)
+	if resp.Tokens == nil || resp.Tokens.Estimated || resp.Tokens.PromptTokens == 0 || resp.Tokens.TotalTokens != resp.Tokens.PromptTokens+resp.Tokens.CompletionTokens {
+		t.Errorf("expected the provider's token counts, got %+v", resp.Tokens)
+	}
+	prompt := resp.Debug.Prompt
+	if prompt == nil || prompt.MaxTokens != 320 || prompt.EstimatedTokens > 320 || len(prompt.Dropped) == 0 || len(prompt.Articles)+len(prompt.Dropped) != len(resp.Debug.Retrieval) {
+		t.Errorf("expected the budget to leave out lower-ranked articles, got %+v", prompt)
+	}
+
+	cfg.LLM = replyLLM{`{"ai_summary_answer": "Use the reset link [kb-001].", "ai_relevant_articles": [{"id": "kb-001"}]}`}
+	cfg.AnswerOptions.MaxPromptTokens = 0
+	json.NewDecoder(postSearch(SearchHandler(cfg), `{"query":"password reset"}`).Body).Decode(&resp)
+	if resp.Tokens == nil || !resp.Tokens.Estimated || resp.Tokens.PromptTokens != resp.Debug.Prompt.EstimatedTokens || resp.Tokens.CompletionTokens == 0 {
+		t.Errorf("expected estimated token counts, got %+v", resp.Tokens)
+	}
+
+	var retrieved SearchResponse
+	json.NewDecoder(postSearch(SearchHandler(cfg), `{"query":"password reset","mode":"retrieve"}`).Body).Decode(&retrieved)
+	if retrieved.Tokens != nil || retrieved.Debug.Prompt != nil {
+		t.Errorf("expected no token counts for retrieval-only searches, got %+v", retrieved)
+	}
+}
+
+// TestSearchHandler_FallbackChainExhausted tests that answer mode ends the fallback
+// chain with the retrieval-only answer when every provider fails.
+func TestSearchHandler_FallbackChainExhausted(t *testing.T) {
+	db := database.InitDB(testDBFile)
+	defer db.Close()
+
+	primary, secondary := &failingLLM{}, &failingLLM{}
+	cfg := newSearchConfig(db)
+	cfg.LLM = ai.NewFallback(primary, secondary)
+	cfg.RetrievalFallback = true
+
+	rr := postSearch(SearchHandler(cfg), `{"query":"vpn","mode":"answer"}`)
+	var resp SearchResponse
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("could not decode response body: %v", err)
+	}
+	if rr.Code != http.StatusOK || resp.Mode != ModeRetrieve || resp.Provider != ProviderRetrieval || resp.Warning != fallbackWarning || len(resp.Results) == 0 {
+		t.Errorf("expected a retrieval-only answer with a warning, got %d %+v", rr.Code, resp)
+	}
+	if primary.calls == 0 || secondary.calls == 0 {
+		t.Errorf("expected every provider to be tried, got %d and %d calls", primary.calls, secondary.calls)
+	}
+
+	events := parseEvents(t, postSearch(SearchStreamHandler(cfg), `{"query":"vpn","mode":"answer"}`).Body.String())
+	var done StreamDone
+	decodeEvent(t, events, EventDone, &done)
+	if done.Mode != ModeRetrieve || done.Provider != ProviderRetrieval || done.Warning != fallbackWarning {
+		t.Errorf("expected a retrieval-only stream with a warning, got %+v", done)
+	}
+}
+
+// TestSearchHandler_CitesOnlyPromptedPassages tests that citations of passages the
+// prompt budget left out are rejected, since the model never saw them.
+func TestSearchHandler_CitesOnlyPromptedPassages(t *testing.T) {
+	db := database.InitDB(testDBFile)
+	defer db.Close()
+
+	cfg := newSearchConfig(db)
+	cfg.AnswerOptions.MaxPromptTokens = 450
+	cfg.LLM = replyLLM{`{"ai_summary_answer": "No answer.", "ai_relevant_articles": []}`}
+	const query = `{"query":"reset password vpn email printer"}`
+	var resp SearchResponse
+	json.NewDecoder(postSearch(SearchHandler(cfg), query).Body).Decode(&resp)
+	if resp.Debug.Prompt == nil || len(resp.Debug.Prompt.Articles) == 0 || len(resp.Debug.Prompt.Dropped) == 0 {
+		t.Fatalf("expected the budget to leave out an article, got %+v", resp.Debug.Prompt)
+	}
+	kept, dropped := resp.Debug.Prompt.Articles[0], resp.Debug.Prompt.Dropped[0]
+
+	cfg.LLM = replyLLM{`{"ai_summary_answer": "See [` + kept + `] and [` + dropped + `].",
+		"ai_relevant_articles": [{"id": "` + kept + `"}, {"id": "` + dropped + `"}]}`}
+	resp = SearchResponse{}
+	json.NewDecoder(postSearch(SearchHandler(cfg), query).Body).Decode(&resp)
+	if len(resp.Citations) != 1 || resp.Citations[0].ChunkID != kept || len(resp.RelevantArticles) != 1 {
+		t.Errorf("expected only %s cited, got %+v", kept, resp.Citations)
+	}
+	if len(resp.CitationWarnings) != 1 || resp.CitationWarnings[0].ID != dropped || resp.CitationWarnings[0].Problem != CitationUnknown {
+		t.Errorf("expected the citation of %s rejected, got %+v", dropped, resp.CitationWarnings)
+	}
+}
@@ -0,0 +1,238 @@
+package handlers
+
+import (
+	"ai-knowledge-base/internal/ai"
+	"ai-knowledge-base/internal/grounding"
+	"ai-knowledge-base/internal/kb"
+	"ai-knowledge-base/internal/usage"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// Server-sent events emitted by SearchStreamHandler, in order.
+const (
+	// EventRetrieval carries a StreamRetrieval as soon as retrieval finishes.
+	EventRetrieval = "retrieval"
+	// EventToken carries a StreamToken for each piece of the answer as it is generated.
+	EventToken = "token"
+	// EventDone carries a StreamDone and ends a successful stream.
+	EventDone = "done"
+	// EventError carries an ErrorResponse and ends a failed stream.
+	EventError = "error"
+)
+
+// StreamRetrieval is the data of an EventRetrieval event.
+type StreamRetrieval struct {
+	Results []SearchResult `json:"results"`
+	Debug   SearchDebug    `json:"debug"`
+}
+
+// StreamToken is the data of an EventToken event.
+type StreamToken struct {
+	Text string `json:"text"`
+}
+
+// StreamDone is the data of an EventDone event: the full answer, as SearchHandler
+// would return it, and the ID of the saved search history record.
+type StreamDone struct {
+	*ai.AIResponse
+	Mode             string            `json:"mode"`
+	Warning          string            `json:"warning,omitempty"`
+	Cached           bool              `json:"cached,omitempty"`
+	Cache            *CacheHit         `json:"cache,omitempty"`
+	ConversationID   string            `json:"conversation_id,omitempty"`
+	RewrittenQuery   string            `json:"rewritten_query,omitempty"`
+	Provider         string            `json:"provider"`
+	Citations        []Citation        `json:"citations"`
+	CitationWarnings []CitationWarning `json:"citation_warnings"`
+	// GroundingScore and Grounding are as in SearchResponse. When the answer is
+	// withheld, the answer here replaces the streamed text.
+	GroundingScore *float64             `json:"grounding_score,omitempty"`
+	Grounding      []grounding.Sentence `json:"grounding,omitempty"`
+	// InjectionWarnings, Tokens and Usage are as in SearchResponse, and Prompt as in SearchDebug.
+	InjectionWarnings []InjectionWarning `json:"injection_warnings,omitempty"`
+	Tokens            *TokenCounts       `json:"tokens,omitempty"`
+	Usage             *usage.Summary     `json:"usage,omitempty"`
+	Prompt            *ai.PromptBudget   `json:"prompt,omitempty"`
+	// HistoryID is the ID of the search_history record, or 0 if saving failed.
+	HistoryID int64 `json:"history_id"`
+}
+
+// SearchStreamHandler is the HTTP handler for the /api/search-query/stream endpoint.
+// It accepts the same request as SearchHandler, either as a JSON POST body or as the
+// query, mode and conversation_id parameters of a GET (for EventSource clients), and
+// answers with server-sent events: the retrieved articles first, then the answer as
+// it is generated, then the citations. If the client disconnects, generation is
+// cancelled and nothing is saved. The search deadlines of SearchHandler apply; a timeout after
+// the stream has started is reported in the EventError event.
+func SearchStreamHandler(cfg SearchConfig) http.HandlerFunc {
+	db := cfg.DB
+	llm := cfg.llm()
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req SearchRequest
+		switch r.Method {
+		case http.MethodGet:
+			params := r.URL.Query()
+			req = SearchRequest{Query: params.Get("query"), Mode: params.Get("mode"), ConversationID: params.Get("conversation_id")}
+		case http.MethodPost:
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "Invalid request body", http.StatusBadRequest)
+				return
+			}
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := validateSearchRequest(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		who := requesterOf(r, cfg.CallerHeader)
+		budgetWarning := applyBudget(cfg, &req, who)
+		promptQuery, injectionWarnings, err := screenQuery(cfg, req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		messages, err := loadConversation(db, req.ConversationID)
+		if err != nil {
+			writeConversationError(w, err)
+			return
+		}
+		opts := cfg.AnswerOptions
+		var historyWarnings []InjectionWarning
+		opts.History, historyWarnings = screenHistory(cfg, req, historyTurns(llm, messages, cfg.HistoryTokens))
+		injectionWarnings = append(injectionWarnings, historyWarnings...)
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
+			return
+		}
+
+		ctx, cancel := withBudget(r.Context(), cfg.Timeout)
+		defer cancel()
+		recorder := &ai.UsageRecorder{}
+		ctx = ai.WithUsageRecorder(ctx, recorder)
+		saved := false
+		defer keepUsage(cfg, who, recorder, &saved)
+
+		// Failures before the first event can still be reported with a status code.
+		query := retrievalQuery(ctx, cfg, llm, req, promptQuery, messages, opts.History)
+		passages, msg, err := retrievePassages(ctx, cfg, query)
+		if err != nil {
+			writeStageError(ctx, w, r, cfg, StageRetrieval, err, msg)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.WriteHeader(http.StatusOK)
+		events := &eventWriter{w: w, flusher: flusher}
+
+		if err := events.send(EventRetrieval, StreamRetrieval{
+			Results: searchResults(query, passages),
+			Debug:   SearchDebug{Retrieval: passageHits(passages)},
+		}); err != nil {
+			return
+		}
+
+		// A write error means the client is gone; returning it from onText stops generation.
+		done := StreamDone{Warning: budgetWarning}
+		if query != req.Query {
+			done.RewrittenQuery = query
+		}
+		// A cached answer is sent as a single token.
+		var aiResponse *ai.AIResponse
+		var articles []kb.Article
+		var cacheQuery *answerQuery
+		var cached *cachedAnswer
+		if req.Mode != ModeRetrieve {
+			var warnings []InjectionWarning
+			articles, warnings = screenArticles(cfg, promptArticles(passages))
+			done.InjectionWarnings = append(injectionWarnings, warnings...)
+			cacheQuery = answerCacheQuery(cfg, llm, promptQuery, articles, opts)
+			cached, done.Cache = lookupAnswer(ctx, cfg, cacheQuery)
+			done.Cached = cached != nil
+			if done.Cached && events.send(EventToken, StreamToken{Text: cached.SummaryAnswer}) != nil {
+				return
+			}
+		}
+		if req.Mode != ModeRetrieve && !done.Cached {
+			streamed := false
+			aiCtx, cancelAI := withBudget(ctx, cfg.AITimeout)
+			aiResponse, err = ai.AnswerStream(aiCtx, llm, promptQuery, articles, opts, func(text string) error {
+				streamed = true
+				return events.send(EventToken, StreamToken{Text: text})
+			})
+			cancelAI()
+			if r.Context().Err() != nil || events.err != nil {
+				log.Printf("Client disconnected during search stream for %q", req.Query)
+				return
+			}
+			// Tokens already sent cannot be taken back, so only a failure before the
+			// first token, and with time left, can fall back to retrieval-only.
+			if err != nil && (!cfg.fallsBack(req.Mode) || streamed || ctx.Err() != nil) {
+				log.Printf("Failed to stream AI answer: %v", err)
+				resp, _ := stageError(ctx, cfg, StageAI, err, "Failed to get response from AI service")
+				events.send(EventError, resp)
+				return
+			}
+			if err != nil {
+				log.Printf("Failed to stream AI answer, falling back to retrieval-only: %v", err)
+				done.Warning = fallbackWarning
+			}
+		}
+		if done.Cached {
+			done.Mode, done.AIResponse, done.Citations, done.CitationWarnings = settleCached(passages, articles, cached)
+		} else {
+			done.Mode, done.AIResponse, done.Citations, done.CitationWarnings = settleAnswer(passages, articles, aiResponse)
+		}
+		done.Provider = answerProvider(done.AIResponse)
+		done.Prompt = done.AIResponse.Budget
+		var result *grounding.Result
+		var warning string
+		if done.Cached {
+			result = cached.Grounding
+		} else {
+			done.Tokens = tokenCounts(llm, done.AIResponse)
+			result, warning = groundAnswer(ctx, cfg, done.AIResponse, done.Citations)
+			storeAnswer(ctx, cfg, cacheQuery, done.AIResponse, done.Citations, result)
+		}
+		if result != nil {
+			done.GroundingScore, done.Grounding, done.Warning = &result.Score, result.Sentences, warning
+		}
+		done.Usage = usage.Summarize(cfg.Prices, recorder.Records())
+		saved = true
+		done.HistoryID = saveSearch(db, req.Query, who, done.AIResponse, done.CitationWarnings, done.Usage)
+		done.ConversationID = saveTurn(db, req, query, done.AIResponse, done.HistoryID)
+		events.send(EventDone, done)
+	}
+}
+
+// eventWriter writes server-sent events, flushing each one. After a failed write it
+// keeps returning the same error.
+type eventWriter struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+	err     error
+}
+
+// send writes an event whose data is v encoded as JSON.
+func (e *eventWriter) send(event string, v interface{}) error {
+	if e.err != nil {
+		return e.err
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if _, e.err = fmt.Fprintf(e.w, "event: %s\ndata: %s\n\n", event, data); e.err != nil {
+		return e.err
+	}
+	e.flusher.Flush()
+	return nil
+}
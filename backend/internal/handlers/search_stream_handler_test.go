@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"ai-knowledge-base/internal/database"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// sseEvent is one parsed server-sent event.
+type sseEvent struct {
+	name string
+	data string
+}
+
+// parseEvents splits a server-sent event stream into events.
+func parseEvents(t *testing.T, body string) []sseEvent {
+	t.Helper()
+	var events []sseEvent
+	var current sseEvent
+	scanner := bufio.NewScanner(strings.NewReader(body))
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if current.name != "" {
+				events = append(events, current)
+			}
+			current = sseEvent{}
+		case strings.HasPrefix(line, "event: "):
+			current.name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			current.data = strings.TrimPrefix(line, "data: ")
+		default:
+			t.Fatalf("unexpected line in event stream: %q", line)
+		}
+	}
+	return events
+}
+
+// eventNames returns the names of events, collapsing runs of token events into one.
+func eventNames(events []sseEvent) string {
+	var names []string
+	for _, e := range events {
+		if e.name == EventToken && len(names) > 0 && names[len(names)-1] == EventToken {
+			continue
+		}
+		names = append(names, e.name)
+	}
+	return strings.Join(names, ",")
+}
+
+// decodeEvent decodes the data of the last event named name into v.
+func decodeEvent(t *testing.T, events []sseEvent, name string, v interface{}) {
+	t.Helper()
+	for i := len(events) - 1; i >= 0; i-- {
+		if events[i].name == name {
+			if err := json.Unmarshal([]byte(events[i].data), v); err != nil {
+				t.Fatalf("could not decode %s event: %v", name, err)
+			}
+			return
+		}
+	}
+	t.Fatalf("no %s event in stream", name)
+}
+
+func TestSearchStreamHandler(t *testing.T) {
+	db := database.InitDB(testDBFile)
+	defer db.Close()
+
+	req, _ := http.NewRequest("POST", "/api/search-query/stream", strings.NewReader(`{"query":"how to reset password?"}`))
+	rr := httptest.NewRecorder()
+	SearchStreamHandler(newSearchConfig(db)).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("unexpected Content-Type %q", ct)
+	}
+
+	events := parseEvents(t, rr.Body.String())
+	if names := eventNames(events); names != "retrieval,token,done" {
+		t.Fatalf("unexpected event order %q", names)
+	}
+
+	var retrieved StreamRetrieval
+	decodeEvent(t, events, EventRetrieval, &retrieved)
+	if len(retrieved.Results) == 0 || retrieved.Results[0].ArticleID != "kb-001" {
+		t.Errorf("expected kb-001 retrieved first, got %+v", retrieved.Results)
+	}
+
+	var streamed strings.Builder
+	for _, e := range events {
+		if e.name == EventToken {
+			var token StreamToken
+			json.Unmarshal([]byte(e.data), &token)
+			streamed.WriteString(token.Text)
+		}
+	}
+
+	var done StreamDone
+	decodeEvent(t, events, EventDone, &done)
+	want := "To reset your password, go to the login page and click on the 'Forgot Password' link. [kb-001]"
+	if done.SummaryAnswer != want || streamed.String() != want {
+		t.Errorf("got answer %q streamed as %q, want %q", done.SummaryAnswer, streamed.String(), want)
+	}
+	if done.Mode != ModeAnswer || done.Provider != "fake" || len(done.Citations) != 1 || done.Citations[0].ArticleID != "kb-001" {
+		t.Errorf("unexpected final event %+v", done)
+	}
+	if done.Usage == nil || done.Usage.Models[0].Model != "fake" || done.Usage.CompletionTokens == 0 {
+		t.Errorf("expected the usage of the streamed answer, got %+v", done.Usage)
+	}
+
+	var query string
+	if err := db.QueryRow("SELECT user_query FROM search_history WHERE id = ?", done.HistoryID).Scan(&query); err != nil || query != "how to reset password?" {
+		t.Errorf("history_id %d does not point at the saved search: %q, %v", done.HistoryID, query, err)
+	}
+}
+
+// TestSearchStreamHandler_RetrieveModeGET tests the EventSource-friendly GET form in
+// retrieval-only mode, which emits no tokens.
+func TestSearchStreamHandler_RetrieveModeGET(t *testing.T) {
+	db := database.InitDB(testDBFile)
+	defer db.Close()
+
+	llm := &failingLLM{}
+	cfg := newSearchConfig(db)
+	cfg.LLM = llm
+
+	req, _ := http.NewRequest("GET", "/api/search-query/stream?query=vpn&mode=retrieve", nil)
+	rr := httptest.NewRecorder()
+	SearchStreamHandler(cfg).ServeHTTP(rr, req)
+
+	events := parseEvents(t, rr.Body.String())
+	if names := eventNames(events); names != "retrieval,done" {
+		t.Fatalf("unexpected event order %q", names)
+	}
+	var done StreamDone
+	decodeEvent(t, events, EventDone, &done)
+	if done.Mode != ModeRetrieve || len(done.RelevantArticles) == 0 || done.HistoryID == 0 {
+		t.Errorf("unexpected final event %+v", done)
+	}
+	if llm.calls != 0 {
+		t.Errorf("AI must not be called in retrieve mode, got %d calls", llm.calls)
+	}
+}
+
+// TestSearchStreamHandler_AIFailure tests that auto mode falls back to retrieval-only
+// while answer mode ends the stream with an error event.
+func TestSearchStreamHandler_AIFailure(t *testing.T) {
+	db := database.InitDB(testDBFile)
+	defer db.Close()
+
+	cfg := newSearchConfig(db)
+	cfg.LLM = &failingLLM{}
+	handler := SearchStreamHandler(cfg)
+
+	rr := postSearch(handler, `{"query":"vpn","mode":"auto"}`)
+	events := parseEvents(t, rr.Body.String())
+	var done StreamDone
+	decodeEvent(t, events, EventDone, &done)
+	if done.Mode != ModeRetrieve || done.Warning == "" {
+		t.Errorf("expected a retrieval-only fallback with a warning, got %+v", done)
+	}
+
+	rr = postSearch(handler, `{"query":"vpn","mode":"answer"}`)
+	events = parseEvents(t, rr.Body.String())
+	if names := eventNames(events); names != "retrieval,error" {
+		t.Errorf("unexpected event order %q", names)
+	}
+}
+
+// TestSearchStreamHandler_BadRequest tests that invalid requests are rejected before
+// the stream starts.
+func TestSearchStreamHandler_BadRequest(t *testing.T) {
+	db := database.InitDB(testDBFile)
+	defer db.Close()
+
+	handler := SearchStreamHandler(newSearchConfig(db))
+	for _, target := range []string{"/api/search-query/stream", "/api/search-query/stream?query=vpn&mode=guess"} {
+		req, _ := http.NewRequest("GET", target, nil)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: got %v want %v", target, rr.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+// disconnectingWriter simulates a client that goes away after the first event.
+type disconnectingWriter struct {
+	*httptest.ResponseRecorder
+	writes int
+}
+
+func (w *disconnectingWriter) Write(p []byte) (int, error) {
+	w.writes++
+	if w.writes > 1 {
+		return 0, errors.New("broken pipe")
+	}
+	return w.ResponseRecorder.Write(p)
+}
+
+// TestSearchStreamHandler_ClientDisconnect tests that generation stops and nothing is
+// saved when the client disconnects mid-stream.
+func TestSearchStreamHandler_ClientDisconnect(t *testing.T) {
+	db := database.InitDB(testDBFile)
+	defer db.Close()
+
+	const query = "disconnect while streaming the password answer"
+	req, _ := http.NewRequest("POST", "/api/search-query/stream", bytes.NewReader([]byte(`{"query":"`+query+`"}`)))
+	w := &disconnectingWriter{ResponseRecorder: httptest.NewRecorder()}
+	SearchStreamHandler(newSearchConfig(db)).ServeHTTP(w, req)
+
+	if w.writes != 2 {
+		t.Errorf("expected generation to stop at the first failed write, got %d writes", w.writes)
+	}
+	var count int
+	db.QueryRow("SELECT COUNT(*) FROM search_history WHERE user_query = ?", query).Scan(&count)
+	if count != 0 {
+		t.Errorf("expected nothing saved after a disconnect, found %d records", count)
+	}
+}
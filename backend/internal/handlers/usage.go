@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"ai-knowledge-base/internal/ai"
+	"ai-knowledge-base/internal/usage"
+	"cmp"
+	"database/sql"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultCallerHeader is the request header that labels the caller of a search in
+// usage reports.
+const DefaultCallerHeader = "X-User-ID"
+
+// budgetWarnings tell the user why a search fell back to retrieval-only, by the limit
+// that was reached.
+var budgetWarnings = map[string]string{
+	"daily":  "Today's AI budget has been used up; showing the best matching articles instead.",
+	"client": "Your AI budget for today has been used up; showing the best matching articles instead.",
+}
+
+// requester identifies who made a search. The server does not authenticate callers, so
+// caller, which the client chooses, only labels usage in reports, while budgets are
+// enforced on client, the address the request came from.
+type requester struct {
+	caller, client string
+}
+
+// requesterOf identifies who made a request: its caller is the value of the caller
+// header, by default DefaultCallerHeader, or else the client's address.
+func requesterOf(r *http.Request, header string) requester {
+	client := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		client = host
+	}
+	caller := cmp.Or(strings.TrimSpace(r.Header.Get(cmp.Or(header, DefaultCallerHeader))), client)
+	return requester{caller: caller, client: client}
+}
+
+// applyBudget switches req to retrieval-only if its client or everyone has used up
+// today's AI budget, and returns the warning to show. If spending cannot be read, the
+// search goes ahead.
+func applyBudget(cfg SearchConfig, req *SearchRequest, who requester) string {
+	if req.Mode == ModeRetrieve {
+		return ""
+	}
+	limit, err := cfg.Budget.Exceeded(cfg.DB, who.client, time.Now())
+	if err != nil {
+		log.Printf("Failed to check AI budget, allowing the search: %v", err)
+		return ""
+	}
+	if limit == "" {
+		return ""
+	}
+	log.Printf("AI budget (%s) exceeded for %s (%s), answering %q with retrieval only", limit, who.client, who.caller, req.Query)
+	req.Mode = ModeRetrieve
+	return budgetWarnings[limit]
+}
+
+// saveUsage records the usage of a search. Failures are only logged.
+func saveUsage(db *sql.DB, searchID int64, who requester, summary *usage.Summary) {
+	if err := usage.Save(db, searchID, who.caller, who.client, summary); err != nil {
+		log.Printf("Failed to save AI usage: %v", err)
+	}
+}
+
+// keepUsage saves the usage recorded for a search that ended without being saved, such
+// as one that failed or whose client went away, so that it still counts towards the
+// budgets.
+func keepUsage(cfg SearchConfig, who requester, recorder *ai.UsageRecorder, saved *bool) {
+	if !*saved {
+		saveUsage(cfg.DB, 0, who, usage.Summarize(cfg.Prices, recorder.Records()))
+	}
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"ai-knowledge-base/internal/database"
+	"ai-knowledge-base/internal/usage"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// postSearchAs sends a search request to handler from the client address given, on
+// behalf of caller.
+func postSearchAs(handler http.Handler, client, caller, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/api/search-query", bytes.NewReader([]byte(body)))
+	req.RemoteAddr = client + ":52100"
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(DefaultCallerHeader, caller)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	return rr
+}
+
+// TestRequesterOf tests labelling callers by header, then by address, and identifying
+// clients by address only.
+func TestRequesterOf(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.0.0.7:52100"
+	if got := requesterOf(req, DefaultCallerHeader); got != (requester{caller: "10.0.0.7", client: "10.0.0.7"}) {
+		t.Errorf("Expected the client address, got %+v", got)
+	}
+	req.Header.Set(DefaultCallerHeader, " alice ")
+	if got := requesterOf(req, DefaultCallerHeader); got != (requester{caller: "alice", client: "10.0.0.7"}) {
+		t.Errorf("Expected the caller header as the label only, got %+v", got)
+	}
+}
+
+// TestSearchHandler_Usage tests that a search reports and records its tokens and cost.
+func TestSearchHandler_Usage(t *testing.T) {
+	db := database.InitDB(testDBFile)
+	defer db.Close()
+
+	cfg := newSearchConfig(db)
+	cfg.Prices = usage.Prices{"fake": {InputPerMillion: 1, OutputPerMillion: 2}}
+	var resp SearchResponse
+	json.NewDecoder(postSearchAs(SearchHandler(cfg), "10.2.0.1", "usage-tester", `{"query":"how to reset password?"}`).Body).Decode(&resp)
+
+	summary := resp.Usage
+	if summary == nil || len(summary.Models) != 1 || summary.Models[0].Model != "fake" || summary.Models[0].Requests != 1 || summary.PromptTokens == 0 {
+		t.Fatalf("Expected the usage of one fake request, got %+v", summary)
+	}
+	if want := float64(summary.PromptTokens+2*summary.CompletionTokens) / 1e6; summary.CostUSD != want {
+		t.Errorf("Expected a cost of %v, got %v", want, summary.CostUSD)
+	}
+
+	var promptTokens, completionTokens, rows int
+	var cost float64
+	err := db.QueryRow(`SELECT h.prompt_tokens, h.completion_tokens, h.cost_usd, COUNT(u.id) FROM search_history h
+        JOIN ai_usage u ON u.search_id = h.id WHERE h.caller = 'usage-tester' AND u.caller = 'usage-tester'`).Scan(&promptTokens, &completionTokens, &cost, &rows)
+	if err != nil || promptTokens != summary.PromptTokens || completionTokens != summary.CompletionTokens || cost != summary.CostUSD || rows != 1 {
+		t.Errorf("Expected the usage saved with the search, got %d, %d, %v, %d rows (%v)", promptTokens, completionTokens, cost, rows, err)
+	}
+
+	var retrieved SearchResponse
+	json.NewDecoder(postSearchAs(SearchHandler(cfg), "10.2.0.1", "usage-tester", `{"query":"password","mode":"retrieve"}`).Body).Decode(&retrieved)
+	if retrieved.Usage != nil {
+		t.Errorf("Expected no usage for retrieval-only searches, got %+v", retrieved.Usage)
+	}
+}
+
+// TestSearchHandler_Budget tests that a client over its daily budget gets
+// retrieval-only answers, whatever caller it claims to be, while other clients still
+// get AI answers.
+func TestSearchHandler_Budget(t *testing.T) {
+	db := database.InitDB(testDBFile)
+	defer db.Close()
+
+	cfg := newSearchConfig(db)
+	// A dollar per token uses up the budget with the first search.
+	cfg.Prices = usage.Prices{"fake": {InputPerMillion: 1e6, OutputPerMillion: 1e6}}
+	cfg.Budget = usage.Limits{PerClient: 1}
+	handler := SearchHandler(cfg)
+
+	body := `{"query":"how to reset password?","mode":"auto"}`
+	var first SearchResponse
+	json.NewDecoder(postSearchAs(handler, "10.2.0.2", "budget-tester", body).Body).Decode(&first)
+	if first.Mode != ModeAnswer || first.Usage == nil || first.Usage.CostUSD < 1 {
+		t.Fatalf("Expected an AI answer using up the budget, got %+v", first)
+	}
+
+	var second SearchResponse
+	json.NewDecoder(postSearchAs(handler, "10.2.0.2", "someone-else", body).Body).Decode(&second)
+	if second.Mode != ModeRetrieve || second.Warning != budgetWarnings["client"] || second.Usage != nil || len(second.Results) == 0 {
+		t.Errorf("Expected a retrieval-only answer with a budget warning, got %+v", second)
+	}
+
+	var other SearchResponse
+	json.NewDecoder(postSearchAs(handler, "10.2.0.3", "budget-tester", body).Body).Decode(&other)
+	if other.Mode != ModeAnswer {
+		t.Errorf("Expected other clients to keep their budget, got mode %q", other.Mode)
+	}
+}
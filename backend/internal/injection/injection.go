@@ -0,0 +1,116 @@
+// Package injection detects prompt-injection attempts in text that is sent to the
+// model but not written by us: user queries and knowledge base articles.
+package injection
+
+import (
+	"math"
+	"regexp"
+	"strings"
+)
+
+// Policies for text flagged as an injection attempt.
+const (
+	// PolicyBlock rejects a flagged query and leaves flagged articles out of the prompt.
+	PolicyBlock = "block"
+	// PolicyWarn sends flagged text to the model unchanged and reports it.
+	PolicyWarn = "warn"
+	// PolicyStrip removes the matched instructions from flagged text and reports it.
+	PolicyStrip = "strip"
+)
+
+// ValidPolicy reports whether policy is one of the known policies.
+func ValidPolicy(policy string) bool {
+	return policy == PolicyBlock || policy == PolicyWarn || policy == PolicyStrip
+}
+
+// DefaultThreshold is the score from which text is flagged.
+const DefaultThreshold = 0.5
+
+// rule is a pattern typical of injection attempts, weighted by how strongly it
+// suggests one on its own.
+type rule struct {
+	name    string
+	weight  float64
+	pattern *regexp.Regexp
+}
+
+var rules = []rule{
+	{"ignore_instructions", 0.9, regexp.MustCompile(`(?i)\b(ignore|disregard|forget|skip|override|bypass)\b[^.\n]{0,40}\b(instructions?|prompts?|rules|directions|guidelines|context|everything)\b`)},
+	{"new_instructions", 0.6, regexp.MustCompile(`(?i)\b(new|updated|real|actual|following)\s+(instructions?|rules|task|orders)\s*:`)},
+	{"role_change", 0.5, regexp.MustCompile(`(?i)\b(you are now|from now on,? you|act as|pretend (to be|you are)|roleplay as|you must now)\b`)},
+	{"prompt_leak", 0.6, regexp.MustCompile(`(?i)\b(reveal|print|show|repeat|output|leak)\b[^.\n]{0,30}\b(system prompt|your (instructions|prompt|rules)|the prompt above)\b`)},
+	{"system_prompt", 0.3, regexp.MustCompile(`(?i)\bsystem\s+prompt\b`)},
+	{"role_marker", 0.6, regexp.MustCompile(`(?im)^\s*(system|assistant|developer)\s*:|<\|im_(start|end)\|>|\[/?INST\]|<</?SYS>>|###\s*(instruction|system)`)},
+	{"delimiter_breakout", 0.8, regexp.MustCompile(`(?i)</?\s*(` + delimiterTags + `)\b[^>]*>|-{3}\s*(START|END) OF ARTICLES\s*-{3}`)},
+	{"forced_output", 0.4, regexp.MustCompile(`(?i)\b(respond|reply|answer|say|output)\b[^.\n]{0,20}\bonly\s+(with\s+)?["']`)},
+	{"jailbreak", 0.5, regexp.MustCompile(`(?i)\b(jailbreak|developer mode|DAN mode|do anything now|no restrictions)\b`)},
+}
+
+// Detection is the outcome of scanning a text.
+type Detection struct {
+	// Score estimates the likelihood of an injection attempt, from 0 to 1.
+	Score float64 `json:"score"`
+	// Rules names the patterns that matched.
+	Rules []string `json:"rules,omitempty"`
+}
+
+// Detector scores texts for injection attempts with heuristic patterns.
+type Detector struct {
+	// Threshold is the score from which a text is flagged.
+	Threshold float64
+}
+
+// NewDetector creates a detector with the default threshold.
+func NewDetector() *Detector {
+	return &Detector{Threshold: DefaultThreshold}
+}
+
+// Detect scores text. Each matching pattern adds its weight as an independent piece
+// of evidence, so that several weak signals together can flag a text.
+func (d *Detector) Detect(text string) Detection {
+	var detection Detection
+	clean := 1.0
+	for _, r := range rules {
+		if r.pattern.MatchString(text) {
+			detection.Rules = append(detection.Rules, r.name)
+			clean *= 1 - r.weight
+		}
+	}
+	detection.Score = math.Round((1-clean)*100) / 100
+	return detection
+}
+
+// Flagged reports whether a detection reaches the threshold.
+func (d *Detector) Flagged(detection Detection) bool {
+	return detection.Score >= d.Threshold
+}
+
+// Strip removes every match of the patterns from text. Removing one match can expose
+// another, such as a role marker that now starts the text, so it repeats until nothing
+// matches.
+func Strip(text string) string {
+	for {
+		stripped := text
+		for _, r := range rules {
+			stripped = strings.TrimSpace(r.pattern.ReplaceAllString(stripped, ""))
+		}
+		if stripped == text {
+			return stripped
+		}
+		text = stripped
+	}
+}
+
+// Neutralize makes text safe to place between the prompt's delimiter tags: anything
+// that looks like one of them is defused so that untrusted text cannot close its
+// block and continue as instructions.
+func Neutralize(text string) string {
+	return delimiterPattern.ReplaceAllStringFunc(text, func(tag string) string {
+		return "(" + strings.Trim(tag, "<>") + ")"
+	})
+}
+
+// delimiterTags are the tags prompts enclose untrusted text in.
+const delimiterTags = "article|articles|question|conversation|turn|follow_up|passage|passages|sentence|sentences"
+
+var delimiterPattern = regexp.MustCompile(`(?i)</?\s*(` + delimiterTags + `)\b[^>]*>?`)
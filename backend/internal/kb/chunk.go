@@ -0,0 +1,168 @@
+package kb
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Chunk is a passage of an article. Start and End are byte offsets into the article's
+// Content, so Content[Start:End] == Text.
+type Chunk struct {
+	ID        string `json:"id"`
+	ArticleID string `json:"article_id"`
+	// Heading is the nearest markdown heading above the passage, if any.
+	Heading string `json:"heading,omitempty"`
+	Text    string `json:"text"`
+	Start   int    `json:"start"`
+	End     int    `json:"end"`
+}
+
+// Chunker splits articles into passages. Passages never cross a markdown heading;
+// within a section, whole paragraphs are packed together up to MaxTokens, and
+// paragraphs longer than that are cut into MaxTokens windows that overlap by
+// OverlapTokens. Tokens are approximated by whitespace-separated words.
+type Chunker struct {
+	MaxTokens     int
+	OverlapTokens int
+}
+
+var (
+	headingPattern   = regexp.MustCompile(`(?m)^#{1,6}[ \t]+(.+?)[ \t#]*$`)
+	paragraphPattern = regexp.MustCompile(`\n[ \t]*\n`)
+	wordPattern      = regexp.MustCompile(`\S+`)
+)
+
+// NewChunker creates a Chunker. The overlap is clamped below maxTokens so that
+// windows always advance.
+func NewChunker(maxTokens, overlapTokens int) *Chunker {
+	if maxTokens < 1 {
+		maxTokens = 1
+	}
+	if overlapTokens >= maxTokens {
+		overlapTokens = maxTokens - 1
+	}
+	if overlapTokens < 0 {
+		overlapTokens = 0
+	}
+	return &Chunker{MaxTokens: maxTokens, OverlapTokens: overlapTokens}
+}
+
+// ChunkID returns the stable ID of the index-th chunk of an article. The same
+// content split with the same settings always yields the same IDs.
+func ChunkID(articleID string, index int) string {
+	return fmt.Sprintf("%s#%d", articleID, index)
+}
+
+// ParseChunkID splits a chunk ID into its article ID and chunk index. IDs without a
+// chunk suffix (whole articles) return ok == false and the ID itself as the article ID.
+func ParseChunkID(id string) (articleID string, index int, ok bool) {
+	i := strings.LastIndex(id, "#")
+	if i < 0 {
+		return id, 0, false
+	}
+	index, err := strconv.Atoi(id[i+1:])
+	if err != nil {
+		return id, 0, false
+	}
+	return id[:i], index, true
+}
+
+// span is a [start, end) byte range of the article content.
+type span struct{ start, end int }
+
+// Split returns the passages of an article in document order.
+func (c *Chunker) Split(article Article) []Chunk {
+	content := article.Content
+	var chunks []Chunk
+
+	emit := func(heading string, words []span) {
+		if len(words) == 0 {
+			return
+		}
+		start, end := words[0].start, words[len(words)-1].end
+		chunks = append(chunks, Chunk{
+			ID:        ChunkID(article.ID, len(chunks)),
+			ArticleID: article.ID,
+			Heading:   heading,
+			Text:      content[start:end],
+			Start:     start,
+			End:       end,
+		})
+	}
+
+	for _, section := range sections(content) {
+		var pending []span
+		for _, para := range paragraphs(content, section.body) {
+			words := wordSpans(content, para)
+			if len(words) == 0 {
+				continue
+			}
+			if len(words) > c.MaxTokens {
+				emit(section.heading, pending)
+				pending = nil
+				step := c.MaxTokens - c.OverlapTokens
+				for i := 0; i < len(words); i += step {
+					emit(section.heading, words[i:min(i+c.MaxTokens, len(words))])
+					if i+c.MaxTokens >= len(words) {
+						break
+					}
+				}
+				continue
+			}
+			if len(pending)+len(words) > c.MaxTokens {
+				emit(section.heading, pending)
+				pending = nil
+			}
+			pending = append(pending, words...)
+		}
+		emit(section.heading, pending)
+	}
+	return chunks
+}
+
+type section struct {
+	heading string
+	body    span
+}
+
+// sections splits content at markdown headings. The heading line itself is not part
+// of the section body.
+func sections(content string) []section {
+	matches := headingPattern.FindAllStringSubmatchIndex(content, -1)
+	if len(matches) == 0 {
+		return []section{{body: span{0, len(content)}}}
+	}
+
+	result := []section{{body: span{0, matches[0][0]}}}
+	for i, m := range matches {
+		end := len(content)
+		if i+1 < len(matches) {
+			end = matches[i+1][0]
+		}
+		result = append(result, section{heading: content[m[2]:m[3]], body: span{m[1], end}})
+	}
+	return result
+}
+
+// paragraphs splits a range of content on blank lines.
+func paragraphs(content string, within span) []span {
+	var result []span
+	start := within.start
+	for _, m := range paragraphPattern.FindAllStringIndex(content[within.start:within.end], -1) {
+		result = append(result, span{start, within.start + m[0]})
+		start = within.start + m[1]
+	}
+	return append(result, span{start, within.end})
+}
+
+// wordSpans returns the byte ranges of the words in a range of content.
+func wordSpans(content string, within span) []span {
+	matches := wordPattern.FindAllStringIndex(content[within.start:within.end], -1)
+	words := make([]span, len(matches))
+	for i, m := range matches {
+		words[i] = span{within.start + m[0], within.start + m[1]}
+	}
+	return words
+}
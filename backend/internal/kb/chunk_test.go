@@ -0,0 +1,77 @@
+package kb
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestChunkerPacksParagraphs tests that short paragraphs share a passage and that
+// passages never cross a heading.
+func TestChunkerPacksParagraphs(t *testing.T) {
+	article := Article{ID: "kb-1", Content: "One two.\n\nThree four.\n\n# Next\n\nFive six."}
+	chunks := NewChunker(10, 2).Split(article)
+
+	if len(chunks) != 2 {
+		t.Fatalf("Expected 2 chunks, got %+v", chunks)
+	}
+	if chunks[0].Text != "One two.\n\nThree four." || chunks[0].Heading != "" {
+		t.Errorf("Unexpected first chunk %+v", chunks[0])
+	}
+	if chunks[1].Text != "Five six." || chunks[1].Heading != "Next" || chunks[1].ID != "kb-1#1" {
+		t.Errorf("Unexpected second chunk %+v", chunks[1])
+	}
+	for _, chunk := range chunks {
+		if article.Content[chunk.Start:chunk.End] != chunk.Text {
+			t.Errorf("Offsets of %s do not match its text", chunk.ID)
+		}
+	}
+}
+
+// TestChunkerWindowsLongParagraphs tests that a paragraph longer than MaxTokens is
+// split into overlapping windows that cover every word.
+func TestChunkerWindowsLongParagraphs(t *testing.T) {
+	words := make([]string, 10)
+	for i := range words {
+		words[i] = string(rune('a' + i))
+	}
+	chunks := NewChunker(4, 1).Split(Article{ID: "kb-1", Content: strings.Join(words, " ")})
+
+	want := []string{"a b c d", "d e f g", "g h i j"}
+	if len(chunks) != len(want) {
+		t.Fatalf("Expected %d chunks, got %+v", len(want), chunks)
+	}
+	for i, chunk := range chunks {
+		if chunk.Text != want[i] {
+			t.Errorf("Chunk %d: expected %q, got %q", i, want[i], chunk.Text)
+		}
+	}
+}
+
+// TestNewChunkerClampsOverlap tests that windows always advance.
+func TestNewChunkerClampsOverlap(t *testing.T) {
+	c := NewChunker(3, 5)
+	if c.OverlapTokens != 2 {
+		t.Errorf("Expected overlap clamped to 2, got %d", c.OverlapTokens)
+	}
+}
+
+// TestParseChunkID tests round-tripping chunk IDs, including article IDs containing '#'.
+func TestParseChunkID(t *testing.T) {
+	tests := []struct {
+		id        string
+		articleID string
+		index     int
+		ok        bool
+	}{
+		{ChunkID("kb-1", 3), "kb-1", 3, true},
+		{ChunkID("a#b", 0), "a#b", 0, true},
+		{"kb-1", "kb-1", 0, false},
+		{"kb#x", "kb#x", 0, false},
+	}
+	for _, tt := range tests {
+		articleID, index, ok := ParseChunkID(tt.id)
+		if articleID != tt.articleID || index != tt.index || ok != tt.ok {
+			t.Errorf("ParseChunkID(%q) = %q, %d, %v", tt.id, articleID, index, ok)
+		}
+	}
+}
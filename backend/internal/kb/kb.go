@@ -7,7 +7,7 @@ type Article struct {
 	Content string `json:"content"`
 }
 
-// GetArticles returns a hardcoded slice of articles to simulate a real knowledge base.
+// GetArticles returns the default articles used to seed an empty Store.
 func GetArticles() []Article {
 	return []Article{
 		{
@@ -0,0 +1,82 @@
+package kb
+
+import (
+	"sort"
+	"sync"
+)
+
+// MemoryStore is an in-memory Store, used as a fixture in tests and for running without a database.
+type MemoryStore struct {
+	mu       sync.RWMutex
+	articles map[string]Article
+}
+
+// NewMemoryStore creates a MemoryStore pre-populated with the given articles.
+func NewMemoryStore(articles ...Article) *MemoryStore {
+	s := &MemoryStore{articles: make(map[string]Article, len(articles))}
+	for _, article := range articles {
+		s.articles[article.ID] = article
+	}
+	return s
+}
+
+// List returns every article, ordered by ID.
+func (s *MemoryStore) List() ([]Article, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	articles := make([]Article, 0, len(s.articles))
+	for _, article := range s.articles {
+		articles = append(articles, article)
+	}
+	sort.Slice(articles, func(i, j int) bool { return articles[i].ID < articles[j].ID })
+	return articles, nil
+}
+
+// Get returns the article with the given ID, or ErrNotFound.
+func (s *MemoryStore) Get(id string) (Article, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	article, ok := s.articles[id]
+	if !ok {
+		return Article{}, ErrNotFound
+	}
+	return article, nil
+}
+
+// Create inserts a new article, or returns ErrAlreadyExists if the ID is taken.
+func (s *MemoryStore) Create(article Article) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.articles[article.ID]; ok {
+		return ErrAlreadyExists
+	}
+	s.articles[article.ID] = article
+	return nil
+}
+
+// Update replaces an existing article, or returns ErrNotFound.
+func (s *MemoryStore) Update(article Article) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.articles[article.ID]; !ok {
+		return ErrNotFound
+	}
+	s.articles[article.ID] = article
+	return nil
+}
+
+// Delete removes the article with the given ID, or returns ErrNotFound.
+func (s *MemoryStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.articles[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.articles, id)
+	return nil
+}
@@ -0,0 +1,102 @@
+package kb
+
+import (
+	"errors"
+	"testing"
+)
+
+// TestMemoryStoreCRUD tests the full create/read/update/delete cycle of MemoryStore.
+func TestMemoryStoreCRUD(t *testing.T) {
+	store := NewMemoryStore()
+
+	article := Article{ID: "kb-100", Title: "Title", Content: "Content"}
+	if err := store.Create(article); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	if err := store.Create(article); !errors.Is(err, ErrAlreadyExists) {
+		t.Errorf("Expected ErrAlreadyExists on duplicate create, got %v", err)
+	}
+
+	got, err := store.Get("kb-100")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if got != article {
+		t.Errorf("Expected %+v, got %+v", article, got)
+	}
+
+	article.Title = "Updated Title"
+	if err := store.Update(article); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	got, _ = store.Get("kb-100")
+	if got.Title != "Updated Title" {
+		t.Errorf("Expected updated title, got '%s'", got.Title)
+	}
+
+	if err := store.Update(Article{ID: "missing"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound on update of missing article, got %v", err)
+	}
+
+	if err := store.Delete("kb-100"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, err := store.Get("kb-100"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound after delete, got %v", err)
+	}
+	if err := store.Delete("kb-100"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound on second delete, got %v", err)
+	}
+}
+
+// TestMemoryStoreListOrder tests that List returns articles ordered by ID.
+func TestMemoryStoreListOrder(t *testing.T) {
+	store := NewMemoryStore(
+		Article{ID: "kb-003", Title: "C", Content: "c"},
+		Article{ID: "kb-001", Title: "A", Content: "a"},
+		Article{ID: "kb-002", Title: "B", Content: "b"},
+	)
+
+	articles, err := store.List()
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+
+	expected := []string{"kb-001", "kb-002", "kb-003"}
+	if len(articles) != len(expected) {
+		t.Fatalf("Expected %d articles, got %d", len(expected), len(articles))
+	}
+	for i, id := range expected {
+		if articles[i].ID != id {
+			t.Errorf("Article %d: expected ID '%s', got '%s'", i, id, articles[i].ID)
+		}
+	}
+}
+
+// TestSeed tests that Seed populates an empty store and leaves a non-empty one alone.
+func TestSeed(t *testing.T) {
+	store := NewMemoryStore()
+	if err := Seed(store, GetArticles()); err != nil {
+		t.Fatalf("Seed failed: %v", err)
+	}
+
+	articles, _ := store.List()
+	if len(articles) != len(GetArticles()) {
+		t.Errorf("Expected %d seeded articles, got %d", len(GetArticles()), len(articles))
+	}
+
+	// Seeding again must not fail on the existing IDs.
+	if err := Seed(store, GetArticles()); err != nil {
+		t.Errorf("Second Seed failed: %v", err)
+	}
+
+	custom := NewMemoryStore(Article{ID: "custom", Title: "Custom", Content: "Custom"})
+	if err := Seed(custom, GetArticles()); err != nil {
+		t.Fatalf("Seed failed: %v", err)
+	}
+	articles, _ = custom.List()
+	if len(articles) != 1 {
+		t.Errorf("Expected non-empty store to be left untouched, got %d articles", len(articles))
+	}
+}
@@ -0,0 +1,50 @@
+package kb
+
+// Observer is notified after an article has been successfully written to a Store.
+// Search indexes implement it to stay in sync with the knowledge base.
+type Observer interface {
+	ArticleSaved(article Article)
+	ArticleDeleted(id string)
+}
+
+// observedStore wraps a Store and fans successful writes out to observers.
+type observedStore struct {
+	Store
+	observers []Observer
+}
+
+// Observe returns a Store that behaves like store but notifies the observers
+// after every successful Create, Update and Delete.
+func Observe(store Store, observers ...Observer) Store {
+	return &observedStore{Store: store, observers: observers}
+}
+
+func (s *observedStore) Create(article Article) error {
+	if err := s.Store.Create(article); err != nil {
+		return err
+	}
+	for _, o := range s.observers {
+		o.ArticleSaved(article)
+	}
+	return nil
+}
+
+func (s *observedStore) Update(article Article) error {
+	if err := s.Store.Update(article); err != nil {
+		return err
+	}
+	for _, o := range s.observers {
+		o.ArticleSaved(article)
+	}
+	return nil
+}
+
+func (s *observedStore) Delete(id string) error {
+	if err := s.Store.Delete(id); err != nil {
+		return err
+	}
+	for _, o := range s.observers {
+		o.ArticleDeleted(id)
+	}
+	return nil
+}
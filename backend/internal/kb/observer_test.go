@@ -0,0 +1,37 @@
+package kb
+
+import "testing"
+
+// recordingObserver records the notifications it receives.
+type recordingObserver struct {
+	saved   []string
+	deleted []string
+}
+
+func (o *recordingObserver) ArticleSaved(article Article) { o.saved = append(o.saved, article.ID) }
+func (o *recordingObserver) ArticleDeleted(id string)     { o.deleted = append(o.deleted, id) }
+
+// TestObserve tests that observers see successful writes and only successful writes.
+func TestObserve(t *testing.T) {
+	observer := &recordingObserver{}
+	store := Observe(NewMemoryStore(GetArticles()...), observer)
+
+	store.Create(Article{ID: "kb-004", Title: "T", Content: "C"})
+	store.Create(Article{ID: "kb-004", Title: "T", Content: "C"}) // duplicate, fails
+	store.Update(Article{ID: "kb-001", Title: "T", Content: "C"})
+	store.Update(Article{ID: "missing", Title: "T", Content: "C"}) // fails
+	store.Delete("kb-002")
+	store.Delete("missing") // fails
+
+	if len(observer.saved) != 2 || observer.saved[0] != "kb-004" || observer.saved[1] != "kb-001" {
+		t.Errorf("Unexpected saved notifications: %v", observer.saved)
+	}
+	if len(observer.deleted) != 1 || observer.deleted[0] != "kb-002" {
+		t.Errorf("Unexpected deleted notifications: %v", observer.deleted)
+	}
+
+	// Reads pass straight through to the wrapped store.
+	if _, err := store.Get("kb-004"); err != nil {
+		t.Errorf("Get through observed store failed: %v", err)
+	}
+}
@@ -0,0 +1,91 @@
+package kb
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// SQLiteStore is a Store backed by the "articles" table created by database.InitDB.
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+// NewSQLiteStore creates a SQLiteStore on top of an already initialized database.
+func NewSQLiteStore(db *sql.DB) *SQLiteStore {
+	return &SQLiteStore{db: db}
+}
+
+// List returns every article, ordered by ID.
+func (s *SQLiteStore) List() ([]Article, error) {
+	rows, err := s.db.Query("SELECT id, title, content FROM articles ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	articles := []Article{}
+	for rows.Next() {
+		var article Article
+		if err := rows.Scan(&article.ID, &article.Title, &article.Content); err != nil {
+			return nil, err
+		}
+		articles = append(articles, article)
+	}
+	return articles, rows.Err()
+}
+
+// Get returns the article with the given ID, or ErrNotFound.
+func (s *SQLiteStore) Get(id string) (Article, error) {
+	var article Article
+	err := s.db.QueryRow("SELECT id, title, content FROM articles WHERE id = ?", id).
+		Scan(&article.ID, &article.Title, &article.Content)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Article{}, ErrNotFound
+	}
+	if err != nil {
+		return Article{}, err
+	}
+	return article, nil
+}
+
+// Create inserts a new article, or returns ErrAlreadyExists if the ID is taken.
+func (s *SQLiteStore) Create(article Article) error {
+	_, err := s.db.Exec("INSERT INTO articles(id, title, content) VALUES(?, ?, ?)", article.ID, article.Title, article.Content)
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey {
+		return ErrAlreadyExists
+	}
+	return err
+}
+
+// Update replaces an existing article, or returns ErrNotFound.
+func (s *SQLiteStore) Update(article Article) error {
+	res, err := s.db.Exec("UPDATE articles SET title = ?, content = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?", article.Title, article.Content, article.ID)
+	if err != nil {
+		return err
+	}
+	return requireAffected(res)
+}
+
+// Delete removes the article with the given ID, or returns ErrNotFound.
+func (s *SQLiteStore) Delete(id string) error {
+	res, err := s.db.Exec("DELETE FROM articles WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	return requireAffected(res)
+}
+
+// requireAffected maps a statement that touched no rows to ErrNotFound.
+func requireAffected(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package kb
+
+import (
+	"ai-knowledge-base/internal/database"
+	"errors"
+	"os"
+	"testing"
+)
+
+// TestSQLiteStoreCRUD tests the full create/read/update/delete cycle of SQLiteStore.
+func TestSQLiteStoreCRUD(t *testing.T) {
+	tempFile := "test_sqlite_store.sqlite"
+	defer os.Remove(tempFile)
+
+	db := database.InitDB(tempFile)
+	defer db.Close()
+
+	store := NewSQLiteStore(db)
+
+	article := Article{ID: "kb-100", Title: "Title", Content: "Content with 'quotes'"}
+	if err := store.Create(article); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	if err := store.Create(article); !errors.Is(err, ErrAlreadyExists) {
+		t.Errorf("Expected ErrAlreadyExists on duplicate create, got %v", err)
+	}
+
+	got, err := store.Get("kb-100")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if got != article {
+		t.Errorf("Expected %+v, got %+v", article, got)
+	}
+
+	article.Content = "Updated content"
+	if err := store.Update(article); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	got, _ = store.Get("kb-100")
+	if got.Content != "Updated content" {
+		t.Errorf("Expected updated content, got '%s'", got.Content)
+	}
+
+	if err := store.Update(Article{ID: "missing", Title: "x", Content: "x"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound on update of missing article, got %v", err)
+	}
+
+	if err := store.Delete("kb-100"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, err := store.Get("kb-100"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound after delete, got %v", err)
+	}
+	if err := store.Delete("kb-100"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound on second delete, got %v", err)
+	}
+}
+
+// TestSQLiteStoreSeed tests seeding the SQLite store with the default articles.
+func TestSQLiteStoreSeed(t *testing.T) {
+	tempFile := "test_sqlite_seed.sqlite"
+	defer os.Remove(tempFile)
+
+	db := database.InitDB(tempFile)
+	defer db.Close()
+
+	store := NewSQLiteStore(db)
+	if err := Seed(store, GetArticles()); err != nil {
+		t.Fatalf("Seed failed: %v", err)
+	}
+
+	articles, err := store.List()
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+
+	expected := GetArticles()
+	if len(articles) != len(expected) {
+		t.Fatalf("Expected %d articles, got %d", len(expected), len(articles))
+	}
+	for i := range expected {
+		if articles[i] != expected[i] {
+			t.Errorf("Article %d mismatch: expected %+v, got %+v", i, expected[i], articles[i])
+		}
+	}
+}
+
+// TestSQLiteStoreWithClosedDB tests that store errors are surfaced rather than swallowed.
+func TestSQLiteStoreWithClosedDB(t *testing.T) {
+	tempFile := "test_sqlite_closed.sqlite"
+	defer os.Remove(tempFile)
+
+	db := database.InitDB(tempFile)
+	db.Close()
+
+	store := NewSQLiteStore(db)
+	if _, err := store.List(); err == nil {
+		t.Error("Expected error when listing from closed database, but got none")
+	}
+	if _, err := store.Get("kb-001"); err == nil || errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected a database error from closed database, got %v", err)
+	}
+}
@@ -0,0 +1,43 @@
+package kb
+
+import "errors"
+
+var (
+	// ErrNotFound is returned when an article with the requested ID does not exist.
+	ErrNotFound = errors.New("article not found")
+	// ErrAlreadyExists is returned when creating an article whose ID is already taken.
+	ErrAlreadyExists = errors.New("article already exists")
+)
+
+// Store is the persistence interface for knowledge base articles.
+type Store interface {
+	// List returns every article, ordered by ID.
+	List() ([]Article, error)
+	// Get returns the article with the given ID, or ErrNotFound.
+	Get(id string) (Article, error)
+	// Create inserts a new article, or returns ErrAlreadyExists if the ID is taken.
+	Create(article Article) error
+	// Update replaces an existing article, or returns ErrNotFound.
+	Update(article Article) error
+	// Delete removes the article with the given ID, or returns ErrNotFound.
+	Delete(id string) error
+}
+
+// Seed inserts the given articles into an empty store.
+// It is a no-op if the store already contains articles, so it is safe to call on every startup.
+func Seed(store Store, articles []Article) error {
+	existing, err := store.List()
+	if err != nil {
+		return err
+	}
+	if len(existing) > 0 {
+		return nil
+	}
+
+	for _, article := range articles {
+		if err := store.Create(article); err != nil {
+			return err
+		}
+	}
+	return nil
+}
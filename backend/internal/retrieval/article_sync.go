@@ -0,0 +1,149 @@
+package retrieval
+
+import (
+	"ai-knowledge-base/internal/kb"
+	"cmp"
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// DefaultSyncTimeout bounds indexing an article written through the API, which may
+// call a remote embedder.
+const DefaultSyncTimeout = 10 * time.Second
+
+// ArticleSync keeps a DocumentIndex in step with the knowledge base. It splits each
+// article into documents and remembers which documents came from which article, so
+// that when an article is edited into fewer passages the leftovers are removed.
+//
+// Articles that fail to index when written are kept and retried with the next write
+// and by Retry, so that a transient embedder outage does not leave the index stale.
+type ArticleSync struct {
+	index DocumentIndex
+	split Splitter
+	// Timeout bounds indexing each written article. Zero means DefaultSyncTimeout.
+	Timeout time.Duration
+
+	// indexing serializes writes to the index, so that a retry never overwrites a
+	// newer version of an article or re-adds a deleted one.
+	indexing sync.Mutex
+	mu       sync.Mutex
+	docs     map[string][]string   // article ID -> document IDs
+	pending  map[string]kb.Article // article ID -> latest version that failed to index
+}
+
+// NewArticleSync creates an ArticleSync that feeds index with the documents produced by split.
+func NewArticleSync(index DocumentIndex, split Splitter) *ArticleSync {
+	return &ArticleSync{index: index, split: split, docs: make(map[string][]string), pending: make(map[string]kb.Article)}
+}
+
+// Load indexes the given articles, typically the whole store at startup.
+func (s *ArticleSync) Load(ctx context.Context, articles []kb.Article) error {
+	var all []Document
+	for _, article := range articles {
+		all = append(all, s.track(article)...)
+	}
+	return s.index.AddDocuments(ctx, all)
+}
+
+// ArticleSaved implements kb.Observer. The article itself has already been saved, so
+// an indexing failure is logged and the article queued for Retry rather than returned.
+// Articles queued earlier are retried after it, within the same Timeout.
+func (s *ArticleSync) ArticleSaved(article kb.Article) {
+	ctx, cancel := context.WithTimeout(context.Background(), cmp.Or(s.Timeout, DefaultSyncTimeout))
+	defer cancel()
+	s.indexing.Lock()
+	err := s.add(ctx, article)
+	s.indexing.Unlock()
+	if err != nil {
+		log.Printf("Failed to index article %s, will retry: %v", article.ID, err)
+		return
+	}
+	s.Retry(ctx)
+}
+
+// ArticleDeleted implements kb.Observer.
+func (s *ArticleSync) ArticleDeleted(id string) {
+	s.indexing.Lock()
+	defer s.indexing.Unlock()
+	s.mu.Lock()
+	stale := s.docs[id]
+	delete(s.docs, id)
+	delete(s.pending, id)
+	s.mu.Unlock()
+
+	s.index.RemoveDocuments(stale)
+}
+
+// Retry indexes the articles that failed to index when they were written, and returns
+// how many are still pending.
+func (s *ArticleSync) Retry(ctx context.Context) int {
+	s.mu.Lock()
+	pending := make([]kb.Article, 0, len(s.pending))
+	for _, article := range s.pending {
+		pending = append(pending, article)
+	}
+	s.mu.Unlock()
+
+	for _, article := range pending {
+		if ctx.Err() != nil {
+			break
+		}
+		s.indexing.Lock()
+		// The article may have been saved again or deleted since it was queued.
+		s.mu.Lock()
+		current, ok := s.pending[article.ID]
+		s.mu.Unlock()
+		if ok && current == article {
+			if err := s.add(ctx, article); err != nil {
+				log.Printf("Failed to index article %s on retry: %v", article.ID, err)
+			}
+		}
+		s.indexing.Unlock()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.pending)
+}
+
+// add indexes article, queueing it if that fails. The caller holds s.indexing.
+func (s *ArticleSync) add(ctx context.Context, article kb.Article) error {
+	err := s.index.AddDocuments(ctx, s.track(article))
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		s.pending[article.ID] = article
+	} else {
+		delete(s.pending, article.ID)
+	}
+	return err
+}
+
+// track splits an article, records its document IDs and removes documents left
+// over from its previous version.
+func (s *ArticleSync) track(article kb.Article) []Document {
+	docs := s.split(article)
+	ids := make([]string, len(docs))
+	current := make(map[string]bool, len(docs))
+	for i, doc := range docs {
+		ids[i] = doc.ID
+		current[doc.ID] = true
+	}
+
+	s.mu.Lock()
+	previous := s.docs[article.ID]
+	s.docs[article.ID] = ids
+	s.mu.Unlock()
+
+	var stale []string
+	for _, id := range previous {
+		if !current[id] {
+			stale = append(stale, id)
+		}
+	}
+	if len(stale) > 0 {
+		s.index.RemoveDocuments(stale)
+	}
+	return docs
+}
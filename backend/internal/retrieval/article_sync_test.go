@@ -0,0 +1,102 @@
+package retrieval
+
+import (
+	"ai-knowledge-base/internal/kb"
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestChunkedSplitter tests that passages become documents titled with their heading.
+func TestChunkedSplitter(t *testing.T) {
+	article := kb.Article{ID: "kb-9", Title: "Guide", Content: "Intro text.\n\n## Setup\n\nInstall it."}
+	docs := Chunked(kb.NewChunker(50, 0))(article)
+
+	if len(docs) != 2 {
+		t.Fatalf("Expected 2 documents, got %v", docs)
+	}
+	if docs[0].ID != "kb-9#0" || docs[0].Title != "Guide" {
+		t.Errorf("Unexpected first document %+v", docs[0])
+	}
+	if docs[1].ID != "kb-9#1" || docs[1].Title != "Guide - Setup" || docs[1].Text != "Install it." {
+		t.Errorf("Unexpected second document %+v", docs[1])
+	}
+}
+
+// TestArticleSyncRemovesStalePassages tests that shrinking an article removes the
+// passages that no longer exist, and that deleting it removes all of them.
+func TestArticleSyncRemovesStalePassages(t *testing.T) {
+	idx := NewBM25Index()
+	syncer := NewArticleSync(idx, Chunked(kb.NewChunker(5, 0)))
+
+	long := kb.Article{ID: "kb-9", Title: "Guide", Content: strings.Repeat("alpha beta gamma delta epsilon ", 3) + "zeta"}
+	if err := syncer.Load(context.Background(), []kb.Article{long}); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if idx.Len() != 4 {
+		t.Fatalf("Expected 4 passages, got %d", idx.Len())
+	}
+	if hits := idx.Search("zeta", 1); len(hits) != 1 || hits[0].ID != "kb-9#3" {
+		t.Errorf("Expected zeta in the last passage, got %v", hits)
+	}
+
+	syncer.ArticleSaved(kb.Article{ID: "kb-9", Title: "Guide", Content: "alpha beta"})
+	if idx.Len() != 1 {
+		t.Errorf("Expected 1 passage after shrinking, got %d", idx.Len())
+	}
+	if hits := idx.Search("zeta", 1); len(hits) != 0 {
+		t.Errorf("Expected stale passage to be removed, got %v", hits)
+	}
+
+	syncer.ArticleDeleted("kb-9")
+	if idx.Len() != 0 {
+		t.Errorf("Expected empty index after delete, got %d", idx.Len())
+	}
+}
+
+// flakyIndex is a DocumentIndex that fails while down, waiting for the context to end.
+type flakyIndex struct {
+	*BM25Index
+	down bool
+}
+
+func (f *flakyIndex) AddDocuments(ctx context.Context, docs []Document) error {
+	if f.down {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	return f.BM25Index.AddDocuments(ctx, docs)
+}
+
+// TestArticleSyncRetries tests that indexing a written article is bounded by the
+// timeout, and that articles that failed are retried without overwriting newer versions.
+func TestArticleSyncRetries(t *testing.T) {
+	idx := &flakyIndex{BM25Index: NewBM25Index(), down: true}
+	syncer := NewArticleSync(idx, WholeArticle)
+	syncer.Timeout = 20 * time.Millisecond
+
+	start := time.Now()
+	syncer.ArticleSaved(kb.Article{ID: "kb-9", Title: "Guide", Content: "alpha"})
+	syncer.ArticleSaved(kb.Article{ID: "kb-8", Title: "Other", Content: "gamma"})
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("Expected indexing to give up after the timeout, took %s", elapsed)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if pending := syncer.Retry(ctx); pending != 2 || idx.Len() != 0 {
+		t.Fatalf("Expected both articles pending while the index is down, got %d", pending)
+	}
+
+	idx.down = false
+	syncer.ArticleSaved(kb.Article{ID: "kb-9", Title: "Guide", Content: "beta"})
+	if hits := idx.Search("alpha", 1); len(hits) != 0 {
+		t.Errorf("Expected the newer version of kb-9 only, got %v", hits)
+	}
+	if hits := idx.Search("gamma", 1); len(hits) != 1 {
+		t.Errorf("Expected kb-8 indexed by the retry after the next write, got %v", hits)
+	}
+	if pending := syncer.Retry(context.Background()); pending != 0 {
+		t.Errorf("Expected nothing pending, got %d", pending)
+	}
+}
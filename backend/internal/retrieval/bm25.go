@@ -0,0 +1,178 @@
+package retrieval
+
+import (
+	"context"
+	"math"
+	"sort"
+	"sync"
+)
+
+// Default BM25 parameters. K1 controls term-frequency saturation and B controls
+// document-length normalization; TitleBoost weights a title occurrence of a term
+// as that many body occurrences.
+const (
+	DefaultK1         = 1.2
+	DefaultB          = 0.75
+	DefaultTitleBoost = 2.0
+)
+
+// BM25Index is an in-memory inverted index that ranks documents with Okapi BM25.
+// It is safe for concurrent use.
+type BM25Index struct {
+	K1         float64
+	B          float64
+	TitleBoost float64
+
+	mu       sync.RWMutex
+	postings map[string]map[string]float64 // term -> doc ID -> weighted term frequency
+	docTerms map[string]map[string]float64 // doc ID -> term -> weighted term frequency
+	docLen   map[string]float64
+	totalLen float64
+}
+
+// NewBM25Index creates an empty index with the default parameters.
+func NewBM25Index() *BM25Index {
+	return &BM25Index{
+		K1:         DefaultK1,
+		B:          DefaultB,
+		TitleBoost: DefaultTitleBoost,
+		postings:   make(map[string]map[string]float64),
+		docTerms:   make(map[string]map[string]float64),
+		docLen:     make(map[string]float64),
+	}
+}
+
+// Add indexes a document, replacing any previous version with the same ID.
+func (idx *BM25Index) Add(doc Document) {
+	terms := make(map[string]float64)
+	for _, token := range Tokenize(doc.Title) {
+		terms[token] += idx.TitleBoost
+	}
+	for _, token := range Tokenize(doc.Text) {
+		terms[token]++
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.removeLocked(doc.ID)
+
+	var length float64
+	for term, tf := range terms {
+		if idx.postings[term] == nil {
+			idx.postings[term] = make(map[string]float64)
+		}
+		idx.postings[term][doc.ID] = tf
+		length += tf
+	}
+	idx.docTerms[doc.ID] = terms
+	idx.docLen[doc.ID] = length
+	idx.totalLen += length
+}
+
+// Remove drops a document from the index. Removing an unknown ID is a no-op.
+func (idx *BM25Index) Remove(id string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.removeLocked(id)
+}
+
+func (idx *BM25Index) removeLocked(id string) {
+	terms, ok := idx.docTerms[id]
+	if !ok {
+		return
+	}
+	for term := range terms {
+		delete(idx.postings[term], id)
+		if len(idx.postings[term]) == 0 {
+			delete(idx.postings, term)
+		}
+	}
+	idx.totalLen -= idx.docLen[id]
+	delete(idx.docTerms, id)
+	delete(idx.docLen, id)
+}
+
+// Len returns the number of indexed documents.
+func (idx *BM25Index) Len() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return len(idx.docTerms)
+}
+
+// Search returns the k highest-scoring documents for the query.
+// Documents that share no terms with the query are never returned.
+func (idx *BM25Index) Search(query string, k int) []Hit {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	n := float64(len(idx.docTerms))
+	if n == 0 || k <= 0 {
+		return nil
+	}
+	avgLen := idx.totalLen / n
+
+	scores := make(map[string]float64)
+	seen := make(map[string]bool)
+	for _, term := range Tokenize(query) {
+		if seen[term] {
+			continue
+		}
+		seen[term] = true
+
+		postings := idx.postings[term]
+		if len(postings) == 0 {
+			continue
+		}
+		df := float64(len(postings))
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+		for id, tf := range postings {
+			norm := idx.K1 * (1 - idx.B + idx.B*idx.docLen[id]/avgLen)
+			scores[id] += idf * tf * (idx.K1 + 1) / (tf + norm)
+		}
+	}
+
+	return topHits(scores, k)
+}
+
+// Retrieve implements Retriever.
+func (idx *BM25Index) Retrieve(ctx context.Context, query string, k int) ([]Hit, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return idx.Search(query, k), nil
+}
+
+// AddDocuments implements DocumentIndex.
+func (idx *BM25Index) AddDocuments(ctx context.Context, docs []Document) error {
+	for _, doc := range docs {
+		idx.Add(doc)
+	}
+	return nil
+}
+
+// RemoveDocuments implements DocumentIndex.
+func (idx *BM25Index) RemoveDocuments(ids []string) {
+	for _, id := range ids {
+		idx.Remove(id)
+	}
+}
+
+// topHits sorts scored documents by descending score (ties broken by ID for
+// stable output) and returns at most k of them.
+func topHits(scores map[string]float64, k int) []Hit {
+	hits := make([]Hit, 0, len(scores))
+	for id, score := range scores {
+		hits = append(hits, Hit{ID: id, Score: score})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].ID < hits[j].ID
+	})
+	if len(hits) > k {
+		hits = hits[:k]
+	}
+	return hits
+}
@@ -0,0 +1,148 @@
+package retrieval
+
+import (
+	"ai-knowledge-base/internal/kb"
+	"context"
+	"fmt"
+	"testing"
+)
+
+func newTestIndex() *BM25Index {
+	idx := NewBM25Index()
+	NewArticleSync(idx, WholeArticle).Load(context.Background(), kb.GetArticles())
+	return idx
+}
+
+// TestBM25Search tests that the obvious article is ranked first for typical queries.
+func TestBM25Search(t *testing.T) {
+	idx := newTestIndex()
+
+	tests := []struct {
+		query    string
+		expected string
+	}{
+		{"how do I reset my password?", "kb-001"},
+		{"can't connect to the VPN", "kb-002"},
+		{"add a printer", "kb-003"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			hits := idx.Search(tt.query, 3)
+			if len(hits) == 0 {
+				t.Fatalf("Expected hits for %q, got none", tt.query)
+			}
+			if hits[0].ID != tt.expected {
+				t.Errorf("Expected top hit %s, got %s (%v)", tt.expected, hits[0].ID, hits)
+			}
+		})
+	}
+}
+
+// TestBM25SearchNoMatch tests that documents sharing no terms with the query are not returned.
+func TestBM25SearchNoMatch(t *testing.T) {
+	idx := newTestIndex()
+
+	if hits := idx.Search("quarterly revenue forecast", 3); len(hits) != 0 {
+		t.Errorf("Expected no hits, got %v", hits)
+	}
+	if hits := idx.Search("the and of", 3); len(hits) != 0 {
+		t.Errorf("Expected no hits for a stopword-only query, got %v", hits)
+	}
+}
+
+// TestBM25TopK tests that at most k hits are returned, in descending score order.
+func TestBM25TopK(t *testing.T) {
+	idx := NewBM25Index()
+	for i := 0; i < 10; i++ {
+		idx.Add(Document{ID: fmt.Sprintf("doc-%d", i), Title: "network", Text: fmt.Sprintf("network issue %d", i)})
+	}
+
+	hits := idx.Search("network", 4)
+	if len(hits) != 4 {
+		t.Fatalf("Expected 4 hits, got %d", len(hits))
+	}
+	for i := 1; i < len(hits); i++ {
+		if hits[i].Score > hits[i-1].Score {
+			t.Errorf("Hits not sorted by score: %v", hits)
+		}
+	}
+
+	if hits := idx.Search("network", 0); len(hits) != 0 {
+		t.Errorf("Expected no hits for k=0, got %d", len(hits))
+	}
+}
+
+// TestBM25TitleBoost tests that a title match outranks the same term in the body.
+func TestBM25TitleBoost(t *testing.T) {
+	idx := NewBM25Index()
+	idx.Add(Document{ID: "body", Title: "General tips", Text: "Restart the laptop when it is slow."})
+	idx.Add(Document{ID: "title", Title: "Laptop is slow", Text: "Restart it and close unused programs."})
+
+	hits := idx.Search("laptop", 2)
+	if len(hits) != 2 || hits[0].ID != "title" {
+		t.Errorf("Expected title match to rank first, got %v", hits)
+	}
+}
+
+// TestBM25AddReplaceRemove tests that re-adding replaces a document and Remove drops it.
+func TestBM25AddReplaceRemove(t *testing.T) {
+	idx := NewBM25Index()
+	idx.Add(Document{ID: "doc", Title: "Printer", Text: "Printer setup"})
+	idx.Add(Document{ID: "doc", Title: "Scanner", Text: "Scanner setup"})
+
+	if idx.Len() != 1 {
+		t.Errorf("Expected 1 document after replace, got %d", idx.Len())
+	}
+	if hits := idx.Search("printer", 1); len(hits) != 0 {
+		t.Errorf("Expected replaced terms to be gone, got %v", hits)
+	}
+	if hits := idx.Search("scanner", 1); len(hits) != 1 {
+		t.Errorf("Expected new terms to be indexed, got %v", hits)
+	}
+
+	idx.Remove("doc")
+	idx.Remove("missing")
+	if idx.Len() != 0 {
+		t.Errorf("Expected empty index after remove, got %d", idx.Len())
+	}
+	if hits := idx.Search("scanner", 1); len(hits) != 0 {
+		t.Errorf("Expected no hits after remove, got %v", hits)
+	}
+}
+
+// TestBM25FollowsStore tests that the index stays in sync through kb.Observe.
+func TestBM25FollowsStore(t *testing.T) {
+	idx := NewBM25Index()
+	syncer := NewArticleSync(idx, WholeArticle)
+	syncer.Load(context.Background(), kb.GetArticles())
+	store := kb.Observe(kb.NewMemoryStore(kb.GetArticles()...), syncer)
+
+	store.Create(kb.Article{ID: "kb-004", Title: "Mobile email", Content: "Install the mail app on your phone."})
+	hits, err := idx.Retrieve(context.Background(), "phone email", 1)
+	if err != nil || len(hits) != 1 || hits[0].ID != "kb-004" {
+		t.Errorf("Expected new article to be retrievable, got %v (%v)", hits, err)
+	}
+
+	store.Delete("kb-004")
+	if hits := idx.Search("phone", 1); len(hits) != 0 {
+		t.Errorf("Expected deleted article to be gone, got %v", hits)
+	}
+}
+
+// BenchmarkBM25Search benchmarks searching a moderately sized index.
+func BenchmarkBM25Search(b *testing.B) {
+	idx := NewBM25Index()
+	for i := 0; i < 5000; i++ {
+		idx.Add(Document{
+			ID:    fmt.Sprintf("doc-%d", i),
+			Title: fmt.Sprintf("Article %d about topic %d", i, i%50),
+			Text:  fmt.Sprintf("Body text for document %d covering topic %d and subject %d.", i, i%50, i%17),
+		})
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		idx.Search("topic 7 subject 3", 5)
+	}
+}
@@ -0,0 +1,65 @@
+package retrieval
+
+import (
+	"context"
+	"math"
+)
+
+// Embedder turns text into dense vectors for semantic retrieval.
+type Embedder interface {
+	// Embed returns one vector per input text, in the same order.
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+	// Model identifies the embedding model. Vectors from different models are not
+	// comparable, so it is stored alongside persisted embeddings.
+	Model() string
+}
+
+// Cosine returns the cosine similarity of two vectors, or 0 if either is all zeros
+// or their lengths differ.
+func Cosine(a, b []float32) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+// Normalize returns a unit-length copy of v, so that cosine similarity reduces to a dot product.
+func Normalize(v []float32) []float32 {
+	var norm float64
+	for _, x := range v {
+		norm += float64(x) * float64(x)
+	}
+	out := make([]float32, len(v))
+	if norm == 0 {
+		return out
+	}
+	norm = math.Sqrt(norm)
+	for i, x := range v {
+		out[i] = float32(float64(x) / norm)
+	}
+	return out
+}
+
+// dot is the inner product of two equal-length vectors.
+func dot(a, b []float32) float64 {
+	var sum float64
+	for i := range a {
+		sum += float64(a[i]) * float64(b[i])
+	}
+	return sum
+}
+
+// embeddingText is the text embedded for a document; the title is included so that
+// short queries matching a title land close to the document.
+func embeddingText(doc Document) string {
+	return doc.Title + "\n" + doc.Text
+}
@@ -0,0 +1,46 @@
+package retrieval
+
+import (
+	"math"
+	"testing"
+)
+
+// TestCosine tests cosine similarity on simple vectors and degenerate inputs.
+func TestCosine(t *testing.T) {
+	tests := []struct {
+		name     string
+		a, b     []float32
+		expected float64
+	}{
+		{"Identical", []float32{1, 2, 3}, []float32{1, 2, 3}, 1},
+		{"Scaled", []float32{1, 2, 3}, []float32{2, 4, 6}, 1},
+		{"Orthogonal", []float32{1, 0}, []float32{0, 1}, 0},
+		{"Opposite", []float32{1, 1}, []float32{-1, -1}, -1},
+		{"Zero vector", []float32{0, 0}, []float32{1, 1}, 0},
+		{"Length mismatch", []float32{1, 2}, []float32{1, 2, 3}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Cosine(tt.a, tt.b); math.Abs(got-tt.expected) > 1e-6 {
+				t.Errorf("Cosine(%v, %v) = %f, want %f", tt.a, tt.b, got, tt.expected)
+			}
+		})
+	}
+}
+
+// TestNormalize tests that Normalize returns a unit vector without modifying its input.
+func TestNormalize(t *testing.T) {
+	input := []float32{3, 4}
+	got := Normalize(input)
+
+	if math.Abs(float64(got[0])-0.6) > 1e-6 || math.Abs(float64(got[1])-0.8) > 1e-6 {
+		t.Errorf("Normalize(%v) = %v, want [0.6 0.8]", input, got)
+	}
+	if input[0] != 3 {
+		t.Error("Normalize modified its input")
+	}
+	if zero := Normalize([]float32{0, 0}); zero[0] != 0 || zero[1] != 0 {
+		t.Errorf("Normalize of zero vector should stay zero, got %v", zero)
+	}
+}
@@ -0,0 +1,114 @@
+package retrieval
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+)
+
+// StoredEmbedding is a persisted vector together with the hash of the text it was computed from.
+type StoredEmbedding struct {
+	ContentHash string
+	Vector      []float32
+}
+
+// EmbeddingStore persists document embeddings in the "embeddings" table created by database.InitDB.
+type EmbeddingStore struct {
+	db *sql.DB
+}
+
+// NewEmbeddingStore creates an EmbeddingStore on top of an already initialized database.
+func NewEmbeddingStore(db *sql.DB) *EmbeddingStore {
+	return &EmbeddingStore{db: db}
+}
+
+// Load returns every stored embedding for the given model, keyed by document ID.
+func (s *EmbeddingStore) Load(model string) (map[string]StoredEmbedding, error) {
+	rows, err := s.db.Query("SELECT document_id, content_hash, vector FROM embeddings WHERE model = ?", model)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	embeddings := make(map[string]StoredEmbedding)
+	for rows.Next() {
+		var id, hash string
+		var blob []byte
+		if err := rows.Scan(&id, &hash, &blob); err != nil {
+			return nil, err
+		}
+		vec, err := DecodeVector(blob)
+		if err != nil {
+			return nil, fmt.Errorf("embedding for %s: %w", id, err)
+		}
+		embeddings[id] = StoredEmbedding{ContentHash: hash, Vector: vec}
+	}
+	return embeddings, rows.Err()
+}
+
+// Get returns the stored embedding of one document for the given model.
+func (s *EmbeddingStore) Get(documentID, model string) (StoredEmbedding, bool, error) {
+	var hash string
+	var blob []byte
+	err := s.db.QueryRow("SELECT content_hash, vector FROM embeddings WHERE document_id = ? AND model = ?",
+		documentID, model).Scan(&hash, &blob)
+	if err == sql.ErrNoRows {
+		return StoredEmbedding{}, false, nil
+	}
+	if err != nil {
+		return StoredEmbedding{}, false, err
+	}
+	vec, err := DecodeVector(blob)
+	if err != nil {
+		return StoredEmbedding{}, false, fmt.Errorf("embedding for %s: %w", documentID, err)
+	}
+	return StoredEmbedding{ContentHash: hash, Vector: vec}, true, nil
+}
+
+// Save inserts or replaces the embedding of a document for the given model.
+func (s *EmbeddingStore) Save(documentID, model, contentHash string, vec []float32) error {
+	_, err := s.db.Exec(`
+    INSERT INTO embeddings(document_id, model, content_hash, vector) VALUES(?, ?, ?, ?)
+    ON CONFLICT(document_id, model) DO UPDATE SET
+        content_hash = excluded.content_hash,
+        vector = excluded.vector,
+        updated_at = CURRENT_TIMESTAMP`,
+		documentID, model, contentHash, EncodeVector(vec))
+	return err
+}
+
+// Delete removes the embeddings of a document for every model.
+func (s *EmbeddingStore) Delete(documentID string) error {
+	_, err := s.db.Exec("DELETE FROM embeddings WHERE document_id = ?", documentID)
+	return err
+}
+
+// contentHash fingerprints the text a document's embedding is computed from.
+func contentHash(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:])
+}
+
+// EncodeVector packs a vector as little-endian float32s, for storing it as a BLOB.
+func EncodeVector(vec []float32) []byte {
+	buf := make([]byte, 4*len(vec))
+	for i, x := range vec {
+		binary.LittleEndian.PutUint32(buf[4*i:], math.Float32bits(x))
+	}
+	return buf
+}
+
+// DecodeVector unpacks a vector packed by EncodeVector.
+func DecodeVector(buf []byte) ([]float32, error) {
+	if len(buf)%4 != 0 {
+		return nil, fmt.Errorf("invalid vector blob length %d", len(buf))
+	}
+	vec := make([]float32, len(buf)/4)
+	for i := range vec {
+		vec[i] = math.Float32frombits(binary.LittleEndian.Uint32(buf[4*i:]))
+	}
+	return vec, nil
+}
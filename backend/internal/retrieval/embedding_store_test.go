@@ -0,0 +1,58 @@
+package retrieval
+
+import (
+	"ai-knowledge-base/internal/database"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// TestEmbeddingStore tests saving, replacing, loading and deleting embeddings.
+func TestEmbeddingStore(t *testing.T) {
+	tempFile := "test_embedding_store.sqlite"
+	defer os.Remove(tempFile)
+
+	db := database.InitDB(tempFile)
+	defer db.Close()
+	store := NewEmbeddingStore(db)
+
+	if err := store.Save("kb-001", "model-a", "hash-1", []float32{0.5, -1.25, 3}); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if err := store.Save("kb-001", "model-b", "hash-1", []float32{1}); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if err := store.Save("kb-001", "model-a", "hash-2", []float32{1, 2, 3}); err != nil {
+		t.Fatalf("Save (replace) failed: %v", err)
+	}
+
+	loaded, err := store.Load("model-a")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	want := map[string]StoredEmbedding{"kb-001": {ContentHash: "hash-2", Vector: []float32{1, 2, 3}}}
+	if !reflect.DeepEqual(loaded, want) {
+		t.Errorf("Load returned %v, want %v", loaded, want)
+	}
+
+	if err := store.Delete("kb-001"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	for _, model := range []string{"model-a", "model-b"} {
+		if loaded, _ := store.Load(model); len(loaded) != 0 {
+			t.Errorf("Expected no %s embeddings after delete, got %v", model, loaded)
+		}
+	}
+}
+
+// TestVectorEncoding tests that vectors round-trip through their blob encoding.
+func TestVectorEncoding(t *testing.T) {
+	vec := []float32{0, 1.5, -2.25, 3.4028235e38}
+	decoded, err := DecodeVector(EncodeVector(vec))
+	if err != nil || !reflect.DeepEqual(decoded, vec) {
+		t.Errorf("Round trip gave %v (%v), want %v", decoded, err, vec)
+	}
+	if _, err := DecodeVector([]byte{1, 2, 3}); err == nil {
+		t.Error("Expected error for truncated blob")
+	}
+}
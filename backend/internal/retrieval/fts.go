@@ -0,0 +1,158 @@
+package retrieval
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Highlight markers wrapped around matched terms in FTS snippets.
+const (
+	HighlightStart = "<mark>"
+	HighlightEnd   = "</mark>"
+)
+
+// FTSRetriever ranks articles with SQLite's FTS5 bm25() over the articles_fts index
+// created by database.InitDB. Unlike BM25Index, nothing is held in memory.
+type FTSRetriever struct {
+	db *sql.DB
+	// TitleWeight is the bm25() column weight of the title relative to the content.
+	TitleWeight float64
+	// SnippetTokens is the approximate length of each snippet, in tokens.
+	SnippetTokens int
+}
+
+// NewFTSRetriever creates an FTSRetriever with the same title boost as BM25Index.
+func NewFTSRetriever(db *sql.DB) *FTSRetriever {
+	return &FTSRetriever{db: db, TitleWeight: DefaultTitleBoost, SnippetTokens: 16}
+}
+
+// Retrieve implements Retriever. Scores are the negated bm25() values, so that,
+// as with every other retriever, a higher score means more relevant.
+func (f *FTSRetriever) Retrieve(ctx context.Context, query string, k int) ([]Hit, error) {
+	match := matchExpression(query)
+	if match == "" || k <= 0 {
+		return nil, nil
+	}
+
+	rows, err := f.db.QueryContext(ctx, `
+    SELECT a.id, -bm25(articles_fts, ?, 1.0) AS score,
+           snippet(articles_fts, 1, ?, ?, '…', ?)
+    FROM articles_fts
+    JOIN articles a ON a.rowid = articles_fts.rowid
+    WHERE articles_fts MATCH ?
+    ORDER BY score DESC, a.id
+    LIMIT ?`,
+		f.TitleWeight, HighlightStart, HighlightEnd, f.SnippetTokens, match, k)
+	if err != nil {
+		return nil, fmt.Errorf("full-text query failed: %w", err)
+	}
+	defer rows.Close()
+
+	hits := []Hit{}
+	for rows.Next() {
+		var hit Hit
+		if err := rows.Scan(&hit.ID, &hit.Score, &hit.Snippet); err != nil {
+			return nil, err
+		}
+		hits = append(hits, hit)
+	}
+	return hits, rows.Err()
+}
+
+// FTSPassageIndex ranks documents, typically article passages, with SQLite's FTS5
+// bm25() over the passages_fts index created by database.InitDB. Unlike
+// FTSRetriever, whose index follows the articles table through triggers, it is fed
+// documents as a DocumentIndex, usually by an ArticleSync, so that its hits carry the
+// same chunk IDs as the other retrievers'.
+type FTSPassageIndex struct {
+	db *sql.DB
+	// TitleWeight is the bm25() column weight of the title relative to the content.
+	TitleWeight float64
+	// SnippetTokens is the approximate length of each snippet, in tokens.
+	SnippetTokens int
+}
+
+// NewFTSPassageIndex creates an FTSPassageIndex with the same title boost as BM25Index.
+func NewFTSPassageIndex(db *sql.DB) *FTSPassageIndex {
+	return &FTSPassageIndex{db: db, TitleWeight: DefaultTitleBoost, SnippetTokens: 16}
+}
+
+// Clear drops every document, so that passages of a previous run, such as those of an
+// article chunked differently, do not linger once the current ones are loaded.
+func (f *FTSPassageIndex) Clear() error {
+	_, err := f.db.Exec("DELETE FROM passages_fts")
+	return err
+}
+
+// AddDocuments implements DocumentIndex.
+func (f *FTSPassageIndex) AddDocuments(ctx context.Context, docs []Document) error {
+	tx, err := f.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, doc := range docs {
+		if _, err := tx.Exec("DELETE FROM passages_fts WHERE id = ?", doc.ID); err != nil {
+			return err
+		}
+		if _, err := tx.Exec("INSERT INTO passages_fts(id, title, content) VALUES(?, ?, ?)", doc.ID, doc.Title, doc.Text); err != nil {
+			return fmt.Errorf("failed to index %s: %w", doc.ID, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// RemoveDocuments implements DocumentIndex. Failures are logged.
+func (f *FTSPassageIndex) RemoveDocuments(ids []string) {
+	for _, id := range ids {
+		if _, err := f.db.Exec("DELETE FROM passages_fts WHERE id = ?", id); err != nil {
+			log.Printf("Failed to remove %s from the full-text index: %v", id, err)
+		}
+	}
+}
+
+// Retrieve implements Retriever, scoring as FTSRetriever does.
+func (f *FTSPassageIndex) Retrieve(ctx context.Context, query string, k int) ([]Hit, error) {
+	match := matchExpression(query)
+	if match == "" || k <= 0 {
+		return nil, nil
+	}
+
+	rows, err := f.db.QueryContext(ctx, `
+    SELECT id, -bm25(passages_fts, 0.0, ?, 1.0) AS score,
+           snippet(passages_fts, 2, ?, ?, '…', ?)
+    FROM passages_fts
+    WHERE passages_fts MATCH ?
+    ORDER BY score DESC, id
+    LIMIT ?`,
+		f.TitleWeight, HighlightStart, HighlightEnd, f.SnippetTokens, match, k)
+	if err != nil {
+		return nil, fmt.Errorf("full-text query failed: %w", err)
+	}
+	defer rows.Close()
+
+	hits := []Hit{}
+	for rows.Next() {
+		var hit Hit
+		if err := rows.Scan(&hit.ID, &hit.Score, &hit.Snippet); err != nil {
+			return nil, err
+		}
+		hits = append(hits, hit)
+	}
+	return hits, rows.Err()
+}
+
+// matchExpression turns free text into an FTS5 MATCH expression that ORs the query
+// terms together. Every term is quoted, so user input can never be parsed as FTS5
+// query syntax (NEAR, column filters, etc.).
+func matchExpression(query string) string {
+	terms := Terms(query)
+	quoted := make([]string, len(terms))
+	for i, term := range terms {
+		quoted[i] = `"` + strings.ReplaceAll(term, `"`, `""`) + `"`
+	}
+	return strings.Join(quoted, " OR ")
+}
@@ -0,0 +1,165 @@
+package retrieval
+
+import (
+	"ai-knowledge-base/internal/database"
+	"ai-knowledge-base/internal/kb"
+	"context"
+	"database/sql"
+	"os"
+	"strings"
+	"testing"
+)
+
+// openFTSDB initializes a seeded test database, skipping the test if the binary
+// was built without FTS5 (go test -tags sqlite_fts5 enables it).
+func openFTSDB(t *testing.T, file string) (*sql.DB, kb.Store) {
+	t.Helper()
+	db := database.InitDB(file)
+	t.Cleanup(func() {
+		db.Close()
+		os.Remove(file)
+	})
+	if !database.HasFullTextSearch(db) {
+		t.Skip("FTS5 not available; run with -tags sqlite_fts5")
+	}
+
+	store := kb.NewSQLiteStore(db)
+	if err := kb.Seed(store, kb.GetArticles()); err != nil {
+		t.Fatalf("Seed failed: %v", err)
+	}
+	return db, store
+}
+
+// TestMatchExpression tests that free text is turned into a safe OR of quoted terms.
+func TestMatchExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"reset password", `"reset" OR "password"`},
+		{"How do I connect?", `"connect"`},
+		{`title:vpn NEAR("a" b)`, `"title" OR "vpn" OR "near" OR "b"`},
+		{"the of", ""},
+	}
+
+	for _, tt := range tests {
+		if got := matchExpression(tt.input); got != tt.expected {
+			t.Errorf("matchExpression(%q) = %q, want %q", tt.input, got, tt.expected)
+		}
+	}
+}
+
+// TestFTSRetrieve tests bm25() ranking and snippet() highlighting.
+func TestFTSRetrieve(t *testing.T) {
+	db, _ := openFTSDB(t, "test_fts_retrieve.sqlite")
+	retriever := NewFTSRetriever(db)
+
+	hits, err := retriever.Retrieve(context.Background(), "how do I reset my password?", 3)
+	if err != nil {
+		t.Fatalf("Retrieve failed: %v", err)
+	}
+	if len(hits) == 0 || hits[0].ID != "kb-001" {
+		t.Fatalf("Expected kb-001 as top hit, got %v", hits)
+	}
+	if hits[0].Score <= 0 {
+		t.Errorf("Expected positive score, got %f", hits[0].Score)
+	}
+	if !strings.Contains(hits[0].Snippet, HighlightStart) {
+		t.Errorf("Expected highlighted snippet, got %q", hits[0].Snippet)
+	}
+
+	// Porter stemming in FTS5 matches inflected forms.
+	hits, _ = retriever.Retrieve(context.Background(), "printers", 3)
+	if len(hits) == 0 || hits[0].ID != "kb-003" {
+		t.Errorf("Expected kb-003 for 'printers', got %v", hits)
+	}
+
+	hits, _ = retriever.Retrieve(context.Background(), "the of", 3)
+	if len(hits) != 0 {
+		t.Errorf("Expected no hits for stopword-only query, got %v", hits)
+	}
+}
+
+// TestFTSFollowsWrites tests that the triggers keep the index in sync with article writes.
+func TestFTSFollowsWrites(t *testing.T) {
+	db, store := openFTSDB(t, "test_fts_writes.sqlite")
+	retriever := NewFTSRetriever(db)
+	ctx := context.Background()
+
+	store.Create(kb.Article{ID: "kb-004", Title: "Mobile email", Content: "Install the mail app on your phone."})
+	hits, _ := retriever.Retrieve(ctx, "phone", 5)
+	if len(hits) != 1 || hits[0].ID != "kb-004" {
+		t.Fatalf("Expected inserted article to be indexed, got %v", hits)
+	}
+
+	store.Update(kb.Article{ID: "kb-004", Title: "Mobile email", Content: "Install the mail app on your tablet."})
+	if hits, _ := retriever.Retrieve(ctx, "phone", 5); len(hits) != 0 {
+		t.Errorf("Expected old content to be gone after update, got %v", hits)
+	}
+	if hits, _ := retriever.Retrieve(ctx, "tablet", 5); len(hits) != 1 {
+		t.Errorf("Expected new content to be indexed after update, got %v", hits)
+	}
+
+	store.Delete("kb-004")
+	if hits, _ := retriever.Retrieve(ctx, "tablet", 5); len(hits) != 0 {
+		t.Errorf("Expected deleted article to be gone, got %v", hits)
+	}
+}
+
+// TestFTSPassageIndex tests indexing, replacing and removing passages.
+func TestFTSPassageIndex(t *testing.T) {
+	db, _ := openFTSDB(t, "test_fts_passages.sqlite")
+	index := NewFTSPassageIndex(db)
+	ctx := context.Background()
+
+	syncer := NewArticleSync(index, Chunked(kb.NewChunker(200, 40)))
+	if err := syncer.Load(ctx, kb.GetArticles()); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	hits, err := index.Retrieve(ctx, "how do I reset my password?", 3)
+	if err != nil {
+		t.Fatalf("Retrieve failed: %v", err)
+	}
+	if len(hits) == 0 || hits[0].ID != "kb-001#0" || hits[0].Score <= 0 || !strings.Contains(hits[0].Snippet, HighlightStart) {
+		t.Fatalf("Expected passage kb-001#0 as top hit, got %v", hits)
+	}
+
+	syncer.ArticleSaved(kb.Article{ID: "kb-001", Title: "Account recovery", Content: "Call the helpdesk."})
+	if hits, _ := index.Retrieve(ctx, "forgot password link", 5); len(hits) != 0 {
+		t.Errorf("Expected the old passage to be replaced, got %v", hits)
+	}
+	syncer.ArticleDeleted("kb-001")
+	if hits, _ := index.Retrieve(ctx, "helpdesk", 5); len(hits) != 0 {
+		t.Errorf("Expected the deleted article's passages to be gone, got %v", hits)
+	}
+
+	if err := index.Clear(); err != nil {
+		t.Fatalf("Clear failed: %v", err)
+	}
+	if hits, _ := index.Retrieve(ctx, "vpn", 5); len(hits) != 0 {
+		t.Errorf("Expected no passages after Clear, got %v", hits)
+	}
+}
+
+// TestHybridOverChunkedFTS tests that FTS and vector hits over the same passages are
+// fused, rather than ranked apart under article and chunk IDs.
+func TestHybridOverChunkedFTS(t *testing.T) {
+	db, _ := openFTSDB(t, "test_fts_hybrid.sqlite")
+	split := Chunked(kb.NewChunker(200, 40))
+	lexical := NewFTSPassageIndex(db)
+	NewArticleSync(lexical, split).Load(context.Background(), kb.GetArticles())
+	vector := NewVectorRetriever(NewHashEmbedder(256), NewBruteForceIndex(), nil)
+	NewArticleSync(vector, split).Load(context.Background(), kb.GetArticles())
+
+	hybrid := NewHybridRetriever(
+		Stage{Name: "lexical", Retriever: lexical, Weight: 1},
+		Stage{Name: "vector", Retriever: vector, Weight: 1},
+	)
+	hits := mustRetrieve(t, hybrid, "VPN keeps disconnecting", 3)
+	if len(hits) == 0 || hits[0].ID != "kb-002#0" {
+		t.Fatalf("Expected passage kb-002#0 first, got %v", hits)
+	}
+	if hits[0].Ranks["lexical"] != 1 || hits[0].Ranks["vector"] != 1 {
+		t.Errorf("Expected kb-002#0 to be ranked first by both stages, got %v", hits[0].Ranks)
+	}
+}
@@ -0,0 +1,62 @@
+package retrieval
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math"
+)
+
+// HashEmbedder is a deterministic, offline Embedder based on the hashing trick:
+// stemmed words and their character trigrams are hashed into a fixed number of signed
+// buckets with sublinear term-frequency weighting. It needs no model or network, which
+// makes it suitable for tests and development; it captures lexical and sub-word
+// similarity ("connect" vs "connection") but not true synonyms.
+type HashEmbedder struct {
+	Dims int
+}
+
+// NewHashEmbedder creates a HashEmbedder producing vectors of the given size.
+func NewHashEmbedder(dims int) *HashEmbedder {
+	return &HashEmbedder{Dims: dims}
+}
+
+// Model implements Embedder.
+func (h *HashEmbedder) Model() string {
+	return fmt.Sprintf("hash-%d", h.Dims)
+}
+
+// Embed implements Embedder.
+func (h *HashEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		vectors[i] = h.embed(text)
+	}
+	return vectors, nil
+}
+
+func (h *HashEmbedder) embed(text string) []float32 {
+	features := make(map[string]float64)
+	for _, token := range Tokenize(text) {
+		features["w:"+token]++
+		padded := "^" + token + "$"
+		for i := 0; i+3 <= len(padded); i++ {
+			features["t:"+padded[i:i+3]] += 0.5
+		}
+	}
+
+	vec := make([]float32, h.Dims)
+	for feature, tf := range features {
+		hasher := fnv.New64a()
+		hasher.Write([]byte(feature))
+		sum := hasher.Sum64()
+		bucket := int(sum % uint64(h.Dims))
+		// A second hash bit picks the sign, so collisions cancel out on average.
+		sign := 1.0
+		if sum>>63 == 1 {
+			sign = -1.0
+		}
+		vec[bucket] += float32(sign * (1 + math.Log(tf+1)))
+	}
+	return Normalize(vec)
+}
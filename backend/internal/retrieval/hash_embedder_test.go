@@ -0,0 +1,55 @@
+package retrieval
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+// TestHashEmbedderDeterministic tests that the same text always yields the same unit vector.
+func TestHashEmbedderDeterministic(t *testing.T) {
+	embedder := NewHashEmbedder(128)
+
+	first, err := embedder.Embed(context.Background(), []string{"VPN connection issues"})
+	if err != nil {
+		t.Fatalf("Embed failed: %v", err)
+	}
+	second, _ := NewHashEmbedder(128).Embed(context.Background(), []string{"VPN connection issues"})
+
+	if !reflect.DeepEqual(first, second) {
+		t.Error("Expected identical vectors for identical text")
+	}
+	if len(first[0]) != 128 {
+		t.Errorf("Expected 128 dimensions, got %d", len(first[0]))
+	}
+	if norm := Cosine(first[0], first[0]); norm < 0.999 {
+		t.Errorf("Expected a non-zero vector, got self-similarity %f", norm)
+	}
+	if embedder.Model() != "hash-128" {
+		t.Errorf("Unexpected model name %s", embedder.Model())
+	}
+}
+
+// TestHashEmbedderSimilarity tests that related texts are closer than unrelated ones.
+func TestHashEmbedderSimilarity(t *testing.T) {
+	embedder := NewHashEmbedder(256)
+	vectors, _ := embedder.Embed(context.Background(), []string{
+		"cannot connect to the VPN",
+		"VPN connection problems",
+		"set up a new printer",
+	})
+
+	related := Cosine(vectors[0], vectors[1])
+	unrelated := Cosine(vectors[0], vectors[2])
+	if related <= unrelated {
+		t.Errorf("Expected related texts to be more similar: related=%f unrelated=%f", related, unrelated)
+	}
+}
+
+// TestHashEmbedderNegation tests that a negation moves the embedding of a question.
+func TestHashEmbedderNegation(t *testing.T) {
+	vectors, _ := NewHashEmbedder(256).Embed(context.Background(), []string{"why can i connect to the vpn", "why can i not connect to the vpn"})
+	if similarity := Cosine(vectors[0], vectors[1]); similarity >= 0.9 {
+		t.Errorf("Expected the negated question to be less than 0.9 similar, got %.3f", similarity)
+	}
+}
@@ -0,0 +1,79 @@
+package retrieval
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+var highlightWordPattern = regexp.MustCompile(`[\p{L}\p{N}]+`)
+
+// Highlight returns an excerpt of about maxWords words of text, positioned to cover as
+// many query terms as possible, with each matching word wrapped in HighlightStart and
+// HighlightEnd. Words match when they tokenize to the same stem, so the markup is
+// consistent with how BM25Index scored the text. It produces the same kind of snippet
+// FTSRetriever gets from SQLite, for retrievers that have none.
+func Highlight(text, query string, maxWords int) string {
+	terms := make(map[string]bool)
+	for _, term := range Tokenize(query) {
+		terms[term] = true
+	}
+
+	words := highlightWordPattern.FindAllStringIndex(text, -1)
+	if len(words) == 0 || maxWords <= 0 {
+		return ""
+	}
+	matched := make([]bool, len(words))
+	for i, w := range words {
+		if tokens := Tokenize(text[w[0]:w[1]]); len(tokens) == 1 && terms[tokens[0]] {
+			matched[i] = true
+		}
+	}
+
+	// Slide a maxWords window over the text and keep the first one with the most matches.
+	size := min(maxWords, len(words))
+	count := 0
+	for i := 0; i < size; i++ {
+		if matched[i] {
+			count++
+		}
+	}
+	first, best := 0, count
+	for i := size; i < len(words); i++ {
+		if matched[i] {
+			count++
+		}
+		if matched[i-size] {
+			count--
+		}
+		if count > best {
+			first, best = i-size+1, count
+		}
+	}
+	last := first + size - 1
+
+	var b strings.Builder
+	if first > 0 {
+		b.WriteString("…")
+	}
+	pos := words[first][0]
+	for i := first; i <= last; i++ {
+		if !matched[i] {
+			continue
+		}
+		b.WriteString(text[pos:words[i][0]])
+		b.WriteString(HighlightStart)
+		b.WriteString(text[words[i][0]:words[i][1]])
+		b.WriteString(HighlightEnd)
+		pos = words[i][1]
+	}
+	end := words[last][1]
+	if last == len(words)-1 {
+		end = len(strings.TrimRightFunc(text, unicode.IsSpace))
+	}
+	b.WriteString(text[pos:max(pos, end)])
+	if last < len(words)-1 {
+		b.WriteString("…")
+	}
+	return b.String()
+}
@@ -0,0 +1,51 @@
+package retrieval
+
+import "testing"
+
+// TestHighlight tests marking stemmed query terms and windowing around the best match.
+func TestHighlight(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		query    string
+		maxWords int
+		want     string
+	}{
+		{
+			name:     "Whole text",
+			text:     "Reset your password from the login page.",
+			query:    "reset passwords",
+			maxWords: 20,
+			want:     "<mark>Reset</mark> your <mark>password</mark> from the login page.",
+		},
+		{
+			name:     "Window around matches",
+			text:     "one two three four VPN client five six seven",
+			query:    "vpn clients",
+			maxWords: 3,
+			want:     "…four <mark>VPN</mark> <mark>client</mark>…",
+		},
+		{
+			name:     "No match keeps the start",
+			text:     "alpha beta gamma delta",
+			query:    "printer",
+			maxWords: 2,
+			want:     "alpha beta…",
+		},
+		{
+			name:     "Stopwords are not marked",
+			text:     "How to add a printer",
+			query:    "how to add printer",
+			maxWords: 10,
+			want:     "How to <mark>add</mark> a <mark>printer</mark>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Highlight(tt.text, tt.query, tt.maxWords); got != tt.want {
+				t.Errorf("Highlight() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,298 @@
+package retrieval
+
+import (
+	"container/heap"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+)
+
+// Default HNSW parameters. M is the number of links per node on the upper layers
+// (twice that on layer 0); EfConstruction and EfSearch are the candidate-list sizes
+// used while inserting and searching. Larger values trade speed for recall.
+const (
+	DefaultHNSWM              = 16
+	DefaultHNSWEfConstruction = 200
+	DefaultHNSWEfSearch       = 64
+)
+
+// HNSWIndex is an approximate VectorIndex based on Hierarchical Navigable Small World
+// graphs (Malkov & Yashunin, 2016). Searches are sub-linear in the number of vectors,
+// at the cost of occasionally missing a true nearest neighbour.
+//
+// Deleted and replaced vectors are tombstoned rather than unlinked; the graph is
+// rebuilt from the live vectors once tombstones outnumber them.
+type HNSWIndex struct {
+	M              int
+	EfConstruction int
+	EfSearch       int
+
+	mu       sync.RWMutex
+	nodes    map[string]*hnswNode // live nodes only
+	entry    *hnswNode
+	maxLevel int
+	deleted  int
+	rng      *rand.Rand
+}
+
+type hnswNode struct {
+	id        string
+	vec       []float32
+	neighbors [][]*hnswNode // one adjacency list per layer, 0..level
+	deleted   bool
+}
+
+type scoredNode struct {
+	node *hnswNode
+	sim  float64
+}
+
+// NewHNSWIndex creates an empty HNSWIndex with the default parameters. Level
+// assignment uses a fixed seed, so the same insertions always build the same graph.
+func NewHNSWIndex() *HNSWIndex {
+	return &HNSWIndex{
+		M:              DefaultHNSWM,
+		EfConstruction: DefaultHNSWEfConstruction,
+		EfSearch:       DefaultHNSWEfSearch,
+		nodes:          make(map[string]*hnswNode),
+		rng:            rand.New(rand.NewSource(1)),
+	}
+}
+
+// Add implements VectorIndex.
+func (h *HNSWIndex) Add(id string, vec []float32) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.tombstoneLocked(id)
+	h.insertLocked(&hnswNode{id: id, vec: Normalize(vec)})
+	h.maybeCompactLocked()
+}
+
+// Remove implements VectorIndex.
+func (h *HNSWIndex) Remove(id string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.tombstoneLocked(id)
+	h.maybeCompactLocked()
+}
+
+// Len implements VectorIndex.
+func (h *HNSWIndex) Len() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.nodes)
+}
+
+// Search implements VectorIndex.
+func (h *HNSWIndex) Search(vec []float32, k int) []Hit {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if h.entry == nil || k <= 0 || len(vec) != len(h.entry.vec) {
+		return nil
+	}
+	query := Normalize(vec)
+
+	ep := h.entry
+	for level := h.maxLevel; level > 0; level-- {
+		ep = h.greedyClosest(query, ep, level)
+	}
+	candidates := h.searchLayer(query, ep, max(h.EfSearch, k), 0)
+
+	scores := make(map[string]float64, len(candidates))
+	for _, c := range candidates {
+		if !c.node.deleted {
+			scores[c.node.id] = c.sim
+		}
+	}
+	return topHits(scores, k)
+}
+
+func (h *HNSWIndex) tombstoneLocked(id string) {
+	if node, ok := h.nodes[id]; ok {
+		node.deleted = true
+		delete(h.nodes, id)
+		h.deleted++
+	}
+}
+
+func (h *HNSWIndex) maybeCompactLocked() {
+	if h.deleted == 0 || h.deleted <= len(h.nodes) {
+		return
+	}
+	live := make([]*hnswNode, 0, len(h.nodes))
+	for _, node := range h.nodes {
+		live = append(live, node)
+	}
+	// Reinsert in a fixed order so rebuilding is deterministic.
+	sort.Slice(live, func(i, j int) bool { return live[i].id < live[j].id })
+
+	h.nodes = make(map[string]*hnswNode, len(live))
+	h.entry = nil
+	h.maxLevel = 0
+	h.deleted = 0
+	for _, node := range live {
+		h.insertLocked(&hnswNode{id: node.id, vec: node.vec})
+	}
+}
+
+func (h *HNSWIndex) maxConnections(level int) int {
+	if level == 0 {
+		return 2 * h.M
+	}
+	return h.M
+}
+
+func (h *HNSWIndex) randomLevel() int {
+	mult := 1 / math.Log(float64(h.M))
+	return int(math.Floor(-math.Log(1-h.rng.Float64()) * mult))
+}
+
+func (h *HNSWIndex) insertLocked(node *hnswNode) {
+	level := h.randomLevel()
+	node.neighbors = make([][]*hnswNode, level+1)
+	h.nodes[node.id] = node
+
+	if h.entry == nil {
+		h.entry = node
+		h.maxLevel = level
+		return
+	}
+
+	ep := h.entry
+	for l := h.maxLevel; l > level; l-- {
+		ep = h.greedyClosest(node.vec, ep, l)
+	}
+
+	for l := min(level, h.maxLevel); l >= 0; l-- {
+		candidates := h.searchLayer(node.vec, ep, h.EfConstruction, l)
+		ep = candidates[0].node
+
+		neighbors := h.selectNeighbors(candidates)
+		node.neighbors[l] = neighbors
+
+		for _, nb := range neighbors {
+			nb.neighbors[l] = append(nb.neighbors[l], node)
+			if len(nb.neighbors[l]) > h.maxConnections(l) {
+				h.shrink(nb, l)
+			}
+		}
+	}
+
+	if level > h.maxLevel {
+		h.entry = node
+		h.maxLevel = level
+	}
+}
+
+// selectNeighbors picks up to M of the candidates (sorted most similar first) to link a
+// new node to. Live nodes are preferred; tombstones only fill remaining slots, which
+// keeps a node reachable even when everything near it has been deleted.
+func (h *HNSWIndex) selectNeighbors(candidates []scoredNode) []*hnswNode {
+	neighbors := make([]*hnswNode, 0, h.M)
+	for _, c := range candidates {
+		if len(neighbors) < h.M && !c.node.deleted {
+			neighbors = append(neighbors, c.node)
+		}
+	}
+	for _, c := range candidates {
+		if len(neighbors) < h.M && c.node.deleted {
+			neighbors = append(neighbors, c.node)
+		}
+	}
+	return neighbors
+}
+
+// shrink keeps only the closest maxConnections neighbours of node on the given layer,
+// preferring live nodes over tombstones.
+func (h *HNSWIndex) shrink(node *hnswNode, level int) {
+	links := node.neighbors[level]
+	sort.Slice(links, func(i, j int) bool {
+		if links[i].deleted != links[j].deleted {
+			return !links[i].deleted
+		}
+		return dot(node.vec, links[i].vec) > dot(node.vec, links[j].vec)
+	})
+	node.neighbors[level] = links[:h.maxConnections(level)]
+}
+
+// greedyClosest walks from ep towards the query on one layer until no neighbour is closer.
+func (h *HNSWIndex) greedyClosest(query []float32, ep *hnswNode, level int) *hnswNode {
+	current := ep
+	best := dot(query, current.vec)
+	for changed := true; changed; {
+		changed = false
+		for _, nb := range current.neighbors[level] {
+			if sim := dot(query, nb.vec); sim > best {
+				current, best, changed = nb, sim, true
+			}
+		}
+	}
+	return current
+}
+
+// searchLayer is the beam search of the HNSW paper: it returns up to ef nodes closest
+// to the query on the given layer, most similar first. Tombstoned nodes are traversed
+// (they keep the graph connected) and left for the caller to filter.
+func (h *HNSWIndex) searchLayer(query []float32, ep *hnswNode, ef int, level int) []scoredNode {
+	start := scoredNode{node: ep, sim: dot(query, ep.vec)}
+	visited := map[*hnswNode]bool{ep: true}
+	candidates := &maxSimHeap{start}
+	results := &minSimHeap{start}
+
+	for candidates.Len() > 0 {
+		c := heap.Pop(candidates).(scoredNode)
+		if results.Len() >= ef && c.sim < (*results)[0].sim {
+			break
+		}
+		for _, nb := range c.node.neighbors[level] {
+			if visited[nb] {
+				continue
+			}
+			visited[nb] = true
+			sim := dot(query, nb.vec)
+			if results.Len() < ef || sim > (*results)[0].sim {
+				heap.Push(candidates, scoredNode{node: nb, sim: sim})
+				heap.Push(results, scoredNode{node: nb, sim: sim})
+				if results.Len() > ef {
+					heap.Pop(results)
+				}
+			}
+		}
+	}
+
+	out := []scoredNode(*results)
+	sort.Slice(out, func(i, j int) bool { return out[i].sim > out[j].sim })
+	return out
+}
+
+// maxSimHeap pops the most similar node first.
+type maxSimHeap []scoredNode
+
+func (s maxSimHeap) Len() int            { return len(s) }
+func (s maxSimHeap) Less(i, j int) bool  { return s[i].sim > s[j].sim }
+func (s maxSimHeap) Swap(i, j int)       { s[i], s[j] = s[j], s[i] }
+func (s *maxSimHeap) Push(x interface{}) { *s = append(*s, x.(scoredNode)) }
+func (s *maxSimHeap) Pop() interface{} {
+	old := *s
+	item := old[len(old)-1]
+	*s = old[:len(old)-1]
+	return item
+}
+
+// minSimHeap pops the least similar node first.
+type minSimHeap []scoredNode
+
+func (s minSimHeap) Len() int            { return len(s) }
+func (s minSimHeap) Less(i, j int) bool  { return s[i].sim < s[j].sim }
+func (s minSimHeap) Swap(i, j int)       { s[i], s[j] = s[j], s[i] }
+func (s *minSimHeap) Push(x interface{}) { *s = append(*s, x.(scoredNode)) }
+func (s *minSimHeap) Pop() interface{} {
+	old := *s
+	item := old[len(old)-1]
+	*s = old[:len(old)-1]
+	return item
+}
@@ -0,0 +1,117 @@
+package retrieval
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func randomVectors(n, dims int, seed int64) map[string][]float32 {
+	rng := rand.New(rand.NewSource(seed))
+	vectors := make(map[string][]float32, n)
+	for i := 0; i < n; i++ {
+		vec := make([]float32, dims)
+		for j := range vec {
+			vec[j] = float32(rng.NormFloat64())
+		}
+		vectors[fmt.Sprintf("doc-%d", i)] = vec
+	}
+	return vectors
+}
+
+// TestHNSWRecall tests that HNSW finds nearly all of the exact top-10 neighbours.
+func TestHNSWRecall(t *testing.T) {
+	vectors := randomVectors(2000, 32, 1)
+	exact := NewBruteForceIndex()
+	approx := NewHNSWIndex()
+	for id, vec := range vectors {
+		exact.Add(id, vec)
+		approx.Add(id, vec)
+	}
+
+	queries := randomVectors(50, 32, 2)
+	found, total := 0, 0
+	for _, query := range queries {
+		want := map[string]bool{}
+		for _, hit := range exact.Search(query, 10) {
+			want[hit.ID] = true
+		}
+		for _, hit := range approx.Search(query, 10) {
+			if want[hit.ID] {
+				found++
+			}
+		}
+		total += len(want)
+	}
+
+	if recall := float64(found) / float64(total); recall < 0.9 {
+		t.Errorf("Expected recall@10 >= 0.9, got %.3f", recall)
+	}
+}
+
+// TestHNSWRemoveAndReplace tests that tombstoned vectors are never returned and that
+// compaction keeps the index searchable.
+func TestHNSWRemoveAndReplace(t *testing.T) {
+	idx := NewHNSWIndex()
+	vectors := randomVectors(200, 16, 3)
+	for id, vec := range vectors {
+		idx.Add(id, vec)
+	}
+
+	target := vectors["doc-7"]
+	if hits := idx.Search(target, 1); len(hits) != 1 || hits[0].ID != "doc-7" {
+		t.Fatalf("Expected doc-7 to be its own nearest neighbour, got %v", hits)
+	}
+
+	idx.Remove("doc-7")
+	for _, hit := range idx.Search(target, 10) {
+		if hit.ID == "doc-7" {
+			t.Fatal("Removed vector returned by search")
+		}
+	}
+
+	// Replacing moves the ID to a new position.
+	idx.Add("doc-8", target)
+	if hits := idx.Search(target, 1); len(hits) != 1 || hits[0].ID != "doc-8" {
+		t.Errorf("Expected replaced doc-8 at the old doc-7 position, got %v", hits)
+	}
+
+	// Removing most vectors triggers compaction; the survivors must still be found.
+	for i := 0; i < 150; i++ {
+		idx.Remove(fmt.Sprintf("doc-%d", i))
+	}
+	if idx.Len() != 50 {
+		t.Fatalf("Expected 50 live vectors, got %d", idx.Len())
+	}
+	if hits := idx.Search(vectors["doc-180"], 1); len(hits) != 1 || hits[0].ID != "doc-180" {
+		t.Errorf("Expected doc-180 after compaction, got %v", hits)
+	}
+
+	for i := 150; i < 200; i++ {
+		idx.Remove(fmt.Sprintf("doc-%d", i))
+	}
+	if hits := idx.Search(target, 5); len(hits) != 0 {
+		t.Errorf("Expected empty index to return nothing, got %v", hits)
+	}
+	idx.Add("fresh", target)
+	if hits := idx.Search(target, 1); len(hits) != 1 || hits[0].ID != "fresh" {
+		t.Errorf("Expected vector added to an emptied index to be found, got %v", hits)
+	}
+}
+
+// BenchmarkVectorSearch compares exact and approximate search on 20k vectors.
+func BenchmarkVectorSearch(b *testing.B) {
+	vectors := randomVectors(20000, 64, 4)
+	query := randomVectors(1, 64, 5)["doc-0"]
+
+	for name, idx := range map[string]VectorIndex{"brute": NewBruteForceIndex(), "hnsw": NewHNSWIndex()} {
+		for id, vec := range vectors {
+			idx.Add(id, vec)
+		}
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				idx.Search(query, 10)
+			}
+		})
+	}
+}
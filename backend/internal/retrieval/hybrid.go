@@ -0,0 +1,102 @@
+package retrieval
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+)
+
+// DefaultRRFK is the rank offset from the original reciprocal rank fusion paper
+// (Cormack et al., 2009). It dampens the advantage of the very top ranks.
+const DefaultRRFK = 60
+
+// DefaultCandidateDepth is how many hits each stage contributes to the fusion.
+const DefaultCandidateDepth = 20
+
+// Stage is one retriever taking part in hybrid retrieval.
+type Stage struct {
+	// Name identifies the stage in Hit.Ranks, e.g. "lexical" or "vector".
+	Name      string
+	Retriever Retriever
+	// Weight scales the stage's contribution to the fused score.
+	Weight float64
+}
+
+// HybridRetriever runs several retrievers and merges their rankings with weighted
+// reciprocal rank fusion: each document scores sum(weight / (K + rank)) over the
+// stages that returned it. RRF only looks at ranks, so stages with incomparable score
+// scales (BM25 vs cosine similarity) can be combined without normalization.
+type HybridRetriever struct {
+	Stages []Stage
+	// K is the RRF rank offset.
+	K float64
+	// CandidateDepth is the minimum number of hits requested from each stage.
+	CandidateDepth int
+}
+
+// NewHybridRetriever creates a HybridRetriever with the default RRF parameters.
+func NewHybridRetriever(stages ...Stage) *HybridRetriever {
+	return &HybridRetriever{Stages: stages, K: DefaultRRFK, CandidateDepth: DefaultCandidateDepth}
+}
+
+// Retrieve implements Retriever. The stages run concurrently. A failing stage is
+// logged and skipped so that, for example, an embedding outage degrades search to
+// lexical-only; an error is returned only if every stage fails.
+func (h *HybridRetriever) Retrieve(ctx context.Context, query string, k int) ([]Hit, error) {
+	depth := max(k, h.CandidateDepth)
+	results := make([][]Hit, len(h.Stages))
+	errs := make([]error, len(h.Stages))
+
+	var wg sync.WaitGroup
+	for i, stage := range h.Stages {
+		wg.Add(1)
+		go func(i int, stage Stage) {
+			defer wg.Done()
+			results[i], errs[i] = stage.Retriever.Retrieve(ctx, query, depth)
+		}(i, stage)
+	}
+	wg.Wait()
+
+	failed := 0
+	for i, err := range errs {
+		if err != nil {
+			failed++
+			log.Printf("Hybrid retrieval stage %q failed: %v", h.Stages[i].Name, err)
+		}
+	}
+	if failed > 0 && failed == len(h.Stages) {
+		return nil, fmt.Errorf("all retrieval stages failed: %w", errors.Join(errs...))
+	}
+
+	return h.fuse(results, k), nil
+}
+
+// fuse merges per-stage rankings into a single list of at most k hits.
+func (h *HybridRetriever) fuse(results [][]Hit, k int) []Hit {
+	scores := make(map[string]float64)
+	ranks := make(map[string]map[string]int)
+	snippets := make(map[string]string)
+
+	for i, hits := range results {
+		stage := h.Stages[i]
+		for rank, hit := range hits {
+			scores[hit.ID] += stage.Weight / (h.K + float64(rank+1))
+			if ranks[hit.ID] == nil {
+				ranks[hit.ID] = make(map[string]int)
+			}
+			ranks[hit.ID][stage.Name] = rank + 1
+			if snippets[hit.ID] == "" {
+				snippets[hit.ID] = hit.Snippet
+			}
+		}
+	}
+
+	fused := topHits(scores, k)
+	for i := range fused {
+		fused[i].Ranks = ranks[fused[i].ID]
+		fused[i].Snippet = snippets[fused[i].ID]
+	}
+	return fused
+}
@@ -0,0 +1,123 @@
+package retrieval
+
+import (
+	"ai-knowledge-base/internal/kb"
+	"context"
+	"errors"
+	"testing"
+)
+
+// staticRetriever returns a fixed ranking, or a fixed error.
+type staticRetriever struct {
+	hits []Hit
+	err  error
+}
+
+func (s staticRetriever) Retrieve(ctx context.Context, query string, k int) ([]Hit, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	if len(s.hits) > k {
+		return s.hits[:k], nil
+	}
+	return s.hits, nil
+}
+
+func ids(hits []Hit) []string {
+	out := make([]string, len(hits))
+	for i, hit := range hits {
+		out[i] = hit.ID
+	}
+	return out
+}
+
+// TestHybridFusion tests that documents ranked well by both stages win, and that
+// per-stage ranks and snippets are carried through.
+func TestHybridFusion(t *testing.T) {
+	lexical := staticRetriever{hits: []Hit{{ID: "a", Snippet: "<mark>a</mark>"}, {ID: "b"}, {ID: "c"}}}
+	vector := staticRetriever{hits: []Hit{{ID: "c"}, {ID: "b"}, {ID: "d"}}}
+	hybrid := NewHybridRetriever(
+		Stage{Name: "lexical", Retriever: lexical, Weight: 1},
+		Stage{Name: "vector", Retriever: vector, Weight: 1},
+	)
+
+	hits, err := hybrid.Retrieve(context.Background(), "query", 3)
+	if err != nil {
+		t.Fatalf("Retrieve failed: %v", err)
+	}
+
+	// c: 1/63 + 1/61 = 0.03227, b: 1/62 + 1/62 = 0.03226, a: 1/61, d: 1/63
+	if got := ids(hits); len(got) != 3 || got[0] != "c" || got[1] != "b" || got[2] != "a" {
+		t.Fatalf("Unexpected fused order %v", got)
+	}
+	if hits[1].Ranks["lexical"] != 2 || hits[1].Ranks["vector"] != 2 {
+		t.Errorf("Unexpected ranks for b: %v", hits[1].Ranks)
+	}
+	if _, ok := hits[2].Ranks["vector"]; ok {
+		t.Errorf("a was not returned by the vector stage, got ranks %v", hits[2].Ranks)
+	}
+	if hits[2].Snippet != "<mark>a</mark>" {
+		t.Errorf("Expected lexical snippet to be kept, got %q", hits[2].Snippet)
+	}
+}
+
+// TestHybridWeights tests that stage weights shift the fused ranking.
+func TestHybridWeights(t *testing.T) {
+	lexical := staticRetriever{hits: []Hit{{ID: "a"}, {ID: "b"}}}
+	vector := staticRetriever{hits: []Hit{{ID: "b"}, {ID: "a"}}}
+
+	hybrid := NewHybridRetriever(
+		Stage{Name: "lexical", Retriever: lexical, Weight: 1},
+		Stage{Name: "vector", Retriever: vector, Weight: 3},
+	)
+	hits, _ := hybrid.Retrieve(context.Background(), "query", 2)
+	if hits[0].ID != "b" {
+		t.Errorf("Expected the vector-preferred document first, got %v", ids(hits))
+	}
+
+	hybrid.Stages[0].Weight, hybrid.Stages[1].Weight = 3, 1
+	hits, _ = hybrid.Retrieve(context.Background(), "query", 2)
+	if hits[0].ID != "a" {
+		t.Errorf("Expected the lexical-preferred document first, got %v", ids(hits))
+	}
+}
+
+// TestHybridStageFailure tests that one failing stage degrades rather than fails the search.
+func TestHybridStageFailure(t *testing.T) {
+	broken := staticRetriever{err: errors.New("embedding service down")}
+	working := staticRetriever{hits: []Hit{{ID: "a"}}}
+
+	hybrid := NewHybridRetriever(
+		Stage{Name: "lexical", Retriever: working, Weight: 1},
+		Stage{Name: "vector", Retriever: broken, Weight: 1},
+	)
+	hits, err := hybrid.Retrieve(context.Background(), "query", 5)
+	if err != nil || len(hits) != 1 || hits[0].ID != "a" {
+		t.Errorf("Expected lexical-only results, got %v (%v)", hits, err)
+	}
+
+	hybrid.Stages[0].Retriever = broken
+	if _, err := hybrid.Retrieve(context.Background(), "query", 5); err == nil {
+		t.Error("Expected an error when every stage fails")
+	}
+}
+
+// TestHybridOverRealRetrievers tests fusing BM25 and hash-vector retrieval over the default articles.
+func TestHybridOverRealRetrievers(t *testing.T) {
+	bm25 := NewBM25Index()
+	NewArticleSync(bm25, WholeArticle).Load(context.Background(), kb.GetArticles())
+	vector := NewVectorRetriever(NewHashEmbedder(256), NewBruteForceIndex(), nil)
+	NewArticleSync(vector, WholeArticle).Load(context.Background(), kb.GetArticles())
+
+	hybrid := NewHybridRetriever(
+		Stage{Name: "lexical", Retriever: bm25, Weight: 1},
+		Stage{Name: "vector", Retriever: vector, Weight: 1},
+	)
+	hits := mustRetrieve(t, hybrid, "VPN keeps disconnecting", 3)
+	if len(hits) == 0 || hits[0].ID != "kb-002" {
+		t.Fatalf("Expected kb-002 first, got %v", hits)
+	}
+	if hits[0].Ranks["lexical"] != 1 || hits[0].Ranks["vector"] != 1 {
+		t.Errorf("Expected kb-002 to be ranked first by both stages, got %v", hits[0].Ranks)
+	}
+}
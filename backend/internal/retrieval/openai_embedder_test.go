@@ -0,0 +1,55 @@
+package retrieval
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestOpenAIEmbedder tests the request format and response parsing against a stand-in server.
+func TestOpenAIEmbedder(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/embeddings" {
+			t.Errorf("Unexpected path %s", r.URL.Path)
+		}
+		if auth := r.Header.Get("Authorization"); auth != "Bearer test-key" {
+			t.Errorf("Unexpected Authorization header %q", auth)
+		}
+
+		var req embeddingsRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.Model != "test-model" || len(req.Input) != 2 {
+			t.Errorf("Unexpected request %+v", req)
+		}
+
+		// Return the items out of order to check that Index is honoured.
+		w.Write([]byte(`{"data":[{"index":1,"embedding":[0,1]},{"index":0,"embedding":[1,0]}]}`))
+	}))
+	defer server.Close()
+
+	embedder := NewOpenAIEmbedder(server.URL+"/v1/", "test-key", "test-model")
+	vectors, err := embedder.Embed(context.Background(), []string{"first", "second"})
+	if err != nil {
+		t.Fatalf("Embed failed: %v", err)
+	}
+	if vectors[0][0] != 1 || vectors[1][1] != 1 {
+		t.Errorf("Vectors not matched to inputs by index: %v", vectors)
+	}
+}
+
+// TestOpenAIEmbedderError tests that non-200 responses surface as errors.
+func TestOpenAIEmbedderError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "invalid model", http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	embedder := NewOpenAIEmbedder(server.URL, "", "missing-model")
+	_, err := embedder.Embed(context.Background(), []string{"text"})
+	if err == nil || !strings.Contains(err.Error(), "400") || !strings.Contains(err.Error(), "invalid model") {
+		t.Errorf("Expected status error with body, got %v", err)
+	}
+}
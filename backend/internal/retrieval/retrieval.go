@@ -0,0 +1,65 @@
+package retrieval
+
+import (
+	"ai-knowledge-base/internal/kb"
+	"context"
+)
+
+// Document is the unit of text a retriever indexes and ranks.
+type Document struct {
+	ID    string
+	Title string
+	Text  string
+}
+
+// Hit is a single ranked retrieval result.
+type Hit struct {
+	ID    string  `json:"id"`
+	Score float64 `json:"score"`
+	// Snippet is a highlighted excerpt of the matching text, for retrievers that produce one.
+	Snippet string `json:"snippet,omitempty"`
+	// Ranks records, for fused results, the 1-based rank of the document in each stage
+	// that returned it, keyed by stage name.
+	Ranks map[string]int `json:"ranks,omitempty"`
+}
+
+// Retriever selects the documents most relevant to a query.
+type Retriever interface {
+	// Retrieve returns at most k hits, ordered from most to least relevant.
+	Retrieve(ctx context.Context, query string, k int) ([]Hit, error)
+}
+
+// DocumentIndex is an index that ArticleSync can keep in sync with the knowledge base.
+type DocumentIndex interface {
+	// AddDocuments indexes documents, replacing previous versions with the same IDs.
+	AddDocuments(ctx context.Context, docs []Document) error
+	// RemoveDocuments drops documents from the index. Unknown IDs are ignored.
+	RemoveDocuments(ids []string)
+}
+
+// Splitter turns an article into the documents that represent it in an index.
+type Splitter func(article kb.Article) []Document
+
+// WholeArticle is the Splitter that indexes each article as a single document whose
+// ID is the article ID.
+func WholeArticle(article kb.Article) []Document {
+	return []Document{{ID: article.ID, Title: article.Title, Text: article.Content}}
+}
+
+// Chunked returns a Splitter that indexes each passage of an article as its own
+// document, identified by its chunk ID. The section heading is appended to the
+// title so that heading matches count as title matches.
+func Chunked(chunker *kb.Chunker) Splitter {
+	return func(article kb.Article) []Document {
+		chunks := chunker.Split(article)
+		docs := make([]Document, len(chunks))
+		for i, chunk := range chunks {
+			title := article.Title
+			if chunk.Heading != "" {
+				title += " - " + chunk.Heading
+			}
+			docs[i] = Document{ID: chunk.ID, Title: title, Text: chunk.Text}
+		}
+		return docs
+	}
+}
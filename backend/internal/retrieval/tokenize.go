@@ -0,0 +1,60 @@
+package retrieval
+
+import (
+	"strings"
+	"unicode"
+)
+
+// stopwords are common English words that carry no retrieval signal. Negations such as
+// "not" are kept: they turn a question into its opposite, which embeddings of the
+// question must tell apart.
+var stopwords = map[string]bool{
+	"a": true, "about": true, "an": true, "and": true, "are": true, "as": true, "at": true,
+	"be": true, "but": true, "by": true, "can": true, "do": true, "does": true, "for": true,
+	"from": true, "has": true, "have": true, "how": true, "i": true, "if": true, "in": true,
+	"is": true, "it": true, "its": true, "me": true, "my": true, "of": true,
+	"on": true, "or": true, "our": true, "should": true, "so": true, "that": true, "the": true,
+	"their": true, "then": true, "there": true, "these": true, "this": true, "to": true,
+	"was": true, "we": true, "what": true, "when": true, "where": true, "which": true,
+	"who": true, "why": true, "will": true, "with": true, "you": true, "your": true,
+}
+
+// Tokenize lowercases text, splits it on anything that is not a letter or digit,
+// drops stopwords and applies a light suffix stemmer so that "passwords" matches "password".
+func Tokenize(text string) []string {
+	terms := Terms(text)
+	for i, term := range terms {
+		terms[i] = stem(term)
+	}
+	return terms
+}
+
+// Terms is Tokenize without stemming, for backends such as FTS5 that stem on their own.
+func Terms(text string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	terms := make([]string, 0, len(fields))
+	for _, field := range fields {
+		if !stopwords[field] {
+			terms = append(terms, field)
+		}
+	}
+	return terms
+}
+
+// stem strips a few common English suffixes. It is deliberately conservative:
+// a suffix is only removed if at least three characters remain.
+func stem(word string) string {
+	for _, suffix := range []string{"ing", "ed", "s"} {
+		if !strings.HasSuffix(word, suffix) || len(word)-len(suffix) < 3 {
+			continue
+		}
+		if suffix == "s" && strings.HasSuffix(word, "ss") {
+			continue
+		}
+		return strings.TrimSuffix(word, suffix)
+	}
+	return word
+}
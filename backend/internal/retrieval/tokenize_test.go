@@ -0,0 +1,33 @@
+package retrieval
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestTokenize tests lowercasing, splitting, stopword removal and stemming.
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []string
+	}{
+		{"Simple", "VPN client", []string{"vpn", "client"}},
+		{"Stopwords removed", "How do I reset my password?", []string{"reset", "password"}},
+		{"Punctuation split", "Wi-Fi 'Printers & Scanners'", []string{"wi", "fi", "printer", "scanner"}},
+		{"Plural stemmed", "passwords issues", []string{"password", "issue"}},
+		{"Double s kept", "access", []string{"access"}},
+		{"Verb suffixes", "connecting installed", []string{"connect", "install"}},
+		{"Short words kept", "used", []string{"used"}},
+		{"Empty", "", []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Tokenize(tt.input)
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Tokenize(%q) = %v, want %v", tt.input, got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package retrieval
+
+import "sync"
+
+// VectorIndex stores document vectors and finds the nearest ones by cosine similarity.
+// Implementations must be safe for concurrent use.
+type VectorIndex interface {
+	// Add stores a vector, replacing any previous vector with the same ID.
+	Add(id string, vec []float32)
+	// Remove drops a vector. Removing an unknown ID is a no-op.
+	Remove(id string)
+	// Search returns up to k hits scored by cosine similarity, most similar first.
+	Search(vec []float32, k int) []Hit
+	// Len returns the number of stored vectors.
+	Len() int
+}
+
+// BruteForceIndex is an exact VectorIndex that compares the query against every vector.
+// It is the right choice up to tens of thousands of documents.
+type BruteForceIndex struct {
+	mu      sync.RWMutex
+	vectors map[string][]float32
+}
+
+// NewBruteForceIndex creates an empty BruteForceIndex.
+func NewBruteForceIndex() *BruteForceIndex {
+	return &BruteForceIndex{vectors: make(map[string][]float32)}
+}
+
+// Add implements VectorIndex.
+func (b *BruteForceIndex) Add(id string, vec []float32) {
+	normalized := Normalize(vec)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.vectors[id] = normalized
+}
+
+// Remove implements VectorIndex.
+func (b *BruteForceIndex) Remove(id string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.vectors, id)
+}
+
+// Search implements VectorIndex.
+func (b *BruteForceIndex) Search(vec []float32, k int) []Hit {
+	if k <= 0 {
+		return nil
+	}
+	query := Normalize(vec)
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	scores := make(map[string]float64, len(b.vectors))
+	for id, v := range b.vectors {
+		if len(v) == len(query) {
+			scores[id] = dot(query, v)
+		}
+	}
+	return topHits(scores, k)
+}
+
+// Len implements VectorIndex.
+func (b *BruteForceIndex) Len() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.vectors)
+}
@@ -0,0 +1,32 @@
+package retrieval
+
+import "testing"
+
+// TestBruteForceIndex tests exact nearest-neighbour search, replacement and removal.
+func TestBruteForceIndex(t *testing.T) {
+	idx := NewBruteForceIndex()
+	idx.Add("x", []float32{1, 0, 0})
+	idx.Add("y", []float32{0, 1, 0})
+	idx.Add("xy", []float32{1, 1, 0})
+
+	hits := idx.Search([]float32{2, 0.1, 0}, 2)
+	if len(hits) != 2 || hits[0].ID != "x" || hits[1].ID != "xy" {
+		t.Errorf("Unexpected hits %v", hits)
+	}
+	if hits[0].Score < 0.99 {
+		t.Errorf("Expected near-1 cosine for the closest vector, got %f", hits[0].Score)
+	}
+
+	idx.Add("x", []float32{0, 0, 1})
+	if hits := idx.Search([]float32{1, 0, 0}, 1); hits[0].ID != "xy" {
+		t.Errorf("Expected replaced vector to no longer match, got %v", hits)
+	}
+
+	idx.Remove("xy")
+	if idx.Len() != 2 {
+		t.Errorf("Expected 2 vectors after remove, got %d", idx.Len())
+	}
+	if hits := idx.Search([]float32{1, 0, 0}, 0); len(hits) != 0 {
+		t.Errorf("Expected no hits for k=0, got %v", hits)
+	}
+}
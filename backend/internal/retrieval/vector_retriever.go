@@ -0,0 +1,112 @@
+package retrieval
+
+import (
+	"context"
+	"fmt"
+	"log"
+)
+
+// embedBatchSize bounds how many texts are sent to the embedder in one call.
+const embedBatchSize = 64
+
+// VectorRetriever ranks documents by cosine similarity between the embedded query and
+// the embedded documents. Embeddings are persisted in an optional EmbeddingStore so
+// that unchanged documents are not re-embedded on startup.
+type VectorRetriever struct {
+	embedder Embedder
+	index    VectorIndex
+	store    *EmbeddingStore
+}
+
+// NewVectorRetriever creates a VectorRetriever. store may be nil to disable persistence.
+func NewVectorRetriever(embedder Embedder, index VectorIndex, store *EmbeddingStore) *VectorRetriever {
+	return &VectorRetriever{embedder: embedder, index: index, store: store}
+}
+
+// Retrieve implements Retriever.
+func (v *VectorRetriever) Retrieve(ctx context.Context, query string, k int) ([]Hit, error) {
+	vectors, err := v.embedder.Embed(ctx, []string{query})
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed query: %w", err)
+	}
+	if len(vectors) != 1 || len(vectors[0]) == 0 {
+		return nil, fmt.Errorf("embedder returned %d vectors for the query, want one non-empty vector", len(vectors))
+	}
+	return v.index.Search(vectors[0], k), nil
+}
+
+// AddDocuments implements DocumentIndex. Persisted embeddings whose content is
+// unchanged are reused; the remaining documents are embedded and persisted.
+func (v *VectorRetriever) AddDocuments(ctx context.Context, docs []Document) error {
+	stored, err := v.stored(docs)
+	if err != nil {
+		return fmt.Errorf("failed to load embeddings: %w", err)
+	}
+
+	var stale []Document
+	for _, doc := range docs {
+		if emb, ok := stored[doc.ID]; ok && emb.ContentHash == contentHash(embeddingText(doc)) {
+			v.index.Add(doc.ID, emb.Vector)
+			continue
+		}
+		stale = append(stale, doc)
+	}
+
+	for start := 0; start < len(stale); start += embedBatchSize {
+		end := min(start+embedBatchSize, len(stale))
+		if err := v.add(ctx, stale[start:end]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stored returns the persisted embeddings of docs. A single document (the common
+// case when an article is saved) is looked up directly instead of loading them all.
+func (v *VectorRetriever) stored(docs []Document) (map[string]StoredEmbedding, error) {
+	if v.store == nil || len(docs) == 0 {
+		return nil, nil
+	}
+	if len(docs) > 1 {
+		return v.store.Load(v.embedder.Model())
+	}
+	emb, ok, err := v.store.Get(docs[0].ID, v.embedder.Model())
+	if err != nil || !ok {
+		return nil, err
+	}
+	return map[string]StoredEmbedding{docs[0].ID: emb}, nil
+}
+
+// add embeds, persists and indexes a batch of documents.
+func (v *VectorRetriever) add(ctx context.Context, docs []Document) error {
+	texts := make([]string, len(docs))
+	for i, doc := range docs {
+		texts[i] = embeddingText(doc)
+	}
+	vectors, err := v.embedder.Embed(ctx, texts)
+	if err != nil {
+		return fmt.Errorf("failed to embed documents: %w", err)
+	}
+
+	for i, doc := range docs {
+		if v.store != nil {
+			if err := v.store.Save(doc.ID, v.embedder.Model(), contentHash(texts[i]), vectors[i]); err != nil {
+				return fmt.Errorf("failed to save embedding for %s: %w", doc.ID, err)
+			}
+		}
+		v.index.Add(doc.ID, vectors[i])
+	}
+	return nil
+}
+
+// RemoveDocuments implements DocumentIndex.
+func (v *VectorRetriever) RemoveDocuments(ids []string) {
+	for _, id := range ids {
+		v.index.Remove(id)
+		if v.store != nil {
+			if err := v.store.Delete(id); err != nil {
+				log.Printf("Failed to delete embedding for %s: %v", id, err)
+			}
+		}
+	}
+}
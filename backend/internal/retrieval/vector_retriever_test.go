@@ -0,0 +1,107 @@
+package retrieval
+
+import (
+	"ai-knowledge-base/internal/database"
+	"ai-knowledge-base/internal/kb"
+	"context"
+	"os"
+	"testing"
+)
+
+// countingEmbedder wraps an Embedder and counts how many texts it embeds.
+type countingEmbedder struct {
+	Embedder
+	count int
+}
+
+func (c *countingEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	c.count += len(texts)
+	return c.Embedder.Embed(ctx, texts)
+}
+
+// TestVectorRetriever tests ranking and that the index follows store writes.
+func TestVectorRetriever(t *testing.T) {
+	retriever := NewVectorRetriever(NewHashEmbedder(256), NewBruteForceIndex(), nil)
+	syncer := NewArticleSync(retriever, WholeArticle)
+	if err := syncer.Load(context.Background(), kb.GetArticles()); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	hits, err := retriever.Retrieve(context.Background(), "printers", 1)
+	if err != nil || len(hits) != 1 || hits[0].ID != "kb-003" {
+		t.Errorf("Expected kb-003 for 'printers', got %v (%v)", hits, err)
+	}
+
+	store := kb.Observe(kb.NewMemoryStore(kb.GetArticles()...), syncer)
+	store.Create(kb.Article{ID: "kb-004", Title: "Mobile email", Content: "Install the mail app on your phone."})
+	hits, _ = retriever.Retrieve(context.Background(), "email on my phone", 1)
+	if len(hits) != 1 || hits[0].ID != "kb-004" {
+		t.Errorf("Expected kb-004 after create, got %v", hits)
+	}
+
+	store.Delete("kb-004")
+	for _, hit := range mustRetrieve(t, retriever, "email on my phone", 5) {
+		if hit.ID == "kb-004" {
+			t.Error("Deleted article still retrievable")
+		}
+	}
+}
+
+// TestVectorRetrieverReusesPersistedEmbeddings tests that unchanged articles are not
+// re-embedded on the next start, while changed ones are.
+func TestVectorRetrieverReusesPersistedEmbeddings(t *testing.T) {
+	tempFile := "test_vector_retriever.sqlite"
+	defer os.Remove(tempFile)
+
+	db := database.InitDB(tempFile)
+	defer db.Close()
+	embeddings := NewEmbeddingStore(db)
+	articles := kb.GetArticles()
+
+	first := &countingEmbedder{Embedder: NewHashEmbedder(64)}
+	if err := NewArticleSync(NewVectorRetriever(first, NewBruteForceIndex(), embeddings), WholeArticle).Load(context.Background(), articles); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if first.count != len(articles) {
+		t.Errorf("Expected %d embeddings on first sync, got %d", len(articles), first.count)
+	}
+
+	articles[1].Content = "Changed content"
+	second := &countingEmbedder{Embedder: NewHashEmbedder(64)}
+	restarted := NewVectorRetriever(second, NewBruteForceIndex(), embeddings)
+	if err := NewArticleSync(restarted, WholeArticle).Load(context.Background(), articles); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if second.count != 1 {
+		t.Errorf("Expected only the changed article to be re-embedded, got %d", second.count)
+	}
+	if hits := mustRetrieve(t, restarted, "password", 1); hits[0].ID != "kb-001" {
+		t.Errorf("Expected persisted embedding to be searchable, got %v", hits)
+	}
+}
+
+func mustRetrieve(t *testing.T, r Retriever, query string, k int) []Hit {
+	t.Helper()
+	hits, err := r.Retrieve(context.Background(), query, k)
+	if err != nil {
+		t.Fatalf("Retrieve failed: %v", err)
+	}
+	return hits
+}
+
+// emptyEmbedder stands in for a provider that returns no vector.
+type emptyEmbedder struct {
+	Embedder
+}
+
+func (emptyEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	return nil, nil
+}
+
+// TestVectorRetrieverWithoutQueryVector tests that a missing query vector is an error.
+func TestVectorRetrieverWithoutQueryVector(t *testing.T) {
+	v := NewVectorRetriever(emptyEmbedder{NewHashEmbedder(8)}, NewBruteForceIndex(), nil)
+	if _, err := v.Retrieve(context.Background(), "vpn", 3); err == nil {
+		t.Error("Expected an error when the embedder returns no vector")
+	}
+}
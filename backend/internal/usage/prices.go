@@ -0,0 +1,108 @@
+// Package usage prices the tokens consumed by AI requests, records them per search
+// and reports and caps them per day, model and caller.
+package usage
+
+import (
+	"ai-knowledge-base/internal/ai"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Price is what a model charges, in US dollars per million tokens.
+type Price struct {
+	InputPerMillion  float64 `json:"input_per_million"`
+	OutputPerMillion float64 `json:"output_per_million"`
+}
+
+// Cost returns the price of u.
+func (p Price) Cost(u ai.Usage) float64 {
+	return (float64(u.PromptTokens)*p.InputPerMillion + float64(u.CompletionTokens)*p.OutputPerMillion) / 1e6
+}
+
+// Prices maps model names to their price. A key can also name a model family, such as
+// "gemini-1.5-flash" for "gemini-1.5-flash-002", or a provider whose models all cost
+// the same, such as "ollama".
+type Prices map[string]Price
+
+// DefaultPrices returns the list prices of the default models. Local and fake models
+// are free.
+func DefaultPrices() Prices {
+	return Prices{
+		"gemini-1.5-flash": {InputPerMillion: 0.075, OutputPerMillion: 0.30},
+		"gemini-1.5-pro":   {InputPerMillion: 1.25, OutputPerMillion: 5.00},
+		"gemini-2.5-flash": {InputPerMillion: 0.30, OutputPerMillion: 2.50},
+		"gpt-4o":           {InputPerMillion: 2.50, OutputPerMillion: 10.00},
+		"gpt-4o-mini":      {InputPerMillion: 0.15, OutputPerMillion: 0.60},
+		"ollama":           {},
+		"fake":             {},
+	}
+}
+
+// ParsePrices returns DefaultPrices overridden by entries of the form
+// "model=input/output", with prices in US dollars per million tokens.
+func ParsePrices(entries []string) (Prices, error) {
+	prices := DefaultPrices()
+	for _, entry := range entries {
+		model, rates, ok := strings.Cut(entry, "=")
+		input, output, ok2 := strings.Cut(rates, "/")
+		if !ok || !ok2 || strings.TrimSpace(model) == "" {
+			return nil, fmt.Errorf("invalid price %q: expected model=input/output", entry)
+		}
+		var price Price
+		var err error
+		if price.InputPerMillion, err = parseRate(input); err != nil {
+			return nil, fmt.Errorf("invalid price %q: %w", entry, err)
+		}
+		if price.OutputPerMillion, err = parseRate(output); err != nil {
+			return nil, fmt.Errorf("invalid price %q: %w", entry, err)
+		}
+		prices[strings.TrimSpace(model)] = price
+	}
+	return prices, nil
+}
+
+func parseRate(raw string) (float64, error) {
+	rate, err := strconv.ParseFloat(strings.TrimSpace(raw), 64)
+	if err != nil || rate < 0 {
+		return 0, fmt.Errorf("%q is not a non-negative number", raw)
+	}
+	return rate, nil
+}
+
+// Lookup returns the price of model as served by provider: the price of the model
+// itself, else of the longest key the model name starts with, else of the provider.
+func (p Prices) Lookup(provider, model string) (Price, bool) {
+	if price, ok := p[model]; ok {
+		return price, true
+	}
+	best, found := "", false
+	for key := range p {
+		if strings.HasPrefix(model, key) && len(key) > len(best) {
+			best, found = key, true
+		}
+	}
+	if found {
+		return p[best], true
+	}
+	price, ok := p[provider]
+	return price, ok
+}
+
+// unpriced holds the models already reported as missing from the price table.
+var unpriced sync.Map
+
+// cost returns the price of u for model, or zero for a model without a price, which
+// is logged once.
+func (p Prices) cost(provider, model string, u ai.Usage) float64 {
+	price, ok := p.Lookup(provider, model)
+	if !ok {
+		if _, logged := unpriced.LoadOrStore(provider+"/"+model, true); !logged {
+			log.Printf("Warning: no price for model %q of %s, counting its cost as 0; set AI_PRICES", model, provider)
+		}
+		return 0
+	}
+	return price.Cost(u)
+}
@@ -0,0 +1,190 @@
+package usage
+
+import (
+	"ai-knowledge-base/internal/ai"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// dayFormat is how days are written in reports and compared in the database, in UTC.
+const dayFormat = "2006-01-02"
+
+// ModelUsage is the usage of one model within a search.
+type ModelUsage struct {
+	Provider string `json:"provider"`
+	Model    string `json:"model"`
+	Requests int    `json:"requests"`
+	ai.Usage
+	CostUSD float64 `json:"cost_usd"`
+	// Estimated reports that the provider did not count some of the tokens, so they were
+	// estimated.
+	Estimated bool `json:"estimated,omitempty"`
+}
+
+// Summary is the usage of all the AI requests of a search.
+type Summary struct {
+	ai.Usage
+	CostUSD   float64      `json:"cost_usd"`
+	Estimated bool         `json:"estimated,omitempty"`
+	Models    []ModelUsage `json:"models"`
+}
+
+// Summarize totals records per model, in order of first use, and prices them. It
+// returns nil if there are no records.
+func Summarize(prices Prices, records []ai.UsageRecord) *Summary {
+	if len(records) == 0 {
+		return nil
+	}
+	summary := &Summary{}
+	index := make(map[[2]string]int)
+	for _, record := range records {
+		key := [2]string{record.Provider, record.Model}
+		i, ok := index[key]
+		if !ok {
+			i = len(summary.Models)
+			index[key] = i
+			summary.Models = append(summary.Models, ModelUsage{Provider: record.Provider, Model: record.Model})
+		}
+		m := &summary.Models[i]
+		m.Requests++
+		m.Usage = m.Usage.Add(record.Usage)
+		m.Estimated = m.Estimated || record.Estimated
+	}
+	for i := range summary.Models {
+		m := &summary.Models[i]
+		m.CostUSD = prices.cost(m.Provider, m.Model, m.Usage)
+		summary.Usage = summary.Usage.Add(m.Usage)
+		summary.CostUSD += m.CostUSD
+		summary.Estimated = summary.Estimated || m.Estimated
+	}
+	return summary
+}
+
+// Save records the usage of the search with the given search_history ID, one row per
+// model, under the caller it is reported for and the client it is budgeted to. A nil
+// summary saves nothing.
+func Save(db *sql.DB, searchID int64, caller, client string, summary *Summary) error {
+	if summary == nil {
+		return nil
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	stmt, err := tx.Prepare(`INSERT INTO ai_usage(search_id, caller, client, provider, model, requests, prompt_tokens, completion_tokens, cost_usd, estimated)
+        VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, m := range summary.Models {
+		if _, err := stmt.Exec(sql.NullInt64{Int64: searchID, Valid: searchID != 0}, caller, client, m.Provider, m.Model,
+			m.Requests, m.PromptTokens, m.CompletionTokens, m.CostUSD, m.Estimated); err != nil {
+			return fmt.Errorf("failed to save usage of %s: %w", m.Model, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// Filter selects the usage included in a report. From and To are inclusive days; an
+// empty Caller includes every caller.
+type Filter struct {
+	From, To time.Time
+	Caller   string
+}
+
+// ReportRow is the usage of one model by one caller on one day.
+type ReportRow struct {
+	Day      string `json:"day"`
+	Provider string `json:"provider"`
+	Model    string `json:"model"`
+	Caller   string `json:"caller"`
+	// Searches counts the searches that used the model, and Requests the requests made.
+	Searches int `json:"searches"`
+	Requests int `json:"requests"`
+	ai.Usage
+	CostUSD   float64 `json:"cost_usd"`
+	Estimated bool    `json:"estimated,omitempty"`
+}
+
+// Report aggregates the usage selected by filter by day, model and caller, newest day
+// first and most expensive first within a day.
+func Report(db *sql.DB, filter Filter) ([]ReportRow, error) {
+	query := `SELECT date(created_at) AS day, provider, model, caller, COUNT(DISTINCT search_id), SUM(requests),
+        SUM(prompt_tokens), SUM(completion_tokens), SUM(cost_usd), MAX(estimated)
+        FROM ai_usage WHERE date(created_at) BETWEEN ? AND ?`
+	args := []interface{}{filter.From.UTC().Format(dayFormat), filter.To.UTC().Format(dayFormat)}
+	if filter.Caller != "" {
+		query += " AND caller = ?"
+		args = append(args, filter.Caller)
+	}
+	query += " GROUP BY day, provider, model, caller ORDER BY day DESC, SUM(cost_usd) DESC, model, caller"
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	report := []ReportRow{}
+	for rows.Next() {
+		var row ReportRow
+		if err := rows.Scan(&row.Day, &row.Provider, &row.Model, &row.Caller, &row.Searches, &row.Requests,
+			&row.PromptTokens, &row.CompletionTokens, &row.CostUSD, &row.Estimated); err != nil {
+			return nil, err
+		}
+		row.TotalTokens = row.PromptTokens + row.CompletionTokens
+		report = append(report, row)
+	}
+	return report, rows.Err()
+}
+
+// Spent returns the estimated cost of the usage on the UTC day of day, by client or,
+// if client is empty, by everyone.
+func Spent(db *sql.DB, day time.Time, client string) (float64, error) {
+	query := "SELECT COALESCE(SUM(cost_usd), 0) FROM ai_usage WHERE date(created_at) = ?"
+	args := []interface{}{day.UTC().Format(dayFormat)}
+	if client != "" {
+		query += " AND client = ?"
+		args = append(args, client)
+	}
+	var spent float64
+	err := db.QueryRow(query, args...).Scan(&spent)
+	return spent, err
+}
+
+// Limits caps the estimated cost of AI requests per UTC day, in US dollars. Zero means
+// no cap.
+type Limits struct {
+	// Daily caps the cost of all clients together.
+	Daily float64
+	// PerClient caps the cost of each client. Clients are identified by something the
+	// server observes, such as their address, never by a label they choose, which they
+	// could change to escape the cap or to spend another's budget.
+	PerClient float64
+}
+
+// Exceeded reports which of the limits client has reached on the day of now: "daily",
+// "client" or "" if neither.
+func (l Limits) Exceeded(db *sql.DB, client string, now time.Time) (string, error) {
+	if l.Daily > 0 {
+		spent, err := Spent(db, now, "")
+		if err != nil {
+			return "", err
+		}
+		if spent >= l.Daily {
+			return "daily", nil
+		}
+	}
+	if l.PerClient > 0 {
+		spent, err := Spent(db, now, client)
+		if err != nil {
+			return "", err
+		}
+		if spent >= l.PerClient {
+			return "client", nil
+		}
+	}
+	return "", nil
+}
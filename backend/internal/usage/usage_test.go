@@ -0,0 +1,130 @@
+package usage
+
+import (
+	"ai-knowledge-base/internal/ai"
+	"ai-knowledge-base/internal/database"
+	"math"
+	"os"
+	"testing"
+	"time"
+)
+
+// TestParsePrices tests overriding and adding prices, and rejecting malformed entries.
+func TestParsePrices(t *testing.T) {
+	prices, err := ParsePrices([]string{"gpt-4o=3/12", "my-model = 0.5 / 1"})
+	if err != nil {
+		t.Fatalf("ParsePrices failed: %v", err)
+	}
+	if prices["gpt-4o"] != (Price{3, 12}) || prices["my-model"] != (Price{0.5, 1}) || prices["gpt-4o-mini"] != DefaultPrices()["gpt-4o-mini"] {
+		t.Errorf("Unexpected prices %+v", prices)
+	}
+	for _, entry := range []string{"gpt-4o", "gpt-4o=3", "=1/2", "gpt-4o=a/1", "gpt-4o=1/-2"} {
+		if _, err := ParsePrices([]string{entry}); err == nil {
+			t.Errorf("Expected %q to be rejected", entry)
+		}
+	}
+}
+
+// TestLookup tests exact, model family and provider matches.
+func TestLookup(t *testing.T) {
+	prices := DefaultPrices()
+	tests := []struct {
+		provider, model string
+		want            Price
+		found           bool
+	}{
+		{"openai", "gpt-4o", prices["gpt-4o"], true},
+		{"openai", "gpt-4o-mini-2024-07-18", prices["gpt-4o-mini"], true},
+		{"gemini", "gemini-1.5-flash-002", prices["gemini-1.5-flash"], true},
+		{"ollama", "llama3", Price{}, true},
+		{"openai", "o1", Price{}, false},
+	}
+	for _, tt := range tests {
+		if got, found := prices.Lookup(tt.provider, tt.model); got != tt.want || found != tt.found {
+			t.Errorf("Lookup(%s, %s) = %+v, %t, want %+v, %t", tt.provider, tt.model, got, found, tt.want, tt.found)
+		}
+	}
+}
+
+// TestSummarize tests totalling and pricing records per model.
+func TestSummarize(t *testing.T) {
+	if Summarize(DefaultPrices(), nil) != nil {
+		t.Error("Expected no summary without records")
+	}
+	summary := Summarize(DefaultPrices(), []ai.UsageRecord{
+		{Provider: "openai", Model: "gpt-4o-mini", Usage: ai.Usage{PromptTokens: 1000, CompletionTokens: 200, TotalTokens: 1200}},
+		{Provider: "ollama", Model: "llama3", Usage: ai.Usage{PromptTokens: 50, CompletionTokens: 5, TotalTokens: 55}, Estimated: true},
+		{Provider: "openai", Model: "gpt-4o-mini", Usage: ai.Usage{PromptTokens: 1000, CompletionTokens: 800, TotalTokens: 1800}},
+	})
+	if len(summary.Models) != 2 || summary.Models[0].Requests != 2 || summary.Models[1].Model != "llama3" {
+		t.Fatalf("Unexpected models %+v", summary.Models)
+	}
+	// 2000 input tokens at $0.15 and 1000 output tokens at $0.60 per million.
+	if math.Abs(summary.CostUSD-0.0009) > 1e-12 || summary.Models[1].CostUSD != 0 {
+		t.Errorf("Unexpected cost %v", summary.CostUSD)
+	}
+	if summary.PromptTokens != 2050 || summary.CompletionTokens != 1005 || summary.TotalTokens != 3055 || !summary.Estimated || summary.Models[0].Estimated {
+		t.Errorf("Unexpected totals %+v", summary)
+	}
+}
+
+// TestReportAndLimits tests saving usage, reporting it by day, model and caller and
+// checking it against daily limits, which apply to clients whatever caller they claim.
+func TestReportAndLimits(t *testing.T) {
+	tempFile := "test_usage.sqlite"
+	defer os.Remove(tempFile)
+	db := database.InitDB(tempFile)
+	defer db.Close()
+
+	save := func(searchID int64, caller, client, model string, cost float64) {
+		summary := &Summary{Models: []ModelUsage{{Provider: "openai", Model: model, Requests: 1, Usage: ai.Usage{PromptTokens: 100, CompletionTokens: 10}, CostUSD: cost}}}
+		if err := Save(db, searchID, caller, client, summary); err != nil {
+			t.Fatalf("Save failed: %v", err)
+		}
+	}
+	save(1, "alice", "10.0.0.1", "gpt-4o", 0.25)
+	save(2, "alice", "10.0.0.1", "gpt-4o", 0.5)
+	save(3, "bob", "10.0.0.2", "gpt-4o-mini", 0.01)
+	save(4, "alice", "10.0.0.1", "gpt-4o", 2)
+	if err := Save(db, 5, "alice", "10.0.0.1", nil); err != nil {
+		t.Fatalf("Save of nil summary failed: %v", err)
+	}
+	// Move the last search to the day before.
+	if _, err := db.Exec("UPDATE ai_usage SET created_at = datetime('now', '-1 day') WHERE search_id = 4"); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().UTC()
+	yesterday := now.AddDate(0, 0, -1)
+	rows, err := Report(db, Filter{From: yesterday, To: now})
+	if err != nil {
+		t.Fatalf("Report failed: %v", err)
+	}
+	today := now.Format(dayFormat)
+	if len(rows) != 3 || rows[0].Day != today || rows[0].Caller != "alice" || rows[0].Searches != 2 || rows[0].CostUSD != 0.75 ||
+		rows[0].PromptTokens != 200 || rows[0].TotalTokens != 220 || rows[1].Caller != "bob" || rows[2].Day != yesterday.Format(dayFormat) {
+		t.Errorf("Unexpected report %+v", rows)
+	}
+	if rows, _ := Report(db, Filter{From: now, To: now, Caller: "bob"}); len(rows) != 1 || rows[0].Model != "gpt-4o-mini" {
+		t.Errorf("Unexpected report for bob %+v", rows)
+	}
+
+	if spent, err := Spent(db, now, ""); err != nil || spent != 0.76 {
+		t.Errorf("Spent = %v, %v, want 0.76", spent, err)
+	}
+	tests := []struct {
+		limits Limits
+		client string
+		want   string
+	}{
+		{Limits{}, "10.0.0.1", ""},
+		{Limits{Daily: 0.76}, "10.0.0.2", "daily"},
+		{Limits{Daily: 1, PerClient: 0.5}, "10.0.0.1", "client"},
+		{Limits{Daily: 1, PerClient: 0.5}, "10.0.0.2", ""},
+	}
+	for _, tt := range tests {
+		if got, err := tt.limits.Exceeded(db, tt.client, now); err != nil || got != tt.want {
+			t.Errorf("%+v.Exceeded(%s) = %q, %v, want %q", tt.limits, tt.client, got, err, tt.want)
+		}
+	}
+}